@@ -3,10 +3,12 @@ package handler
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/wavespeedai/waverless-portal/internal/service"
 	"github.com/wavespeedai/waverless-portal/pkg/config"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 	"github.com/wavespeedai/waverless-portal/pkg/wavespeed"
 
 	"github.com/gin-gonic/gin"
@@ -15,12 +17,14 @@ import (
 type BillingHandler struct {
 	billingService *service.BillingService
 	userService    *service.UserService
+	runwayService  *service.RunwayService
 }
 
-func NewBillingHandler(billingService *service.BillingService, userService *service.UserService) *BillingHandler {
+func NewBillingHandler(billingService *service.BillingService, userService *service.UserService, runwayService *service.RunwayService) *BillingHandler {
 	return &BillingHandler{
 		billingService: billingService,
 		userService:    userService,
+		runwayService:  runwayService,
 	}
 }
 
@@ -37,16 +41,255 @@ func (h *BillingHandler) GetBalance(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"balance":  ToUSD(balance),
-		"currency": "USD",
+		"balance":  ToDecimal(balance),
+		"currency": model.DefaultCurrency, // 主站余额币种
 	})
 }
 
+// GetRunway 按当前消耗速度预测余额可用时长
+func (h *BillingHandler) GetRunway(c *gin.Context) {
+	orgID := c.GetString("org_id")
+
+	forecast, err := h.runwayService.Forecast(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	alerts, err := h.runwayService.ListAlerts(c.Request.Context(), orgID, 20)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	alertList := make([]gin.H, len(alerts))
+	for i, a := range alerts {
+		alertList[i] = gin.H{
+			"action":          a.Action,
+			"threshold_hours": a.ThresholdHours,
+			"runway_hours":    a.RunwayHours,
+			"balance":         ToDecimal(a.Balance),
+			"burn_rate":       ToDecimal(a.BurnRate),
+			"message":         a.Message,
+			"created_at":      a.CreatedAt,
+		}
+	}
+
+	result := gin.H{
+		"balance":         ToDecimal(forecast.Balance),
+		"burn_rate":       ToDecimal(forecast.BurnRate),
+		"runway_hours":    forecast.RunwayHours,
+		"running_workers": forecast.RunningWorkers,
+		"alerts":          alertList,
+		"currency":        model.DefaultCurrency, // 余额及消耗速度均按主站余额币种
+	}
+	if state, err := h.runwayService.GetState(c.Request.Context(), orgID); err == nil {
+		result["negative_since"] = state.NegativeSince
+		result["suspended_at"] = state.SuspendedAt
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 // GetUsage 获取使用统计
 func (h *BillingHandler) GetUsage(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
+	from, to := parseUsageRange(c)
+
+	stats, err := h.billingService.GetUsageStats(c.Request.Context(), orgID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 转换金额为计费币种金额
+	for _, key := range []string{"total_amount", "adjustment_amount", "net_amount"} {
+		stats[key] = ToDecimal(stats[key].(int64))
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetUsageByTag 按标签 key 分组统计花费 (?key=team), 归属以计费时的标签快照为准
+func (h *BillingHandler) GetUsageByTag(c *gin.Context) {
+	orgID := c.GetString("org_id")
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key is required"})
+		return
+	}
+	from, to := parseUsageRange(c)
+
+	rows, err := h.billingService.GetUsageByTag(c.Request.Context(), orgID, key, from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	groups := make([]gin.H, len(rows))
+	for i, r := range rows {
+		groups[i] = gin.H{
+			"value":             r.TagValue, // null 表示未打该标签
+			"amount":            ToDecimal(r.Amount),
+			"adjustment_amount": ToDecimal(r.AdjustmentAmount),
+			"net_amount":        ToDecimal(r.Amount + r.AdjustmentAmount),
+			"duration_seconds":  r.DurationSeconds,
+			"transaction_count": r.TransactionCount,
+			"endpoint_count":    r.EndpointCount,
+		}
+	}
+	currency, ok := h.orgCurrency(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"key":      key,
+		"from":     from,
+		"to":       to,
+		"groups":   groups,
+		"currency": currency,
+	})
+}
+
+// GetUsageBreakdown 按 endpoint/规格/GPU/集群/日期分组统计花费
+// ?group_by=endpoint,day&tz=Asia/Shanghai&from=...&to=...
+func (h *BillingHandler) GetUsageBreakdown(c *gin.Context) {
+	loc, ok := parseUsageLocation(c)
+	if !ok {
+		return
+	}
+	from, to := parseUsageRange(c)
+	groupBy := []string{"endpoint"}
+	if g := c.Query("group_by"); g != "" {
+		groupBy = strings.Split(g, ",")
+		for i := range groupBy {
+			groupBy[i] = strings.TrimSpace(groupBy[i])
+		}
+	}
+
+	items, err := h.billingService.GetUsageBreakdown(c.Request.Context(), &service.UsageBreakdownRequest{
+		OrgID: c.GetString("org_id"), From: from, To: to, GroupBy: groupBy, Location: loc,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var totalAmount, totalAdjustment int64
+	result := make([]gin.H, len(items))
+	for i, item := range items {
+		totalAmount += item.Amount
+		totalAdjustment += item.AdjustmentAmount
+		row := gin.H{
+			"amount":            ToDecimal(item.Amount),
+			"adjustment_amount": ToDecimal(item.AdjustmentAmount),
+			"net_amount":        ToDecimal(item.Amount + item.AdjustmentAmount),
+			"duration_seconds":  item.DurationSeconds,
+			"transaction_count": item.TransactionCount,
+		}
+		for _, dim := range groupBy {
+			switch dim {
+			case "day":
+				row["day"] = item.Day
+			case "endpoint":
+				row["endpoint_id"] = item.EndpointID
+				row["endpoint_name"] = item.EndpointName
+			case "spec":
+				row["spec_name"] = item.SpecName
+			case "gpu_type":
+				row["gpu_type"] = item.GPUType
+			case "cluster":
+				row["cluster_id"] = item.ClusterID
+			}
+		}
+		result[i] = row
+	}
+
+	currency, ok := h.orgCurrency(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"group_by":          groupBy,
+		"timezone":          loc.String(),
+		"from":              from,
+		"to":                to,
+		"total_amount":      ToDecimal(totalAmount),
+		"adjustment_amount": ToDecimal(totalAdjustment),
+		"net_amount":        ToDecimal(totalAmount + totalAdjustment),
+		"groups":            result,
+		"currency":          currency,
+	})
+}
+
+// GetUsageTimeSeries 按日/小时返回花费时间序列 (图表用), 可按一个维度拆分
+// ?interval=day&group_by=spec&tz=Asia/Shanghai&from=...&to=...
+func (h *BillingHandler) GetUsageTimeSeries(c *gin.Context) {
+	loc, ok := parseUsageLocation(c)
+	if !ok {
+		return
+	}
+	from, to := parseUsageRange(c)
+	interval := c.DefaultQuery("interval", service.UsageIntervalDay)
 
-	// 默认查询最近 7 天
+	ts, err := h.billingService.GetUsageTimeSeries(c.Request.Context(), &service.UsageTimeSeriesRequest{
+		OrgID: c.GetString("org_id"), From: from, To: to, Interval: interval, GroupBy: c.Query("group_by"), Location: loc,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	series := make([]gin.H, len(ts.Series))
+	for i, s := range ts.Series {
+		amounts := make([]float64, len(s.Amounts))
+		for j, a := range s.Amounts {
+			amounts[j] = ToDecimal(a)
+		}
+		series[i] = gin.H{
+			"key":               s.Key,
+			"name":              s.Name,
+			"amounts":           amounts, // 含调账的净花费
+			"duration_seconds":  s.DurationSeconds,
+			"total_amount":      ToDecimal(s.TotalAmount),
+			"adjustment_amount": ToDecimal(s.TotalAdjustments),
+		}
+	}
+	currency, ok := h.orgCurrency(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"interval": ts.Interval,
+		"timezone": ts.Timezone,
+		"from":     from,
+		"to":       to,
+		"buckets":  ts.Buckets,
+		"series":   series,
+		"currency": currency,
+	})
+}
+
+// orgCurrency 当前组织计费币种, 失败时返回 500
+func (h *BillingHandler) orgCurrency(c *gin.Context) (string, bool) {
+	currency, err := h.billingService.OrgCurrency(c.Request.Context(), c.GetString("org_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return currency, true
+}
+
+// parseUsageLocation 解析 tz 参数 (IANA 时区名), 默认 UTC
+func parseUsageLocation(c *gin.Context) (*time.Location, bool) {
+	tz := c.DefaultQuery("tz", "UTC")
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tz: " + tz})
+		return nil, false
+	}
+	return loc, true
+}
+
+// parseUsageRange 解析 from/to (RFC3339), 默认最近 7 天
+func parseUsageRange(c *gin.Context) (time.Time, time.Time) {
 	to := time.Now()
 	from := to.AddDate(0, 0, -7)
 
@@ -60,21 +303,12 @@ func (h *BillingHandler) GetUsage(c *gin.Context) {
 			to = t
 		}
 	}
-
-	stats, err := h.billingService.GetUsageStats(c.Request.Context(), userID, from, to)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	// 转换金额为 USD
-	stats["total_amount"] = ToUSD(stats["total_amount"].(int64))
-	c.JSON(http.StatusOK, stats)
+	return from, to
 }
 
 // GetWorkerRecords 获取 Worker 计费记录
 func (h *BillingHandler) GetWorkerRecords(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 
 	limit := 20
 	offset := 0
@@ -89,28 +323,51 @@ func (h *BillingHandler) GetWorkerRecords(c *gin.Context) {
 		}
 	}
 
-	records, total, err := h.billingService.GetWorkerBillingRecords(c.Request.Context(), userID, limit, offset)
+	records, total, err := h.billingService.GetWorkerBillingRecords(c.Request.Context(), orgID, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 转换金额为 USD
+	// 关联的调账金额
+	ids := make([]int64, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	adjustments, err := h.billingService.GetAdjustmentSums(c.Request.Context(), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 转换金额为计费币种金额
 	result := make([]map[string]interface{}, len(records))
 	for i, r := range records {
 		result[i] = map[string]interface{}{
-			"id":                   r.ID,
-			"worker_id":            r.WorkerID,
-			"endpoint_id":          r.EndpointID,
-			"endpoint_name":        r.EndpointName,
-			"spec_name":            r.SpecName,
-			"billing_period_start": r.BillingPeriodStart,
-			"billing_period_end":   r.BillingPeriodEnd,
-			"duration_seconds":     r.DurationSeconds,
-			"price_per_hour":       ToUSD(r.PricePerHour),
-			"amount":               ToUSD(r.Amount),
-			"status":               r.Status,
-			"created_at":           r.CreatedAt,
+			"id":                     r.ID,
+			"worker_id":              r.WorkerID,
+			"task_id":                r.TaskID,
+			"endpoint_id":            r.EndpointID,
+			"endpoint_name":          r.EndpointName,
+			"spec_name":              r.SpecName,
+			"billing_period_start":   r.BillingPeriodStart,
+			"billing_period_end":     r.BillingPeriodEnd,
+			"duration_seconds":       r.DurationSeconds,
+			"billed_seconds":         r.BilledSeconds,
+			"free_seconds":           r.FreeSeconds,
+			"idle_seconds":           r.IdleSeconds,
+			"committed_seconds":      r.CommittedSeconds,
+			"spot":                   r.Spot,
+			"billing_policy_id":      r.BillingPolicyID,
+			"billing_policy_version": r.BillingPolicyVersion,
+			"price_per_hour":         ToDecimal(r.PricePerHour),
+			"amount":                 ToDecimal(r.Amount),
+			"adjustment_amount":      ToDecimal(adjustments[r.ID]),
+			"net_amount":             ToDecimal(r.Amount + adjustments[r.ID]),
+			"currency":               r.Currency,
+			"status":                 r.Status,
+			"delivery_status":        r.DeliveryStatus,
+			"created_at":             r.CreatedAt,
 		}
 	}
 
@@ -121,3 +378,75 @@ func (h *BillingHandler) GetWorkerRecords(c *gin.Context) {
 		"offset":  offset,
 	})
 }
+
+// CreateAdjustments 管理员调账: 按原始流水退款 (credit) 或补扣 (debit), 金额为原始流水币种
+func (h *BillingHandler) CreateAdjustments(c *gin.Context) {
+	var req struct {
+		TransactionIDs []int64 `json:"transaction_ids" binding:"required"`
+		Type           string  `json:"type" binding:"required"`
+		Amount         float64 `json:"amount"` // 每条流水的金额, credit 为空时退还剩余全部金额
+		Reason         string  `json:"reason" binding:"required"`
+		RequestID      string  `json:"request_id"` // 幂等 ID, 重复提交返回已有记录
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adjustments, err := h.billingService.CreateAdjustments(c.Request.Context(), &service.AdjustmentRequest{
+		TransactionIDs: req.TransactionIDs,
+		Type:           req.Type,
+		Amount:         FromDecimal(req.Amount),
+		Reason:         req.Reason,
+		RequestID:      req.RequestID,
+		AdminEmail:     c.GetString("email"),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"adjustments": convertAdjustments(adjustments)})
+}
+
+// ListAdjustments 管理员查询调账记录 (可按 user_id 过滤)
+func (h *BillingHandler) ListAdjustments(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	adjustments, total, err := h.billingService.ListAdjustments(c.Request.Context(), c.Query("user_id"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"adjustments": convertAdjustments(adjustments),
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
+
+func convertAdjustments(adjustments []model.BillingAdjustment) []gin.H {
+	result := make([]gin.H, len(adjustments))
+	for i, a := range adjustments {
+		result[i] = gin.H{
+			"id":              a.ID,
+			"transaction_id":  a.TransactionID,
+			"user_id":         a.UserID,
+			"org_id":          a.OrgID,
+			"endpoint_id":     a.EndpointID,
+			"worker_id":       a.WorkerID,
+			"type":            a.Type,
+			"amount":          ToDecimal(a.Amount),
+			"currency":        a.Currency,
+			"reason":          a.Reason,
+			"admin_email":     a.AdminEmail,
+			"idempotency_key": a.IdempotencyKey,
+			"delivery_status": a.DeliveryStatus,
+			"created_at":      a.CreatedAt,
+		}
+	}
+	return result
+}
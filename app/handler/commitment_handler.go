@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CommitmentHandler struct {
+	commitmentService *service.CommitmentService
+}
+
+func NewCommitmentHandler(commitmentService *service.CommitmentService) *CommitmentHandler {
+	return &CommitmentHandler{commitmentService: commitmentService}
+}
+
+// ListCommitments 用户查看本组织的预留承诺及使用量
+func (h *CommitmentHandler) ListCommitments(c *gin.Context) {
+	h.list(c, c.GetString("org_id"))
+}
+
+// ListCommitmentUsages 用户查看本组织某个承诺的抵扣明细
+func (h *CommitmentHandler) ListCommitmentUsages(c *gin.Context) {
+	h.listUsages(c, c.GetString("org_id"))
+}
+
+// AdminListCommitments 管理员列出承诺 (可按 org_id 过滤)
+func (h *CommitmentHandler) AdminListCommitments(c *gin.Context) {
+	h.list(c, c.Query("org_id"))
+}
+
+// AdminListCommitmentUsages 管理员查看承诺抵扣明细
+func (h *CommitmentHandler) AdminListCommitmentUsages(c *gin.Context) {
+	h.listUsages(c, "")
+}
+
+// CreateCommitment 管理员为组织创建预留承诺 (hours 为 GPU 小时数, CPU 规格为实例小时; 价格为每 GPU 小时, 组织计费币种)
+func (h *CommitmentHandler) CreateCommitment(c *gin.Context) {
+	var req struct {
+		OrgID        string    `json:"org_id" binding:"required"`
+		SpecName     string    `json:"spec_name" binding:"required"`
+		ClusterID    string    `json:"cluster_id"`
+		Hours        float64   `json:"hours" binding:"required"`
+		PricePerHour float64   `json:"price_per_hour"`
+		StartAt      time.Time `json:"start_at" binding:"required"`
+		EndAt        time.Time `json:"end_at" binding:"required"`
+		Note         string    `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	commitment := &model.CapacityCommitment{
+		OrgID:        req.OrgID,
+		SpecName:     req.SpecName,
+		ClusterID:    req.ClusterID,
+		TotalSeconds: int64(math.Round(req.Hours * 3600)),
+		PricePerHour: FromDecimal(req.PricePerHour),
+		StartAt:      req.StartAt,
+		EndAt:        req.EndAt,
+		Note:         req.Note,
+		AdminEmail:   c.GetString("email"),
+	}
+	if err := h.commitmentService.Create(c.Request.Context(), commitment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, convertCommitment(commitment))
+}
+
+// CancelCommitment 管理员取消承诺
+func (h *CommitmentHandler) CancelCommitment(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := h.commitmentService.Cancel(c.Request.Context(), id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "commitment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "cancelled"})
+}
+
+func (h *CommitmentHandler) list(c *gin.Context, orgID string) {
+	limit, offset := parseLimitOffset(c)
+	list, total, err := h.commitmentService.List(c.Request.Context(), orgID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, len(list))
+	for i := range list {
+		result[i] = convertCommitment(&list[i])
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"commitments": result,
+		"total":       total,
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
+
+// listUsages orgID 非空时只允许查看本组织的承诺
+func (h *CommitmentHandler) listUsages(c *gin.Context, orgID string) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	commitment, err := h.commitmentService.Get(c.Request.Context(), id)
+	if err != nil || (orgID != "" && commitment.OrgID != orgID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "commitment not found"})
+		return
+	}
+
+	limit, offset := parseLimitOffset(c)
+	usages, total, err := h.commitmentService.ListUsages(c.Request.Context(), id, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, len(usages))
+	for i, u := range usages {
+		result[i] = gin.H{
+			"id":             u.ID,
+			"transaction_id": u.TransactionID,
+			"endpoint_id":    u.EndpointID,
+			"worker_id":      u.WorkerID,
+			"seconds":        u.Seconds,
+			"amount":         ToDecimal(u.Amount),
+			"period_start":   u.PeriodStart,
+			"created_at":     u.CreatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"commitment": convertCommitment(commitment),
+		"usages":     result,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+func parseLimitOffset(c *gin.Context) (int, int) {
+	limit := 20
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil {
+			limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil {
+			offset = v
+		}
+	}
+	return limit, offset
+}
+
+func convertCommitment(cm *model.CapacityCommitment) gin.H {
+	utilization := 0.0
+	if cm.TotalSeconds > 0 {
+		utilization = math.Round(float64(cm.UsedSeconds)/float64(cm.TotalSeconds)*10000) / 100
+	}
+	return gin.H{
+		"id":              cm.ID,
+		"org_id":          cm.OrgID,
+		"spec_name":       cm.SpecName,
+		"cluster_id":      cm.ClusterID,
+		"hours":           float64(cm.TotalSeconds) / 3600,
+		"used_hours":      float64(cm.UsedSeconds) / 3600,
+		"remaining_hours": float64(cm.RemainingSeconds()) / 3600,
+		"utilization":     utilization, // 百分比
+		"price_per_hour":  ToDecimal(cm.PricePerHour),
+		"currency":        cm.Currency,
+		"start_at":        cm.StartAt,
+		"end_at":          cm.EndAt,
+		"status":          cm.Status,
+		"active":          cm.ActiveAt(time.Now()),
+		"note":            cm.Note,
+		"admin_email":     cm.AdminEmail,
+		"created_at":      cm.CreatedAt,
+	}
+}
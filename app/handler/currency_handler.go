@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CurrencyHandler struct {
+	currencyService *service.CurrencyService
+}
+
+func NewCurrencyHandler(currencyService *service.CurrencyService) *CurrencyHandler {
+	return &CurrencyHandler{currencyService: currencyService}
+}
+
+// ListExchangeRates 管理员查看汇率 (可按 base / quote 过滤)
+func (h *CurrencyHandler) ListExchangeRates(c *gin.Context) {
+	limit, offset := parseLimitOffset(c)
+	rates, total, err := h.currencyService.ListRates(c.Request.Context(), c.Query("base"), c.Query("quote"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"rates":  rates,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// CreateExchangeRate 管理员录入汇率: 1 base = rate quote, 自 effective_at 起生效 (为空表示立即)
+func (h *CurrencyHandler) CreateExchangeRate(c *gin.Context) {
+	var req struct {
+		BaseCurrency  string     `json:"base_currency" binding:"required"`
+		QuoteCurrency string     `json:"quote_currency" binding:"required"`
+		Rate          float64    `json:"rate" binding:"required"`
+		EffectiveAt   *time.Time `json:"effective_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rate := &model.ExchangeRate{
+		BaseCurrency:  req.BaseCurrency,
+		QuoteCurrency: req.QuoteCurrency,
+		Rate:          req.Rate,
+		AdminEmail:    c.GetString("email"),
+	}
+	if req.EffectiveAt != nil {
+		rate.EffectiveAt = *req.EffectiveAt
+	}
+	if err := h.currencyService.CreateRate(c.Request.Context(), rate); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "exchange rate already exists at effective_at"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rate)
+}
+
+// ListSpecPrices 管理员查看规格的多币种标价
+func (h *CurrencyHandler) ListSpecPrices(c *gin.Context) {
+	prices, err := h.currencyService.ListSpecPrices(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	result := make([]gin.H, len(prices))
+	for i := range prices {
+		result[i] = convertSpecCurrencyPrice(&prices[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"spec_name": c.Param("name"), "prices": result})
+}
+
+// SetSpecPrice 管理员设置规格某币种的标价 (只影响之后创建的 endpoint)
+func (h *CurrencyHandler) SetSpecPrice(c *gin.Context) {
+	var req struct {
+		PricePerHour       float64 `json:"price_per_hour" binding:"required"`
+		SpotPricePerHour   float64 `json:"spot_price_per_hour"`
+		TaskPricePerSecond float64 `json:"task_price_per_second"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	price := &model.SpecCurrencyPrice{
+		SpecName:           c.Param("name"),
+		Currency:           c.Param("currency"),
+		PricePerHour:       FromDecimal(req.PricePerHour),
+		SpotPricePerHour:   FromDecimal(req.SpotPricePerHour),
+		TaskPricePerSecond: FromDecimal(req.TaskPricePerSecond),
+	}
+	if err := h.currencyService.SetSpecPrice(c.Request.Context(), price); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, convertSpecCurrencyPrice(price))
+}
+
+// DeleteSpecPrice 管理员删除规格某币种的标价, 之后该币种按汇率换算基础价格
+func (h *CurrencyHandler) DeleteSpecPrice(c *gin.Context) {
+	if err := h.currencyService.DeleteSpecPrice(c.Request.Context(), c.Param("name"), c.Param("currency")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "spec price not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// GetBillingCurrency 本组织计费币种
+func (h *CurrencyHandler) GetBillingCurrency(c *gin.Context) {
+	currency, err := h.currencyService.OrgCurrency(c.Request.Context(), c.GetString("org_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"org_id": c.GetString("org_id"), "currency": currency})
+}
+
+// SetBillingCurrency 设置本组织计费币种 (仅 owner, 组织已有 endpoint、承诺或流水后不可修改)
+func (h *CurrencyHandler) SetBillingCurrency(c *gin.Context) {
+	var req struct {
+		Currency string `json:"currency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID := c.GetString("org_id")
+	if err := h.currencyService.SetOrgCurrency(c.Request.Context(), orgID, req.Currency, c.GetString("email")); err != nil {
+		if errors.Is(err, service.ErrCurrencyLocked) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	currency, err := h.currencyService.OrgCurrency(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"org_id": orgID, "currency": currency})
+}
+
+func convertSpecCurrencyPrice(p *model.SpecCurrencyPrice) gin.H {
+	return gin.H{
+		"spec_name":             p.SpecName,
+		"currency":              p.Currency,
+		"price_per_hour":        ToDecimal(p.PricePerHour),
+		"spot_price_per_hour":   ToDecimal(p.SpotPricePerHour),
+		"task_price_per_second": ToDecimal(p.TaskPricePerSecond),
+		"updated_at":            p.UpdatedAt,
+	}
+}
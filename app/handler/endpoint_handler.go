@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 	"github.com/wavespeedai/waverless-portal/pkg/wavespeed"
 
 	"github.com/gin-gonic/gin"
@@ -12,12 +15,20 @@ import (
 type EndpointHandler struct {
 	endpointService *service.EndpointService
 	userService     *service.UserService
+	budgetService   *service.BudgetService
+	costSimulator   *service.CostSimulatorService
+	revisionService *service.RevisionService
+	rolloutService  *service.RolloutService
 }
 
-func NewEndpointHandler(endpointService *service.EndpointService, userService *service.UserService) *EndpointHandler {
+func NewEndpointHandler(endpointService *service.EndpointService, userService *service.UserService, budgetService *service.BudgetService, costSimulator *service.CostSimulatorService, revisionService *service.RevisionService, rolloutService *service.RolloutService) *EndpointHandler {
 	return &EndpointHandler{
 		endpointService: endpointService,
 		userService:     userService,
+		budgetService:   budgetService,
+		costSimulator:   costSimulator,
+		revisionService: revisionService,
+		rolloutService:  rolloutService,
 	}
 }
 
@@ -39,31 +50,61 @@ func (h *EndpointHandler) CreateEndpoint(c *gin.Context) {
 		return
 	}
 
+	// 检查预算
+	if err := h.budgetService.CheckBudget(c.Request.Context(), orgID, userID); errors.Is(err, service.ErrBudgetExceeded) {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+		return
+	}
+
 	endpoint, err := h.endpointService.Create(c.Request.Context(), userID, orgID, &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.revisionService.Record(c.Request.Context(), orgID, endpoint.LogicalName, model.RevisionSourceCreate, userID, nil, nil)
 
+	placements, _ := h.endpointService.ListPlacements(c.Request.Context(), endpoint.ID)
 	c.JSON(http.StatusOK, gin.H{
 		"endpoint":       endpoint.LogicalName,
 		"cluster":        endpoint.ClusterID,
-		"price_per_hour": ToUSD(endpoint.PricePerHour),
+		"placements":     convertPlacements(placements),
+		"replica_policy": endpoint.ReplicaPolicy,
+		"price_per_hour": ToDecimal(endpoint.PricePerHour),
+		"currency":       endpoint.BillingCurrency(),
 		"status":         endpoint.Status,
+		"tags":           endpoint.Tags,
+		"spot":           endpoint.Spot,
+		"billing_mode":   endpoint.BillingMode,
 	})
 }
 
+func convertPlacements(placements []model.EndpointPlacement) []gin.H {
+	result := make([]gin.H, len(placements))
+	for i, p := range placements {
+		result[i] = gin.H{
+			"cluster_id":       p.ClusterID,
+			"rank":             p.Rank,
+			"replicas":         p.Replicas,
+			"min_replicas":     p.MinReplicas,
+			"max_replicas":     p.MaxReplicas,
+			"current_replicas": p.CurrentReplicas,
+			"status":           p.Status,
+		}
+	}
+	return result
+}
+
 // ListEndpoints 列出用户的 Endpoints
 func (h *EndpointHandler) ListEndpoints(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 
-	endpoints, err := h.endpointService.List(c.Request.Context(), userID)
+	endpoints, err := h.endpointService.List(c.Request.Context(), orgID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 转换 price_per_hour 为 USD
+	// 转换 price_per_hour 为计费币种金额
 	result := make([]map[string]interface{}, len(endpoints))
 	for i, ep := range endpoints {
 		result[i] = map[string]interface{}{
@@ -71,6 +112,8 @@ func (h *EndpointHandler) ListEndpoints(c *gin.Context) {
 			"logical_name":     ep.LogicalName,
 			"physical_name":    ep.PhysicalName,
 			"cluster_id":       ep.ClusterID,
+			"placement_count":  ep.PlacementCount,
+			"replica_policy":   ep.ReplicaPolicy,
 			"spec_name":        ep.SpecName,
 			"spec_type":        ep.SpecType,
 			"image":            ep.Image,
@@ -79,7 +122,11 @@ func (h *EndpointHandler) ListEndpoints(c *gin.Context) {
 			"min_replicas":     ep.MinReplicas,
 			"max_replicas":     ep.MaxReplicas,
 			"status":           ep.Status,
-			"price_per_hour":   ToUSD(ep.PricePerHour),
+			"suspend_reason":   ep.SuspendReason,
+			"tags":             ep.Tags,
+			"price_per_hour":   ToDecimal(ep.PricePerHour),
+			"currency":         ep.BillingCurrency(),
+			"billing_mode":     ep.BillingMode,
 			"created_at":       ep.CreatedAt,
 		}
 	}
@@ -89,10 +136,10 @@ func (h *EndpointHandler) ListEndpoints(c *gin.Context) {
 
 // GetEndpoint 获取 Endpoint 详情 (透传 waverless)
 func (h *EndpointHandler) GetEndpoint(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 
-	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), userID, name)
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
 		return
@@ -108,9 +155,24 @@ func (h *EndpointHandler) GetEndpoint(c *gin.Context) {
 
 	// 合并本地数据
 	detail["logical_name"] = endpoint.LogicalName
-	detail["price_per_hour"] = ToUSD(endpoint.PricePerHour)
+	detail["price_per_hour"] = ToDecimal(endpoint.PricePerHour)
+	detail["currency"] = endpoint.BillingCurrency()
+	detail["billing_mode"] = endpoint.BillingMode
+	if endpoint.TaskBilled() {
+		detail["task_price_per_second"] = ToDecimal(endpoint.TaskPricePerSecond)
+	}
+	if endpoint.Status == model.EndpointStatusSuspended {
+		detail["status"] = endpoint.Status
+		detail["suspend_reason"] = endpoint.SuspendReason
+		detail["suspended_at"] = endpoint.SuspendedAt
+	}
 	detail["cluster_id"] = endpoint.ClusterID
+	detail["replica_policy"] = endpoint.ReplicaPolicy
+	if placements, err := h.endpointService.ListPlacements(c.Request.Context(), endpoint.ID); err == nil {
+		detail["placements"] = convertPlacements(placements)
+	}
 	detail["specName"] = endpoint.SpecName
+	detail["tags"] = endpoint.Tags
 
 	c.JSON(http.StatusOK, detail)
 }
@@ -125,18 +187,52 @@ func (h *EndpointHandler) UpdateEndpoint(c *gin.Context) {
 		Replicas *int              `json:"replicas"`
 		Image    string            `json:"image"`
 		Env      map[string]string `json:"env"`
+		Tags     map[string]string `json:"tags"` // 整体替换, {} 表示清空
+
+		PreemptionPolicy string `json:"preemption_policy"` // resubmit, fail
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Replicas == nil && req.Image == "" && req.Env == nil && req.Tags == nil && req.PreemptionPolicy == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no updatable field provided"})
+		return
+	}
+	if err := service.ValidateTags(req.Tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.PreemptionPolicy != "" {
+		if err := service.ValidatePreemptionPolicy(req.PreemptionPolicy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// 发布进行中不允许修改镜像/环境变量, 否则会被发布的全量或回滚覆盖
+	if req.Image != "" || req.Env != nil {
+		endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
+			return
+		}
+		if err := h.rolloutService.EnsureNoRollout(c.Request.Context(), endpoint.ID); err != nil {
+			if errors.Is(err, service.ErrRolloutInProgress) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	replicas := -1 // -1 表示不更新
 	if req.Replicas != nil {
 		replicas = *req.Replicas
 		// 扩容时检查余额
 		if replicas > 0 {
-			endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), userID, name)
+			endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
 			if err != nil {
 				c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
 				return
@@ -147,13 +243,33 @@ func (h *EndpointHandler) UpdateEndpoint(c *gin.Context) {
 					c.JSON(http.StatusPaymentRequired, gin.H{"error": "insufficient balance"})
 					return
 				}
+				if err := h.budgetService.CheckBudget(c.Request.Context(), orgID, userID); errors.Is(err, service.ErrBudgetExceeded) {
+					c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+					return
+				}
 			}
 		}
 	}
 
-	if err := h.endpointService.UpdateDeployment(c.Request.Context(), userID, name, replicas, req.Image, req.Env); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	// 只修改标签/抢占策略时无需更新 waverless 部署
+	if req.Replicas != nil || req.Image != "" || req.Env != nil {
+		if err := h.endpointService.UpdateDeployment(c.Request.Context(), orgID, name, replicas, req.Image, req.Env); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		h.revisionService.Record(c.Request.Context(), orgID, name, model.RevisionSourceUpdate, userID, nil, nil)
+	}
+	if req.Tags != nil {
+		if err := h.endpointService.UpdateTags(c.Request.Context(), orgID, name, req.Tags); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.PreemptionPolicy != "" {
+		if err := h.endpointService.UpdatePreemptionPolicy(c.Request.Context(), orgID, name, req.PreemptionPolicy); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
@@ -161,7 +277,7 @@ func (h *EndpointHandler) UpdateEndpoint(c *gin.Context) {
 
 // UpdateEndpointConfig 更新 Endpoint 配置
 func (h *EndpointHandler) UpdateEndpointConfig(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 
 	var req map[string]interface{}
@@ -170,20 +286,84 @@ func (h *EndpointHandler) UpdateEndpointConfig(c *gin.Context) {
 		return
 	}
 
-	if err := h.endpointService.UpdateConfig(c.Request.Context(), userID, name, req); err != nil {
+	if err := h.endpointService.UpdateConfig(c.Request.Context(), orgID, name, req); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.revisionService.Record(c.Request.Context(), orgID, name, model.RevisionSourceConfig, c.GetString("user_id"), req, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "updated"})
 }
 
+// SimulateCost 按 endpoint 历史 worker 生命周期和任务负载, 模拟更换规格/扩缩容/计费策略后的成本差异 (金额为 endpoint 计费币种).
+// from/to 为空时使用最近 7 天
+func (h *EndpointHandler) SimulateCost(c *gin.Context) {
+	orgID := c.GetString("org_id")
+	name := c.Param("name")
+
+	var req service.CostSimulationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.From.IsZero() {
+		req.From = req.To.AddDate(0, 0, -7)
+	}
+
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
+		return
+	}
+
+	result, err := h.costSimulator.Simulate(c.Request.Context(), endpoint, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"endpoint_name":      result.EndpointName,
+		"from":               result.From,
+		"to":                 result.To,
+		"method":             result.Method,
+		"tasks":              result.Tasks,
+		"actual_billed":      ToDecimal(result.ActualBilled),
+		"baseline":           convertCostScenario(&result.Baseline),
+		"projected":          convertCostScenario(&result.Projected),
+		"difference":         ToDecimal(result.Difference),
+		"difference_percent": result.DifferencePercent,
+		"currency":           result.Currency,
+	})
+}
+
+func convertCostScenario(sc *service.CostScenario) gin.H {
+	return gin.H{
+		"spec_name":              sc.SpecName,
+		"spot":                   sc.Spot,
+		"price_per_hour":         ToDecimal(sc.PricePerHour),
+		"billing_policy_id":      sc.BillingPolicyID,
+		"billing_policy_version": sc.BillingPolicyVersion,
+		"min_replicas":           sc.MinReplicas,
+		"max_replicas":           sc.MaxReplicas,
+		"workers":                sc.Workers,
+		"worker_seconds":         sc.WorkerSeconds,
+		"busy_seconds":           sc.BusySeconds,
+		"cold_starts":            sc.ColdStarts,
+		"avg_queue_wait_ms":      sc.AvgQueueWaitMs,
+		"cost":                   ToDecimal(sc.Cost),
+	}
+}
+
 // DeleteEndpoint 删除 Endpoint
 func (h *EndpointHandler) DeleteEndpoint(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 
-	if err := h.endpointService.Delete(c.Request.Context(), userID, name); err != nil {
+	if err := h.endpointService.Delete(c.Request.Context(), orgID, name); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/invoice"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type InvoiceHandler struct {
+	invoiceService *service.InvoiceService
+}
+
+func NewInvoiceHandler(invoiceService *service.InvoiceService) *InvoiceHandler {
+	return &InvoiceHandler{invoiceService: invoiceService}
+}
+
+// ListInvoices 获取组织月度账单列表
+func (h *InvoiceHandler) ListInvoices(c *gin.Context) {
+	orgID := c.GetString("org_id")
+
+	limit := 20
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil {
+			limit = v
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil {
+			offset = v
+		}
+	}
+
+	invoices, total, err := h.invoiceService.List(c.Request.Context(), orgID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, len(invoices))
+	for i := range invoices {
+		result[i] = convertInvoice(&invoices[i])
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"invoices": result,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// GetInvoice 获取账单详情及明细
+func (h *InvoiceHandler) GetInvoice(c *gin.Context) {
+	inv, items, ok := h.loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	lineItems := make([]gin.H, len(items))
+	for i, item := range items {
+		lineItems[i] = gin.H{
+			"endpoint_id":       item.EndpointID,
+			"endpoint_name":     item.EndpointName,
+			"spec_name":         item.SpecName,
+			"gpu_type":          item.GPUType,
+			"duration_seconds":  item.DurationSeconds,
+			"amount":            ToDecimal(item.Amount),
+			"transaction_count": item.TransactionCount,
+		}
+	}
+
+	result := convertInvoice(inv)
+	result["line_items"] = lineItems
+	c.JSON(http.StatusOK, result)
+}
+
+// DownloadInvoiceCSV 下载账单 CSV
+func (h *InvoiceHandler) DownloadInvoiceCSV(c *gin.Context) {
+	inv, items, ok := h.loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := invoice.WriteCSV(&buf, inv, items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+inv.InvoiceNumber+`.csv"`)
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// DownloadInvoicePDF 下载账单 PDF
+func (h *InvoiceHandler) DownloadInvoicePDF(c *gin.Context) {
+	inv, items, ok := h.loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := invoice.WritePDF(&buf, inv, items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+inv.InvoiceNumber+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+func (h *InvoiceHandler) loadInvoice(c *gin.Context) (*model.Invoice, []model.InvoiceLineItem, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil, nil, false
+	}
+
+	inv, items, err := h.invoiceService.Get(c.Request.Context(), c.GetString("org_id"), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, nil, false
+	}
+	return inv, items, true
+}
+
+func convertInvoice(inv *model.Invoice) gin.H {
+	return gin.H{
+		"id":             inv.ID,
+		"invoice_number": inv.InvoiceNumber,
+		"org_id":         inv.OrgID,
+		"period_start":   inv.PeriodStart,
+		"period_end":     inv.PeriodEnd,
+		"total_amount":   ToDecimal(inv.TotalAmount),
+		"total_seconds":  inv.TotalSeconds,
+		"currency":       inv.Currency,
+		"status":         inv.Status,
+		"finalized_at":   inv.FinalizedAt,
+		"created_at":     inv.CreatedAt,
+		"updated_at":     inv.UpdatedAt,
+	}
+}
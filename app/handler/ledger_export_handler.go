@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type LedgerExportHandler struct {
+	exportService *service.LedgerExportService
+}
+
+func NewLedgerExportHandler(exportService *service.LedgerExportService) *LedgerExportHandler {
+	return &LedgerExportHandler{exportService: exportService}
+}
+
+// ListExports 管理员查看导出水位及日分区状态 (可按 status 过滤)
+func (h *LedgerExportHandler) ListExports(c *gin.Context) {
+	limit, offset := parseLimitOffset(c)
+	status, err := h.exportService.Status(c.Request.Context(), c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"watermark": gin.H{
+			"last_id":    status.Watermark.LastID,
+			"updated_at": status.Watermark.UpdatedAt,
+		},
+		"exports": status.Exports,
+		"total":   status.Total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// GetExport 管理员查看某天 (YYYY-MM-DD, UTC) 的导出及分片
+func (h *LedgerExportHandler) GetExport(c *gin.Context) {
+	day, ok := parseLedgerDay(c)
+	if !ok {
+		return
+	}
+	export, parts, err := h.exportService.GetDay(c.Request.Context(), day)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"export": export, "parts": parts})
+}
+
+// RerunExport 管理员要求重新导出某天, 由下一轮导出任务执行 (配置了不支持的格式如 parquet 时返回 400)
+func (h *LedgerExportHandler) RerunExport(c *gin.Context) {
+	day, ok := parseLedgerDay(c)
+	if !ok {
+		return
+	}
+	if err := h.exportService.RequestRerun(c.Request.Context(), day); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "rerun requested", "day": day.Format("2006-01-02")})
+}
+
+func parseLedgerDay(c *gin.Context) (time.Time, bool) {
+	day, err := time.Parse("2006-01-02", c.Param("day"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "day must be YYYY-MM-DD"})
+		return time.Time{}, false
+	}
+	return day, true
+}
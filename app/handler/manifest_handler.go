@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/wavespeed"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type ManifestHandler struct {
+	manifestService *service.ManifestService
+	budgetService   *service.BudgetService
+}
+
+func NewManifestHandler(manifestService *service.ManifestService, budgetService *service.BudgetService) *ManifestHandler {
+	return &ManifestHandler{manifestService: manifestService, budgetService: budgetService}
+}
+
+// PlanManifest 对比清单与当前 endpoint 状态, 返回将执行的变更 (?prune=true 时包含待删除的 endpoint)
+func (h *ManifestHandler) PlanManifest(c *gin.Context) {
+	manifest, ok := bindManifest(c)
+	if !ok {
+		return
+	}
+
+	plan, err := h.manifestService.Plan(c.Request.Context(), c.GetString("org_id"), manifest, c.Query("prune") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// ApplyManifest 按清单创建/更新 endpoint, ?prune=true 时删除清单中没有的 endpoint.
+// 计划中有无法应用的 endpoint 时不做任何修改
+func (h *ManifestHandler) ApplyManifest(c *gin.Context) {
+	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
+
+	manifest, ok := bindManifest(c)
+	if !ok {
+		return
+	}
+
+	plan, err := h.manifestService.Plan(c.Request.Context(), orgID, manifest, c.Query("prune") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if plan.HasErrors() {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "manifest cannot be applied", "endpoints": plan.Endpoints})
+		return
+	}
+
+	// 创建或扩容时检查余额及预算
+	if plan.ScalesUp() {
+		balance, err := wavespeed.GetOrgBalanceInternal(c.Request.Context(), orgID)
+		if err == nil && balance <= 0 {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "insufficient balance"})
+			return
+		}
+		if err := h.budgetService.CheckBudget(c.Request.Context(), orgID, userID); errors.Is(err, service.ErrBudgetExceeded) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !h.manifestService.Apply(c.Request.Context(), userID, plan) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "some endpoints failed to apply", "endpoints": plan.Endpoints})
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// bindManifest 按 Content-Type 解析 YAML 或 JSON 清单
+func bindManifest(c *gin.Context) (*service.Manifest, bool) {
+	var manifest service.Manifest
+	var b binding.Binding = binding.JSON
+	if strings.Contains(c.ContentType(), "yaml") {
+		b = binding.YAML
+	}
+	if err := c.ShouldBindWith(&manifest, b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if len(manifest.Endpoints) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "manifest has no endpoints"})
+		return nil, false
+	}
+	return &manifest, true
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type MigrationHandler struct {
+	migrationService *service.MigrationService
+	endpointService  *service.EndpointService
+}
+
+func NewMigrationHandler(migrationService *service.MigrationService, endpointService *service.EndpointService) *MigrationHandler {
+	return &MigrationHandler{migrationService: migrationService, endpointService: endpointService}
+}
+
+// CreateMigration 发起 endpoint 迁移: 在目标集群部署就绪后切换任务路由, 排空并删除源集群部署
+func (h *MigrationHandler) CreateMigration(c *gin.Context) {
+	var req struct {
+		TargetClusterID string `json:"target_cluster_id" binding:"required"`
+		SourceClusterID string `json:"source_cluster_id"` // 默认为主集群
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), c.GetString("org_id"), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
+		return
+	}
+
+	m, err := h.migrationService.Start(c.Request.Context(), endpoint, req.SourceClusterID, req.TargetClusterID, model.MigrationReasonManual, c.GetString("user_id"))
+	if err != nil {
+		if errors.Is(err, service.ErrMigrationInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, convertMigration(m))
+}
+
+// ListMigrations 列出 endpoint 的迁移记录
+func (h *MigrationHandler) ListMigrations(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), c.GetString("org_id"), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
+		return
+	}
+
+	migrations, err := h.migrationService.List(c.Request.Context(), endpoint.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, len(migrations))
+	for i := range migrations {
+		result[i] = convertMigration(&migrations[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"migrations": result})
+}
+
+// CancelMigration 取消尚未切换任务路由的迁移
+func (h *MigrationHandler) CancelMigration(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid migration id"})
+		return
+	}
+
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), c.GetString("org_id"), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
+		return
+	}
+
+	m, err := h.migrationService.Cancel(c.Request.Context(), endpoint, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "migration not found"})
+		case errors.Is(err, service.ErrMigrationNotCancellable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, convertMigration(m))
+}
+
+func convertMigration(m *model.EndpointMigration) gin.H {
+	return gin.H{
+		"id":                m.ID,
+		"source_cluster_id": m.SourceClusterID,
+		"target_cluster_id": m.TargetClusterID,
+		"reason":            m.Reason,
+		"status":            m.Status,
+		"error":             m.Error,
+		"requested_by":      m.RequestedBy,
+		"started_at":        m.StartedAt,
+		"switched_at":       m.SwitchedAt,
+		"completed_at":      m.CompletedAt,
+		"created_at":        m.CreatedAt,
+	}
+}
@@ -37,10 +37,10 @@ func (h *MonitoringHandler) SetWorkerSyncJob(job *jobs.WorkerSyncJob) {
 
 // GetEndpointWorkers 获取 Endpoint 的 Worker 列表 (从本地 workers 表)
 func (h *MonitoringHandler) GetEndpointWorkers(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 
-	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), userID, name)
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
 		return
@@ -65,10 +65,10 @@ func (h *MonitoringHandler) GetEndpointWorkers(c *gin.Context) {
 
 // GetEndpointMetrics 获取 Endpoint 实时指标
 func (h *MonitoringHandler) GetEndpointMetrics(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 
-	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), userID, name)
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
 		return
@@ -88,7 +88,7 @@ func (h *MonitoringHandler) GetEndpointMetrics(c *gin.Context) {
 	}
 
 	// 添加价格信息
-	metrics["price_per_hour"] = ToUSD(endpoint.PricePerHour)
+	metrics["price_per_hour"] = ToDecimal(endpoint.PricePerHour)
 	metrics["endpoint_name"] = name
 
 	c.JSON(http.StatusOK, metrics)
@@ -96,10 +96,10 @@ func (h *MonitoringHandler) GetEndpointMetrics(c *gin.Context) {
 
 // GetEndpointStats 获取 Endpoint 统计数据 (透传 waverless)
 func (h *MonitoringHandler) GetEndpointStats(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 
-	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), userID, name)
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
 		return
@@ -127,10 +127,10 @@ func (h *MonitoringHandler) GetEndpointStats(c *gin.Context) {
 
 // GetEndpointStatistics 获取 Endpoint 统计信息 (透传 waverless)
 func (h *MonitoringHandler) GetEndpointStatistics(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 
-	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), userID, name)
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
 		return
@@ -154,12 +154,12 @@ func (h *MonitoringHandler) GetEndpointStatistics(c *gin.Context) {
 
 // GetWorkerLogs 获取 Worker 日志
 func (h *MonitoringHandler) GetWorkerLogs(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 	podName := c.Query("pod_name")
 	lines := 200
 
-	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), userID, name)
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
 		return
@@ -183,12 +183,12 @@ func (h *MonitoringHandler) GetWorkerLogs(c *gin.Context) {
 
 // GetAllTasks 获取用户所有任务 (从本地 task_routing 表)
 func (h *MonitoringHandler) GetAllTasks(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	status := c.Query("status")
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 
-	tasks, total, err := h.taskRepo.List(c.Request.Context(), userID, status, limit, offset)
+	tasks, total, err := h.taskRepo.List(c.Request.Context(), orgID, status, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -199,9 +199,9 @@ func (h *MonitoringHandler) GetAllTasks(c *gin.Context) {
 
 // GetTasksOverview 获取任务总览统计 (从本地 task_routing 表)
 func (h *MonitoringHandler) GetTasksOverview(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 
-	overview, err := h.taskRepo.GetOverview(c.Request.Context(), userID)
+	overview, err := h.taskRepo.GetOverview(c.Request.Context(), orgID)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"completed": 0, "in_progress": 0, "pending": 0, "failed": 0})
 		return
@@ -212,7 +212,7 @@ func (h *MonitoringHandler) GetTasksOverview(c *gin.Context) {
 
 // GetWorkerTasks 获取任务列表
 func (h *MonitoringHandler) GetWorkerTasks(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 	workerID := c.Query("worker_id")
 	status := c.Query("status")
@@ -220,7 +220,7 @@ func (h *MonitoringHandler) GetWorkerTasks(c *gin.Context) {
 	limit := c.DefaultQuery("limit", "100")
 	offset := c.DefaultQuery("offset", "0")
 
-	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), userID, name)
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
 		return
@@ -244,11 +244,11 @@ func (h *MonitoringHandler) GetWorkerTasks(c *gin.Context) {
 
 // GetTaskTimeline 获取任务时间线
 func (h *MonitoringHandler) GetTaskTimeline(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	taskID := c.Param("task_id")
 
 	// 从本地 task_routing 获取任务信息
-	task, err := h.taskRepo.GetByTaskID(c.Request.Context(), taskID, userID)
+	task, err := h.taskRepo.GetByTaskID(c.Request.Context(), taskID, orgID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
 		return
@@ -272,10 +272,10 @@ func (h *MonitoringHandler) GetTaskTimeline(c *gin.Context) {
 
 // GetTaskExecutionHistory 获取任务执行历史
 func (h *MonitoringHandler) GetTaskExecutionHistory(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	taskID := c.Param("task_id")
 
-	task, err := h.taskRepo.GetByTaskID(c.Request.Context(), taskID, userID)
+	task, err := h.taskRepo.GetByTaskID(c.Request.Context(), taskID, orgID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
 		return
@@ -299,11 +299,11 @@ func (h *MonitoringHandler) GetTaskExecutionHistory(c *gin.Context) {
 
 // GetScalingHistory 获取扩缩容历史
 func (h *MonitoringHandler) GetScalingHistory(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 
-	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), userID, name)
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
 		return
@@ -327,11 +327,11 @@ func (h *MonitoringHandler) GetScalingHistory(c *gin.Context) {
 
 // ExecWorker WebSocket 代理到 waverless
 func (h *MonitoringHandler) ExecWorker(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 	workerID := c.Query("worker_id")
 
-	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), userID, name)
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), orgID, name)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
 		return
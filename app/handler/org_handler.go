@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrgHandler struct {
+	orgService *service.OrgService
+}
+
+func NewOrgHandler(orgService *service.OrgService) *OrgHandler {
+	return &OrgHandler{orgService: orgService}
+}
+
+// GetMembership 当前用户在本组织的角色
+func (h *OrgHandler) GetMembership(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"org_id":  c.GetString("org_id"),
+		"user_id": c.GetString("user_id"),
+		"role":    c.GetString("org_role"),
+	})
+}
+
+// ListMembers 列出本组织成员
+func (h *OrgHandler) ListMembers(c *gin.Context) {
+	members, err := h.orgService.ListMembers(c.Request.Context(), c.GetString("org_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// AddMember 按邮箱添加成员 (admin 只能添加 viewer/developer)
+func (h *OrgHandler) AddMember(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+		Role  string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := h.orgService.AddMember(c.Request.Context(), orgMember(c), req.Email, req.Role)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "added", "member": member})
+}
+
+// UpdateMemberRole 修改成员角色
+func (h *OrgHandler) UpdateMemberRole(c *gin.Context) {
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.orgService.UpdateRole(c.Request.Context(), orgMember(c), c.Param("user_id"), req.Role); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "updated"})
+}
+
+// RemoveMember 移除成员
+func (h *OrgHandler) RemoveMember(c *gin.Context) {
+	if err := h.orgService.RemoveMember(c.Request.Context(), orgMember(c), c.Param("user_id")); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "removed"})
+}
+
+// orgMember 获取 OrgAuth 中间件设置的当前成员
+func orgMember(c *gin.Context) *model.OrgMember {
+	member, _ := c.MustGet("org_member").(*model.OrgMember)
+	return member
+}
+
+func orgError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrOrgRoleForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotOrgMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
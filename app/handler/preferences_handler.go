@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PreferencesHandler struct {
+	budgetService   *service.BudgetService
+	currencyService *service.CurrencyService
+}
+
+func NewPreferencesHandler(budgetService *service.BudgetService, currencyService *service.CurrencyService) *PreferencesHandler {
+	return &PreferencesHandler{budgetService: budgetService, currencyService: currencyService}
+}
+
+// GetPreferences 获取用户偏好设置
+func (h *PreferencesHandler) GetPreferences(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	prefs, err := h.budgetService.GetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, convertPreferences(prefs))
+}
+
+// UpdatePreferences 更新用户偏好设置 (预算金额为组织计费币种, 0 表示不限制)
+func (h *PreferencesHandler) UpdatePreferences(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		DailyBudgetLimit        *float64 `json:"daily_budget_limit"`
+		MonthlyBudgetLimit      *float64 `json:"monthly_budget_limit"`
+		AutoSuspendOnLowBalance *bool    `json:"auto_suspend_on_low_balance"`
+		AutoMigrateForPrice     *bool    `json:"auto_migrate_for_price"`
+		AutoMigrateForHealth    *bool    `json:"auto_migrate_for_health"`
+		EmailNotifications      *bool    `json:"email_notifications"`
+		LowBalanceAlert         *bool    `json:"low_balance_alert"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	prefs, err := h.budgetService.GetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DailyBudgetLimit != nil {
+		prefs.DailyBudgetLimit = FromDecimal(*req.DailyBudgetLimit)
+	}
+	if req.MonthlyBudgetLimit != nil {
+		prefs.MonthlyBudgetLimit = FromDecimal(*req.MonthlyBudgetLimit)
+	}
+	if req.AutoSuspendOnLowBalance != nil {
+		prefs.AutoSuspendOnLowBalance = *req.AutoSuspendOnLowBalance
+	}
+	if req.AutoMigrateForPrice != nil {
+		prefs.AutoMigrateForPrice = *req.AutoMigrateForPrice
+	}
+	if req.AutoMigrateForHealth != nil {
+		prefs.AutoMigrateForHealth = *req.AutoMigrateForHealth
+	}
+	if req.EmailNotifications != nil {
+		prefs.EmailNotifications = *req.EmailNotifications
+	}
+	if req.LowBalanceAlert != nil {
+		prefs.LowBalanceAlert = *req.LowBalanceAlert
+	}
+
+	if err := h.budgetService.UpdatePreferences(c.Request.Context(), prefs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, convertPreferences(prefs))
+}
+
+// DeletePreferences 重置用户偏好设置
+func (h *PreferencesHandler) DeletePreferences(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	if err := h.budgetService.DeletePreferences(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// GetBudget 获取当前组织内当日/当月预算使用情况及告警记录
+func (h *PreferencesHandler) GetBudget(c *gin.Context) {
+	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("alert_limit", "20"))
+
+	status, err := h.budgetService.GetBudgetStatus(c.Request.Context(), orgID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	alerts, err := h.budgetService.ListAlerts(c.Request.Context(), orgID, userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	currency, err := h.currencyService.OrgCurrency(c.Request.Context(), orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	alertList := make([]gin.H, len(alerts))
+	for i, a := range alerts {
+		alertList[i] = gin.H{
+			"period_type":  a.PeriodType,
+			"period_start": a.PeriodStart,
+			"threshold":    a.Threshold,
+			"spent":        ToDecimal(a.Spent),
+			"budget_limit": ToDecimal(a.BudgetLimit),
+			"action":       a.Action,
+			"created_at":   a.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"daily":    convertBudgetUsage(status.Daily),
+		"monthly":  convertBudgetUsage(status.Monthly),
+		"exceeded": status.Exceeded,
+		"alerts":   alertList,
+		"currency": currency,
+	})
+}
+
+func convertPreferences(p *model.UserPreferences) gin.H {
+	return gin.H{
+		"daily_budget_limit":          ToDecimal(p.DailyBudgetLimit),
+		"monthly_budget_limit":        ToDecimal(p.MonthlyBudgetLimit),
+		"auto_suspend_on_low_balance": p.AutoSuspendOnLowBalance,
+		"auto_migrate_for_price":      p.AutoMigrateForPrice,
+		"auto_migrate_for_health":     p.AutoMigrateForHealth,
+		"email_notifications":         p.EmailNotifications,
+		"low_balance_alert":           p.LowBalanceAlert,
+		"updated_at":                  p.UpdatedAt,
+	}
+}
+
+func convertBudgetUsage(u service.BudgetUsage) gin.H {
+	return gin.H{
+		"period_start": u.PeriodStart,
+		"period_end":   u.PeriodEnd,
+		"spent":        ToDecimal(u.Spent),
+		"limit":        ToDecimal(u.Limit),
+		"percent":      u.Percent,
+		"exceeded":     u.Exceeded,
+	}
+}
@@ -1,14 +1,14 @@
 package handler
 
-// PriceUnit 价格单位: 1 USD = 1000000
+// PriceUnit 价格单位: 1 个货币单位 (如 1 USD) = 1000000
 const PriceUnit = 1000000
 
-// ToUSD 内部价格转 USD (用于返回给前端)
-func ToUSD(amount int64) float64 {
+// ToDecimal 内部价格转小数金额 (用于返回给前端, 币种由调用方一并返回)
+func ToDecimal(amount int64) float64 {
 	return float64(amount) / PriceUnit
 }
 
-// FromUSD USD 转内部价格 (用于接收前端输入)
-func FromUSD(usd float64) int64 {
-	return int64(usd * PriceUnit)
+// FromDecimal 小数金额转内部价格 (用于接收前端输入)
+func FromDecimal(amount float64) int64 {
+	return int64(amount * PriceUnit)
 }
@@ -0,0 +1,370 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PricingHandler struct {
+	pricingService     *service.PricingService
+	policyService      *service.BillingPolicyService
+	priceChangeService *service.PriceChangeService
+}
+
+func NewPricingHandler(pricingService *service.PricingService, policyService *service.BillingPolicyService, priceChangeService *service.PriceChangeService) *PricingHandler {
+	return &PricingHandler{pricingService: pricingService, policyService: policyService, priceChangeService: priceChangeService}
+}
+
+// pricingOverrideRequest 覆盖价格请求 (币种为空表示 USD, 生效时间为空表示不限)
+type pricingOverrideRequest struct {
+	ClusterID      string     `json:"cluster_id" binding:"required"`
+	SpecName       string     `json:"spec_name" binding:"required"`
+	PricePerHour   float64    `json:"price_per_hour"`
+	Currency       string     `json:"currency"`
+	EffectiveFrom  *time.Time `json:"effective_from"`
+	EffectiveUntil *time.Time `json:"effective_until"`
+	Reason         string     `json:"reason"`
+}
+
+func (r *pricingOverrideRequest) apply(o *model.ClusterPricingOverride) {
+	o.ClusterID = r.ClusterID
+	o.SpecName = r.SpecName
+	o.PricePerHour = FromDecimal(r.PricePerHour)
+	o.Currency = r.Currency
+	o.EffectiveFrom = r.EffectiveFrom
+	o.EffectiveUntil = r.EffectiveUntil
+	o.Reason = r.Reason
+}
+
+// ListOverrides 列出集群覆盖价格 (可按 cluster_id / spec_name 过滤)
+func (h *PricingHandler) ListOverrides(c *gin.Context) {
+	overrides, err := h.pricingService.ListOverrides(c.Request.Context(), c.Query("cluster_id"), c.Query("spec_name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, len(overrides))
+	for i := range overrides {
+		result[i] = convertPricingOverride(&overrides[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"overrides": result})
+}
+
+// CreateOverride 创建集群覆盖价格
+func (h *PricingHandler) CreateOverride(c *gin.Context) {
+	var req pricingOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	override := &model.ClusterPricingOverride{}
+	req.apply(override)
+	if err := h.pricingService.CreateOverride(c.Request.Context(), override); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, convertPricingOverride(override))
+}
+
+// UpdateOverride 更新集群覆盖价格 (整体替换)
+func (h *PricingHandler) UpdateOverride(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req pricingOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	override, err := h.pricingService.GetOverride(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "override not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	req.apply(override)
+	if err := h.pricingService.UpdateOverride(c.Request.Context(), override); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, convertPricingOverride(override))
+}
+
+// DeleteOverride 删除集群覆盖价格
+func (h *PricingHandler) DeleteOverride(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := h.pricingService.DeleteOverride(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+func convertPricingOverride(o *model.ClusterPricingOverride) gin.H {
+	return gin.H{
+		"id":              o.ID,
+		"cluster_id":      o.ClusterID,
+		"spec_name":       o.SpecName,
+		"price_per_hour":  ToDecimal(o.PricePerHour),
+		"currency":        o.Currency,
+		"effective_from":  o.EffectiveFrom,
+		"effective_until": o.EffectiveUntil,
+		"reason":          o.Reason,
+		"active":          o.ActiveAt(time.Now()),
+		"created_at":      o.CreatedAt,
+		"updated_at":      o.UpdatedAt,
+	}
+}
+
+// billingPolicyRequest 计费策略请求
+type billingPolicyRequest struct {
+	Name                 string `json:"name"`
+	Rounding             string `json:"rounding"`
+	MinBillableSeconds   *int64 `json:"min_billable_seconds"`
+	MinimumChargeSeconds int64  `json:"minimum_charge_seconds"`
+	ColdStartFreeSeconds int64  `json:"cold_start_free_seconds"`
+	IdleDiscountPercent  int    `json:"idle_discount_percent"`
+	Description          string `json:"description"`
+}
+
+func (r *billingPolicyRequest) toPolicy() *model.BillingPolicy {
+	p := &model.BillingPolicy{
+		Name:                 r.Name,
+		Rounding:             r.Rounding,
+		MinBillableSeconds:   60,
+		MinimumChargeSeconds: r.MinimumChargeSeconds,
+		ColdStartFreeSeconds: r.ColdStartFreeSeconds,
+		IdleDiscountPercent:  r.IdleDiscountPercent,
+		Description:          r.Description,
+	}
+	if r.MinBillableSeconds != nil {
+		p.MinBillableSeconds = *r.MinBillableSeconds
+	}
+	return p
+}
+
+// ListBillingPolicies 列出计费策略 (all=true 时包含历史版本)
+func (h *PricingHandler) ListBillingPolicies(c *gin.Context) {
+	policies, err := h.policyService.List(c.Request.Context(), c.Query("all") != "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+// CreateBillingPolicy 创建计费策略
+func (h *PricingHandler) CreateBillingPolicy(c *gin.Context) {
+	var req billingPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy := req.toPolicy()
+	if err := h.policyService.Create(c.Request.Context(), policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdateBillingPolicy 修改计费策略: 生成新版本, 已有流水仍引用旧版本
+func (h *PricingHandler) UpdateBillingPolicy(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req billingPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy := req.toPolicy()
+	if err := h.policyService.CreateVersion(c.Request.Context(), id, policy); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "billing policy not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// priceChangeRequest 计划调价请求 (币种为空表示规格基础币种)
+type priceChangeRequest struct {
+	SpecName         string    `json:"spec_name" binding:"required"`
+	PricePerHour     float64   `json:"price_per_hour" binding:"required"`
+	Currency         string    `json:"currency"`
+	SpotPricePerHour *float64  `json:"spot_price_per_hour"` // 为空表示 spot 价格不变
+	EffectiveAt      time.Time `json:"effective_at" binding:"required"`
+	NoticeDays       int       `json:"notice_days"` // 为空使用配置的最短通知天数
+	Reason           string    `json:"reason"`
+}
+
+// ListPriceChanges 列出计划调价 (可按 spec_name / status 过滤)
+func (h *PricingHandler) ListPriceChanges(c *gin.Context) {
+	changes, err := h.priceChangeService.List(c.Request.Context(), c.Query("spec_name"), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, len(changes))
+	for i := range changes {
+		result[i] = convertPriceChange(&changes[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"price_changes": result})
+}
+
+// SchedulePriceChange 创建计划调价: 到生效时间后规格价格更新, 已有 endpoint 迁移到新价格
+func (h *PricingHandler) SchedulePriceChange(c *gin.Context) {
+	var req priceChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change := &model.SpecPriceChange{
+		SpecName:     req.SpecName,
+		PricePerHour: FromDecimal(req.PricePerHour),
+		Currency:     req.Currency,
+		EffectiveAt:  req.EffectiveAt,
+		NoticeDays:   req.NoticeDays,
+		Reason:       req.Reason,
+		AdminEmail:   c.GetString("email"),
+	}
+	if req.SpotPricePerHour != nil {
+		spot := FromDecimal(*req.SpotPricePerHour)
+		change.SpotPricePerHour = &spot
+	}
+	if err := h.priceChangeService.Schedule(c.Request.Context(), change); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, convertPriceChange(change))
+}
+
+// CancelPriceChange 取消尚未生效的计划调价
+func (h *PricingHandler) CancelPriceChange(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if _, err := h.priceChangeService.Get(c.Request.Context(), id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "price change not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.priceChangeService.Cancel(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "cancelled"})
+}
+
+// ListUpcomingPriceChanges 影响本组织 endpoint 的待生效调价
+func (h *PricingHandler) ListUpcomingPriceChanges(c *gin.Context) {
+	changes, err := h.priceChangeService.ListScheduledForOrg(c.Request.Context(), c.GetString("org_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, len(changes))
+	for i := range changes {
+		ch := &changes[i]
+		result[i] = gin.H{
+			"spec_name":           ch.SpecName,
+			"price_per_hour":      ToDecimal(ch.PricePerHour),
+			"spot_price_per_hour": convertOptionalAmount(ch.SpotPricePerHour),
+			"currency":            ch.Currency,
+			"effective_at":        ch.EffectiveAt,
+			"reason":              ch.Reason,
+			"announced_at":        ch.CreatedAt,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"price_changes": result})
+}
+
+// ListPriceHistory 本组织 endpoint 的锁定价格变更历史 (可按 endpoint 名称过滤)
+func (h *PricingHandler) ListPriceHistory(c *gin.Context) {
+	limit, offset := parseLimitOffset(c)
+	records, total, err := h.priceChangeService.ListHistory(c.Request.Context(), c.GetString("org_id"), c.Query("endpoint"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, len(records))
+	for i, r := range records {
+		result[i] = gin.H{
+			"endpoint_id":        r.EndpointID,
+			"endpoint_name":      r.EndpointName,
+			"spec_name":          r.SpecName,
+			"change_id":          r.ChangeID,
+			"old_price_per_hour": ToDecimal(r.OldPricePerHour),
+			"new_price_per_hour": ToDecimal(r.NewPricePerHour),
+			"effective_from":     r.EffectiveFrom,
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"history": result,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+func convertPriceChange(ch *model.SpecPriceChange) gin.H {
+	return gin.H{
+		"id":                  ch.ID,
+		"spec_name":           ch.SpecName,
+		"price_per_hour":      ToDecimal(ch.PricePerHour),
+		"spot_price_per_hour": convertOptionalAmount(ch.SpotPricePerHour),
+		"currency":            ch.Currency,
+		"effective_at":        ch.EffectiveAt,
+		"notice_days":         ch.NoticeDays,
+		"status":              ch.Status,
+		"applied_at":          ch.AppliedAt,
+		"affected_endpoints":  ch.AffectedEndpoints,
+		"reason":              ch.Reason,
+		"admin_email":         ch.AdminEmail,
+		"created_at":          ch.CreatedAt,
+	}
+}
+
+// convertOptionalAmount 可选金额转换为小数金额, 为空时返回 nil
+func convertOptionalAmount(v *int64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return ToDecimal(*v)
+}
@@ -68,9 +68,9 @@ func (h *RegistryCredentialHandler) Create(c *gin.Context) {
 
 // List 列出凭证
 func (h *RegistryCredentialHandler) List(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 
-	creds, err := h.repo.List(c.Request.Context(), userID)
+	creds, err := h.repo.List(c.Request.Context(), orgID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -93,10 +93,10 @@ func (h *RegistryCredentialHandler) List(c *gin.Context) {
 
 // Delete 删除凭证
 func (h *RegistryCredentialHandler) Delete(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	name := c.Param("name")
 
-	if err := h.repo.Delete(c.Request.Context(), userID, name); err != nil {
+	if err := h.repo.Delete(c.Request.Context(), orgID, name); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
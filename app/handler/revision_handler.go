@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"github.com/wavespeedai/waverless-portal/pkg/wavespeed"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RevisionHandler struct {
+	revisionService *service.RevisionService
+	endpointService *service.EndpointService
+	budgetService   *service.BudgetService
+}
+
+func NewRevisionHandler(revisionService *service.RevisionService, endpointService *service.EndpointService, budgetService *service.BudgetService) *RevisionHandler {
+	return &RevisionHandler{revisionService: revisionService, endpointService: endpointService, budgetService: budgetService}
+}
+
+// ListRevisions 列出 endpoint 的配置历史 (新的在前)
+func (h *RevisionHandler) ListRevisions(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), c.GetString("org_id"), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
+		return
+	}
+
+	revs, err := h.revisionService.List(c.Request.Context(), endpoint.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, len(revs))
+	for i := range revs {
+		result[i] = convertRevision(&revs[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": result})
+}
+
+// GetRevision 获取单个 revision 的完整配置
+func (h *RevisionHandler) GetRevision(c *gin.Context) {
+	endpoint, revision, ok := h.resolve(c)
+	if !ok {
+		return
+	}
+
+	rev, err := h.revisionService.Get(c.Request.Context(), endpoint.ID, revision)
+	if err != nil {
+		revisionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, convertRevision(rev))
+}
+
+// DiffRevision 对比 revision 与 from 指定的 revision (默认为上一个 revision) 的差异
+func (h *RevisionHandler) DiffRevision(c *gin.Context) {
+	endpoint, revision, ok := h.resolve(c)
+	if !ok {
+		return
+	}
+	from := revision - 1
+	if v := c.Query("from"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from revision"})
+			return
+		}
+		from = n
+	}
+
+	changes, err := h.revisionService.Diff(c.Request.Context(), endpoint.ID, from, revision)
+	if err != nil {
+		revisionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": revision, "changes": changes})
+}
+
+// RollbackRevision 回滚到指定 revision: 重新下发其部署及扩缩容配置, 生成新的 revision
+func (h *RevisionHandler) RollbackRevision(c *gin.Context) {
+	endpoint, revision, ok := h.resolve(c)
+	if !ok {
+		return
+	}
+
+	rev, err := h.revisionService.Get(c.Request.Context(), endpoint.ID, revision)
+	if err != nil {
+		revisionError(c, err)
+		return
+	}
+	// 回滚后副本数增加时检查余额及预算
+	if rev.Replicas > endpoint.Replicas {
+		balance, err := wavespeed.GetOrgBalanceInternal(c.Request.Context(), endpoint.OrgID)
+		if err == nil && balance <= 0 {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": "insufficient balance"})
+			return
+		}
+		if err := h.budgetService.CheckBudget(c.Request.Context(), endpoint.OrgID, c.GetString("user_id")); errors.Is(err, service.ErrBudgetExceeded) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	newRev, err := h.revisionService.Rollback(c.Request.Context(), endpoint, revision, c.GetString("user_id"))
+	if err != nil {
+		revisionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, convertRevision(newRev))
+}
+
+// resolve 解析 endpoint 及 revision 编号, 失败时已写入响应
+func (h *RevisionHandler) resolve(c *gin.Context) (*model.UserEndpoint, int, bool) {
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+		return nil, 0, false
+	}
+
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), c.GetString("org_id"), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
+		return nil, 0, false
+	}
+	return endpoint, revision, true
+}
+
+func revisionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+	case errors.Is(err, service.ErrRolloutInProgress), errors.Is(err, service.ErrRollbackEnvRemoval):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func convertRevision(r *model.EndpointRevision) gin.H {
+	return gin.H{
+		"revision":     r.Revision,
+		"image":        r.Image,
+		"env":          r.Env,
+		"replicas":     r.Replicas,
+		"min_replicas": r.MinReplicas,
+		"max_replicas": r.MaxReplicas,
+		"task_timeout": r.TaskTimeout,
+		"config":       r.Config,
+		"source":       r.Source,
+		"rollback_of":  r.RollbackOf,
+		"author":       r.Author,
+		"created_at":   r.CreatedAt,
+	}
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RolloutHandler struct {
+	rolloutService  *service.RolloutService
+	endpointService *service.EndpointService
+}
+
+func NewRolloutHandler(rolloutService *service.RolloutService, endpointService *service.EndpointService) *RolloutHandler {
+	return &RolloutHandler{rolloutService: rolloutService, endpointService: endpointService}
+}
+
+// CreateRollout 发起镜像发布 (canary 按比例分流, blue_green 就绪后全部切换)
+func (h *RolloutHandler) CreateRollout(c *gin.Context) {
+	var req service.CreateRolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), c.GetString("org_id"), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
+		return
+	}
+
+	r, err := h.rolloutService.Start(c.Request.Context(), endpoint, &req, c.GetString("user_id"))
+	if err != nil {
+		if errors.Is(err, service.ErrRolloutInProgress) || errors.Is(err, service.ErrMigrationInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, convertRollout(r))
+}
+
+// ListRollouts 列出 endpoint 的镜像发布记录
+func (h *RolloutHandler) ListRollouts(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), c.GetString("org_id"), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
+		return
+	}
+
+	rollouts, err := h.rolloutService.List(c.Request.Context(), endpoint.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, len(rollouts))
+	for i := range rollouts {
+		result[i] = convertRollout(&rollouts[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"rollouts": result})
+}
+
+// GetRollout 获取镜像发布进度及新旧版本失败率
+func (h *RolloutHandler) GetRollout(c *gin.Context) {
+	h.handle(c, func(endpoint *model.UserEndpoint, id int64) (*model.EndpointRollout, error) {
+		return h.rolloutService.Get(c.Request.Context(), endpoint.ID, id)
+	})
+}
+
+// UpdateTraffic 调整 canary 发布分流到新版本的比例
+func (h *RolloutHandler) UpdateTraffic(c *gin.Context) {
+	var req struct {
+		TrafficPercent int `json:"traffic_percent" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.handle(c, func(endpoint *model.UserEndpoint, id int64) (*model.EndpointRollout, error) {
+		return h.rolloutService.SetTraffic(c.Request.Context(), endpoint, id, req.TrafficPercent)
+	})
+}
+
+// PromoteRollout 手动全量
+func (h *RolloutHandler) PromoteRollout(c *gin.Context) {
+	h.handle(c, func(endpoint *model.UserEndpoint, id int64) (*model.EndpointRollout, error) {
+		return h.rolloutService.Promote(c.Request.Context(), endpoint, id)
+	})
+}
+
+// RollbackRollout 手动回滚
+func (h *RolloutHandler) RollbackRollout(c *gin.Context) {
+	h.handle(c, func(endpoint *model.UserEndpoint, id int64) (*model.EndpointRollout, error) {
+		return h.rolloutService.Rollback(c.Request.Context(), endpoint, id)
+	})
+}
+
+// handle 解析 endpoint 及发布 ID 后执行 fn, 返回发布详情
+func (h *RolloutHandler) handle(c *gin.Context, fn func(endpoint *model.UserEndpoint, id int64) (*model.EndpointRollout, error)) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rollout id"})
+		return
+	}
+
+	endpoint, err := h.endpointService.GetByLogicalName(c.Request.Context(), c.GetString("org_id"), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "endpoint not found"})
+		return
+	}
+
+	r, err := fn(endpoint, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "rollout not found"})
+		case errors.Is(err, service.ErrRolloutState):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, convertRollout(r))
+}
+
+func convertRollout(r *model.EndpointRollout) gin.H {
+	return gin.H{
+		"id":                     r.ID,
+		"strategy":               r.Strategy,
+		"status":                 r.Status,
+		"reason":                 r.Reason,
+		"image":                  r.Image,
+		"previous_image":         r.PreviousImage,
+		"cluster_id":             r.ClusterID,
+		"canary_physical_name":   r.CanaryPhysicalName,
+		"replicas":               r.Replicas,
+		"traffic_percent":        r.TrafficPercent,
+		"analysis_minutes":       r.AnalysisMinutes,
+		"min_tasks":              r.MinTasks,
+		"max_failure_rate_delta": r.MaxFailureRateDelta,
+		"auto_promote":           r.AutoPromote,
+		"canary": gin.H{
+			"tasks":        r.CanaryTasks,
+			"failed":       r.CanaryFailed,
+			"failure_rate": service.FailureRate(r.CanaryTasks, r.CanaryFailed),
+		},
+		"baseline": gin.H{
+			"tasks":        r.BaselineTasks,
+			"failed":       r.BaselineFailed,
+			"failure_rate": service.FailureRate(r.BaselineTasks, r.BaselineFailed),
+		},
+		"requested_by": r.RequestedBy,
+		"ready_at":     r.ReadyAt,
+		"promoted_at":  r.PromotedAt,
+		"completed_at": r.CompletedAt,
+		"created_at":   r.CreatedAt,
+	}
+}
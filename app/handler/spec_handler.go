@@ -18,10 +18,14 @@ func NewSpecHandler(specService *service.SpecService) *SpecHandler {
 	return &SpecHandler{specService: specService}
 }
 
-// ListSpecs 列出所有可用规格（带集群可用性）
+// ListSpecs 列出所有可用规格（带集群可用性）, 价格为 ?currency= 指定币种, 默认组织计费币种
 func (h *SpecHandler) ListSpecs(c *gin.Context) {
 	specType := c.Query("type")
-	specs, err := h.specService.ListSpecs(c.Request.Context(), specType)
+	currency, ok := h.requestCurrency(c, c.Query("currency"))
+	if !ok {
+		return
+	}
+	specs, err := h.specService.ListSpecs(c.Request.Context(), specType, currency)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -60,7 +64,10 @@ func convertSpecs(specs []mysql.SpecWithAvailability) []map[string]interface{} {
 			"gpu_count":        s.GPUCount,
 			"cpu_cores":        s.CPUCores,
 			"ram_gb":           s.RAMGB,
-			"price_per_hour":   ToUSD(s.PricePerHour),
+			"price_per_hour":   ToDecimal(s.PricePerHour),
+			"spot_price_per_hour": ToDecimal(s.SpotPricePerHour),
+			"task_price_per_second": ToDecimal(s.TaskPricePerSecond),
+			"currency":         s.Currency,
 			"available_clusters": s.AvailableClusters,
 		}
 	}
@@ -85,11 +92,15 @@ func convertSpecPricing(s *model.SpecPricing) map[string]interface{} {
 		"cpu_cores":      s.CPUCores,
 		"ram_gb":         s.RAMGB,
 		"disk_gb":        s.DiskGB,
-		"price_per_hour": ToUSD(s.PricePerHour),
-		"min_price":      ToUSD(s.MinPrice),
-		"max_price":      ToUSD(s.MaxPrice),
+		"price_per_hour": ToDecimal(s.PricePerHour),
+		"spot_price_per_hour": ToDecimal(s.SpotPricePerHour),
+		"task_price_per_second": ToDecimal(s.TaskPricePerSecond),
+		"currency":       s.Currency,
+		"min_price":      ToDecimal(s.MinPrice),
+		"max_price":      ToDecimal(s.MaxPrice),
 		"description":    s.Description,
 		"is_available":   s.IsAvailable,
+		"billing_policy_id": s.BillingPolicyID,
 	}
 }
 
@@ -108,7 +119,7 @@ func (h *SpecHandler) CreateSpec(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "created", "spec": req})
 }
 
-// UpdateSpec 更新规格
+// UpdateSpec 更新规格 (价格修改只影响新建 endpoint, 已有 endpoint 调价使用计划调价)
 func (h *SpecHandler) UpdateSpec(c *gin.Context) {
 	var req struct {
 		ID                  int64   `json:"id" binding:"required"`
@@ -120,8 +131,11 @@ func (h *SpecHandler) UpdateSpec(c *gin.Context) {
 		RAMGB        int     `json:"ram_gb"`
 		DiskGB       int     `json:"disk_gb"`
 		PricePerHour float64 `json:"price_per_hour"`
+		SpotPricePerHour *float64 `json:"spot_price_per_hour"` // 0 表示取消 spot 档位
+		TaskPricePerSecond *float64 `json:"task_price_per_second"` // 0 表示取消按任务计费
 		Description  string  `json:"description"`
 		IsAvailable  *bool   `json:"is_available"`
+		BillingPolicyID *int64 `json:"billing_policy_id"` // 0 表示恢复默认策略
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -135,9 +149,30 @@ func (h *SpecHandler) UpdateSpec(c *gin.Context) {
 	if req.CPUCores > 0 { updates["cpu_cores"] = req.CPUCores }
 	if req.RAMGB > 0 { updates["ram_gb"] = req.RAMGB }
 	if req.DiskGB > 0 { updates["disk_gb"] = req.DiskGB }
-	if req.PricePerHour > 0 { updates["price_per_hour"] = FromUSD(req.PricePerHour) }
+	if req.PricePerHour > 0 { updates["price_per_hour"] = FromDecimal(req.PricePerHour) }
+	if req.SpotPricePerHour != nil {
+		if *req.SpotPricePerHour < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "spot_price_per_hour must not be negative"})
+			return
+		}
+		updates["spot_price_per_hour"] = FromDecimal(*req.SpotPricePerHour)
+	}
+	if req.TaskPricePerSecond != nil {
+		if *req.TaskPricePerSecond < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "task_price_per_second must not be negative"})
+			return
+		}
+		updates["task_price_per_second"] = FromDecimal(*req.TaskPricePerSecond)
+	}
 	if req.Description != "" { updates["description"] = req.Description }
 	if req.IsAvailable != nil { updates["is_available"] = *req.IsAvailable }
+	if req.BillingPolicyID != nil {
+		if *req.BillingPolicyID > 0 {
+			updates["billing_policy_id"] = *req.BillingPolicyID
+		} else {
+			updates["billing_policy_id"] = nil
+		}
+	}
 
 	if err := h.specService.UpdateSpec(c.Request.Context(), req.ID, updates); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -162,24 +197,47 @@ func (h *SpecHandler) DeleteSpec(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
 }
 
-// EstimateCost 估算成本
+// EstimateCost 估算成本 (currency 为空时按组织计费币种)
 func (h *SpecHandler) EstimateCost(c *gin.Context) {
 	var req struct {
 		SpecName string  `json:"spec_name" binding:"required"`
 		Hours    float64 `json:"hours" binding:"required"`
 		Replicas int     `json:"replicas" binding:"required"`
+		Currency string  `json:"currency"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	cost, err := h.specService.EstimateCost(c.Request.Context(), req.SpecName, req.Hours, req.Replicas)
+	currency, ok := h.requestCurrency(c, req.Currency)
+	if !ok {
+		return
+	}
+	cost, currency, err := h.specService.EstimateCost(c.Request.Context(), req.SpecName, currency, req.Hours, req.Replicas)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"spec_name": req.SpecName, "hours": req.Hours, "replicas": req.Replicas,
-		"estimated_cost": cost, "currency": "USD",
+		"estimated_cost": cost, "currency": currency,
 	})
 }
+
+// requestCurrency 请求指定的币种, 为空时使用组织计费币种
+func (h *SpecHandler) requestCurrency(c *gin.Context, currency string) (string, bool) {
+	var err error
+	if currency == "" {
+		currency, err = h.specService.OrgCurrency(c.Request.Context(), c.GetString("org_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return "", false
+		}
+		return currency, true
+	}
+	if currency, err = service.NormalizeCurrency(currency); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return currency, true
+}
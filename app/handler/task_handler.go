@@ -64,10 +64,10 @@ func (h *TaskHandler) SubmitTaskSync(c *gin.Context) {
 
 // GetTaskStatus 获取任务状态
 func (h *TaskHandler) GetTaskStatus(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	taskID := c.Param("task_id")
 
-	resp, err := h.taskService.GetTaskStatus(c.Request.Context(), userID, taskID)
+	resp, err := h.taskService.GetTaskStatus(c.Request.Context(), orgID, taskID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -78,10 +78,10 @@ func (h *TaskHandler) GetTaskStatus(c *gin.Context) {
 
 // CancelTask 取消任务
 func (h *TaskHandler) CancelTask(c *gin.Context) {
-	userID := c.GetString("user_id")
+	orgID := c.GetString("org_id")
 	taskID := c.Param("task_id")
 
-	if err := h.taskService.CancelTask(c.Request.Context(), userID, taskID); err != nil {
+	if err := h.taskService.CancelTask(c.Request.Context(), orgID, taskID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
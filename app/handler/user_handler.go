@@ -68,6 +68,6 @@ func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 		"user_type":   userType,
 		"is_admin":    userType == "admin",
 		"permissions": user.Permissions,
-		"balance":     ToUSD(balance),
+		"balance":     ToDecimal(balance),
 	})
 }
@@ -1,11 +1,13 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/wavespeedai/waverless-portal/internal/service"
 	"github.com/wavespeedai/waverless-portal/pkg/config"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 	"github.com/wavespeedai/waverless-portal/pkg/wavespeed"
 
 	"github.com/gin-gonic/gin"
@@ -153,3 +155,36 @@ func APIKeyOrJWTAuth(userService *service.UserService) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// OrgAuth 组织成员认证中间件 (需在 JWT/API Key 认证之后), 设置 org_role 及 org_member;
+// 主站组织 owner/admin 首次访问时按主站角色加入 (API Key 不携带主站角色)
+func OrgAuth(orgService *service.OrgService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		member, err := orgService.Authorize(c.Request.Context(), c.GetString("org_id"), c.GetString("user_id"), c.GetString("email"), c.GetString("role"))
+		if err != nil {
+			if errors.Is(err, service.ErrNotOrgMember) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set("org_role", member.Role)
+		c.Set("org_member", member)
+		c.Next()
+	}
+}
+
+// RequireOrgRole 要求组织角色不低于 role
+func RequireOrgRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if model.OrgRoleLevel(c.GetString("org_role")) < model.OrgRoleLevel(role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "requires organization role " + role})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/wavespeedai/waverless-portal/app/handler"
 	"github.com/wavespeedai/waverless-portal/app/middleware"
 	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/metrics"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,7 +20,19 @@ type Router struct {
 	monitoringHandler         *handler.MonitoringHandler
 	userHandler               *handler.UserHandler
 	registryCredentialHandler *handler.RegistryCredentialHandler
+	preferencesHandler        *handler.PreferencesHandler
+	pricingHandler            *handler.PricingHandler
+	invoiceHandler            *handler.InvoiceHandler
+	commitmentHandler         *handler.CommitmentHandler
+	orgHandler                *handler.OrgHandler
+	ledgerExportHandler       *handler.LedgerExportHandler
+	currencyHandler           *handler.CurrencyHandler
+	migrationHandler          *handler.MigrationHandler
+	rolloutHandler            *handler.RolloutHandler
+	revisionHandler           *handler.RevisionHandler
+	manifestHandler           *handler.ManifestHandler
 	userService               *service.UserService
+	orgService                *service.OrgService
 }
 
 func NewRouter(
@@ -31,7 +45,19 @@ func NewRouter(
 	monitoringHandler *handler.MonitoringHandler,
 	userHandler *handler.UserHandler,
 	registryCredentialHandler *handler.RegistryCredentialHandler,
+	preferencesHandler *handler.PreferencesHandler,
+	pricingHandler *handler.PricingHandler,
+	invoiceHandler *handler.InvoiceHandler,
+	commitmentHandler *handler.CommitmentHandler,
+	orgHandler *handler.OrgHandler,
+	ledgerExportHandler *handler.LedgerExportHandler,
+	currencyHandler *handler.CurrencyHandler,
+	migrationHandler *handler.MigrationHandler,
+	rolloutHandler *handler.RolloutHandler,
+	revisionHandler *handler.RevisionHandler,
+	manifestHandler *handler.ManifestHandler,
 	userService *service.UserService,
+	orgService *service.OrgService,
 ) *Router {
 	return &Router{
 		specHandler:               specHandler,
@@ -43,7 +69,19 @@ func NewRouter(
 		monitoringHandler:         monitoringHandler,
 		userHandler:               userHandler,
 		registryCredentialHandler: registryCredentialHandler,
+		preferencesHandler:        preferencesHandler,
+		pricingHandler:            pricingHandler,
+		invoiceHandler:            invoiceHandler,
+		commitmentHandler:         commitmentHandler,
+		orgHandler:                orgHandler,
+		ledgerExportHandler:       ledgerExportHandler,
+		currencyHandler:           currencyHandler,
+		migrationHandler:          migrationHandler,
+		rolloutHandler:            rolloutHandler,
+		revisionHandler:           revisionHandler,
+		manifestHandler:           manifestHandler,
 		userService:               userService,
+		orgService:                orgService,
 	}
 }
 
@@ -57,17 +95,22 @@ func (r *Router) Setup(engine *gin.Engine) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// 组织角色要求: 查看需成员身份 (OrgAuth), 修改 endpoint/任务/凭证需 developer, 管理成员需 admin, 修改计费币种需 owner
+	developer := middleware.RequireOrgRole(model.OrgRoleDeveloper)
+	orgAdmin := middleware.RequireOrgRole(model.OrgRoleAdmin)
+	orgOwner := middleware.RequireOrgRole(model.OrgRoleOwner)
+
 	// V1 API - 任务提交接口 (支持 API Key 或 JWT)
 	v1 := engine.Group("/v1")
-	v1.Use(middleware.APIKeyOrJWTAuth(r.userService))
+	v1.Use(middleware.APIKeyOrJWTAuth(r.userService), middleware.OrgAuth(r.orgService))
 	{
 		v1.GET("/status/:task_id", r.taskHandler.GetTaskStatus)
-		v1.POST("/cancel/:task_id", r.taskHandler.CancelTask)
+		v1.POST("/cancel/:task_id", developer, r.taskHandler.CancelTask)
 
 		endpoint := v1.Group("/:endpoint")
 		{
-			endpoint.POST("/run", r.taskHandler.SubmitTask)
-			endpoint.POST("/runsync", r.taskHandler.SubmitTaskSync)
+			endpoint.POST("/run", developer, r.taskHandler.SubmitTask)
+			endpoint.POST("/runsync", developer, r.taskHandler.SubmitTaskSync)
 		}
 	}
 
@@ -84,8 +127,22 @@ func (r *Router) Setup(engine *gin.Engine) {
 
 		// 需要认证的接口
 		auth := api.Group("")
-		auth.Use(middleware.JWTAuthWithUserService(r.userService))
+		auth.Use(middleware.JWTAuthWithUserService(r.userService), middleware.OrgAuth(r.orgService))
 		{
+			// 组织成员管理
+			org := auth.Group("/org")
+			{
+				org.GET("/membership", r.orgHandler.GetMembership)
+				org.GET("/members", r.orgHandler.ListMembers)
+				org.POST("/members", orgAdmin, r.orgHandler.AddMember)
+				org.PUT("/members/:user_id", orgAdmin, r.orgHandler.UpdateMemberRole)
+				org.DELETE("/members/:user_id", orgAdmin, r.orgHandler.RemoveMember)
+
+				// 组织计费币种
+				org.GET("/billing-currency", r.currencyHandler.GetBillingCurrency)
+				org.PUT("/billing-currency", orgOwner, r.currencyHandler.SetBillingCurrency)
+			}
+
 			// 全局任务查询
 			if r.monitoringHandler != nil {
 				auth.GET("/tasks", r.monitoringHandler.GetAllTasks)
@@ -94,20 +151,47 @@ func (r *Router) Setup(engine *gin.Engine) {
 				auth.GET("/tasks/:task_id/execution-history", r.monitoringHandler.GetTaskExecutionHistory)
 			}
 
+			// 声明式 endpoint 清单 (YAML/JSON)
+			manifests := auth.Group("/manifests")
+			{
+				manifests.POST("/plan", r.manifestHandler.PlanManifest)
+				manifests.POST("/apply", developer, r.manifestHandler.ApplyManifest)
+			}
+
 			// Endpoint 管理
 			endpoints := auth.Group("/endpoints")
 			{
-				endpoints.POST("", r.endpointHandler.CreateEndpoint)
+				endpoints.POST("", developer, r.endpointHandler.CreateEndpoint)
 				endpoints.GET("", r.endpointHandler.ListEndpoints)
 				endpoints.GET("/:name", r.endpointHandler.GetEndpoint)
-				endpoints.PUT("/:name", r.endpointHandler.UpdateEndpoint)
-				endpoints.PUT("/:name/config", r.endpointHandler.UpdateEndpointConfig)
-				endpoints.DELETE("/:name", r.endpointHandler.DeleteEndpoint)
+				endpoints.PUT("/:name", developer, r.endpointHandler.UpdateEndpoint)
+				endpoints.PUT("/:name/config", developer, r.endpointHandler.UpdateEndpointConfig)
+				endpoints.DELETE("/:name", developer, r.endpointHandler.DeleteEndpoint)
+				endpoints.POST("/:name/cost-simulation", r.endpointHandler.SimulateCost)
+
+				// 跨集群迁移
+				endpoints.POST("/:name/migrations", developer, r.migrationHandler.CreateMigration)
+				endpoints.GET("/:name/migrations", r.migrationHandler.ListMigrations)
+				endpoints.POST("/:name/migrations/:id/cancel", developer, r.migrationHandler.CancelMigration)
+
+				// 镜像发布 (canary / blue_green)
+				endpoints.POST("/:name/rollouts", developer, r.rolloutHandler.CreateRollout)
+				endpoints.GET("/:name/rollouts", r.rolloutHandler.ListRollouts)
+				endpoints.GET("/:name/rollouts/:id", r.rolloutHandler.GetRollout)
+				endpoints.PUT("/:name/rollouts/:id/traffic", developer, r.rolloutHandler.UpdateTraffic)
+				endpoints.POST("/:name/rollouts/:id/promote", developer, r.rolloutHandler.PromoteRollout)
+				endpoints.POST("/:name/rollouts/:id/rollback", developer, r.rolloutHandler.RollbackRollout)
+
+				// 配置历史及回滚
+				endpoints.GET("/:name/revisions", r.revisionHandler.ListRevisions)
+				endpoints.GET("/:name/revisions/:revision", r.revisionHandler.GetRevision)
+				endpoints.GET("/:name/revisions/:revision/diff", r.revisionHandler.DiffRevision)
+				endpoints.POST("/:name/revisions/:revision/rollback", developer, r.revisionHandler.RollbackRevision)
 
 				// Endpoint 监控
 				if r.monitoringHandler != nil {
 					endpoints.GET("/:name/workers", r.monitoringHandler.GetEndpointWorkers)
-					endpoints.GET("/:name/workers/exec", r.monitoringHandler.ExecWorker)
+					endpoints.GET("/:name/workers/exec", developer, r.monitoringHandler.ExecWorker)
 					endpoints.GET("/:name/logs", r.monitoringHandler.GetWorkerLogs)
 					endpoints.GET("/:name/tasks", r.monitoringHandler.GetWorkerTasks)
 					endpoints.GET("/:name/metrics", r.monitoringHandler.GetEndpointMetrics)
@@ -122,15 +206,42 @@ func (r *Router) Setup(engine *gin.Engine) {
 			{
 				billing.GET("/balance", r.billingHandler.GetBalance)
 				billing.GET("/usage", r.billingHandler.GetUsage)
+				billing.GET("/usage/tags", r.billingHandler.GetUsageByTag)
+				billing.GET("/usage/breakdown", r.billingHandler.GetUsageBreakdown)
+				billing.GET("/usage/timeseries", r.billingHandler.GetUsageTimeSeries)
 				billing.GET("/workers", r.billingHandler.GetWorkerRecords)
+				billing.GET("/budget", r.preferencesHandler.GetBudget)
+				billing.GET("/runway", r.billingHandler.GetRunway)
+
+				// 月度账单
+				billing.GET("/invoices", r.invoiceHandler.ListInvoices)
+				billing.GET("/invoices/:id", r.invoiceHandler.GetInvoice)
+				billing.GET("/invoices/:id/csv", r.invoiceHandler.DownloadInvoiceCSV)
+				billing.GET("/invoices/:id/pdf", r.invoiceHandler.DownloadInvoicePDF)
+
+				// 预留容量承诺使用情况
+				billing.GET("/commitments", r.commitmentHandler.ListCommitments)
+				billing.GET("/commitments/:id/usages", r.commitmentHandler.ListCommitmentUsages)
+
+				// 计划调价通知与价格历史
+				billing.GET("/price-changes", r.pricingHandler.ListUpcomingPriceChanges)
+				billing.GET("/price-history", r.pricingHandler.ListPriceHistory)
+			}
+
+			// 用户偏好 (预算控制)
+			preferences := auth.Group("/preferences")
+			{
+				preferences.GET("", r.preferencesHandler.GetPreferences)
+				preferences.PUT("", r.preferencesHandler.UpdatePreferences)
+				preferences.DELETE("", r.preferencesHandler.DeletePreferences)
 			}
 
 			// Registry 凭证管理
 			credentials := auth.Group("/registry-credentials")
 			{
-				credentials.POST("", r.registryCredentialHandler.Create)
+				credentials.POST("", developer, r.registryCredentialHandler.Create)
 				credentials.GET("", r.registryCredentialHandler.List)
-				credentials.DELETE("/:name", r.registryCredentialHandler.Delete)
+				credentials.DELETE("/:name", developer, r.registryCredentialHandler.Delete)
 			}
 		}
 
@@ -146,6 +257,9 @@ func (r *Router) Setup(engine *gin.Engine) {
 		admin.Use(middleware.JWTAuthWithUserService(r.userService))
 		admin.Use(middleware.AdminAuth())
 		{
+			// Prometheus 指标 (后台任务、出账、MQ、waverless 调用), 包含计费金额及组织/集群 ID, 仅管理员可访问
+			admin.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 			admin.GET("/clusters", r.clusterHandler.ListClusters)
 			admin.GET("/clusters/:id", r.clusterHandler.GetCluster)
 			admin.GET("/clusters/:id/specs", r.clusterHandler.GetClusterSpecs)
@@ -161,6 +275,44 @@ func (r *Router) Setup(engine *gin.Engine) {
 			admin.POST("/specs", r.specHandler.CreateSpec)
 			admin.PUT("/specs", r.specHandler.UpdateSpec)
 			admin.DELETE("/specs", r.specHandler.DeleteSpec)
+
+			// 集群覆盖价格
+			admin.GET("/pricing-overrides", r.pricingHandler.ListOverrides)
+			admin.POST("/pricing-overrides", r.pricingHandler.CreateOverride)
+			admin.PUT("/pricing-overrides/:id", r.pricingHandler.UpdateOverride)
+			admin.DELETE("/pricing-overrides/:id", r.pricingHandler.DeleteOverride)
+
+			// 计费策略 (修改即生成新版本)
+			admin.GET("/billing-policies", r.pricingHandler.ListBillingPolicies)
+			admin.POST("/billing-policies", r.pricingHandler.CreateBillingPolicy)
+			admin.PUT("/billing-policies/:id", r.pricingHandler.UpdateBillingPolicy)
+
+			// 计划调价 (提前通知, 生效时迁移已有 endpoint)
+			admin.GET("/price-changes", r.pricingHandler.ListPriceChanges)
+			admin.POST("/price-changes", r.pricingHandler.SchedulePriceChange)
+			admin.DELETE("/price-changes/:id", r.pricingHandler.CancelPriceChange)
+
+			// 调账 (退款/补扣)
+			admin.GET("/billing/adjustments", r.billingHandler.ListAdjustments)
+			admin.POST("/billing/adjustments", r.billingHandler.CreateAdjustments)
+
+			// 预留容量承诺
+			admin.GET("/commitments", r.commitmentHandler.AdminListCommitments)
+			admin.POST("/commitments", r.commitmentHandler.CreateCommitment)
+			admin.DELETE("/commitments/:id", r.commitmentHandler.CancelCommitment)
+			admin.GET("/commitments/:id/usages", r.commitmentHandler.AdminListCommitmentUsages)
+
+			// 计费流水导出 (按天分区, day 格式 YYYY-MM-DD)
+			admin.GET("/ledger-exports", r.ledgerExportHandler.ListExports)
+			admin.GET("/ledger-exports/:day", r.ledgerExportHandler.GetExport)
+			admin.POST("/ledger-exports/:day/rerun", r.ledgerExportHandler.RerunExport)
+
+			// 汇率及规格多币种标价
+			admin.GET("/exchange-rates", r.currencyHandler.ListExchangeRates)
+			admin.POST("/exchange-rates", r.currencyHandler.CreateExchangeRate)
+			admin.GET("/specs/:name/prices", r.currencyHandler.ListSpecPrices)
+			admin.PUT("/specs/:name/prices/:currency", r.currencyHandler.SetSpecPrice)
+			admin.DELETE("/specs/:name/prices/:currency", r.currencyHandler.DeleteSpecPrice)
 		}
 	}
 }
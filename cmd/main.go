@@ -13,8 +13,10 @@ import (
 	"github.com/wavespeedai/waverless-portal/app/router"
 	"github.com/wavespeedai/waverless-portal/internal/jobs"
 	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/archive"
 	"github.com/wavespeedai/waverless-portal/pkg/config"
 	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/metrics"
 	"github.com/wavespeedai/waverless-portal/pkg/rocketmq"
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
 	"github.com/wavespeedai/waverless-portal/pkg/store/redis"
@@ -63,25 +65,74 @@ func main() {
 	workerRepo := mysql.NewWorkerRepo(mysqlRepo.DB)
 	taskRepo := mysql.NewTaskRepo(mysqlRepo.DB)
 	registryCredentialRepo := mysql.NewRegistryCredentialRepo(mysqlRepo.DB)
+	preferencesRepo := mysql.NewPreferencesRepo(mysqlRepo.DB)
+	pricingRepo := mysql.NewPricingRepo(mysqlRepo.DB)
+	invoiceRepo := mysql.NewInvoiceRepo(mysqlRepo.DB)
+	runwayRepo := mysql.NewRunwayRepo(mysqlRepo.DB)
+	billingPolicyRepo := mysql.NewBillingPolicyRepo(mysqlRepo.DB)
+	retentionRepo := mysql.NewRetentionRepo(mysqlRepo.DB)
+	commitmentRepo := mysql.NewCommitmentRepo(mysqlRepo.DB)
+	priceChangeRepo := mysql.NewPriceChangeRepo(mysqlRepo.DB)
+	orgMemberRepo := mysql.NewOrgMemberRepo(mysqlRepo.DB)
+	ledgerExportRepo := mysql.NewLedgerExportRepo(mysqlRepo.DB)
+	currencyRepo := mysql.NewCurrencyRepo(mysqlRepo.DB)
+	placementRepo := mysql.NewPlacementRepo(mysqlRepo.DB)
+	migrationRepo := mysql.NewMigrationRepo(mysqlRepo.DB)
+	rolloutRepo := mysql.NewRolloutRepo(mysqlRepo.DB)
+	revisionRepo := mysql.NewRevisionRepo(mysqlRepo.DB)
 
 	// Services
 	userService := service.NewUserService(userRepo)
+	orgService := service.NewOrgService(orgMemberRepo, userRepo)
 	clusterService := service.NewClusterService(clusterRepo)
-	endpointService := service.NewEndpointService(endpointRepo, clusterRepo, specRepo, registryCredentialRepo, clusterService)
-	taskService := service.NewTaskService(taskRepo, endpointService, clusterService)
-	specService := service.NewSpecService(specRepo)
-	billingService := service.NewBillingService(billingRepo, userRepo, endpointRepo)
+	currencyService := service.NewCurrencyService(currencyRepo, specRepo)
+	pricingService := service.NewPricingService(pricingRepo, clusterRepo, specRepo, currencyService)
+	commitmentService := service.NewCommitmentService(commitmentRepo, specRepo, currencyService)
+	endpointService := service.NewEndpointService(endpointRepo, clusterRepo, specRepo, registryCredentialRepo, clusterService, pricingService, commitmentService, currencyService, placementRepo)
+	revisionService := service.NewRevisionService(revisionRepo, endpointRepo, rolloutRepo, endpointService)
+	manifestService := service.NewManifestService(endpointService, revisionService, rolloutRepo, registryCredentialRepo)
+	rolloutService := service.NewRolloutService(rolloutRepo, endpointRepo, taskRepo, migrationRepo, endpointService, clusterService, revisionService)
+	taskService := service.NewTaskService(taskRepo, endpointService, clusterService, rolloutService)
+	specService := service.NewSpecService(specRepo, currencyService)
+	billingService := service.NewBillingService(billingRepo, userRepo, endpointRepo, currencyService)
+	budgetService := service.NewBudgetService(preferencesRepo, billingRepo, endpointRepo, endpointService, currencyService)
+	invoiceService := service.NewInvoiceService(invoiceRepo, currencyService)
+	runwayService := service.NewRunwayService(runwayRepo, workerRepo, endpointRepo, preferencesRepo, endpointService, pricingService, currencyService)
+	billingPolicyService := service.NewBillingPolicyService(billingPolicyRepo, specRepo)
+	priceChangeService := service.NewPriceChangeService(priceChangeRepo, specRepo, currencyService)
+	costSimulatorService := service.NewCostSimulatorService(workerRepo, taskRepo, billingRepo, specRepo, billingPolicyService, currencyService)
+	migrationService := service.NewMigrationService(migrationRepo, endpointRepo, placementRepo, clusterRepo, taskRepo, preferencesRepo, rolloutRepo, endpointService, clusterService, pricingService)
+
+	// 计费流水导出存储 (未启用或初始化失败时只能查询导出状态)
+	var ledgerStorage archive.Storage
+	if config.GlobalConfig.Billing.LedgerExport.Enabled {
+		if ledgerStorage, err = archive.NewStorage(&config.GlobalConfig.Billing.LedgerExport.Target); err != nil {
+			logger.Errorf("Failed to init ledger export storage, ledger export disabled: %v", err)
+		}
+	}
+	ledgerExportService := service.NewLedgerExportService(ledgerExportRepo, ledgerStorage)
 
 	// Handlers
 	specHandler := handler.NewSpecHandler(specService)
-	endpointHandler := handler.NewEndpointHandler(endpointService, userService)
+	endpointHandler := handler.NewEndpointHandler(endpointService, userService, budgetService, costSimulatorService, revisionService, rolloutService)
 	taskHandler := handler.NewTaskHandler(taskService)
-	billingHandler := handler.NewBillingHandler(billingService, userService)
+	billingHandler := handler.NewBillingHandler(billingService, userService, runwayService)
 	clusterHandler := handler.NewClusterHandler(clusterService)
 	webhookHandler := handler.NewWebhookHandler(billingService)
 	monitoringHandler := handler.NewMonitoringHandler(endpointService, clusterService, taskRepo, workerRepo, nil)
 	userHandler := handler.NewUserHandler(userService)
 	registryCredentialHandler := handler.NewRegistryCredentialHandler(registryCredentialRepo)
+	preferencesHandler := handler.NewPreferencesHandler(budgetService, currencyService)
+	pricingHandler := handler.NewPricingHandler(pricingService, billingPolicyService, priceChangeService)
+	invoiceHandler := handler.NewInvoiceHandler(invoiceService)
+	commitmentHandler := handler.NewCommitmentHandler(commitmentService)
+	orgHandler := handler.NewOrgHandler(orgService)
+	ledgerExportHandler := handler.NewLedgerExportHandler(ledgerExportService)
+	currencyHandler := handler.NewCurrencyHandler(currencyService)
+	migrationHandler := handler.NewMigrationHandler(migrationService, endpointService)
+	rolloutHandler := handler.NewRolloutHandler(rolloutService, endpointService)
+	revisionHandler := handler.NewRevisionHandler(revisionService, endpointService, budgetService)
+	manifestHandler := handler.NewManifestHandler(manifestService, budgetService)
 
 	// Router
 	r := router.NewRouter(
@@ -94,7 +145,19 @@ func main() {
 		monitoringHandler,
 		userHandler,
 		registryCredentialHandler,
+		preferencesHandler,
+		pricingHandler,
+		invoiceHandler,
+		commitmentHandler,
+		orgHandler,
+		ledgerExportHandler,
+		currencyHandler,
+		migrationHandler,
+		rolloutHandler,
+		revisionHandler,
+		manifestHandler,
 		userService,
+		orgService,
 	)
 
 	if config.GlobalConfig.Server.Mode == "release" {
@@ -104,11 +167,11 @@ func main() {
 	r.Setup(engine)
 
 	// Background jobs
-	jobsManager := jobs.NewManager(billingService, clusterService)
+	jobsManager := jobs.NewManager(billingService, clusterService, endpointService)
 	jobsManager.Start()
 
 	// Endpoint sync service
-	endpointSyncService := jobs.NewEndpointSyncService(endpointRepo, clusterService, endpointService)
+	endpointSyncService := jobs.NewEndpointSyncService(endpointRepo, placementRepo, clusterService, endpointService)
 	endpointSyncService.Start()
 
 	// Worker sync job
@@ -120,17 +183,43 @@ func main() {
 	go metricsSyncJob.Start(context.Background())
 
 	// Task sync job
-	taskSyncJob := jobs.NewTaskSyncJob(mysqlRepo.DB, clusterService, endpointService)
+	taskSyncJob := jobs.NewTaskSyncJob(mysqlRepo.DB, clusterService, endpointService, taskRepo, endpointRepo)
 	go taskSyncJob.Start(context.Background())
 
 	// Billing job
-	billingJob := jobs.NewBillingJob(mysqlRepo.DB, workerRepo, billingRepo, endpointRepo, endpointService)
+	billingJob := jobs.NewBillingJob(mysqlRepo.DB, workerRepo, billingRepo, endpointRepo, endpointService, budgetService, pricingService, runwayService, billingPolicyService, priceChangeService)
 	go billingJob.Start(context.Background())
 
-	// Cleanup job (delete data older than 7 days)
-	cleanupJob := jobs.NewCleanupJob(mysqlRepo.DB)
+	// Billing outbox dispatcher (投递计费 MQ 消息)
+	billingOutboxDispatcher := jobs.NewBillingOutboxDispatcher(billingRepo)
+	go billingOutboxDispatcher.Start(context.Background())
+
+	// Invoice job (刷新当月草稿账单, 月初关账上月账单)
+	invoiceJob := jobs.NewInvoiceJob(invoiceService)
+	go invoiceJob.Start(context.Background())
+
+	// Cleanup job (按表保留策略归档并删除过期数据)
+	archiveStorage, err := archive.NewStorage(&config.GlobalConfig.Retention.Archive)
+	if err != nil {
+		logger.Errorf("Failed to init archive storage, tables requiring archive will not be cleaned: %v", err)
+	}
+	cleanupJob := jobs.NewCleanupJob(retentionRepo, archiveStorage)
 	go cleanupJob.Start(context.Background())
 
+	// Ledger export job (按天增量导出计费流水到本地目录或 S3)
+	if ledgerStorage != nil {
+		ledgerExportJob := jobs.NewLedgerExportJob(ledgerExportService)
+		go ledgerExportJob.Start(context.Background())
+	}
+
+	// Migration job (推进 endpoint 跨集群迁移, 按用户偏好自动发起迁移)
+	migrationJob := jobs.NewMigrationJob(migrationService)
+	go migrationJob.Start(context.Background())
+
+	// Rollout job (推进镜像发布, 按失败率自动全量或回滚)
+	rolloutJob := jobs.NewRolloutJob(rolloutService)
+	go rolloutJob.Start(context.Background())
+
 	// Update monitoringHandler with workerSyncJob
 	monitoringHandler.SetWorkerSyncJob(workerSyncJob)
 
@@ -146,6 +235,23 @@ func main() {
 		}
 	}()
 
+	// Prometheus 指标单独监听内部端口, 供集群内抓取 (不经过公网入口)
+	var metricsServer *http.Server
+	if port := config.GlobalConfig.Server.MetricsPort; port > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", config.GlobalConfig.Server.Host, port),
+			Handler: mux,
+		}
+		go func() {
+			logger.Infof("Metrics server listening on %s", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Errorf("Metrics server error: %v", err)
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -160,6 +266,11 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Errorf("Server shutdown error: %v", err)
 	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			logger.Errorf("Metrics server shutdown error: %v", err)
+		}
+	}
 
 	jobsManager.Wait()
 	logger.Infof("Server stopped")
@@ -2,34 +2,47 @@ package jobs
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"time"
 
 	"github.com/wavespeedai/waverless-portal/internal/service"
 	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/metrics"
 	"github.com/wavespeedai/waverless-portal/pkg/rocketmq"
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
-	"github.com/wavespeedai/waverless-portal/pkg/wavespeed"
 	"gorm.io/gorm"
 )
 
+// coldStartWaitGrace 冷启动免费时长之外等待 worker 上报就绪的宽限时间, 超时后不再等待按正常时长计费
+const coldStartWaitGrace = 5 * time.Minute
+
 type BillingJob struct {
 	db              *gorm.DB
 	workerRepo      *mysql.WorkerRepo
 	billingRepo     *mysql.BillingRepo
 	endpointRepo    *mysql.EndpointRepo
 	endpointService *service.EndpointService
+	budgetService   *service.BudgetService
+	pricingService  *service.PricingService
+	runwayService   *service.RunwayService
+	policyService   *service.BillingPolicyService
+	priceChanges    *service.PriceChangeService
 	interval        time.Duration
 }
 
-func NewBillingJob(db *gorm.DB, workerRepo *mysql.WorkerRepo, billingRepo *mysql.BillingRepo, endpointRepo *mysql.EndpointRepo, endpointService *service.EndpointService) *BillingJob {
+func NewBillingJob(db *gorm.DB, workerRepo *mysql.WorkerRepo, billingRepo *mysql.BillingRepo, endpointRepo *mysql.EndpointRepo, endpointService *service.EndpointService, budgetService *service.BudgetService, pricingService *service.PricingService, runwayService *service.RunwayService, policyService *service.BillingPolicyService, priceChanges *service.PriceChangeService) *BillingJob {
 	return &BillingJob{
 		db:              db,
 		workerRepo:      workerRepo,
 		billingRepo:     billingRepo,
 		endpointRepo:    endpointRepo,
 		endpointService: endpointService,
+		budgetService:   budgetService,
+		pricingService:  pricingService,
+		runwayService:   runwayService,
+		policyService:   policyService,
+		priceChanges:    priceChanges,
 		interval:        60 * time.Second,
 	}
 }
@@ -51,24 +64,71 @@ func (j *BillingJob) Start(ctx context.Context) {
 }
 
 func (j *BillingJob) run(ctx context.Context) {
+	run := metrics.StartBillingRun("billing")
+	defer run.Done()
+
+	// 先应用已到生效时间的计划调价, 保证本轮拆分时段时价格历史完整
+	if j.priceChanges != nil {
+		j.priceChanges.ApplyDue(ctx)
+	}
+
 	workers, err := j.workerRepo.GetBillableWorkers(ctx)
 	if err != nil {
+		run.Error()
 		logger.ErrorCtx(ctx, "[BillingJob] GetBillableWorkers error: %v", err)
 		return
 	}
 
 	logger.InfoCtx(ctx, "[BillingJob] found %d billable workers", len(workers))
+	run.Processed(len(workers))
 
+	users := make(map[string]bool)
+	orgs := make(map[string]bool)
 	for _, worker := range workers {
-		j.processWorker(ctx, &worker)
+		if orgID := j.processWorker(ctx, run, &worker); orgID != "" {
+			orgs[orgID] = true
+		}
+		users[worker.UserID] = true
+	}
+
+	// 有运行中 endpoint 的组织 (含本轮计费的组织) 预测余额, 余额不足时按宽限策略停机
+	if j.runwayService != nil {
+		j.runwayService.CheckAll(ctx, orgs)
+	}
+
+	// 本轮有计费的用户检查日/月预算
+	if j.budgetService != nil {
+		for userID := range users {
+			j.budgetService.Enforce(ctx, userID)
+		}
 	}
 }
 
-func (j *BillingJob) processWorker(ctx context.Context, worker *model.Worker) {
+// recoverDuplicate 时段已有流水时不重复计费; 若 worker 的出账时间未随流水推进 (出账中途失败的遗留数据),
+// 仅将 last_billed_at 推进到已有流水的结束时间, 其余时长下一轮正常计费
+func (j *BillingJob) recoverDuplicate(ctx context.Context, worker *model.Worker, deductStart, deductEnd time.Time, terminated bool) {
+	billedEnd, err := j.billingRepo.GetLastPeriodEnd(ctx, worker.WorkerID)
+	if err != nil || billedEnd == nil || !billedEnd.After(deductStart) {
+		return
+	}
+	final := terminated && !billedEnd.Before(deductEnd)
+	advanced, err := j.workerRepo.AdvanceBilledAt(ctx, worker.WorkerID, worker.LastBilledAt, *billedEnd, final)
+	if err != nil {
+		logger.ErrorCtx(ctx, "[BillingJob] advance billed_at for worker %s error: %v", worker.WorkerID, err)
+		return
+	}
+	if advanced {
+		logger.WarnCtx(ctx, "[BillingJob] worker %s last_billed_at advanced to existing transactions end %v", worker.WorkerID, *billedEnd)
+	}
+}
+
+// processWorker 计费单个 worker, 返回运行中 worker 所属组织 (未计费或已终止时返回空)
+func (j *BillingJob) processWorker(ctx context.Context, run *metrics.JobRun, worker *model.Worker) string {
 	// 边界检查: pod_started_at 必须有值才能计费
 	if worker.PodStartedAt == nil {
+		run.Error()
 		logger.ErrorCtx(ctx, "[BillingJob] worker %s has no pod_started_at, skip", worker.WorkerID)
-		return
+		return ""
 	}
 
 	// 计算扣费时间段
@@ -94,8 +154,17 @@ func (j *BillingJob) processWorker(ctx context.Context, worker *model.Worker) {
 
 	// 边界检查: deductEnd 不能早于 deductStart
 	if deductEnd.Before(deductStart) {
+		if terminated {
+			// 终止/抢占时间早于已出账时间 (同步延迟或按心跳下线), 不再计费直接结束
+			logger.WarnCtx(ctx, "[BillingJob] worker %s terminated at %v before last billed %v, finish billing", worker.WorkerID, deductEnd, deductStart)
+			j.workerRepo.Update(ctx, worker.WorkerID, map[string]interface{}{
+				"billing_status": "final_billed",
+			})
+			return ""
+		}
+		run.Error()
 		logger.ErrorCtx(ctx, "[BillingJob] worker %s deductEnd %v before deductStart %v, skip", worker.WorkerID, deductEnd, deductStart)
-		return
+		return ""
 	}
 
 	duration := int64(deductEnd.Sub(deductStart).Seconds())
@@ -103,12 +172,6 @@ func (j *BillingJob) processWorker(ctx context.Context, worker *model.Worker) {
 	logger.InfoCtx(ctx, "[BillingJob] worker %s: status=%s, deductStart=%v, deductEnd=%v, duration=%d, terminated=%v",
 		worker.WorkerID, worker.Status, deductStart, deductEnd, duration, terminated)
 
-	// 运行中的 worker 不足 60 秒跳过，已终止的必须计费
-	if !terminated && duration < 60 {
-		logger.InfoCtx(ctx, "[BillingJob] worker %s duration %d < 60s, skip", worker.WorkerID, duration)
-		return
-	}
-
 	if duration <= 0 {
 		if terminated {
 			// 终止但无需计费，直接标记完成
@@ -116,101 +179,271 @@ func (j *BillingJob) processWorker(ctx context.Context, worker *model.Worker) {
 				"billing_status": "final_billed",
 			})
 		}
-		return
+		return ""
 	}
 
 	// 获取 endpoint 价格
 	endpoint, err := j.endpointRepo.GetByID(ctx, worker.EndpointID)
 	if err != nil {
+		run.Error()
 		logger.ErrorCtx(ctx, "[BillingJob] GetEndpoint error: %v", err)
-		return
+		return ""
 	}
 
-	// 计算费用: price_per_hour / 3600 * seconds
-	cost := endpoint.PricePerHour * duration / 3600
-	if cost <= 0 {
-		return
+	// 按任务计费的 endpoint 由 TaskSyncJob 按任务执行时长出账, worker 时长只推进不计费
+	if endpoint.TaskBilled() {
+		updates := map[string]interface{}{
+			"last_billed_at":      deductEnd,
+			"billed_execution_ms": worker.TotalExecutionTimeMs,
+		}
+		if terminated {
+			updates["billing_status"] = "final_billed"
+		}
+		if err := j.workerRepo.Update(ctx, worker.WorkerID, updates); err != nil {
+			run.Error()
+			logger.ErrorCtx(ctx, "[BillingJob] skip task-billed worker %s error: %v", worker.WorkerID, err)
+			return ""
+		}
+		if terminated {
+			return ""
+		}
+		return endpoint.OrgID
+	}
+
+	// spot worker 随时可能被抢占, 运行中只出账到最近一次心跳, 避免计费超过抢占时间
+	if endpoint.Spot && !terminated && worker.LastHeartbeat != nil && worker.LastHeartbeat.Before(deductEnd) {
+		deductEnd = *worker.LastHeartbeat
+		if duration = int64(deductEnd.Sub(deductStart).Seconds()); duration <= 0 {
+			return ""
+		}
 	}
 
-	// 生成幂等 key
-	idempotentKey := fmt.Sprintf("portal-%s-%d", worker.WorkerID, deductStart.Unix())
+	// 规格计费策略
+	policy := model.DefaultBillingPolicy()
+	if j.policyService != nil {
+		policy = j.policyService.ForSpec(ctx, endpoint.SpecName)
+	}
 
-	// 事务: 本地记录计费流水 + 更新 worker
+	// 运行中的 worker 不足最小出账时长跳过, 并只按整取整单位出账; 已终止的必须计费
+	if !terminated {
+		if duration < policy.MinBillableSeconds {
+			logger.InfoCtx(ctx, "[BillingJob] worker %s duration %d < %ds, skip", worker.WorkerID, duration, policy.MinBillableSeconds)
+			return ""
+		}
+		duration -= duration % policy.RoundingUnit()
+		if duration <= 0 {
+			return ""
+		}
+		// 冷启动尚未完成时等待, 避免免费时长被提前计费; 超过免费上限 + 宽限仍未就绪则不再等待
+		coldStartDeadline := worker.PodStartedAt.Add(time.Duration(policy.ColdStartFreeSeconds)*time.Second + coldStartWaitGrace)
+		if policy.ColdStartFreeSeconds > 0 && worker.ColdStartDurationMs == nil && worker.PodReadyAt == nil && now.Before(coldStartDeadline) {
+			logger.InfoCtx(ctx, "[BillingJob] worker %s cold start not finished, skip", worker.WorkerID)
+			return ""
+		}
+	}
+
+	// 按 endpoint 价格历史 (计划调价) 拆分计费时段, 再按集群覆盖价格的生效边界拆分 (spot 档位不使用覆盖价格)
 	deductEndTime := deductStart.Add(time.Duration(duration) * time.Second)
+	baseSegments := []service.PriceSegment{{Start: deductStart, End: deductEndTime, PricePerHour: endpoint.PricePerHour}}
+	if j.priceChanges != nil {
+		baseSegments, err = j.priceChanges.BasePriceSegments(ctx, endpoint, deductStart, deductEndTime)
+		if err != nil {
+			run.Error()
+			logger.ErrorCtx(ctx, "[BillingJob] get price history for worker %s error: %v", worker.WorkerID, err)
+			return ""
+		}
+	}
+	segments := baseSegments
+	if j.pricingService != nil && !endpoint.Spot {
+		segments = nil
+		for _, base := range baseSegments {
+			split, err := j.pricingService.SplitPeriod(ctx, worker.ClusterID, endpoint.SpecName, endpoint.BillingCurrency(), base.PricePerHour, base.Start, base.End)
+			if err != nil {
+				run.Error()
+				logger.ErrorCtx(ctx, "[BillingJob] split billing period for worker %s error: %v", worker.WorkerID, err)
+				return ""
+			}
+			segments = append(segments, split...)
+		}
+	}
+
+	// 本时段内的任务执行时长, 其余为空闲时长
+	busySeconds := (worker.TotalExecutionTimeMs - worker.BilledExecutionMs) / 1000
+	if busySeconds < 0 {
+		busySeconds = 0
+	}
+
+	// 按策略计算费用
+	charges := service.ComputeCharges(policy, &service.ChargeInput{
+		Segments:           segments,
+		PodStartedAt:       *worker.PodStartedAt,
+		ColdStartMs:        worker.ColdStartDurationMs,
+		BusySeconds:        busySeconds,
+		PriorBilledSeconds: int64(worker.TotalBilledSeconds),
+		Final:              terminated,
+	})
+	var cost int64
+	for _, charge := range charges {
+		cost += charge.Amount
+	}
+	// 不足计费最小单位时等待下一轮; 末段为免费价格时继续推进 last_billed_at
+	if cost <= 0 && !terminated && segments[len(segments)-1].PricePerHour > 0 {
+		return ""
+	}
+
+	var policyID *int64
+	if policy.ID > 0 {
+		policyID = &policy.ID
+	}
+
+	// 事务: 每个价格时段先抵扣预留承诺, 再记录一条流水并写入 outbox + 更新 worker
+	var billedCost int64
 	err = j.billingRepo.Transaction(ctx, func(billingTx *mysql.BillingRepo, userTx *mysql.UserRepo) error {
-		// 创建流水
-		tx := &model.BillingTransaction{
-			UserID:             worker.UserID,
-			OrgID:              endpoint.OrgID,
-			EndpointID:         worker.EndpointID,
-			ClusterID:          worker.ClusterID,
-			WorkerID:           worker.WorkerID,
-			GPUType:            endpoint.GPUType,
-			GPUCount:           endpoint.GPUCount,
-			BillingPeriodStart: deductStart,
-			BillingPeriodEnd:   deductEndTime,
-			DurationSeconds:    duration,
-			PricePerHour:       endpoint.PricePerHour,
-			Amount:             cost,
-			Status:             "success",
-		}
-		if err := billingTx.CreateTransaction(ctx, tx); err != nil {
-			return err
+		billedCost = 0
+		for i := range charges {
+			charge := &charges[i]
+			seg := charge.Segment
+			segDuration := seg.Seconds()
+
+			// 预留承诺只抵扣按需档位, segCost 为抵扣后应向主站扣款的金额 (承诺部分按承诺单价)
+			var draws []service.CommitmentDraw
+			segCost := charge.Amount
+			if !endpoint.Spot {
+				var err error
+				draws, segCost, err = service.ApplyCommitments(ctx, billingTx.Commitments(), endpoint.OrgID, endpoint.SpecName, worker.ClusterID, endpoint.GPUCount, charge)
+				if err != nil {
+					return err
+				}
+			}
+			if segCost <= 0 && len(draws) == 0 {
+				continue
+			}
+			var committedGPUSeconds int64
+			for _, d := range draws {
+				committedGPUSeconds += d.Seconds
+			}
+			committedSeconds := committedGPUSeconds
+			if endpoint.GPUCount > 1 {
+				committedSeconds /= int64(endpoint.GPUCount)
+			}
+			billedCost += segCost
+
+			// 创建流水
+			tx := &model.BillingTransaction{
+				UserID:             worker.UserID,
+				OrgID:              endpoint.OrgID,
+				EndpointID:         worker.EndpointID,
+				ClusterID:          worker.ClusterID,
+				WorkerID:           worker.WorkerID,
+				Tags:               endpoint.Tags,
+				SpecName:           endpoint.SpecName,
+				Spot:               endpoint.Spot,
+				GPUType:            endpoint.GPUType,
+				GPUCount:           endpoint.GPUCount,
+				BillingPeriodStart: seg.Start,
+				BillingPeriodEnd:   seg.End,
+				DurationSeconds:    segDuration,
+				PricePerHour:       seg.PricePerHour,
+				PricingOverrideID:  seg.OverrideID,
+				Amount:             segCost,
+				Currency:           endpoint.BillingCurrency(),
+
+				BillingPolicyID:      policyID,
+				BillingPolicyVersion: policy.Version,
+				BilledSeconds:        charge.BilledSeconds,
+				FreeSeconds:          charge.FreeSeconds,
+				IdleSeconds:          charge.IdleSeconds,
+				CommittedSeconds:     committedSeconds,
+
+				Status:         "success",
+				DeliveryStatus: model.DeliveryStatusPending,
+			}
+			if segCost <= 0 {
+				// 全部由单价为 0 的已预付承诺抵扣, 无需主站扣款
+				tx.DeliveryStatus = model.DeliveryStatusSent
+			}
+			if err := billingTx.CreateTransaction(ctx, tx); err != nil {
+				return err
+			}
+
+			// 承诺抵扣明细
+			for _, d := range draws {
+				if err := billingTx.Commitments().CreateUsage(ctx, &model.CommitmentUsage{
+					CommitmentID:  d.CommitmentID,
+					TransactionID: tx.ID,
+					EndpointID:    worker.EndpointID,
+					WorkerID:      worker.WorkerID,
+					Seconds:       d.Seconds,
+					Amount:        d.Amount,
+					PeriodStart:   seg.Start,
+				}); err != nil {
+					return err
+				}
+			}
+			if segCost <= 0 {
+				continue
+			}
+
+			// 幂等 key
+			idempotentKey := tx.MessageKey()
+
+			// 主站扣款消息写入 outbox, 由 BillingOutboxDispatcher 投递
+			payload, err := rocketmq.NewBillingPayload(&rocketmq.BillingMessage{
+				UserID:      worker.UserID,
+				OrgID:       endpoint.OrgID,
+				RequestID:   idempotentKey,
+				EndpointID:  worker.EndpointID,
+				WorkerID:    worker.WorkerID,
+				Amount:      segCost,
+				Currency:    tx.Currency,
+				DurationSec: segDuration,
+				Service:     "waverless-portal",
+			})
+			if err != nil {
+				return err
+			}
+			if err := billingTx.CreateOutbox(ctx, &model.BillingOutbox{
+				TransactionID: tx.ID,
+				Topic:         rocketmq.TopicMeteringBilling,
+				Tag:           rocketmq.TagDeductExec,
+				MessageKey:    idempotentKey,
+				Payload:       string(payload),
+				Status:        model.DeliveryStatusPending,
+				NextRetryAt:   time.Now(),
+			}); err != nil {
+				return err
+			}
 		}
 
 		// 更新 worker
 		updates := map[string]interface{}{
 			"last_billed_at":       deductEndTime,
 			"total_billed_seconds": gorm.Expr("total_billed_seconds + ?", duration),
-			"total_billed_amount":  gorm.Expr("total_billed_amount + ?", cost),
+			"total_billed_amount":  gorm.Expr("total_billed_amount + ?", billedCost),
+			"billed_execution_ms":  worker.TotalExecutionTimeMs,
 		}
 		if terminated {
 			updates["billing_status"] = "final_billed"
 		}
-		return j.workerRepo.Update(ctx, worker.WorkerID, updates)
+		return billingTx.Workers().Update(ctx, worker.WorkerID, updates)
 	})
 
+	if errors.Is(err, mysql.ErrDuplicateBilling) {
+		logger.WarnCtx(ctx, "[BillingJob] worker %s period from %v already billed, skip", worker.WorkerID, deductStart)
+		j.recoverDuplicate(ctx, worker, deductStart, deductEndTime, terminated)
+		return ""
+	}
 	if err != nil {
+		run.Error()
 		logger.ErrorCtx(ctx, "[BillingJob] record billing for worker %s error: %v", worker.WorkerID, err)
-		return
+		return ""
 	}
 
-	// 发送 MQ 到主站扣款 (异步，失败不影响本地记录)
-	billingMsg := &rocketmq.BillingMessage{
-		UserID:      worker.UserID,
-		OrgID:       endpoint.OrgID,
-		RequestID:   idempotentKey,
-		EndpointID:  worker.EndpointID,
-		WorkerID:    worker.WorkerID,
-		Amount:      cost,
-		DurationSec: duration,
-		Service:     "waverless-portal",
-	}
-	if err := rocketmq.SendBillingMessage(ctx, billingMsg); err != nil {
-		logger.ErrorCtx(ctx, "[BillingJob] send MQ failed for worker %s: %v", worker.WorkerID, err)
-	}
+	logger.InfoCtx(ctx, "[BillingJob] worker %s billed %d for %d seconds", worker.WorkerID, billedCost, duration)
+	run.Billed(endpoint.BillingCurrency(), billedCost, duration)
 
-	logger.InfoCtx(ctx, "[BillingJob] worker %s billed %d for %d seconds", worker.WorkerID, cost, duration)
-
-	// 检查余额，不足则停机
-	if !terminated {
-		j.checkBalanceAndStop(ctx, endpoint)
-	}
-}
-
-func (j *BillingJob) checkBalanceAndStop(ctx context.Context, endpoint *model.UserEndpoint) {
-	balance, err := wavespeed.GetOrgBalanceInternal(ctx, endpoint.OrgID)
-	if err != nil {
-		logger.ErrorCtx(ctx, "[BillingJob] get balance for org %s error: %v", endpoint.OrgID, err)
-		return
-	}
-
-	// 余额不足则停机
-	if balance < 0 {
-		logger.InfoCtx(ctx, "[BillingJob] org %s balance %d, stopping endpoint %d",
-			endpoint.OrgID, balance, endpoint.ID)
-		if err := j.endpointService.ScaleEndpoint(ctx, endpoint, 0); err != nil {
-			logger.ErrorCtx(ctx, "[BillingJob] stop endpoint %d error: %v", endpoint.ID, err)
-		}
+	if terminated {
+		return ""
 	}
+	return endpoint.OrgID
 }
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/config"
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/metrics"
+	"github.com/wavespeedai/waverless-portal/pkg/rocketmq"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+)
+
+// BillingOutboxDispatcher 投递 billing_outbox 中的计费消息, 失败按指数退避重试直到 MQ 确认
+type BillingOutboxDispatcher struct {
+	billingRepo *mysql.BillingRepo
+	interval    time.Duration
+	batchSize   int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	maxAttempts int
+}
+
+func NewBillingOutboxDispatcher(billingRepo *mysql.BillingRepo) *BillingOutboxDispatcher {
+	d := &BillingOutboxDispatcher{
+		billingRepo: billingRepo,
+		interval:    5 * time.Second,
+		batchSize:   100,
+		baseBackoff: 5 * time.Second,
+		maxBackoff:  10 * time.Minute,
+		maxAttempts: 10,
+	}
+	if config.GlobalConfig != nil {
+		cfg := config.GlobalConfig.Billing.Outbox
+		if cfg.IntervalSeconds > 0 {
+			d.interval = time.Duration(cfg.IntervalSeconds) * time.Second
+		}
+		if cfg.BatchSize > 0 {
+			d.batchSize = cfg.BatchSize
+		}
+		if cfg.BaseBackoffSecond > 0 {
+			d.baseBackoff = time.Duration(cfg.BaseBackoffSecond) * time.Second
+		}
+		if cfg.MaxBackoffSecond > 0 {
+			d.maxBackoff = time.Duration(cfg.MaxBackoffSecond) * time.Second
+		}
+		if cfg.MaxAttempts > 0 {
+			d.maxAttempts = cfg.MaxAttempts
+		}
+	}
+	return d
+}
+
+func (d *BillingOutboxDispatcher) Start(ctx context.Context) {
+	logger.InfoCtx(ctx, "[BillingOutbox] started")
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.InfoCtx(ctx, "[BillingOutbox] stopped")
+			return
+		case <-ticker.C:
+			d.dispatch(ctx)
+		}
+	}
+}
+
+func (d *BillingOutboxDispatcher) dispatch(ctx context.Context) {
+	// MQ 未配置时消息保留在 pending, 等待配置后再投递
+	if !rocketmq.Enabled() {
+		return
+	}
+
+	now := time.Now()
+	msgs, err := d.billingRepo.ListDueOutbox(ctx, now, d.batchSize)
+	if err != nil {
+		logger.ErrorCtx(ctx, "[BillingOutbox] ListDueOutbox error: %v", err)
+		return
+	}
+
+	for i := range msgs {
+		d.deliver(ctx, &msgs[i])
+	}
+}
+
+func (d *BillingOutboxDispatcher) deliver(ctx context.Context, msg *model.BillingOutbox) {
+	// 先抢占租约, 防止其他副本同时投递
+	claimed, err := d.billingRepo.ClaimOutbox(ctx, msg, time.Now().Add(d.maxBackoff))
+	if err != nil || !claimed {
+		return
+	}
+
+	sendErr := rocketmq.SendRaw(ctx, msg.Topic, msg.Tag, msg.MessageKey, []byte(msg.Payload))
+	if sendErr == nil {
+		metrics.MQSent.Inc(msg.Topic, msg.Tag)
+		if err := d.billingRepo.MarkOutboxSent(ctx, msg, time.Now()); err != nil {
+			logger.ErrorCtx(ctx, "[BillingOutbox] mark %s sent error: %v", msg.MessageKey, err)
+		}
+		return
+	}
+	metrics.MQSendFailures.Inc(msg.Topic, msg.Tag)
+
+	attempts := msg.Attempts + 1
+	status := model.DeliveryStatusPending
+	if attempts >= d.maxAttempts {
+		status = model.DeliveryStatusFailed
+	}
+	nextRetryAt := time.Now().Add(d.backoff(attempts))
+	logger.ErrorCtx(ctx, "[BillingOutbox] deliver %s failed (attempt %d, status %s, next retry %v): %v",
+		msg.MessageKey, attempts, status, nextRetryAt, sendErr)
+	if err := d.billingRepo.MarkOutboxRetry(ctx, msg, status, nextRetryAt, sendErr.Error()); err != nil {
+		logger.ErrorCtx(ctx, "[BillingOutbox] mark %s retry error: %v", msg.MessageKey, err)
+	}
+}
+
+// backoff 指数退避: base * 2^(attempts-1), 上限 maxBackoff
+func (d *BillingOutboxDispatcher) backoff(attempts int) time.Duration {
+	delay := d.baseBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
@@ -2,27 +2,51 @@ package jobs
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"path"
 	"time"
 
-	"gorm.io/gorm"
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/archive"
+	"github.com/wavespeedai/waverless-portal/pkg/config"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 )
 
-// CleanupJob 清理过期数据
+// 支持按保留策略清理的表
+const (
+	tableBillingTransactions = "billing_transactions"
+	tableTaskRouting         = "task_routing"
+)
+
+// 未配置时的默认保留策略: 计费流水永久保留, 任务路由保留 7 天
+var defaultTableRetention = map[string]config.TableRetentionConfig{
+	tableBillingTransactions: {RetentionDays: 0, Archive: true},
+	tableTaskRouting:         {RetentionDays: 7},
+}
+
+// CleanupJob 按表保留策略清理过期数据: 计费流水删除前先写日汇总, 需要归档的表先上传压缩文件,
+// 每批的汇总、归档记录和删除在同一事务内完成, 中断后下次从剩余数据继续
 type CleanupJob struct {
-	db *gorm.DB
+	repo    *mysql.RetentionRepo
+	storage archive.Storage // 为空时需要归档的表不清理
 }
 
-func NewCleanupJob(db *gorm.DB) *CleanupJob {
-	return &CleanupJob{db: db}
+func NewCleanupJob(repo *mysql.RetentionRepo, storage archive.Storage) *CleanupJob {
+	return &CleanupJob{repo: repo, storage: storage}
 }
 
-// Start 启动清理任务 (每天执行一次)
+// Start 启动清理任务 (默认每天执行一次)
 func (j *CleanupJob) Start(ctx context.Context) {
 	// 启动时执行一次
-	j.cleanup()
+	j.cleanup(ctx)
 
-	ticker := time.NewTicker(24 * time.Hour)
+	interval := 24 * time.Hour
+	if config.GlobalConfig != nil && config.GlobalConfig.Retention.IntervalHours > 0 {
+		interval = time.Duration(config.GlobalConfig.Retention.IntervalHours) * time.Hour
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -30,27 +54,125 @@ func (j *CleanupJob) Start(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			j.cleanup()
+			j.cleanup(ctx)
 		}
 	}
 }
 
-func (j *CleanupJob) cleanup() {
-	cutoff := time.Now().AddDate(0, 0, -7)
+func (j *CleanupJob) cleanup(ctx context.Context) {
+	var cfg config.RetentionConfig
+	if config.GlobalConfig != nil {
+		cfg = config.GlobalConfig.Retention
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
 
-	// 清理 billing_transactions
-	result := j.db.Exec("DELETE FROM billing_transactions WHERE created_at < ?", cutoff)
-	if result.Error != nil {
-		log.Printf("[Cleanup] failed to clean billing_transactions: %v", result.Error)
-	} else if result.RowsAffected > 0 {
-		log.Printf("[Cleanup] deleted %d billing_transactions older than 7 days", result.RowsAffected)
+	now := time.Now()
+	for _, table := range []string{tableBillingTransactions, tableTaskRouting} {
+		tc, ok := cfg.Tables[table]
+		if !ok {
+			tc = defaultTableRetention[table]
+		}
+		if tc.RetentionDays <= 0 {
+			continue
+		}
+
+		cutoff := now.AddDate(0, 0, -tc.RetentionDays)
+		if table == tableBillingTransactions {
+			// 至少保留上月及当月流水, 用于月度账单关账和月预算统计
+			if keep := service.MonthStart(now).AddDate(0, -1, 0); cutoff.After(keep) {
+				cutoff = keep
+			}
+		}
+		if tc.Archive && j.storage == nil {
+			log.Printf("[Cleanup] archive storage not available, skip %s", table)
+			continue
+		}
+
+		total := 0
+		for ctx.Err() == nil {
+			n, err := j.purgeBatch(ctx, table, cutoff, tc.Archive, cfg.BatchSize, cfg.Archive.Format)
+			if err != nil {
+				log.Printf("[Cleanup] failed to clean %s: %v", table, err)
+				break
+			}
+			total += n
+			if n < cfg.BatchSize {
+				break
+			}
+		}
+		if total > 0 {
+			log.Printf("[Cleanup] deleted %d %s before %s", total, table, cutoff.Format("2006-01-02"))
+		}
+	}
+}
+
+// purgeBatch 归档并删除一批过期数据, 返回本批行数.
+// 上传成功但事务失败时, 下次会重新上传同一 key 的文件 (覆盖), data_archives 以事务提交为准
+func (j *CleanupJob) purgeBatch(ctx context.Context, table string, cutoff time.Time, archiveEnabled bool, batchSize int, format string) (int, error) {
+	var rows interface{}
+	var ids []int64
+	var minTime, maxTime time.Time
+	track := func(id int64, t time.Time) {
+		ids = append(ids, id)
+		if minTime.IsZero() || t.Before(minTime) {
+			minTime = t
+		}
+		if t.After(maxTime) {
+			maxTime = t
+		}
+	}
+
+	switch table {
+	case tableBillingTransactions:
+		txs, err := j.repo.ListExpiredTransactions(ctx, cutoff, batchSize)
+		if err != nil {
+			return 0, err
+		}
+		for _, tx := range txs {
+			track(tx.ID, tx.BillingPeriodStart)
+		}
+		rows = txs
+	case tableTaskRouting:
+		tasks, err := j.repo.ListExpiredTaskRoutings(ctx, cutoff, batchSize)
+		if err != nil {
+			return 0, err
+		}
+		for _, task := range tasks {
+			track(task.ID, task.SubmittedAt)
+		}
+		rows = tasks
+	default:
+		return 0, fmt.Errorf("unsupported table %s", table)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var record *model.DataArchive
+	if archiveEnabled {
+		file, err := archive.Encode(format, rows)
+		if err != nil {
+			return 0, err
+		}
+		firstID, lastID := ids[0], ids[len(ids)-1]
+		key := fmt.Sprintf("%s/%s/%s-%d-%d%s", table, minTime.UTC().Format("2006/01"), table, firstID, lastID, file.Ext())
+		if err := j.storage.Put(ctx, key, file.Data, "application/gzip"); err != nil {
+			return 0, fmt.Errorf("upload archive %s: %w", key, err)
+		}
+		if err := j.storage.Put(ctx, key+".sha256", file.ChecksumFile(path.Base(key)), "text/plain"); err != nil {
+			return 0, fmt.Errorf("upload checksum %s: %w", key, err)
+		}
+		record = &model.DataArchive{
+			SourceTable: table, Storage: j.storage.Name(), ObjectKey: key, Format: file.Format,
+			FirstID: firstID, LastID: lastID, RowCount: len(ids), MinTime: minTime, MaxTime: maxTime,
+			Cutoff: cutoff, SizeBytes: int64(len(file.Data)), SHA256: file.SHA256,
+		}
 	}
 
-	// 清理 task_routing
-	result = j.db.Exec("DELETE FROM task_routing WHERE submitted_at < ?", cutoff)
-	if result.Error != nil {
-		log.Printf("[Cleanup] failed to clean task_routing: %v", result.Error)
-	} else if result.RowsAffected > 0 {
-		log.Printf("[Cleanup] deleted %d task_routing older than 7 days", result.RowsAffected)
+	if err := j.repo.PurgeBatch(ctx, table, ids, table == tableBillingTransactions, record); err != nil {
+		return 0, err
 	}
+	return len(ids), nil
 }
@@ -2,17 +2,21 @@ package jobs
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/wavespeedai/waverless-portal/internal/service"
 	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/metrics"
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 )
 
 // EndpointSyncService 后台同步 endpoint 状态
 type EndpointSyncService struct {
 	endpointRepo    *mysql.EndpointRepo
+	placementRepo   *mysql.PlacementRepo
 	clusterService  *service.ClusterService
 	endpointService *service.EndpointService
 	interval        time.Duration
@@ -21,11 +25,13 @@ type EndpointSyncService struct {
 
 func NewEndpointSyncService(
 	endpointRepo *mysql.EndpointRepo,
+	placementRepo *mysql.PlacementRepo,
 	clusterService *service.ClusterService,
 	endpointService *service.EndpointService,
 ) *EndpointSyncService {
 	return &EndpointSyncService{
 		endpointRepo:    endpointRepo,
+		placementRepo:   placementRepo,
 		clusterService:  clusterService,
 		endpointService: endpointService,
 		interval:        10 * time.Second,
@@ -58,75 +64,136 @@ func (s *EndpointSyncService) run() {
 	}
 }
 
+// placementSync 单个 placement 的同步结果
+type placementSync struct {
+	placement    *model.EndpointPlacement
+	physicalName string
+	detail       map[string]interface{} // 获取失败时为空
+}
+
 func (s *EndpointSyncService) syncAll() {
+	run := metrics.StartJobRun("endpoint_sync")
+	defer run.Done()
+
 	ctx := context.Background()
 	endpoints, err := s.endpointRepo.ListAll(ctx)
 	if err != nil {
+		run.Error()
 		logger.Errorf("failed to list endpoints for sync: %v", err)
 		return
 	}
+	placements, err := s.placementRepo.ListActive(ctx)
+	if err != nil {
+		run.Error()
+		logger.Errorf("failed to list endpoint placements for sync: %v", err)
+		return
+	}
+	run.Processed(len(endpoints))
+
+	endpointByID := make(map[int64]*model.UserEndpoint, len(endpoints))
+	for i := range endpoints {
+		endpointByID[endpoints[i].ID] = &endpoints[i]
+	}
 
 	// 按集群分组
-	clusterEndpoints := make(map[string][]struct {
-		ID           int64
-		PhysicalName string
-	})
-	for _, ep := range endpoints {
-		clusterEndpoints[ep.ClusterID] = append(clusterEndpoints[ep.ClusterID], struct {
-			ID           int64
-			PhysicalName string
-		}{ep.ID, ep.PhysicalName})
+	clusterPlacements := make(map[string][]*placementSync)
+	placementCount := make(map[int64]int)
+	for i := range placements {
+		ep, ok := endpointByID[placements[i].EndpointID]
+		if !ok {
+			continue
+		}
+		placementCount[ep.ID]++
+		clusterPlacements[placements[i].ClusterID] = append(clusterPlacements[placements[i].ClusterID], &placementSync{
+			placement: &placements[i], physicalName: ep.PhysicalName,
+		})
 	}
 
 	// 并发获取每个集群的 endpoint 状态
 	var wg sync.WaitGroup
-	for clusterID, eps := range clusterEndpoints {
+	for clusterID, items := range clusterPlacements {
 		wg.Add(1)
-		go func(cid string, endpoints []struct {
-			ID           int64
-			PhysicalName string
-		}) {
+		go func(cid string, items []*placementSync) {
 			defer wg.Done()
-			s.syncClusterEndpoints(ctx, cid, endpoints)
-		}(clusterID, eps)
+			s.syncClusterEndpoints(ctx, run, cid, items)
+		}(clusterID, items)
 	}
 	wg.Wait()
+
+	// 按 endpoint 汇总, rank 最小 (主) 的集群在前
+	synced := make(map[int64][]*placementSync)
+	for _, items := range clusterPlacements {
+		for _, item := range items {
+			if item.detail != nil {
+				synced[item.placement.EndpointID] = append(synced[item.placement.EndpointID], item)
+			}
+		}
+	}
+	for id, items := range synced {
+		sort.Slice(items, func(i, j int) bool { return items[i].placement.Rank < items[j].placement.Rank })
+		updates := endpointUpdates(endpointByID[id], items, len(items) == placementCount[id])
+		if len(updates) > 0 {
+			s.endpointRepo.Update(ctx, id, updates)
+		}
+	}
 }
 
-func (s *EndpointSyncService) syncClusterEndpoints(ctx context.Context, clusterID string, endpoints []struct {
-	ID           int64
-	PhysicalName string
-}) {
+// endpointUpdates 由各集群状态汇总 endpoint 的更新: 状态及镜像以主集群为准,
+// 副本数为各集群之和 (仅在所有集群都同步成功时更新)
+func endpointUpdates(ep *model.UserEndpoint, items []*placementSync, complete bool) map[string]interface{} {
+	updates := map[string]interface{}{}
+	primary := items[0].detail
+	// suspended 由 Portal 维护, 不被集群状态覆盖
+	if status, ok := primary["status"].(string); ok && ep.Status != model.EndpointStatusSuspended {
+		updates["status"] = status
+	}
+	if image, ok := primary["image"].(string); ok {
+		updates["image"] = image
+	}
+	if !complete {
+		return updates
+	}
+	replicas, readyReplicas := 0, 0
+	hasReplicas, hasReady := false, false
+	for _, item := range items {
+		if v, ok := item.detail["replicas"].(float64); ok {
+			replicas += int(v)
+			hasReplicas = true
+		}
+		if v, ok := item.detail["readyReplicas"].(float64); ok {
+			readyReplicas += int(v)
+			hasReady = true
+		}
+	}
+	if hasReplicas {
+		updates["replicas"] = replicas
+	}
+	if hasReady {
+		updates["current_replicas"] = readyReplicas
+	}
+	return updates
+}
+
+func (s *EndpointSyncService) syncClusterEndpoints(ctx context.Context, run *metrics.JobRun, clusterID string, items []*placementSync) {
 	cluster, err := s.clusterService.GetCluster(ctx, clusterID)
 	if err != nil {
+		run.Error()
 		return
 	}
 
 	client := s.endpointService.GetWaverlessClient(cluster)
 
-	for _, ep := range endpoints {
-		detail, err := client.GetEndpoint(ctx, ep.PhysicalName)
+	for _, item := range items {
+		detail, err := client.GetEndpoint(ctx, item.physicalName)
 		if err != nil {
+			run.Error()
 			continue
 		}
+		item.detail = detail
 
-		// 提取状态信息
-		updates := map[string]interface{}{}
-		if status, ok := detail["status"].(string); ok {
-			updates["status"] = status
-		}
-		if replicas, ok := detail["replicas"].(float64); ok {
-			updates["replicas"] = int(replicas)
-		}
+		// 记录该集群的就绪副本数, 用于任务加权路由 (replicas 为 Portal 分配的目标值, 不覆盖)
 		if readyReplicas, ok := detail["readyReplicas"].(float64); ok {
-			updates["current_replicas"] = int(readyReplicas)
-		}
-		if image, ok := detail["image"].(string); ok {
-			updates["image"] = image
-		}
-
-		if len(updates) > 0 {
-			s.endpointRepo.Update(ctx, ep.ID, updates)
+			s.placementRepo.Update(ctx, item.placement.ID, map[string]interface{}{"current_replicas": int(readyReplicas)})
 		}
 	}
 }
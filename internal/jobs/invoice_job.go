@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/config"
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+)
+
+// InvoiceJob 刷新当月草稿账单, 并在月初关账上月账单
+type InvoiceJob struct {
+	invoiceService *service.InvoiceService
+	interval       time.Duration
+	closeDelay     time.Duration
+}
+
+func NewInvoiceJob(invoiceService *service.InvoiceService) *InvoiceJob {
+	j := &InvoiceJob{
+		invoiceService: invoiceService,
+		interval:       time.Hour,
+		closeDelay:     2 * time.Hour,
+	}
+	if config.GlobalConfig != nil {
+		cfg := config.GlobalConfig.Billing.Invoice
+		if cfg.IntervalSeconds > 0 {
+			j.interval = time.Duration(cfg.IntervalSeconds) * time.Second
+		}
+		if cfg.CloseDelayHours > 0 {
+			j.closeDelay = time.Duration(cfg.CloseDelayHours) * time.Hour
+		}
+	}
+	return j
+}
+
+func (j *InvoiceJob) Start(ctx context.Context) {
+	logger.InfoCtx(ctx, "[InvoiceJob] started")
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.InfoCtx(ctx, "[InvoiceJob] stopped")
+			return
+		case <-ticker.C:
+			j.run(ctx)
+		}
+	}
+}
+
+func (j *InvoiceJob) run(ctx context.Context) {
+	now := time.Now().UTC()
+	monthStart := service.MonthStart(now)
+
+	// 上月关账 (延迟 closeDelay 等待跨月的最后一轮计费落库)
+	if !now.Before(monthStart.Add(j.closeDelay)) {
+		lastMonth := monthStart.AddDate(0, -1, 0)
+		if err := j.invoiceService.CloseMonth(ctx, lastMonth); err != nil {
+			logger.ErrorCtx(ctx, "[InvoiceJob] close month %s error: %v", lastMonth.Format("2006-01"), err)
+		}
+	}
+
+	// 刷新当月草稿
+	if err := j.invoiceService.RefreshDrafts(ctx, monthStart); err != nil {
+		logger.ErrorCtx(ctx, "[InvoiceJob] refresh drafts for %s error: %v", monthStart.Format("2006-01"), err)
+	}
+}
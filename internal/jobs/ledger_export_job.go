@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/config"
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+)
+
+// LedgerExportJob 定期增量导出计费流水, 并执行管理员要求的整天重导
+type LedgerExportJob struct {
+	exportService *service.LedgerExportService
+	interval      time.Duration
+}
+
+func NewLedgerExportJob(exportService *service.LedgerExportService) *LedgerExportJob {
+	j := &LedgerExportJob{
+		exportService: exportService,
+		interval:      time.Hour,
+	}
+	if config.GlobalConfig != nil && config.GlobalConfig.Billing.LedgerExport.IntervalMinutes > 0 {
+		j.interval = time.Duration(config.GlobalConfig.Billing.LedgerExport.IntervalMinutes) * time.Minute
+	}
+	return j
+}
+
+func (j *LedgerExportJob) Start(ctx context.Context) {
+	logger.InfoCtx(ctx, "[LedgerExportJob] started")
+	j.run(ctx)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.InfoCtx(ctx, "[LedgerExportJob] stopped")
+			return
+		case <-ticker.C:
+			j.run(ctx)
+		}
+	}
+}
+
+func (j *LedgerExportJob) run(ctx context.Context) {
+	if err := j.exportService.Run(ctx); err != nil {
+		logger.ErrorCtx(ctx, "[LedgerExportJob] export error: %v", err)
+	}
+}
@@ -10,18 +10,20 @@ import (
 )
 
 type Manager struct {
-	clusterService *service.ClusterService
-	ctx            context.Context
-	cancel         context.CancelFunc
-	wg             sync.WaitGroup
+	clusterService  *service.ClusterService
+	endpointService *service.EndpointService
+	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
 }
 
-func NewManager(billingService *service.BillingService, clusterService *service.ClusterService) *Manager {
+func NewManager(billingService *service.BillingService, clusterService *service.ClusterService, endpointService *service.EndpointService) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Manager{
-		clusterService: clusterService,
-		ctx:            ctx,
-		cancel:         cancel,
+		clusterService:  clusterService,
+		endpointService: endpointService,
+		ctx:             ctx,
+		cancel:          cancel,
 	}
 }
 
@@ -56,6 +58,8 @@ func (m *Manager) runClusterHealthCheck() {
 			if err := m.clusterService.MarkOfflineClusters(m.ctx, 2*time.Minute); err != nil {
 				logger.Errorf("Cluster health check error: %v", err)
 			}
+			// 替换下线集群上的 endpoint placement
+			m.endpointService.FailoverPlacements(m.ctx)
 		}
 	}
 }
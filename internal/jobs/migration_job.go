@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/metrics"
+)
+
+// MigrationJob 推进进行中的 endpoint 迁移, 并定期为开启自动迁移的用户发起迁移
+type MigrationJob struct {
+	migrationService *service.MigrationService
+	interval         time.Duration
+	planInterval     time.Duration
+}
+
+func NewMigrationJob(migrationService *service.MigrationService) *MigrationJob {
+	return &MigrationJob{
+		migrationService: migrationService,
+		interval:         15 * time.Second,
+		planInterval:     10 * time.Minute,
+	}
+}
+
+func (j *MigrationJob) Start(ctx context.Context) {
+	logger.InfoCtx(ctx, "[MigrationJob] started")
+	j.plan(ctx)
+	j.advance(ctx)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	planTicker := time.NewTicker(j.planInterval)
+	defer planTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.InfoCtx(ctx, "[MigrationJob] stopped")
+			return
+		case <-ticker.C:
+			j.advance(ctx)
+		case <-planTicker.C:
+			j.plan(ctx)
+		}
+	}
+}
+
+func (j *MigrationJob) advance(ctx context.Context) {
+	run := metrics.StartJobRun("endpoint_migration")
+	defer run.Done()
+
+	migrations, err := j.migrationService.ListInProgress(ctx)
+	if err != nil {
+		run.Error()
+		logger.ErrorCtx(ctx, "[MigrationJob] list migrations error: %v", err)
+		return
+	}
+	for i := range migrations {
+		m := &migrations[i]
+		if err := j.migrationService.Advance(ctx, m); err != nil {
+			run.Error()
+			logger.WarnCtx(ctx, "[MigrationJob] advance migration %d (%s) error: %v", m.ID, m.Status, err)
+		}
+		run.Processed(1)
+	}
+}
+
+func (j *MigrationJob) plan(ctx context.Context) {
+	run := metrics.StartJobRun("endpoint_migration_plan")
+	defer run.Done()
+
+	started, err := j.migrationService.PlanAutoMigrations(ctx)
+	if err != nil {
+		run.Error()
+		logger.ErrorCtx(ctx, "[MigrationJob] plan auto migrations error: %v", err)
+		return
+	}
+	run.Processed(started)
+	if started > 0 {
+		logger.InfoCtx(ctx, "[MigrationJob] started %d auto migrations", started)
+	}
+}
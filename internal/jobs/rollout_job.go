@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/metrics"
+)
+
+// RolloutJob 推进进行中的镜像发布: 等待新版本就绪, 对比失败率后自动全量或回滚
+type RolloutJob struct {
+	rolloutService *service.RolloutService
+	interval       time.Duration
+}
+
+func NewRolloutJob(rolloutService *service.RolloutService) *RolloutJob {
+	return &RolloutJob{
+		rolloutService: rolloutService,
+		interval:       15 * time.Second,
+	}
+}
+
+func (j *RolloutJob) Start(ctx context.Context) {
+	logger.InfoCtx(ctx, "[RolloutJob] started")
+	j.run(ctx)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.InfoCtx(ctx, "[RolloutJob] stopped")
+			return
+		case <-ticker.C:
+			j.run(ctx)
+		}
+	}
+}
+
+func (j *RolloutJob) run(ctx context.Context) {
+	run := metrics.StartJobRun("endpoint_rollout")
+	defer run.Done()
+
+	rollouts, err := j.rolloutService.ListInProgress(ctx)
+	if err != nil {
+		run.Error()
+		logger.ErrorCtx(ctx, "[RolloutJob] list rollouts error: %v", err)
+		return
+	}
+	for i := range rollouts {
+		r := &rollouts[i]
+		if err := j.rolloutService.Advance(ctx, r); err != nil {
+			run.Error()
+			logger.WarnCtx(ctx, "[RolloutJob] advance rollout %d (%s) error: %v", r.ID, r.Status, err)
+		}
+		run.Processed(1)
+	}
+}
@@ -2,23 +2,30 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
 	"github.com/wavespeedai/waverless-portal/internal/service"
+	"github.com/wavespeedai/waverless-portal/pkg/metrics"
+	"github.com/wavespeedai/waverless-portal/pkg/rocketmq"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 	"github.com/wavespeedai/waverless-portal/pkg/waverless"
 	"gorm.io/gorm"
 )
 
-// TaskSyncJob 同步未完成任务的状态
+// TaskSyncJob 同步未完成任务的状态, 并为按任务计费的 endpoint 出账已结束的任务
 type TaskSyncJob struct {
 	db              *gorm.DB
 	clusterService  *service.ClusterService
 	endpointService *service.EndpointService
+	taskRepo        *mysql.TaskRepo
+	endpointRepo    *mysql.EndpointRepo
 }
 
-func NewTaskSyncJob(db *gorm.DB, clusterService *service.ClusterService, endpointService *service.EndpointService) *TaskSyncJob {
-	return &TaskSyncJob{db: db, clusterService: clusterService, endpointService: endpointService}
+func NewTaskSyncJob(db *gorm.DB, clusterService *service.ClusterService, endpointService *service.EndpointService, taskRepo *mysql.TaskRepo, endpointRepo *mysql.EndpointRepo) *TaskSyncJob {
+	return &TaskSyncJob{db: db, clusterService: clusterService, endpointService: endpointService, taskRepo: taskRepo, endpointRepo: endpointRepo}
 }
 
 // Start 启动 Task 同步任务 (每 10 秒执行一次)
@@ -31,12 +38,15 @@ func (j *TaskSyncJob) Start(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			j.sync(ctx)
+			run := metrics.StartBillingRun("task_sync")
+			j.sync(ctx, run)
+			j.billTasks(ctx, run)
+			run.Done()
 		}
 	}
 }
 
-func (j *TaskSyncJob) sync(ctx context.Context) {
+func (j *TaskSyncJob) sync(ctx context.Context, run *metrics.JobRun) {
 	// 查询未完成的任务 (PENDING, IN_PROGRESS)
 	var tasks []struct {
 		ID        int64
@@ -49,6 +59,7 @@ func (j *TaskSyncJob) sync(ctx context.Context) {
 		Where("status IN ?", []string{"PENDING", "IN_PROGRESS"}).
 		Limit(100).
 		Find(&tasks).Error; err != nil {
+		run.Error()
 		log.Printf("[TaskSync] failed to list tasks: %v", err)
 		return
 	}
@@ -56,6 +67,7 @@ func (j *TaskSyncJob) sync(ctx context.Context) {
 	if len(tasks) == 0 {
 		return
 	}
+	run.Processed(len(tasks))
 
 	// 按集群分组
 	clusterTasks := make(map[string][]struct {
@@ -72,19 +84,21 @@ func (j *TaskSyncJob) sync(ctx context.Context) {
 	for clusterID, taskList := range clusterTasks {
 		cluster, err := j.clusterService.GetCluster(ctx, clusterID)
 		if err != nil {
+			run.Error()
 			continue
 		}
 
-		client := waverless.NewClient(cluster.APIEndpoint, cluster.APIKey)
+		client := waverless.NewClient(cluster.ClusterID, cluster.APIEndpoint, cluster.APIKey)
 		for _, t := range taskList {
-			j.syncTask(ctx, client, t.TaskID)
+			j.syncTask(ctx, run, client, t.TaskID)
 		}
 	}
 }
 
-func (j *TaskSyncJob) syncTask(ctx context.Context, client *waverless.Client, taskID string) {
+func (j *TaskSyncJob) syncTask(ctx context.Context, run *metrics.JobRun, client *waverless.Client, taskID string) {
 	resp, err := client.GetTaskStatus(ctx, taskID)
 	if err != nil {
+		run.Error()
 		return
 	}
 
@@ -103,3 +117,116 @@ func (j *TaskSyncJob) syncTask(ctx context.Context, client *waverless.Client, ta
 
 	j.db.Table("task_routing").Where("task_id = ?", taskID).Updates(updates)
 }
+
+// billTasks 按任务执行时长出账已进入终态的任务 (包括用户查询状态时已更新为终态的任务)
+func (j *TaskSyncJob) billTasks(ctx context.Context, run *metrics.JobRun) {
+	tasks, err := j.taskRepo.ListUnbilled(ctx, 100)
+	if err != nil {
+		run.Error()
+		log.Printf("[TaskSync] failed to list unbilled tasks: %v", err)
+		return
+	}
+
+	endpoints := make(map[int64]*model.UserEndpoint)
+	for i := range tasks {
+		task := &tasks[i]
+		endpoint, ok := endpoints[task.EndpointID]
+		if !ok {
+			endpoint, err = j.endpointRepo.GetByID(ctx, task.EndpointID)
+			if err != nil {
+				run.Error()
+				log.Printf("[TaskSync] failed to get endpoint %d of task %s: %v", task.EndpointID, task.TaskID, err)
+				continue
+			}
+			endpoints[task.EndpointID] = endpoint
+		}
+		if err := j.billTask(ctx, run, endpoint, task); err != nil {
+			run.Error()
+			log.Printf("[TaskSync] failed to bill task %s: %v", task.TaskID, err)
+		}
+	}
+}
+
+// billTask 事务内按执行时长 (不足 1 微美元向上取整) 记录一条带 task_id 的流水并写入 outbox, 同时标记任务已出账
+func (j *TaskSyncJob) billTask(ctx context.Context, run *metrics.JobRun, endpoint *model.UserEndpoint, task *model.TaskRouting) error {
+	now := time.Now()
+	amount := (task.ExecutionTimeMs*endpoint.TaskPricePerSecond + 999) / 1000
+	durationSec := (task.ExecutionTimeMs + 999) / 1000
+
+	periodEnd := now
+	if task.CompletedAt != nil {
+		periodEnd = *task.CompletedAt
+	}
+	periodStart := periodEnd.Add(-time.Duration(task.ExecutionTimeMs) * time.Millisecond)
+
+	billed := false
+	err := j.db.WithContext(ctx).Transaction(func(db *gorm.DB) error {
+		// 先标记出账, 并发或重复出账时直接返回
+		marked, err := mysql.NewTaskRepo(db).MarkBilled(ctx, task.TaskID, now)
+		if err != nil || !marked || amount <= 0 {
+			return err
+		}
+
+		billingTx := mysql.NewBillingRepo(db)
+		tx := &model.BillingTransaction{
+			UserID:             task.UserID,
+			OrgID:              endpoint.OrgID,
+			EndpointID:         task.EndpointID,
+			ClusterID:          task.ClusterID,
+			WorkerID:           task.WorkerID,
+			TaskID:             task.TaskID,
+			Tags:               endpoint.Tags,
+			SpecName:           endpoint.SpecName,
+			GPUType:            endpoint.GPUType,
+			GPUCount:           endpoint.GPUCount,
+			BillingPeriodStart: periodStart,
+			BillingPeriodEnd:   periodEnd,
+			DurationSeconds:    durationSec,
+			PricePerHour:       endpoint.TaskPricePerSecond * 3600,
+			Amount:             amount,
+			Currency:           endpoint.BillingCurrency(),
+			BilledSeconds:      durationSec,
+			Status:             "success",
+			DeliveryStatus:     model.DeliveryStatusPending,
+		}
+		if err := billingTx.CreateTransaction(ctx, tx); err != nil {
+			if errors.Is(err, mysql.ErrDuplicateBilling) {
+				// 任务已有流水 (billed_at 未落库的遗留数据), 仅标记出账
+				log.Printf("[TaskSync] task %s already billed, skip", task.TaskID)
+				return nil
+			}
+			return err
+		}
+
+		idempotentKey := tx.MessageKey()
+		payload, err := rocketmq.NewBillingPayload(&rocketmq.BillingMessage{
+			UserID:      task.UserID,
+			OrgID:       endpoint.OrgID,
+			RequestID:   idempotentKey,
+			EndpointID:  task.EndpointID,
+			WorkerID:    task.WorkerID,
+			TaskID:      task.TaskID,
+			Amount:      amount,
+			Currency:    tx.Currency,
+			DurationSec: durationSec,
+			Service:     "waverless-portal",
+		})
+		if err != nil {
+			return err
+		}
+		billed = true
+		return billingTx.CreateOutbox(ctx, &model.BillingOutbox{
+			TransactionID: tx.ID,
+			Topic:         rocketmq.TopicMeteringBilling,
+			Tag:           rocketmq.TagDeductTask,
+			MessageKey:    idempotentKey,
+			Payload:       string(payload),
+			Status:        model.DeliveryStatusPending,
+			NextRetryAt:   now,
+		})
+	})
+	if err == nil && billed {
+		run.Billed(endpoint.BillingCurrency(), amount, durationSec)
+	}
+	return err
+}
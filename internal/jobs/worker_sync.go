@@ -2,10 +2,12 @@ package jobs
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/wavespeedai/waverless-portal/internal/service"
 	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/metrics"
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 	"github.com/wavespeedai/waverless-portal/pkg/waverless"
 	"gorm.io/gorm"
@@ -40,50 +42,120 @@ func (j *WorkerSyncJob) Start(ctx context.Context) {
 	}
 }
 
-// SyncEndpoint 同步单个 endpoint 的 workers (供 API 调用)
+// SyncEndpoint 同步单个 endpoint 在各集群的 workers (供 API 调用)
 func (j *WorkerSyncJob) SyncEndpoint(ctx context.Context, ep *model.UserEndpoint) {
-	cluster, err := j.clusterService.GetCluster(ctx, ep.ClusterID)
-	if err != nil {
+	var placements []model.EndpointPlacement
+	if err := j.db.Where("endpoint_id = ? AND status IN ?", ep.ID, model.PlacementDeployedStatuses).Find(&placements).Error; err != nil {
+		return
+	}
+	for _, p := range placements {
+		cluster, err := j.clusterService.GetCluster(ctx, p.ClusterID)
+		if err != nil {
+			continue
+		}
+		client := waverless.NewClient(cluster.ClusterID, cluster.APIEndpoint, cluster.APIKey)
+		j.syncEndpointWorkers(ctx, client, ep, cluster.ClusterID, nil)
+	}
+	var rollouts []model.EndpointRollout
+	if err := j.db.Where("endpoint_id = ? AND status IN ?", ep.ID, model.RolloutInProgressStatuses).Find(&rollouts).Error; err != nil {
 		return
 	}
-	client := waverless.NewClient(cluster.APIEndpoint, cluster.APIKey)
-	j.syncEndpointWorkers(ctx, client, ep)
+	for i := range rollouts {
+		cluster, err := j.clusterService.GetCluster(ctx, rollouts[i].ClusterID)
+		if err != nil {
+			continue
+		}
+		client := waverless.NewClient(cluster.ClusterID, cluster.APIEndpoint, cluster.APIKey)
+		j.syncEndpointWorkers(ctx, client, rolloutEndpoint(ep, &rollouts[i]), cluster.ClusterID, &rollouts[i].ID)
+	}
+}
+
+// workerSyncTarget 待同步 worker 的部署: endpoint 本身 (rolloutID 为空) 或其镜像发布的新版本
+type workerSyncTarget struct {
+	ep        *model.UserEndpoint
+	rolloutID *int64
+}
+
+// rolloutEndpoint 镜像发布新版本对应的 endpoint (physical name 替换为新版本部署)
+func rolloutEndpoint(ep *model.UserEndpoint, r *model.EndpointRollout) *model.UserEndpoint {
+	canary := *ep
+	canary.PhysicalName = r.CanaryPhysicalName
+	return &canary
 }
 
 func (j *WorkerSyncJob) sync(ctx context.Context) {
-	// 获取所有活跃的 endpoints
+	run := metrics.StartJobRun("worker_sync")
+	defer run.Done()
+
+	// 获取所有活跃的 endpoints (包括已停机的, 缩容后的 worker 需同步下线以停止计费)
 	var endpoints []model.UserEndpoint
-	if err := j.db.Where("status IN ?", []string{"running", "deploying"}).Find(&endpoints).Error; err != nil {
+	if err := j.db.Where("status IN ?", []string{"running", "deploying", model.EndpointStatusSuspended}).Find(&endpoints).Error; err != nil {
+		run.Error()
 		logger.Infof("[WorkerSync] failed to list endpoints: %v", err)
 		return
 	}
 
-	// 按集群分组
-	clusterEndpoints := make(map[string][]model.UserEndpoint)
-	for _, ep := range endpoints {
-		clusterEndpoints[ep.ClusterID] = append(clusterEndpoints[ep.ClusterID], ep)
+	if len(endpoints) == 0 {
+		return
+	}
+	endpointByID := make(map[int64]*model.UserEndpoint, len(endpoints))
+	ids := make([]int64, 0, len(endpoints))
+	for i := range endpoints {
+		endpointByID[endpoints[i].ID] = &endpoints[i]
+		ids = append(ids, endpoints[i].ID)
+	}
+
+	// 按 placement 所在集群分组, 一个 endpoint 可部署在多个集群
+	var placements []model.EndpointPlacement
+	if err := j.db.Where("endpoint_id IN ? AND status IN ?", ids, model.PlacementDeployedStatuses).Find(&placements).Error; err != nil {
+		run.Error()
+		logger.Infof("[WorkerSync] failed to list endpoint placements: %v", err)
+		return
+	}
+	clusterEndpoints := make(map[string][]workerSyncTarget)
+	for _, p := range placements {
+		clusterEndpoints[p.ClusterID] = append(clusterEndpoints[p.ClusterID], workerSyncTarget{ep: endpointByID[p.EndpointID]})
+	}
+
+	// 镜像发布的新版本部署
+	var rollouts []model.EndpointRollout
+	if err := j.db.Where("endpoint_id IN ? AND status IN ? AND canary_physical_name != ''", ids, model.RolloutInProgressStatuses).Find(&rollouts).Error; err != nil {
+		run.Error()
+		logger.Infof("[WorkerSync] failed to list endpoint rollouts: %v", err)
+	}
+	for i := range rollouts {
+		r := &rollouts[i]
+		clusterEndpoints[r.ClusterID] = append(clusterEndpoints[r.ClusterID], workerSyncTarget{
+			ep: rolloutEndpoint(endpointByID[r.EndpointID], r), rolloutID: &r.ID,
+		})
 	}
 
 	// 遍历每个集群同步 workers
-	for clusterID, eps := range clusterEndpoints {
+	for clusterID, targets := range clusterEndpoints {
 		cluster, err := j.clusterService.GetCluster(ctx, clusterID)
 		if err != nil {
+			run.Error()
 			logger.Infof("[WorkerSync] failed to get cluster %s: %v", clusterID, err)
 			continue
 		}
 
-		client := waverless.NewClient(cluster.APIEndpoint, cluster.APIKey)
-		for _, ep := range eps {
-			j.syncEndpointWorkers(ctx, client, &ep)
+		client := waverless.NewClient(cluster.ClusterID, cluster.APIEndpoint, cluster.APIKey)
+		for _, t := range targets {
+			if err := j.syncEndpointWorkers(ctx, client, t.ep, clusterID, t.rolloutID); err != nil {
+				run.Error()
+			}
+			run.Processed(1)
 		}
 	}
 }
 
-func (j *WorkerSyncJob) syncEndpointWorkers(ctx context.Context, client *waverless.Client, ep *model.UserEndpoint) {
+// syncEndpointWorkers 同步 endpoint 在 clusterID 集群的 workers (rolloutID 不为空时为镜像发布新版本的 workers),
+// 返回获取远端 worker 列表的错误
+func (j *WorkerSyncJob) syncEndpointWorkers(ctx context.Context, client *waverless.Client, ep *model.UserEndpoint, clusterID string, rolloutID *int64) error {
 	workerList, err := client.GetEndpointWorkers(ctx, ep.PhysicalName)
 	if err != nil {
 		logger.Infof("[WorkerSync] failed to get workers for %s: %v", ep.PhysicalName, err)
-		return
+		return err
 	}
 
 	logger.Infof("[WorkerSync] endpoint %s got %d workers from waverless", ep.PhysicalName, len(workerList))
@@ -109,7 +181,8 @@ func (j *WorkerSyncJob) syncEndpointWorkers(ctx context.Context, client *waverle
 			worker = model.Worker{
 				WorkerID:      workerID,
 				EndpointID:    ep.ID,
-				ClusterID:     ep.ClusterID,
+				ClusterID:     clusterID,
+				RolloutID:     rolloutID,
 				UserID:        ep.UserID,
 				PodName:       getString(wm, "pod_name"),
 				Status:        getString(wm, "status"),
@@ -142,6 +215,15 @@ func (j *WorkerSyncJob) syncEndpointWorkers(ctx context.Context, client *waverle
 				logger.Infof("[WorkerSync] failed to create worker %s: %v", workerID, err)
 			}
 		} else if result.Error == nil {
+			// 已被抢占的 worker 为终态, 不再覆盖
+			if worker.Preempted {
+				continue
+			}
+			if preempted, at := preemption(wm); preempted {
+				j.markPreempted(ctx, client, ep, &worker, at, now)
+				continue
+			}
+
 			// 更新现有 worker
 			updates := map[string]interface{}{
 				"status":                getString(wm, "status"),
@@ -172,9 +254,9 @@ func (j *WorkerSyncJob) syncEndpointWorkers(ctx context.Context, client *waverle
 	// 处理本地存在但远端没返回的 workers
 	// 调用 waverless 的 /workers/:id 接口获取真实状态和终止时间
 	var existingWorkers []model.Worker
-	j.db.Where("endpoint_id = ? AND status NOT IN ?", ep.ID, []string{"OFFLINE"}).Find(&existingWorkers)
+	j.db.Where("endpoint_id = ? AND cluster_id = ? AND rollout_id <=> ? AND status NOT IN ?", ep.ID, clusterID, rolloutID, []string{"OFFLINE"}).Find(&existingWorkers)
 	for _, w := range existingWorkers {
-		if !seenWorkerIDs[w.WorkerID] {
+		if !seenWorkerIDs[w.WorkerID] && !w.Preempted {
 			// 查询远端 worker 详情
 			remoteWorker, err := client.GetWorker(ctx, w.WorkerID)
 			if err != nil {
@@ -188,6 +270,8 @@ func (j *WorkerSyncJob) syncEndpointWorkers(ctx context.Context, client *waverle
 					"pod_terminated_at": terminatedAt,
 					"updated_at":        now,
 				})
+			} else if preempted, at := preemption(remoteWorker); preempted {
+				j.markPreempted(ctx, client, ep, &w, at, now)
 			} else {
 				// 使用远端的真实状态和终止时间
 				updates := map[string]interface{}{
@@ -203,6 +287,94 @@ func (j *WorkerSyncJob) syncEndpointWorkers(ctx context.Context, client *waverle
 			}
 		}
 	}
+	return nil
+}
+
+// preemption 判断远端 worker 是否被抢占, 返回抢占时间 (未知时为空)
+func preemption(m map[string]interface{}) (bool, *time.Time) {
+	preempted, _ := m["preempted"].(bool)
+	if !preempted && getString(m, "termination_reason") != model.TerminationReasonPreempted && getString(m, "status") != "PREEMPTED" {
+		return false, nil
+	}
+	for _, key := range []string{"preempted_at", "terminated_at", "last_heartbeat"} {
+		if t := parseTime(m, key); t != nil {
+			return true, t
+		}
+	}
+	return true, nil
+}
+
+// markPreempted 记录 worker 被抢占: 计费截止到抢占时间, 并按 endpoint 设置处理进行中的任务
+func (j *WorkerSyncJob) markPreempted(ctx context.Context, client *waverless.Client, ep *model.UserEndpoint, w *model.Worker, at *time.Time, now time.Time) {
+	preemptedAt := now
+	if at != nil {
+		preemptedAt = *at
+	} else if w.LastHeartbeat != nil {
+		preemptedAt = *w.LastHeartbeat
+	}
+	if err := j.db.Model(w).Updates(map[string]interface{}{
+		"status":             "OFFLINE",
+		"preempted":          true,
+		"preempted_at":       preemptedAt,
+		"termination_reason": model.TerminationReasonPreempted,
+		"pod_terminated_at":  preemptedAt,
+		"updated_at":         now,
+	}).Error; err != nil {
+		logger.Infof("[WorkerSync] failed to mark worker %s preempted: %v", w.WorkerID, err)
+		return
+	}
+	logger.Infof("[WorkerSync] worker %s of endpoint %s preempted at %v", w.WorkerID, ep.PhysicalName, preemptedAt)
+
+	var tasks []model.TaskRouting
+	if err := j.db.Where("worker_id = ? AND status IN ?", w.WorkerID, []string{"PENDING", "IN_PROGRESS"}).Find(&tasks).Error; err != nil {
+		logger.Infof("[WorkerSync] failed to list tasks of preempted worker %s: %v", w.WorkerID, err)
+		return
+	}
+	for i := range tasks {
+		j.handlePreemptedTask(ctx, client, ep, &tasks[i], now)
+	}
+}
+
+// handlePreemptedTask 取消远端任务后重新提交到 endpoint 或标记失败; 重新提交失败时也标记失败
+func (j *WorkerSyncJob) handlePreemptedTask(ctx context.Context, client *waverless.Client, ep *model.UserEndpoint, task *model.TaskRouting, now time.Time) {
+	// 避免 waverless 侧重试与重新提交重复执行
+	client.CancelTask(ctx, task.TaskID)
+
+	if ep.PreemptionPolicy != model.PreemptionPolicyFail {
+		var input map[string]interface{}
+		if err := json.Unmarshal(task.Input, &input); err != nil {
+			logger.Infof("[WorkerSync] task %s has invalid input, mark failed: %v", task.TaskID, err)
+		} else if resp, err := client.SubmitTask(ctx, ep.PhysicalName, input); err != nil {
+			logger.Infof("[WorkerSync] failed to resubmit task %s, mark failed: %v", task.TaskID, err)
+		} else {
+			err := j.db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&model.TaskRouting{
+					TaskID: resp.ID, UserID: task.UserID, OrgID: task.OrgID, EndpointID: task.EndpointID, ClusterID: task.ClusterID,
+					Input: task.Input, Status: "PENDING", SubmittedAt: now, CreatedAt: &now, RolloutID: task.RolloutID,
+				}).Error; err != nil {
+					return err
+				}
+				return tx.Model(task).Updates(map[string]interface{}{
+					"status":              model.TaskStatusPreempted,
+					"resubmitted_task_id": resp.ID,
+					"completed_at":        now,
+				}).Error
+			})
+			if err != nil {
+				logger.Infof("[WorkerSync] failed to record resubmitted task %s -> %s: %v", task.TaskID, resp.ID, err)
+				return
+			}
+			logger.Infof("[WorkerSync] task %s resubmitted as %s after preemption", task.TaskID, resp.ID)
+			return
+		}
+	}
+
+	if err := j.db.Model(task).Updates(map[string]interface{}{
+		"status":       "FAILED",
+		"completed_at": now,
+	}).Error; err != nil {
+		logger.Infof("[WorkerSync] failed to mark task %s failed: %v", task.TaskID, err)
+	}
 }
 
 // 辅助函数
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+)
+
+// BillingPolicyService 规格计费策略 (取整/最低消费/冷启动免费/空闲折扣)
+type BillingPolicyService struct {
+	repo     *mysql.BillingPolicyRepo
+	specRepo *mysql.SpecRepo
+}
+
+func NewBillingPolicyService(repo *mysql.BillingPolicyRepo, specRepo *mysql.SpecRepo) *BillingPolicyService {
+	return &BillingPolicyService{repo: repo, specRepo: specRepo}
+}
+
+// ForSpec 获取规格当前的计费策略, 未配置时返回默认策略
+func (s *BillingPolicyService) ForSpec(ctx context.Context, specName string) *model.BillingPolicy {
+	spec, err := s.specRepo.GetByName(ctx, specName)
+	if err != nil || spec.BillingPolicyID == nil {
+		return model.DefaultBillingPolicy()
+	}
+	policy, err := s.repo.GetByID(ctx, *spec.BillingPolicyID)
+	if err != nil {
+		logger.WarnCtx(ctx, "[BillingPolicy] policy %d of spec %s not found, use default: %v", *spec.BillingPolicyID, specName, err)
+		return model.DefaultBillingPolicy()
+	}
+	return policy
+}
+
+func (s *BillingPolicyService) List(ctx context.Context, latestOnly bool) ([]model.BillingPolicy, error) {
+	return s.repo.List(ctx, latestOnly)
+}
+
+func (s *BillingPolicyService) Get(ctx context.Context, id int64) (*model.BillingPolicy, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// Create 创建策略 (版本 1)
+func (s *BillingPolicyService) Create(ctx context.Context, policy *model.BillingPolicy) error {
+	if policy.Name == "" {
+		return errors.New("name is required")
+	}
+	if err := validatePolicy(policy); err != nil {
+		return err
+	}
+	policy.ID = 0
+	policy.Version = 1
+	return s.repo.Create(ctx, policy)
+}
+
+// CreateVersion 基于已有策略生成新版本, 使用旧版本的规格自动切换到新版本
+func (s *BillingPolicyService) CreateVersion(ctx context.Context, oldID int64, policy *model.BillingPolicy) error {
+	old, err := s.repo.GetByID(ctx, oldID)
+	if err != nil {
+		return err
+	}
+	if err := validatePolicy(policy); err != nil {
+		return err
+	}
+	policy.ID = 0
+	policy.Name = old.Name
+	policy.Version = old.Version + 1
+	return s.repo.CreateVersion(ctx, oldID, policy)
+}
+
+func validatePolicy(p *model.BillingPolicy) error {
+	if p.Rounding == "" {
+		p.Rounding = model.BillingRoundingSecond
+	}
+	if p.Rounding != model.BillingRoundingSecond && p.Rounding != model.BillingRoundingMinute {
+		return fmt.Errorf("rounding must be %s or %s", model.BillingRoundingSecond, model.BillingRoundingMinute)
+	}
+	if p.MinBillableSeconds < 0 || p.MinimumChargeSeconds < 0 || p.ColdStartFreeSeconds < 0 {
+		return errors.New("seconds must not be negative")
+	}
+	if p.IdleDiscountPercent < 0 || p.IdleDiscountPercent > 100 {
+		return errors.New("idle_discount_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+// ChargeInput 一次出账的输入
+type ChargeInput struct {
+	Segments           []PriceSegment // 按价格拆分的计费时段
+	PodStartedAt       time.Time
+	ColdStartMs        *int64 // 为空表示冷启动时长未知, 不免费
+	BusySeconds        int64  // 本次时段内的任务执行时长
+	PriorBilledSeconds int64  // worker 此前已出账的时长
+	Final              bool   // worker 已终止, 本次为最后一次出账
+}
+
+// Charge 单个价格时段的计费结果
+type Charge struct {
+	Segment       PriceSegment
+	BilledSeconds int64 // 实际计费秒数 (含取整/最低消费补足, 不含免费部分)
+	FreeSeconds   int64
+	IdleSeconds   int64
+	Amount        int64
+}
+
+// ComputeCharges 按策略计算每个价格时段的费用
+func ComputeCharges(policy *model.BillingPolicy, in *ChargeInput) []Charge {
+	var total int64
+	for _, seg := range in.Segments {
+		total += seg.Seconds()
+	}
+
+	// 冷启动免费区间 [PodStartedAt, freeEnd)
+	freeEnd := in.PodStartedAt
+	if policy.ColdStartFreeSeconds > 0 && in.ColdStartMs != nil {
+		free := *in.ColdStartMs / 1000
+		if free > policy.ColdStartFreeSeconds {
+			free = policy.ColdStartFreeSeconds
+		}
+		freeEnd = in.PodStartedAt.Add(time.Duration(free) * time.Second)
+	}
+
+	// worker 结束时: 按分钟取整补足, 再补足生命周期最低消费
+	var extra int64
+	if in.Final {
+		if unit := policy.RoundingUnit(); total%unit != 0 {
+			extra = unit - total%unit
+		}
+		if lifetime := in.PriorBilledSeconds + total + extra; lifetime < policy.MinimumChargeSeconds {
+			extra += policy.MinimumChargeSeconds - lifetime
+		}
+	}
+
+	// 空闲时长按各时段计费秒数比例分摊
+	var idleTotal int64
+	if policy.IdleDiscountPercent > 0 && total > in.BusySeconds {
+		idleTotal = total - in.BusySeconds
+	}
+
+	// 默认策略沿用原有的向下取整, 配置的计费策略四舍五入到 1/1000000
+	var half int64
+	if policy.ID > 0 {
+		half = 180000
+	}
+
+	charges := make([]Charge, len(in.Segments))
+	for i, seg := range in.Segments {
+		c := Charge{Segment: seg, FreeSeconds: overlapSeconds(seg.Start, seg.End, in.PodStartedAt, freeEnd)}
+		billable := seg.Seconds() - c.FreeSeconds
+		if total > 0 {
+			c.IdleSeconds = idleTotal * billable / total
+		}
+		if i == len(in.Segments)-1 {
+			billable += extra
+		}
+		c.BilledSeconds = billable
+
+		// 金额 = 价格 * (全价秒数 + 空闲秒数 * 折后比例) / 3600
+		weighted := (billable-c.IdleSeconds)*100 + c.IdleSeconds*int64(100-policy.IdleDiscountPercent)
+		c.Amount = (seg.PricePerHour*weighted + half) / 360000
+		charges[i] = c
+	}
+	return charges
+}
+
+// overlapSeconds 区间 [aStart, aEnd) 与 [bStart, bEnd) 的重叠秒数
+func overlapSeconds(aStart, aEnd, bStart, bEnd time.Time) int64 {
+	start, end := aStart, aEnd
+	if bStart.After(start) {
+		start = bStart
+	}
+	if bEnd.Before(end) {
+		end = bEnd
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return int64(end.Sub(start).Seconds())
+}
@@ -2,34 +2,552 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
 	"time"
 
+	"github.com/wavespeedai/waverless-portal/pkg/rocketmq"
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
 )
 
 type BillingService struct {
 	repo         *mysql.BillingRepo
 	userRepo     *mysql.UserRepo
 	endpointRepo *mysql.EndpointRepo
+	currencies   *CurrencyService
 }
 
-func NewBillingService(repo *mysql.BillingRepo, userRepo *mysql.UserRepo, endpointRepo *mysql.EndpointRepo) *BillingService {
-	return &BillingService{repo: repo, userRepo: userRepo, endpointRepo: endpointRepo}
+func NewBillingService(repo *mysql.BillingRepo, userRepo *mysql.UserRepo, endpointRepo *mysql.EndpointRepo, currencies *CurrencyService) *BillingService {
+	return &BillingService{repo: repo, userRepo: userRepo, endpointRepo: endpointRepo, currencies: currencies}
 }
 
-func (s *BillingService) GetUsageStats(ctx context.Context, userID string, from, to time.Time) (map[string]interface{}, error) {
-	totalAmount, totalSeconds, err := s.repo.GetUsageStats(ctx, userID, from, to)
+// OrgCurrency 组织计费币种 (组织流水均为该币种)
+func (s *BillingService) OrgCurrency(ctx context.Context, orgID string) (string, error) {
+	if s.currencies == nil {
+		return model.DefaultCurrency, nil
+	}
+	return s.currencies.OrgCurrency(ctx, orgID)
+}
+
+// convert 将 from 币种的金额按当前汇率换算为 to 币种 (组织切换币种前的流水为旧币种)
+func (s *BillingService) convert(ctx context.Context, amount int64, from, to string) (int64, error) {
+	if s.currencies == nil {
+		return amount, nil
+	}
+	return s.currencies.Convert(ctx, amount, from, to, time.Now())
+}
+
+// GetUsageStats 组织用量汇总 (含调账), 金额换算为组织计费币种
+func (s *BillingService) GetUsageStats(ctx context.Context, orgID string, from, to time.Time) (map[string]interface{}, error) {
+	currency, err := s.OrgCurrency(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.GetOrgUsageStats(ctx, orgID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var totalAmount, totalSeconds int64
+	for _, st := range stats {
+		amount, err := s.convert(ctx, st.TotalAmount, st.Currency, currency)
+		if err != nil {
+			return nil, err
+		}
+		totalAmount += amount
+		totalSeconds += st.TotalSeconds
+	}
+	adjustments, err := s.repo.GetAdjustmentStats(ctx, orgID, from, to)
 	if err != nil {
 		return nil, err
 	}
+	var adjustmentAmount int64
+	for _, adj := range adjustments {
+		amount, err := s.convert(ctx, adj.Amount, adj.Currency, currency)
+		if err != nil {
+			return nil, err
+		}
+		adjustmentAmount += amount
+	}
 	return map[string]interface{}{
-		"total_amount":  totalAmount,
-		"total_seconds": totalSeconds,
-		"from":          from,
-		"to":            to,
+		"total_amount":      totalAmount,
+		"adjustment_amount": adjustmentAmount,
+		"net_amount":        totalAmount + adjustmentAmount,
+		"total_seconds":     totalSeconds,
+		"currency":          currency,
+		"from":              from,
+		"to":                to,
 	}, nil
 }
 
-func (s *BillingService) GetWorkerBillingRecords(ctx context.Context, userID string, limit, offset int) ([]mysql.BillingTransactionWithEndpoint, int64, error) {
-	return s.repo.ListTransactions(ctx, userID, limit, offset)
+// GetUsageByTag 按标签 key 分组统计用量 (按计费时的标签快照归属), 金额换算为组织计费币种, 按金额降序
+func (s *BillingService) GetUsageByTag(ctx context.Context, orgID, tagKey string, from, to time.Time) ([]mysql.TagUsage, error) {
+	if err := ValidateTags(map[string]string{tagKey: ""}); err != nil {
+		return nil, err
+	}
+	currency, err := s.OrgCurrency(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.repo.GetUsageByTag(ctx, orgID, tagKey, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged []mysql.TagUsage
+	index := make(map[string]int)
+	for _, r := range rows {
+		if r.Amount, err = s.convert(ctx, r.Amount, r.Currency, currency); err != nil {
+			return nil, err
+		}
+		if r.AdjustmentAmount, err = s.convert(ctx, r.AdjustmentAmount, r.Currency, currency); err != nil {
+			return nil, err
+		}
+		r.Currency = currency
+		key := mysql.TagValueKey(r.TagValue)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, r)
+			continue
+		}
+		merged[i].Amount += r.Amount
+		merged[i].AdjustmentAmount += r.AdjustmentAmount
+		merged[i].DurationSeconds += r.DurationSeconds
+		merged[i].TransactionCount += r.TransactionCount
+	}
+	sort.SliceStable(merged, func(a, b int) bool {
+		return merged[a].Amount > merged[b].Amount
+	})
+	return merged, nil
+}
+
+func (s *BillingService) GetWorkerBillingRecords(ctx context.Context, orgID string, limit, offset int) ([]mysql.BillingTransactionWithEndpoint, int64, error) {
+	return s.repo.ListTransactions(ctx, orgID, limit, offset)
+}
+
+// GetAdjustmentSums 按流水 ID 汇总调账金额
+func (s *BillingService) GetAdjustmentSums(ctx context.Context, transactionIDs []int64) (map[int64]int64, error) {
+	return s.repo.SumAdjustmentsByTransactions(ctx, transactionIDs)
+}
+
+func (s *BillingService) ListAdjustments(ctx context.Context, userID string, limit, offset int) ([]model.BillingAdjustment, int64, error) {
+	return s.repo.ListAdjustments(ctx, userID, limit, offset)
+}
+
+// AdjustmentRequest 管理员调账请求
+type AdjustmentRequest struct {
+	TransactionIDs []int64
+	Type           string // credit, debit
+	Amount         int64  // 每条流水的调账金额 (正数), credit 为 0 时退还剩余全部金额
+	Reason         string
+	RequestID      string // 调用方幂等 ID, 为空时每次请求都生成新调账
+	AdminEmail     string
+}
+
+// CreateAdjustments 为每条原始流水创建一条调账记录并写入 outbox, 全部成功或全部失败
+func (s *BillingService) CreateAdjustments(ctx context.Context, req *AdjustmentRequest) ([]model.BillingAdjustment, error) {
+	if len(req.TransactionIDs) == 0 {
+		return nil, errors.New("transaction_ids is required")
+	}
+	if req.Reason == "" {
+		return nil, errors.New("reason is required")
+	}
+	if req.AdminEmail == "" {
+		return nil, errors.New("admin email is required")
+	}
+	if req.Type != model.AdjustmentTypeCredit && req.Type != model.AdjustmentTypeDebit {
+		return nil, errors.New("type must be credit or debit")
+	}
+	if req.Amount < 0 || (req.Type == model.AdjustmentTypeDebit && req.Amount == 0) {
+		return nil, errors.New("amount must be positive")
+	}
+
+	nonce := time.Now().UnixNano()
+	var adjustments []model.BillingAdjustment
+	err := s.repo.Transaction(ctx, func(billingTx *mysql.BillingRepo, _ *mysql.UserRepo) error {
+		adjustments = adjustments[:0]
+		for _, txID := range req.TransactionIDs {
+			key := fmt.Sprintf("portal-adj-%d-%d", txID, nonce)
+			if req.RequestID != "" {
+				key = fmt.Sprintf("portal-adj-%s-%d", req.RequestID, txID)
+			}
+
+			// 重复请求直接返回已有记录
+			if existing, err := billingTx.GetAdjustmentByKey(ctx, key); err == nil {
+				adjustments = append(adjustments, *existing)
+				continue
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			adj, err := s.createAdjustment(ctx, billingTx, txID, key, req)
+			if err != nil {
+				return err
+			}
+			adjustments = append(adjustments, *adj)
+		}
+		return nil
+	})
+	return adjustments, err
+}
+
+func (s *BillingService) createAdjustment(ctx context.Context, billingTx *mysql.BillingRepo, txID int64, key string, req *AdjustmentRequest) (*model.BillingAdjustment, error) {
+	// 锁定原始流水, 避免并发退款超出原金额
+	tx, err := billingTx.GetTransactionForUpdate(ctx, txID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("transaction %d not found", txID)
+		}
+		return nil, err
+	}
+	sums, err := billingTx.SumAdjustmentsByTransactions(ctx, []int64{txID})
+	if err != nil {
+		return nil, err
+	}
+	remaining := tx.Amount + sums[txID]
+
+	amount := req.Amount
+	if req.Type == model.AdjustmentTypeCredit {
+		if amount == 0 {
+			amount = remaining
+		}
+		if amount <= 0 || amount > remaining {
+			return nil, fmt.Errorf("credit %d exceeds remaining amount %d of transaction %d", amount, remaining, txID)
+		}
+		amount = -amount
+	}
+
+	adj := &model.BillingAdjustment{
+		TransactionID:  tx.ID,
+		UserID:         tx.UserID,
+		OrgID:          tx.OrgID,
+		EndpointID:     tx.EndpointID,
+		WorkerID:       tx.WorkerID,
+		Type:           req.Type,
+		Amount:         amount,
+		Currency:       tx.Currency,
+		Reason:         req.Reason,
+		AdminEmail:     req.AdminEmail,
+		IdempotencyKey: key,
+		DeliveryStatus: model.DeliveryStatusPending,
+	}
+	if err := billingTx.CreateAdjustment(ctx, adj); err != nil {
+		return nil, err
+	}
+
+	// 主站调账消息写入 outbox, 由 BillingOutboxDispatcher 投递
+	payload, err := rocketmq.NewBillingPayload(&rocketmq.BillingMessage{
+		UserID:            tx.UserID,
+		OrgID:             tx.OrgID,
+		RequestID:         key,
+		EndpointID:        tx.EndpointID,
+		WorkerID:          tx.WorkerID,
+		Amount:            amount,
+		Currency:          tx.Currency,
+		Service:           "waverless-portal",
+		AdjustmentID:      adj.ID,
+		OriginalRequestID: tx.MessageKey(),
+		Reason:            req.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := billingTx.CreateOutbox(ctx, &model.BillingOutbox{
+		AdjustmentID: adj.ID,
+		Topic:        rocketmq.TopicMeteringBilling,
+		Tag:          rocketmq.TagBillingAdjust,
+		MessageKey:   key,
+		Payload:      string(payload),
+		Status:       model.DeliveryStatusPending,
+		NextRetryAt:  time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	return adj, nil
+}
+
+// 用量明细时间粒度
+const (
+	UsageIntervalDay  = "day"
+	UsageIntervalHour = "hour"
+
+	// 按天分组 (group_by=day)
+	UsageDimDay = "day"
+
+	maxUsageRangeDays     = 366
+	maxUsageHourRangeDays = 31
+)
+
+// UsageBreakdownRequest 用量明细请求
+type UsageBreakdownRequest struct {
+	OrgID    string
+	From, To time.Time
+	GroupBy  []string // endpoint, spec, gpu_type, cluster, day
+	Location *time.Location
+}
+
+// UsageBreakdownItem 用量明细分组
+type UsageBreakdownItem struct {
+	Day              string `json:"day,omitempty"` // 本地日期 YYYY-MM-DD
+	EndpointID       int64  `json:"endpoint_id,omitempty"`
+	EndpointName     string `json:"endpoint_name,omitempty"`
+	SpecName         string `json:"spec_name,omitempty"`
+	GPUType          string `json:"gpu_type,omitempty"`
+	ClusterID        string `json:"cluster_id,omitempty"`
+	Amount           int64  `json:"amount"`
+	AdjustmentAmount int64  `json:"adjustment_amount"`
+	DurationSeconds  int64  `json:"duration_seconds"`
+	TransactionCount int64  `json:"transaction_count"`
+}
+
+// GetUsageBreakdown 按 endpoint/规格/GPU/集群/本地日期分组统计用量, 按金额降序
+func (s *BillingService) GetUsageBreakdown(ctx context.Context, req *UsageBreakdownRequest) ([]UsageBreakdownItem, error) {
+	if err := validateUsageRange(req.From, req.To, maxUsageRangeDays); err != nil {
+		return nil, err
+	}
+	q := &mysql.UsageBreakdownQuery{OrgID: req.OrgID, From: req.From, To: req.To}
+	for _, dim := range req.GroupBy {
+		switch dim {
+		case UsageDimDay:
+			q.BucketSeconds = 86400
+			q.Offsets = tzOffsets(req.Location, req.From, req.To)
+		case mysql.UsageDimEndpoint, mysql.UsageDimSpec, mysql.UsageDimGPUType, mysql.UsageDimCluster:
+			q.Dimensions = append(q.Dimensions, dim)
+		default:
+			return nil, fmt.Errorf("unsupported group_by %q", dim)
+		}
+	}
+
+	rows, err := s.usageRows(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]UsageBreakdownItem, len(rows))
+	for i, r := range rows {
+		items[i] = UsageBreakdownItem{
+			EndpointID: r.EndpointID, EndpointName: r.EndpointName, SpecName: r.SpecName,
+			GPUType: r.GPUType, ClusterID: r.ClusterID,
+			Amount: r.Amount, AdjustmentAmount: r.AdjustmentAmount,
+			DurationSeconds: r.DurationSeconds, TransactionCount: r.TransactionCount,
+		}
+		if r.Bucket != nil {
+			items[i].Day = bucketTime(*r.Bucket, 86400, req.Location).Format("2006-01-02")
+		}
+	}
+	sort.SliceStable(items, func(a, b int) bool {
+		if items[a].Day != items[b].Day {
+			return items[a].Day < items[b].Day
+		}
+		return items[a].Amount > items[b].Amount
+	})
+	return items, nil
+}
+
+// UsageTimeSeriesRequest 用量时间序列请求
+type UsageTimeSeriesRequest struct {
+	OrgID    string
+	From, To time.Time
+	Interval string // day, hour
+	GroupBy  string // 为空表示总量, 或 endpoint, spec, gpu_type, cluster
+	Location *time.Location
+}
+
+// UsageSeries 一条时间序列 (与 Buckets 一一对应, 无用量的桶补 0)
+type UsageSeries struct {
+	Key              string  `json:"key"`
+	Name             string  `json:"name"`
+	Amounts          []int64 `json:"amounts"`
+	DurationSeconds  []int64 `json:"duration_seconds"`
+	TotalAmount      int64   `json:"total_amount"`
+	TotalAdjustments int64   `json:"total_adjustments"`
+}
+
+// UsageTimeSeries 用量时间序列 (用于图表)
+type UsageTimeSeries struct {
+	Interval string        `json:"interval"`
+	Timezone string        `json:"timezone"`
+	Buckets  []time.Time   `json:"buckets"` // 每个桶的本地起始时间
+	Series   []UsageSeries `json:"series"`
+}
+
+// GetUsageTimeSeries 按本地日/小时统计用量, 可按一个维度拆分成多条序列
+func (s *BillingService) GetUsageTimeSeries(ctx context.Context, req *UsageTimeSeriesRequest) (*UsageTimeSeries, error) {
+	var bucketSeconds int64
+	switch req.Interval {
+	case UsageIntervalDay:
+		bucketSeconds = 86400
+		if err := validateUsageRange(req.From, req.To, maxUsageRangeDays); err != nil {
+			return nil, err
+		}
+	case UsageIntervalHour:
+		bucketSeconds = 3600
+		if err := validateUsageRange(req.From, req.To, maxUsageHourRangeDays); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported interval %q", req.Interval)
+	}
+
+	q := &mysql.UsageBreakdownQuery{
+		OrgID: req.OrgID, From: req.From, To: req.To,
+		BucketSeconds: bucketSeconds, Offsets: tzOffsets(req.Location, req.From, req.To),
+	}
+	switch req.GroupBy {
+	case "":
+	case mysql.UsageDimEndpoint, mysql.UsageDimSpec, mysql.UsageDimGPUType, mysql.UsageDimCluster:
+		q.Dimensions = []string{req.GroupBy}
+	default:
+		return nil, fmt.Errorf("unsupported group_by %q", req.GroupBy)
+	}
+
+	rows, err := s.usageRows(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按本地时间生成完整的桶序列
+	first := localBucket(req.From, bucketSeconds, req.Location)
+	last := localBucket(req.To.Add(-time.Nanosecond), bucketSeconds, req.Location)
+	ts := &UsageTimeSeries{Interval: req.Interval, Timezone: req.Location.String()}
+	for b := first; b <= last; b++ {
+		ts.Buckets = append(ts.Buckets, bucketTime(b, bucketSeconds, req.Location))
+	}
+
+	index := make(map[string]int)
+	for _, r := range rows {
+		if r.Bucket == nil || *r.Bucket < first || *r.Bucket > last {
+			continue
+		}
+		key, name := "total", "total"
+		switch req.GroupBy {
+		case mysql.UsageDimEndpoint:
+			key, name = fmt.Sprintf("%d", r.EndpointID), r.EndpointName
+		case mysql.UsageDimSpec:
+			key, name = r.SpecName, r.SpecName
+		case mysql.UsageDimGPUType:
+			key, name = r.GPUType, r.GPUType
+		case mysql.UsageDimCluster:
+			key, name = r.ClusterID, r.ClusterID
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(ts.Series)
+			index[key] = i
+			ts.Series = append(ts.Series, UsageSeries{
+				Key: key, Name: name,
+				Amounts:         make([]int64, len(ts.Buckets)),
+				DurationSeconds: make([]int64, len(ts.Buckets)),
+			})
+		}
+		series := &ts.Series[i]
+		pos := *r.Bucket - first
+		series.Amounts[pos] += r.Amount + r.AdjustmentAmount
+		series.DurationSeconds[pos] += r.DurationSeconds
+		series.TotalAmount += r.Amount + r.AdjustmentAmount
+		series.TotalAdjustments += r.AdjustmentAmount
+	}
+	sort.SliceStable(ts.Series, func(a, b int) bool {
+		return ts.Series[a].TotalAmount > ts.Series[b].TotalAmount
+	})
+	return ts, nil
+}
+
+// usageRows 查询用量明细并换算为组织计费币种, 合并各币种的同一分组
+func (s *BillingService) usageRows(ctx context.Context, q *mysql.UsageBreakdownQuery) ([]mysql.UsageBreakdownRow, error) {
+	currency, err := s.OrgCurrency(ctx, q.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.repo.GetUsageBreakdown(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged []mysql.UsageBreakdownRow
+	index := make(map[string]int)
+	for _, r := range rows {
+		if r.Amount, err = s.convert(ctx, r.Amount, r.Currency, currency); err != nil {
+			return nil, err
+		}
+		if r.AdjustmentAmount, err = s.convert(ctx, r.AdjustmentAmount, r.Currency, currency); err != nil {
+			return nil, err
+		}
+		r.Currency = currency
+		bucket := "-"
+		if r.Bucket != nil {
+			bucket = fmt.Sprintf("%d", *r.Bucket)
+		}
+		key := fmt.Sprintf("%s|%d|%s|%s|%s", bucket, r.EndpointID, r.SpecName, r.GPUType, r.ClusterID)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, r)
+			continue
+		}
+		merged[i].Amount += r.Amount
+		merged[i].AdjustmentAmount += r.AdjustmentAmount
+		merged[i].DurationSeconds += r.DurationSeconds
+		merged[i].TransactionCount += r.TransactionCount
+	}
+	return merged, nil
+}
+
+func validateUsageRange(from, to time.Time, maxDays int) error {
+	if !to.After(from) {
+		return errors.New("to must be after from")
+	}
+	if to.Sub(from) > time.Duration(maxDays)*24*time.Hour {
+		return fmt.Errorf("time range must not exceed %d days", maxDays)
+	}
+	return nil
+}
+
+// tzOffsets 计算 [from, to] 内时区偏移的变化区间 (夏令时切换), 供 SQL 换算本地时间
+func tzOffsets(loc *time.Location, from, to time.Time) []mysql.TZOffset {
+	_, offset := from.In(loc).Zone()
+	var offsets []mysql.TZOffset
+	prev := from
+	for t := from.Add(15 * time.Minute); ; t = t.Add(15 * time.Minute) {
+		if t.After(to) {
+			t = to
+		}
+		if _, o := t.In(loc).Zone(); o != offset {
+			// 二分查找切换时刻 (精确到秒)
+			lo, hi := prev.Unix(), t.Unix()
+			for lo+1 < hi {
+				mid := (lo + hi) / 2
+				if _, mo := time.Unix(mid, 0).In(loc).Zone(); mo == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			offsets = append(offsets, mysql.TZOffset{Until: hi, Offset: offset})
+			offset = o
+		}
+		if !t.Before(to) {
+			break
+		}
+		prev = t
+	}
+	return append(offsets, mysql.TZOffset{Offset: offset})
+}
+
+// localBucket 时间 t 在本地时间下的桶序号
+func localBucket(t time.Time, bucketSeconds int64, loc *time.Location) int64 {
+	_, offset := t.In(loc).Zone()
+	local := t.Unix() + int64(offset)
+	if local < 0 {
+		return (local - bucketSeconds + 1) / bucketSeconds
+	}
+	return local / bucketSeconds
+}
+
+// bucketTime 桶序号对应的本地起始时间
+func bucketTime(bucket, bucketSeconds int64, loc *time.Location) time.Time {
+	wall := time.Unix(bucket*bucketSeconds, 0).UTC()
+	return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), 0, 0, 0, loc)
 }
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/config"
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+// ErrBudgetExceeded 用户日/月预算已用完
+var ErrBudgetExceeded = errors.New("budget limit exceeded")
+
+// BudgetService 成员日/月预算: 预算按用户设置, 在其所属的每个组织内分别统计和执行.
+// 流水记在 endpoint 创建者名下, 因此成员的消费只包含其在该组织创建的 endpoint, 超限时也只停机这些 endpoint;
+// 成员使用他人创建的 endpoint 产生的消费计入创建者的预算, 一个成员超限不会停机其他成员的 endpoint
+type BudgetService struct {
+	prefsRepo       *mysql.PreferencesRepo
+	billingRepo     *mysql.BillingRepo
+	endpointRepo    *mysql.EndpointRepo
+	endpointService *EndpointService
+	currencies      *CurrencyService
+}
+
+func NewBudgetService(prefsRepo *mysql.PreferencesRepo, billingRepo *mysql.BillingRepo, endpointRepo *mysql.EndpointRepo, endpointService *EndpointService, currencies *CurrencyService) *BudgetService {
+	return &BudgetService{prefsRepo: prefsRepo, billingRepo: billingRepo, endpointRepo: endpointRepo, endpointService: endpointService, currencies: currencies}
+}
+
+// BudgetUsage 单个预算周期的消费情况
+type BudgetUsage struct {
+	PeriodType  string    `json:"period_type"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Spent       int64     `json:"spent"`
+	Limit       int64     `json:"limit"` // 0 表示不限制
+	Percent     float64   `json:"percent"`
+	Exceeded    bool      `json:"exceeded"`
+}
+
+// BudgetStatus 用户当前预算状态
+type BudgetStatus struct {
+	Daily    BudgetUsage `json:"daily"`
+	Monthly  BudgetUsage `json:"monthly"`
+	Exceeded bool        `json:"exceeded"`
+}
+
+// GetPreferences 获取用户偏好, 不存在时返回默认值
+func (s *BudgetService) GetPreferences(ctx context.Context, userID string) (*model.UserPreferences, error) {
+	prefs, err := s.prefsRepo.Get(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultPreferences(userID), nil
+	}
+	return prefs, err
+}
+
+// UpdatePreferences 更新用户偏好 (不存在时创建)
+func (s *BudgetService) UpdatePreferences(ctx context.Context, prefs *model.UserPreferences) error {
+	if prefs.DailyBudgetLimit < 0 || prefs.MonthlyBudgetLimit < 0 {
+		return errors.New("budget limit must not be negative")
+	}
+	return s.prefsRepo.Save(ctx, prefs)
+}
+
+// DeletePreferences 重置用户偏好为默认值
+func (s *BudgetService) DeletePreferences(ctx context.Context, userID string) error {
+	return s.prefsRepo.Delete(ctx, userID)
+}
+
+func (s *BudgetService) ListAlerts(ctx context.Context, orgID, userID string, limit int) ([]model.BudgetAlert, error) {
+	return s.prefsRepo.ListAlerts(ctx, orgID, userID, limit)
+}
+
+// GetBudgetStatus 统计成员在组织内当日/当月消费
+func (s *BudgetService) GetBudgetStatus(ctx context.Context, orgID, userID string) (*BudgetStatus, error) {
+	prefs, err := s.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.budgetStatus(ctx, orgID, prefs, time.Now())
+}
+
+// CheckBudget 成员在组织内的预算已用完时返回 ErrBudgetExceeded (扩容前调用)
+func (s *BudgetService) CheckBudget(ctx context.Context, orgID, userID string) error {
+	status, err := s.GetBudgetStatus(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if status.Exceeded {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+// Enforce 按组织检查用户预算: 达到阈值时记录告警, 超限时将用户在该组织创建的 endpoint 缩容到 0
+func (s *BudgetService) Enforce(ctx context.Context, userID string) {
+	prefs, err := s.prefsRepo.Get(ctx, userID)
+	if err != nil {
+		return // 未设置偏好即无预算限制
+	}
+	if prefs.DailyBudgetLimit <= 0 && prefs.MonthlyBudgetLimit <= 0 {
+		return
+	}
+
+	endpoints, err := s.endpointRepo.ListByUser(ctx, userID)
+	if err != nil {
+		logger.ErrorCtx(ctx, "[Budget] list endpoints for user %s error: %v", userID, err)
+		return
+	}
+	byOrg := make(map[string][]model.UserEndpoint)
+	for _, ep := range endpoints {
+		if ep.OrgID != "" {
+			byOrg[ep.OrgID] = append(byOrg[ep.OrgID], ep)
+		}
+	}
+
+	now := time.Now()
+	for orgID, orgEndpoints := range byOrg {
+		s.enforceOrg(ctx, orgID, prefs, orgEndpoints, now)
+	}
+}
+
+func (s *BudgetService) enforceOrg(ctx context.Context, orgID string, prefs *model.UserPreferences, endpoints []model.UserEndpoint, now time.Time) {
+	userID := prefs.UserID
+	status, err := s.budgetStatus(ctx, orgID, prefs, now)
+	if err != nil {
+		logger.ErrorCtx(ctx, "[Budget] get budget status for user %s in org %s error: %v", userID, orgID, err)
+		return
+	}
+
+	for _, usage := range []BudgetUsage{status.Daily, status.Monthly} {
+		if usage.Limit <= 0 {
+			continue
+		}
+		for _, threshold := range warnThresholds() {
+			if usage.Percent >= float64(threshold) {
+				s.recordAlert(ctx, orgID, userID, usage, threshold, "warn")
+			}
+		}
+		if usage.Exceeded {
+			s.recordAlert(ctx, orgID, userID, usage, 100, "suspend")
+		}
+	}
+
+	if status.Daily.Exceeded {
+		s.suspendEndpoints(ctx, orgID, userID, endpoints, "daily budget exceeded")
+	} else if status.Monthly.Exceeded {
+		s.suspendEndpoints(ctx, orgID, userID, endpoints, "monthly budget exceeded")
+	}
+}
+
+func (s *BudgetService) budgetStatus(ctx context.Context, orgID string, prefs *model.UserPreferences, now time.Time) (*BudgetStatus, error) {
+	// 预算金额为组织计费币种, 其他币种的流水按当前汇率换算
+	currency := model.DefaultCurrency
+	if s.currencies != nil {
+		var err error
+		if currency, err = s.currencies.OrgCurrency(ctx, orgID); err != nil {
+			return nil, err
+		}
+	}
+
+	now = now.In(budgetLocation())
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	daily, err := s.usage(ctx, orgID, prefs.UserID, currency, now, model.BudgetPeriodDaily, dayStart, dayStart.AddDate(0, 0, 1), prefs.DailyBudgetLimit)
+	if err != nil {
+		return nil, err
+	}
+	monthly, err := s.usage(ctx, orgID, prefs.UserID, currency, now, model.BudgetPeriodMonthly, monthStart, monthStart.AddDate(0, 1, 0), prefs.MonthlyBudgetLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &BudgetStatus{Daily: *daily, Monthly: *monthly, Exceeded: daily.Exceeded || monthly.Exceeded}, nil
+}
+
+func (s *BudgetService) usage(ctx context.Context, orgID, userID, currency string, now time.Time, periodType string, from, to time.Time, limit int64) (*BudgetUsage, error) {
+	rows, err := s.billingRepo.GetMemberUsageByCurrency(ctx, orgID, userID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	var spent int64
+	for _, row := range rows {
+		amount := row.Amount
+		if s.currencies != nil {
+			if amount, err = s.currencies.Convert(ctx, row.Amount, row.Currency, currency, now); err != nil {
+				return nil, err
+			}
+		}
+		spent += amount
+	}
+	u := &BudgetUsage{PeriodType: periodType, PeriodStart: from, PeriodEnd: to, Spent: spent, Limit: limit}
+	if limit > 0 {
+		u.Percent = float64(spent) * 100 / float64(limit)
+		u.Exceeded = spent >= limit
+	}
+	return u, nil
+}
+
+func (s *BudgetService) recordAlert(ctx context.Context, orgID, userID string, usage BudgetUsage, threshold int, action string) {
+	created, err := s.prefsRepo.CreateAlert(ctx, &model.BudgetAlert{
+		OrgID: orgID, UserID: userID, PeriodType: usage.PeriodType, PeriodStart: usage.PeriodStart.UTC(), Threshold: threshold,
+		Spent: usage.Spent, BudgetLimit: usage.Limit, Action: action,
+	})
+	if err != nil {
+		logger.ErrorCtx(ctx, "[Budget] record alert for user %s in org %s error: %v", userID, orgID, err)
+		return
+	}
+	if created {
+		logger.WarnCtx(ctx, "[Budget] user %s in org %s %s budget reached %d%% (spent %d / limit %d), action=%s",
+			userID, orgID, usage.PeriodType, threshold, usage.Spent, usage.Limit, action)
+	}
+}
+
+// suspendEndpoints 停机成员在组织内创建的 endpoint, 不影响其他成员创建的共享 endpoint
+func (s *BudgetService) suspendEndpoints(ctx context.Context, orgID, userID string, endpoints []model.UserEndpoint, reason string) {
+	for i := range endpoints {
+		ep := &endpoints[i]
+		if ep.Replicas == 0 || ep.UserID != userID {
+			continue
+		}
+		logger.InfoCtx(ctx, "[Budget] user %s budget exceeded in org %s, stopping endpoint %d", userID, orgID, ep.ID)
+		if err := s.endpointService.Suspend(ctx, ep, reason); err != nil {
+			logger.ErrorCtx(ctx, "[Budget] stop endpoint %d error: %v", ep.ID, err)
+		}
+	}
+}
+
+func defaultPreferences(userID string) *model.UserPreferences {
+	return &model.UserPreferences{
+		UserID:                  userID,
+		AutoSuspendOnLowBalance: true,
+		EmailNotifications:      true,
+		LowBalanceAlert:         true,
+	}
+}
+
+func warnThresholds() []int {
+	thresholds := []int{50, 80, 90}
+	if config.GlobalConfig != nil && len(config.GlobalConfig.Billing.Budget.WarnThresholds) > 0 {
+		thresholds = append([]int(nil), config.GlobalConfig.Billing.Budget.WarnThresholds...)
+	}
+	sort.Ints(thresholds)
+	return thresholds
+}
+
+func budgetLocation() *time.Location {
+	if config.GlobalConfig == nil || config.GlobalConfig.Billing.Budget.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(config.GlobalConfig.Billing.Budget.Timezone)
+	if err != nil {
+		logger.Warnf("[Budget] invalid timezone %s: %v", config.GlobalConfig.Billing.Budget.Timezone, err)
+		return time.UTC
+	}
+	return loc
+}
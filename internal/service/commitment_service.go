@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+// CommitmentService 预留容量承诺: 管理员按组织/规格售卖 GPU 小时, 计费时先按承诺单价抵扣, 不足部分按需计费
+type CommitmentService struct {
+	repo       *mysql.CommitmentRepo
+	specRepo   *mysql.SpecRepo
+	currencies *CurrencyService
+}
+
+func NewCommitmentService(repo *mysql.CommitmentRepo, specRepo *mysql.SpecRepo, currencies *CurrencyService) *CommitmentService {
+	return &CommitmentService{repo: repo, specRepo: specRepo, currencies: currencies}
+}
+
+// Create 创建承诺, 单价按组织计费币种
+func (s *CommitmentService) Create(ctx context.Context, c *model.CapacityCommitment) error {
+	if c.OrgID == "" || c.SpecName == "" {
+		return errors.New("org_id and spec_name are required")
+	}
+	if c.TotalSeconds <= 0 {
+		return errors.New("hours must be positive")
+	}
+	if c.PricePerHour < 0 {
+		return errors.New("price_per_hour must not be negative")
+	}
+	if !c.EndAt.After(c.StartAt) {
+		return errors.New("end_at must be after start_at")
+	}
+	if _, err := s.specRepo.GetByName(ctx, c.SpecName); err != nil {
+		return fmt.Errorf("spec %s not found", c.SpecName)
+	}
+	c.Currency = model.DefaultCurrency
+	if s.currencies != nil {
+		currency, err := s.currencies.OrgCurrency(ctx, c.OrgID)
+		if err != nil {
+			return err
+		}
+		c.Currency = currency
+	}
+	c.ID = 0
+	c.UsedSeconds = 0
+	c.Status = model.CommitmentStatusActive
+	return s.repo.Create(ctx, c)
+}
+
+func (s *CommitmentService) Get(ctx context.Context, id int64) (*model.CapacityCommitment, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *CommitmentService) List(ctx context.Context, orgID string, limit, offset int) ([]model.CapacityCommitment, int64, error) {
+	return s.repo.List(ctx, orgID, limit, offset)
+}
+
+// Cancel 取消承诺, 之后不再抵扣
+func (s *CommitmentService) Cancel(ctx context.Context, id int64) error {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.Update(ctx, id, map[string]interface{}{"status": model.CommitmentStatusCancelled})
+}
+
+func (s *CommitmentService) ListUsages(ctx context.Context, commitmentID int64, limit, offset int) ([]model.CommitmentUsage, int64, error) {
+	return s.repo.ListUsages(ctx, commitmentID, limit, offset)
+}
+
+// BackingClusters 组织某规格当前有剩余额度的承诺所绑定的集群
+func (s *CommitmentService) BackingClusters(ctx context.Context, orgID, specName string, at time.Time) map[string]bool {
+	clusters := make(map[string]bool)
+	if orgID == "" {
+		return clusters
+	}
+	list, err := s.repo.ListActive(ctx, orgID, specName, at)
+	if err != nil {
+		return clusters
+	}
+	for _, c := range list {
+		if c.ClusterID != "" {
+			clusters[c.ClusterID] = true
+		}
+	}
+	return clusters
+}
+
+// CommitmentDraw 一个计费时段从某个承诺抵扣的 GPU 秒数及按承诺单价计算的金额
+type CommitmentDraw struct {
+	CommitmentID int64
+	Seconds      int64 // GPU 秒
+	Amount       int64
+}
+
+// ApplyCommitments 在计费事务内按最早到期优先从承诺中抵扣时段的计费时长 (按 GPU 秒, 计费秒数 × 规格 GPU 数,
+// CPU 规格按 1 计), 返回抵扣明细及时段应向主站扣款的金额: 抵扣部分按承诺单价 (单价为 0 的已预付承诺不再扣款),
+// 其余部分按原按需金额比例
+func ApplyCommitments(ctx context.Context, repo *mysql.CommitmentRepo, orgID, specName, clusterID string, gpuCount int, charge *Charge) ([]CommitmentDraw, int64, error) {
+	if orgID == "" || charge.BilledSeconds <= 0 {
+		return nil, charge.Amount, nil
+	}
+	if gpuCount < 1 {
+		gpuCount = 1
+	}
+	needed := charge.BilledSeconds * int64(gpuCount)
+
+	var draws []CommitmentDraw
+	var committed, committedAmount int64
+	for committed < needed {
+		c, err := repo.LockNextActive(ctx, orgID, specName, clusterID, charge.Segment.Start)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		seconds := needed - committed
+		if rem := c.RemainingSeconds(); seconds > rem {
+			seconds = rem
+		}
+		if err := repo.AddUsedSeconds(ctx, c.ID, seconds); err != nil {
+			return nil, 0, err
+		}
+		amount := (c.PricePerHour*seconds + 1800) / 3600
+		draws = append(draws, CommitmentDraw{CommitmentID: c.ID, Seconds: seconds, Amount: amount})
+		committed += seconds
+		committedAmount += amount
+	}
+	if committed == 0 {
+		return nil, charge.Amount, nil
+	}
+
+	onDemand := charge.Amount * (needed - committed) / needed
+	return draws, committedAmount + onDemand, nil
+}
@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+)
+
+const (
+	maxSimulationRangeDays      = 31
+	defaultScaleDownIdleSeconds = 300
+	maxSimulatedReplicas        = 1000
+)
+
+// CostSimulatorService 按 endpoint 历史 worker 生命周期和任务负载重放成本, 估算更换规格/扩缩容/计费策略后的费用差异
+type CostSimulatorService struct {
+	workerRepo    *mysql.WorkerRepo
+	taskRepo      *mysql.TaskRepo
+	billingRepo   *mysql.BillingRepo
+	specRepo      *mysql.SpecRepo
+	policyService *BillingPolicyService
+	currencies    *CurrencyService
+}
+
+func NewCostSimulatorService(workerRepo *mysql.WorkerRepo, taskRepo *mysql.TaskRepo, billingRepo *mysql.BillingRepo, specRepo *mysql.SpecRepo, policyService *BillingPolicyService, currencies *CurrencyService) *CostSimulatorService {
+	return &CostSimulatorService{workerRepo: workerRepo, taskRepo: taskRepo, billingRepo: billingRepo, specRepo: specRepo, policyService: policyService, currencies: currencies}
+}
+
+// CostSimulationRequest 模拟参数, 为空的字段保持 endpoint 当前配置
+type CostSimulationRequest struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	SpecName        string `json:"spec_name"`         // 目标规格
+	Spot            *bool  `json:"spot"`              // 是否使用 spot 档位
+	BillingPolicyID *int64 `json:"billing_policy_id"` // 目标计费策略, 为空使用目标规格当前策略, 0 表示默认策略
+
+	// 扩缩容设置, 任一字段有值时按任务负载模拟 worker 扩缩容, 否则重放实际 worker 生命周期
+	MinReplicas          *int `json:"min_replicas"`
+	MaxReplicas          *int `json:"max_replicas"`
+	ScaleDownIdleSeconds *int `json:"scale_down_idle_seconds"` // worker 空闲多久后缩容, 默认 300
+
+	// 目标规格上任务执行时长相对当前的倍数 (如更快的 GPU 为 0.6), 默认 1
+	SpeedFactor float64 `json:"speed_factor"`
+}
+
+// CostScenario 一种配置下的模拟结果 (金额单位: 1/1000000 endpoint 计费币种)
+type CostScenario struct {
+	SpecName             string `json:"spec_name"`
+	Spot                 bool   `json:"spot"`
+	PricePerHour         int64  `json:"price_per_hour"`
+	BillingPolicyID      int64  `json:"billing_policy_id"` // 0 表示默认策略
+	BillingPolicyVersion int    `json:"billing_policy_version"`
+	MinReplicas          int    `json:"min_replicas"`
+	MaxReplicas          int    `json:"max_replicas"`
+
+	Workers        int   `json:"workers"`
+	WorkerSeconds  int64 `json:"worker_seconds"`
+	BusySeconds    int64 `json:"busy_seconds"`
+	ColdStarts     int   `json:"cold_starts"`
+	AvgQueueWaitMs int64 `json:"avg_queue_wait_ms"` // 模拟扩缩容时任务因冷启动/副本上限增加的平均等待
+	Cost           int64 `json:"cost"`
+}
+
+// CostSimulationResult 模拟结果: Baseline 为当前配置按实际 worker 生命周期重放, Projected 为目标配置
+type CostSimulationResult struct {
+	EndpointName string    `json:"endpoint_name"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Method       string    `json:"method"` // replay: 重放实际 worker 生命周期; autoscale: 按任务负载模拟扩缩容
+	Tasks        int       `json:"tasks"`
+	Currency     string    `json:"currency"`
+	ActualBilled int64     `json:"actual_billed"` // 时段内实际计费流水金额
+
+	Baseline          CostScenario `json:"baseline"`
+	Projected         CostScenario `json:"projected"`
+	Difference        int64        `json:"difference"` // Projected - Baseline, 负数表示节省
+	DifferencePercent float64      `json:"difference_percent"`
+}
+
+// Simulate 按历史负载模拟 endpoint 在目标配置下的成本
+func (s *CostSimulatorService) Simulate(ctx context.Context, endpoint *model.UserEndpoint, req *CostSimulationRequest) (*CostSimulationResult, error) {
+	if err := validateUsageRange(req.From, req.To, maxSimulationRangeDays); err != nil {
+		return nil, err
+	}
+	if req.SpeedFactor < 0 {
+		return nil, errors.New("speed_factor must be positive")
+	}
+	if req.SpeedFactor == 0 {
+		req.SpeedFactor = 1
+	}
+
+	workers, err := s.workerRepo.ListByEndpointInWindow(ctx, endpoint.ID, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := s.taskRepo.ListExecutedInWindow(ctx, endpoint.ID, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := s.billingRepo.SumEndpointAmount(ctx, endpoint.ID, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	// 当前配置
+	baseline := CostScenario{
+		SpecName: endpoint.SpecName, Spot: endpoint.Spot, PricePerHour: endpoint.PricePerHour,
+		MinReplicas: endpoint.MinReplicas, MaxReplicas: endpoint.MaxReplicas,
+	}
+	basePolicy := s.policyService.ForSpec(ctx, endpoint.SpecName)
+	baseline.BillingPolicyID, baseline.BillingPolicyVersion = basePolicy.ID, basePolicy.Version
+
+	// 目标配置
+	projected := baseline
+	targetPolicy := basePolicy
+	if req.SpecName != "" || req.Spot != nil {
+		if req.SpecName != "" {
+			projected.SpecName = req.SpecName
+		}
+		if req.Spot != nil {
+			projected.Spot = *req.Spot
+		}
+		spec, err := s.specRepo.GetByName(ctx, projected.SpecName)
+		if err != nil {
+			return nil, fmt.Errorf("spec %s not found", projected.SpecName)
+		}
+		// 目标规格按 endpoint 计费币种的当前价格
+		prices := &SpecPrices{PricePerHour: spec.PricePerHour, SpotPricePerHour: spec.SpotPricePerHour}
+		if s.currencies != nil {
+			if prices, err = s.currencies.SpecPrices(ctx, spec, endpoint.BillingCurrency(), time.Now()); err != nil {
+				return nil, err
+			}
+		}
+		projected.PricePerHour = prices.PricePerHour
+		if projected.Spot {
+			if prices.SpotPricePerHour <= 0 {
+				return nil, fmt.Errorf("spec %s does not offer a spot tier", spec.SpecName)
+			}
+			projected.PricePerHour = prices.SpotPricePerHour
+		}
+		targetPolicy = s.policyService.ForSpec(ctx, projected.SpecName)
+	}
+	if req.BillingPolicyID != nil {
+		targetPolicy = model.DefaultBillingPolicy()
+		if *req.BillingPolicyID > 0 {
+			if targetPolicy, err = s.policyService.Get(ctx, *req.BillingPolicyID); err != nil {
+				return nil, fmt.Errorf("billing policy %d not found", *req.BillingPolicyID)
+			}
+		}
+	}
+	projected.BillingPolicyID, projected.BillingPolicyVersion = targetPolicy.ID, targetPolicy.Version
+
+	result := &CostSimulationResult{
+		EndpointName: endpoint.LogicalName, From: req.From, To: req.To, Tasks: len(tasks), Currency: endpoint.BillingCurrency(), ActualBilled: actual,
+	}
+	busyByWorker := workerBusyMs(tasks)
+	replayWorkers(&baseline, basePolicy, workers, busyByWorker, 1, req.From, req.To)
+
+	if req.MinReplicas == nil && req.MaxReplicas == nil && req.ScaleDownIdleSeconds == nil {
+		result.Method = "replay"
+		replayWorkers(&projected, targetPolicy, workers, busyByWorker, req.SpeedFactor, req.From, req.To)
+	} else {
+		result.Method = "autoscale"
+		if req.MinReplicas != nil {
+			projected.MinReplicas = *req.MinReplicas
+		}
+		if req.MaxReplicas != nil {
+			projected.MaxReplicas = *req.MaxReplicas
+		}
+		if projected.MinReplicas < 0 || projected.MaxReplicas < projected.MinReplicas || projected.MaxReplicas < 1 {
+			return nil, errors.New("replicas must satisfy 0 <= min_replicas <= max_replicas and max_replicas >= 1")
+		}
+		if projected.MaxReplicas > maxSimulatedReplicas {
+			return nil, fmt.Errorf("max_replicas must not exceed %d", maxSimulatedReplicas)
+		}
+		idle := defaultScaleDownIdleSeconds
+		if req.ScaleDownIdleSeconds != nil {
+			if idle = *req.ScaleDownIdleSeconds; idle < 0 {
+				return nil, errors.New("scale_down_idle_seconds must not be negative")
+			}
+		}
+		simulateAutoscale(&projected, targetPolicy, tasks, avgColdStartMs(workers), idle, req.SpeedFactor, req.From, req.To)
+	}
+
+	result.Baseline, result.Projected = baseline, projected
+	result.Difference = projected.Cost - baseline.Cost
+	if baseline.Cost > 0 {
+		result.DifferencePercent = math.Round(float64(result.Difference)/float64(baseline.Cost)*10000) / 100
+	}
+	return result, nil
+}
+
+// workerBusyMs 按 worker 汇总任务执行时长 (毫秒)
+func workerBusyMs(tasks []model.TaskRouting) map[string]int64 {
+	busy := make(map[string]int64)
+	for _, t := range tasks {
+		if t.WorkerID != "" {
+			busy[t.WorkerID] += t.ExecutionTimeMs
+		}
+	}
+	return busy
+}
+
+// replayWorkers 按实际 worker 生命周期 (截取到 [from, to)) 以场景的价格和策略计费
+func replayWorkers(sc *CostScenario, policy *model.BillingPolicy, workers []model.Worker, busyMs map[string]int64, speed float64, from, to time.Time) {
+	now := time.Now()
+	for _, w := range workers {
+		start, end := *w.PodStartedAt, to
+		final := false
+		if w.PodTerminatedAt != nil && w.PodTerminatedAt.Before(to) {
+			end, final = *w.PodTerminatedAt, true
+		}
+		if end.After(now) {
+			end = now
+		}
+		coldStart := w.ColdStartDurationMs
+		if start.Before(from) {
+			// 时段开始前已启动, 冷启动不在本时段内
+			start, coldStart = from, nil
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		busy := int64(float64(busyMs[w.WorkerID]) * speed / 1000)
+		charge(sc, policy, start, end, coldStart, busy, final)
+		if coldStart != nil {
+			sc.ColdStarts++
+		}
+	}
+}
+
+// charge 将一个 worker 的生命周期按策略计费并累计到场景
+func charge(sc *CostScenario, policy *model.BillingPolicy, start, end time.Time, coldStartMs *int64, busySeconds int64, final bool) {
+	seg := PriceSegment{Start: start, End: end, PricePerHour: sc.PricePerHour}
+	if busySeconds > seg.Seconds() {
+		busySeconds = seg.Seconds()
+	}
+	for _, c := range ComputeCharges(policy, &ChargeInput{
+		Segments:     []PriceSegment{seg},
+		PodStartedAt: start,
+		ColdStartMs:  coldStartMs,
+		BusySeconds:  busySeconds,
+		Final:        final,
+	}) {
+		sc.Cost += c.Amount
+	}
+	sc.Workers++
+	sc.WorkerSeconds += seg.Seconds()
+	sc.BusySeconds += busySeconds
+}
+
+func avgColdStartMs(workers []model.Worker) int64 {
+	var total, n int64
+	for _, w := range workers {
+		if w.ColdStartDurationMs != nil {
+			total += *w.ColdStartDurationMs
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / n
+}
+
+// simWorker 模拟中的 worker
+type simWorker struct {
+	start  time.Time
+	freeAt time.Time // 当前任务完成时间
+	busy   time.Duration
+	warm   bool // 最小副本, 不缩容且无冷启动
+}
+
+// simulateAutoscale 按任务到达时间模拟扩缩容: 每个 worker 同时执行一个任务, 没有空闲 worker 时扩容 (冷启动后开始执行),
+// 达到最大副本后排队; 非最小副本的 worker 空闲超过 idle 秒后缩容
+func simulateAutoscale(sc *CostScenario, policy *model.BillingPolicy, tasks []model.TaskRouting, coldStartMs int64, idleSeconds int, speed float64, from, to time.Time) {
+	type load struct {
+		arrive   time.Time
+		duration time.Duration
+	}
+	loads := make([]load, 0, len(tasks))
+	for _, t := range tasks {
+		exec := time.Duration(t.ExecutionTimeMs) * time.Millisecond
+		loads = append(loads, load{
+			arrive:   t.CompletedAt.Add(-exec), // 实际开始执行时间
+			duration: time.Duration(float64(exec) * speed),
+		})
+	}
+	sort.Slice(loads, func(i, j int) bool { return loads[i].arrive.Before(loads[j].arrive) })
+
+	idle := time.Duration(idleSeconds) * time.Second
+	coldStart := time.Duration(coldStartMs) * time.Millisecond
+	var alive []*simWorker
+	var retired []*simWorker
+	for i := 0; i < sc.MinReplicas; i++ {
+		alive = append(alive, &simWorker{start: from, freeAt: from, warm: true})
+	}
+
+	var waited time.Duration
+	for _, l := range loads {
+		// 缩容空闲超时的 worker
+		kept := alive[:0]
+		for _, w := range alive {
+			if !w.warm && !w.freeAt.Add(idle).After(l.arrive) {
+				retired = append(retired, w)
+				continue
+			}
+			kept = append(kept, w)
+		}
+		alive = kept
+
+		// 优先使用最近空闲的 worker, 让其余 worker 尽早缩容
+		var pick, earliest *simWorker
+		for _, w := range alive {
+			if !w.freeAt.After(l.arrive) && (pick == nil || w.freeAt.After(pick.freeAt)) {
+				pick = w
+			}
+			if earliest == nil || w.freeAt.Before(earliest.freeAt) {
+				earliest = w
+			}
+		}
+		begin := l.arrive
+		switch {
+		case pick != nil:
+		case len(alive) < sc.MaxReplicas:
+			pick = &simWorker{start: l.arrive}
+			alive = append(alive, pick)
+			begin = l.arrive.Add(coldStart)
+			sc.ColdStarts++
+		default:
+			pick = earliest
+			begin = earliest.freeAt
+		}
+		waited += begin.Sub(l.arrive)
+		pick.freeAt = begin.Add(l.duration)
+		pick.busy += l.duration
+	}
+	if len(loads) > 0 {
+		sc.AvgQueueWaitMs = waited.Milliseconds() / int64(len(loads))
+	}
+
+	for _, w := range append(retired, alive...) {
+		end := w.freeAt.Add(idle)
+		if w.warm || end.After(to) {
+			end = to
+		}
+		if w.freeAt.After(end) {
+			end = w.freeAt
+		}
+		var cold *int64
+		if !w.warm {
+			cold = &coldStartMs
+		}
+		charge(sc, policy, w.start, end, cold, int64(w.busy.Seconds()), true)
+	}
+}
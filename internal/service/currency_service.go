@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+// ErrCurrencyLocked 组织已有 endpoint、承诺或流水, 计费币种不可修改
+var ErrCurrencyLocked = errors.New("billing currency cannot be changed after the organization has endpoints, commitments or billing history")
+
+var currencyCodeRegex = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// CurrencyService 多币种: 汇率 (按生效时间), 规格多币种标价, 组织计费币种.
+// 所有金额均为所属币种的 1/1000000
+type CurrencyService struct {
+	repo     *mysql.CurrencyRepo
+	specRepo *mysql.SpecRepo
+}
+
+func NewCurrencyService(repo *mysql.CurrencyRepo, specRepo *mysql.SpecRepo) *CurrencyService {
+	return &CurrencyService{repo: repo, specRepo: specRepo}
+}
+
+// NormalizeCurrency 转为大写币种代码, 为空时返回默认币种
+func NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return model.DefaultCurrency, nil
+	}
+	if !currencyCodeRegex.MatchString(currency) {
+		return "", fmt.Errorf("invalid currency code %q", currency)
+	}
+	return currency, nil
+}
+
+// OrgCurrency 组织计费币种, 未设置时为默认币种
+func (s *CurrencyService) OrgCurrency(ctx context.Context, orgID string) (string, error) {
+	if orgID == "" {
+		return model.DefaultCurrency, nil
+	}
+	settings, err := s.repo.GetOrgSettings(ctx, orgID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.DefaultCurrency, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return settings.Currency, nil
+}
+
+// SetOrgCurrency 设置组织计费币种 (需有到默认币种的汇率, 组织已有计费数据后不可修改)
+func (s *CurrencyService) SetOrgCurrency(ctx context.Context, orgID, currency, updatedBy string) error {
+	currency, err := NormalizeCurrency(currency)
+	if err != nil {
+		return err
+	}
+	current, err := s.OrgCurrency(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if current == currency {
+		return nil
+	}
+	locked, err := s.repo.OrgHasBillingData(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return ErrCurrencyLocked
+	}
+	if _, err := s.Rate(ctx, model.DefaultCurrency, currency, time.Now()); err != nil {
+		return err
+	}
+	return s.repo.SaveOrgSettings(ctx, &model.OrgBillingSettings{OrgID: orgID, Currency: currency, UpdatedBy: updatedBy})
+}
+
+// Rate at 时刻 from -> to 的汇率: 优先直接汇率, 其次反向汇率, 最后经默认币种交叉换算
+func (s *CurrencyService) Rate(ctx context.Context, from, to string, at time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	if rate, ok, err := s.directRate(ctx, from, to, at); err != nil || ok {
+		return rate, err
+	}
+	if from != model.DefaultCurrency && to != model.DefaultCurrency {
+		a, okA, err := s.directRate(ctx, from, model.DefaultCurrency, at)
+		if err != nil {
+			return 0, err
+		}
+		b, okB, err := s.directRate(ctx, model.DefaultCurrency, to, at)
+		if err != nil {
+			return 0, err
+		}
+		if okA && okB {
+			return a * b, nil
+		}
+	}
+	return 0, fmt.Errorf("no exchange rate from %s to %s at %s", from, to, at.UTC().Format(time.RFC3339))
+}
+
+func (s *CurrencyService) directRate(ctx context.Context, from, to string, at time.Time) (float64, bool, error) {
+	rate, err := s.repo.GetEffectiveRate(ctx, from, to, at)
+	if err == nil {
+		return rate.Rate, true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, err
+	}
+	rate, err = s.repo.GetEffectiveRate(ctx, to, from, at)
+	if err == nil && rate.Rate > 0 {
+		return 1 / rate.Rate, true, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, err
+	}
+	return 0, false, nil
+}
+
+// Convert 按 at 时刻汇率换算金额 (四舍五入到 1/1000000)
+func (s *CurrencyService) Convert(ctx context.Context, amount int64, from, to string, at time.Time) (int64, error) {
+	if from == "" {
+		from = model.DefaultCurrency
+	}
+	if to == "" {
+		to = model.DefaultCurrency
+	}
+	if from == to || amount == 0 {
+		return amount, nil
+	}
+	rate, err := s.Rate(ctx, from, to, at)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(float64(amount) * rate)), nil
+}
+
+// SpecPrices 规格在某币种下的价格
+type SpecPrices struct {
+	Currency           string
+	PricePerHour       int64
+	SpotPricePerHour   int64
+	TaskPricePerSecond int64
+	Converted          bool // 无该币种标价, 由基础价格按汇率换算
+}
+
+// SpecPrices 获取规格在 currency 下的价格: 优先该币种标价, 否则按 at 时刻汇率换算基础价格
+func (s *CurrencyService) SpecPrices(ctx context.Context, sp *model.SpecPricing, currency string, at time.Time) (*SpecPrices, error) {
+	base := sp.Currency
+	if base == "" {
+		base = model.DefaultCurrency
+	}
+	if currency == "" || currency == base {
+		return &SpecPrices{Currency: base, PricePerHour: sp.PricePerHour, SpotPricePerHour: sp.SpotPricePerHour, TaskPricePerSecond: sp.TaskPricePerSecond}, nil
+	}
+
+	listed, err := s.repo.GetSpecPrice(ctx, sp.SpecName, currency)
+	if err == nil {
+		return &SpecPrices{Currency: currency, PricePerHour: listed.PricePerHour, SpotPricePerHour: listed.SpotPricePerHour, TaskPricePerSecond: listed.TaskPricePerSecond}, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	rate, err := s.Rate(ctx, base, currency, at)
+	if err != nil {
+		return nil, err
+	}
+	convert := func(v int64) int64 { return int64(math.Round(float64(v) * rate)) }
+	return &SpecPrices{
+		Currency:           currency,
+		PricePerHour:       convert(sp.PricePerHour),
+		SpotPricePerHour:   convert(sp.SpotPricePerHour),
+		TaskPricePerSecond: convert(sp.TaskPricePerSecond),
+		Converted:          true,
+	}, nil
+}
+
+// HasListedPrice 规格是否配置了该币种的标价
+func (s *CurrencyService) HasListedPrice(ctx context.Context, specName, currency string) (bool, error) {
+	_, err := s.repo.GetSpecPrice(ctx, specName, currency)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CreateRate 录入汇率
+func (s *CurrencyService) CreateRate(ctx context.Context, rate *model.ExchangeRate) error {
+	var err error
+	if rate.BaseCurrency, err = NormalizeCurrency(rate.BaseCurrency); err != nil {
+		return err
+	}
+	if rate.QuoteCurrency, err = NormalizeCurrency(rate.QuoteCurrency); err != nil {
+		return err
+	}
+	if rate.BaseCurrency == rate.QuoteCurrency {
+		return errors.New("base_currency and quote_currency must differ")
+	}
+	if rate.Rate <= 0 {
+		return errors.New("rate must be positive")
+	}
+	if rate.EffectiveAt.IsZero() {
+		rate.EffectiveAt = time.Now()
+	}
+	rate.ID = 0
+	return s.repo.CreateRate(ctx, rate)
+}
+
+func (s *CurrencyService) ListRates(ctx context.Context, base, quote string, limit, offset int) ([]model.ExchangeRate, int64, error) {
+	return s.repo.ListRates(ctx, strings.ToUpper(base), strings.ToUpper(quote), limit, offset)
+}
+
+// SetSpecPrice 设置规格某币种的标价 (只影响之后创建的 endpoint, 已有 endpoint 通过计划调价迁移)
+func (s *CurrencyService) SetSpecPrice(ctx context.Context, price *model.SpecCurrencyPrice) error {
+	sp, err := s.specRepo.GetByName(ctx, price.SpecName)
+	if err != nil {
+		return fmt.Errorf("spec %s not found", price.SpecName)
+	}
+	if price.Currency, err = NormalizeCurrency(price.Currency); err != nil {
+		return err
+	}
+	if price.Currency == sp.Currency {
+		return fmt.Errorf("%s is the base currency of spec %s, update the spec price instead", price.Currency, price.SpecName)
+	}
+	if price.PricePerHour <= 0 {
+		return errors.New("price_per_hour must be positive")
+	}
+	if price.SpotPricePerHour < 0 || price.TaskPricePerSecond < 0 {
+		return errors.New("prices must not be negative")
+	}
+	return s.repo.UpsertSpecPrice(ctx, price)
+}
+
+func (s *CurrencyService) ListSpecPrices(ctx context.Context, specName string) ([]model.SpecCurrencyPrice, error) {
+	return s.repo.ListSpecPrices(ctx, specName)
+}
+
+func (s *CurrencyService) DeleteSpecPrice(ctx context.Context, specName, currency string) error {
+	ok, err := s.repo.DeleteSpecPrice(ctx, specName, strings.ToUpper(currency))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
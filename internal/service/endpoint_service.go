@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/wavespeedai/waverless-portal/pkg/logger"
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
@@ -21,11 +24,15 @@ type EndpointService struct {
 	specRepo               *mysql.SpecRepo
 	registryCredentialRepo *mysql.RegistryCredentialRepo
 	clusterService         *ClusterService
+	pricingService         *PricingService
+	commitmentService      *CommitmentService
+	currencyService        *CurrencyService
+	placementRepo          *mysql.PlacementRepo
 	waverlessClients       sync.Map
 }
 
-func NewEndpointService(repo *mysql.EndpointRepo, clusterRepo *mysql.ClusterRepo, specRepo *mysql.SpecRepo, registryCredentialRepo *mysql.RegistryCredentialRepo, clusterService *ClusterService) *EndpointService {
-	return &EndpointService{repo: repo, clusterRepo: clusterRepo, specRepo: specRepo, registryCredentialRepo: registryCredentialRepo, clusterService: clusterService}
+func NewEndpointService(repo *mysql.EndpointRepo, clusterRepo *mysql.ClusterRepo, specRepo *mysql.SpecRepo, registryCredentialRepo *mysql.RegistryCredentialRepo, clusterService *ClusterService, pricingService *PricingService, commitmentService *CommitmentService, currencyService *CurrencyService, placementRepo *mysql.PlacementRepo) *EndpointService {
+	return &EndpointService{repo: repo, clusterRepo: clusterRepo, specRepo: specRepo, registryCredentialRepo: registryCredentialRepo, clusterService: clusterService, pricingService: pricingService, commitmentService: commitmentService, currencyService: currencyService, placementRepo: placementRepo}
 }
 
 type CreateEndpointRequest struct {
@@ -39,27 +46,93 @@ type CreateEndpointRequest struct {
 	Env                    map[string]string `json:"env"`
 	PreferRegion           string            `json:"prefer_region"`
 	RegistryCredentialName string            `json:"registry_credential_name"`
+	Tags                   map[string]string `json:"tags"`
+	Spot                   bool              `json:"spot"`              // 使用规格的抢占式 (spot) 档位
+	PreemptionPolicy       string            `json:"preemption_policy"` // spot worker 被抢占时进行中任务的处理: resubmit (默认), fail
+	BillingMode            string            `json:"billing_mode"`      // worker_time (默认), task_execution
+	Placements             int               `json:"placements"`        // 同时部署的集群数, 默认 1
+	ReplicaPolicy          string            `json:"replica_policy"`    // 跨集群副本分布: spread (默认), primary
 }
 
 type ClusterCandidate struct {
 	Cluster     *model.Cluster
 	ClusterSpec *model.ClusterSpec
 	SpecPricing *model.SpecPricing
-	Score       float64
+	// EffectivePrice 当前生效价格 (含集群覆盖价格)
+	EffectivePrice int64
+	// Reserved 集群承载组织的预留承诺, 有容量时优先调度
+	Reserved bool
+	Score    float64
 }
 
 func (s *EndpointService) Create(ctx context.Context, userID, orgID string, req *CreateEndpointRequest) (*model.UserEndpoint, error) {
-	_, err := s.repo.GetByLogicalName(ctx, userID, req.LogicalName)
+	_, err := s.repo.GetByLogicalName(ctx, orgID, req.LogicalName)
 	if err == nil {
 		return nil, errors.New("endpoint already exists")
 	}
+	if err := ValidateTags(req.Tags); err != nil {
+		return nil, err
+	}
+	if req.PreemptionPolicy == "" {
+		req.PreemptionPolicy = model.PreemptionPolicyResubmit
+	}
+	if err := ValidatePreemptionPolicy(req.PreemptionPolicy); err != nil {
+		return nil, err
+	}
+	if req.BillingMode == "" {
+		req.BillingMode = model.BillingModeWorkerTime
+	}
+	if req.BillingMode != model.BillingModeWorkerTime && req.BillingMode != model.BillingModeTaskExecution {
+		return nil, fmt.Errorf("billing_mode must be %s or %s", model.BillingModeWorkerTime, model.BillingModeTaskExecution)
+	}
+	if req.Spot && req.BillingMode == model.BillingModeTaskExecution {
+		return nil, errors.New("spot tier does not support task_execution billing")
+	}
+	if req.Placements == 0 {
+		req.Placements = 1
+	}
+	if req.ReplicaPolicy == "" {
+		req.ReplicaPolicy = model.ReplicaPolicySpread
+	}
+	if err := ValidatePlacements(req.Placements, req.ReplicaPolicy, req.MaxReplicas); err != nil {
+		return nil, err
+	}
 
-	candidate, err := s.selectBestCluster(ctx, req.SpecName, req.PreferRegion)
+	candidates, err := s.selectClusters(ctx, orgID, req.SpecName, req.PreferRegion, req.Placements, nil)
 	if err != nil {
 		return nil, err
 	}
+	if len(candidates) < req.Placements {
+		return nil, fmt.Errorf("only %d active clusters available for spec %s, %d placements requested", len(candidates), req.SpecName, req.Placements)
+	}
+	candidate := &candidates[0]
 
+	// 按组织计费币种锁定价格: 规格有该币种标价时直接使用, 否则按当前汇率换算
 	sp := candidate.SpecPricing
+	prices := &SpecPrices{Currency: sp.Currency, PricePerHour: sp.PricePerHour, SpotPricePerHour: sp.SpotPricePerHour, TaskPricePerSecond: sp.TaskPricePerSecond}
+	if s.currencyService != nil {
+		currency, err := s.currencyService.OrgCurrency(ctx, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if prices, err = s.currencyService.SpecPrices(ctx, sp, currency, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	price := prices.PricePerHour
+	if req.Spot {
+		if prices.SpotPricePerHour <= 0 {
+			return nil, fmt.Errorf("spec %s does not offer a spot tier", req.SpecName)
+		}
+		price = prices.SpotPricePerHour
+	}
+	var taskPrice int64
+	if req.BillingMode == model.BillingModeTaskExecution {
+		if prices.TaskPricePerSecond <= 0 {
+			return nil, fmt.Errorf("spec %s does not offer task_execution billing", req.SpecName)
+		}
+		taskPrice = prices.TaskPricePerSecond
+	}
 	// physicalName := strings.ToLower(fmt.Sprintf("user-%s-%s", userID[:8], req.LogicalName))
 	physicalName := strings.ToLower(req.LogicalName)
 	endpoint := &model.UserEndpoint{
@@ -67,26 +140,29 @@ func (s *EndpointService) Create(ctx context.Context, userID, orgID string, req
 		SpecName: req.SpecName, SpecType: sp.SpecType, GPUType: sp.GPUType,
 		GPUCount: sp.GPUCount, CPUCores: sp.CPUCores, RAMGB: sp.RAMGB,
 		ClusterID: candidate.Cluster.ClusterID, Replicas: req.Replicas, MinReplicas: req.MinReplicas, MaxReplicas: req.MaxReplicas,
-		Image: req.Image, TaskTimeout: req.TaskTimeout, PricePerHour: sp.PricePerHour,
-		Currency: "USD", PreferRegion: req.PreferRegion, Status: "deploying",
+		Image: req.Image, TaskTimeout: req.TaskTimeout, PricePerHour: price,
+		Currency: prices.Currency, PreferRegion: req.PreferRegion, Status: "deploying",
+		Spot: req.Spot, PreemptionPolicy: req.PreemptionPolicy,
+		BillingMode: req.BillingMode, TaskPricePerSecond: taskPrice,
+		PlacementCount: req.Placements, ReplicaPolicy: req.ReplicaPolicy,
+	}
+	if len(req.Tags) > 0 {
+		endpoint.Tags = model.StringMap(req.Tags)
+	}
+	// 保存环境变量, 集群故障转移时按相同配置重新部署
+	if len(req.Env) > 0 {
+		endpoint.Env = envJSON(req.Env)
 	}
 
-	client := s.getWaverlessClient(candidate.Cluster)
 	replicas := req.Replicas
 	if replicas == 0 {
 		replicas = req.MinReplicas
 	}
 
-	// Build waverless request
-	waverlessReq := &waverless.CreateEndpointRequest{
-		Endpoint: physicalName, SpecName: candidate.ClusterSpec.ClusterSpecName, Image: req.Image,
-		Replicas: replicas, MinReplicas: req.MinReplicas, MaxReplicas: req.MaxReplicas,
-		TaskTimeout: req.TaskTimeout, Env: req.Env,
-	}
-
 	// Add registry credential if specified
+	var registryCredential *waverless.RegistryCredential
 	if req.RegistryCredentialName != "" && s.registryCredentialRepo != nil {
-		cred, err := s.registryCredentialRepo.GetByName(ctx, userID, req.RegistryCredentialName)
+		cred, err := s.registryCredentialRepo.GetByName(ctx, orgID, req.RegistryCredentialName)
 		if err != nil {
 			return nil, fmt.Errorf("registry credential not found: %s", req.RegistryCredentialName)
 		}
@@ -94,7 +170,7 @@ func (s *EndpointService) Create(ctx context.Context, userID, orgID string, req
 		if err != nil {
 			return nil, fmt.Errorf("failed to decrypt registry credential")
 		}
-		waverlessReq.RegistryCredential = &waverless.RegistryCredential{
+		registryCredential = &waverless.RegistryCredential{
 			Registry: cred.Registry,
 			Username: cred.Username,
 			Password: password,
@@ -102,21 +178,44 @@ func (s *EndpointService) Create(ctx context.Context, userID, orgID string, req
 		endpoint.RegistryCredentialID = &cred.ID
 	}
 
-	if err := client.CreateEndpoint(ctx, waverlessReq); err != nil {
-		logger.ErrorCtx(ctx, "failed to create endpoint in waverless", zap.Error(err))
-		return nil, fmt.Errorf("failed to create endpoint in waverless: %w", err)
+	// 按副本分布策略在每个集群创建部署, 任一失败时回滚已创建的部署
+	shares := distributeReplicas(req.ReplicaPolicy, len(candidates), replicas, req.MinReplicas, req.MaxReplicas)
+	placements := make([]model.EndpointPlacement, len(candidates))
+	for i := range candidates {
+		placements[i] = model.EndpointPlacement{
+			ClusterID: candidates[i].Cluster.ClusterID, ClusterSpecName: candidates[i].ClusterSpec.ClusterSpecName, Rank: i,
+			Replicas: shares[i].replicas, MinReplicas: shares[i].minReplicas, MaxReplicas: shares[i].maxReplicas,
+			Status: model.PlacementStatusActive,
+		}
+		if err := s.deployPlacement(ctx, endpoint, candidates[i].Cluster, &placements[i], registryCredential); err != nil {
+			logger.ErrorCtx(ctx, "failed to create endpoint in waverless", zap.String("cluster_id", candidates[i].Cluster.ClusterID), zap.Error(err))
+			s.undeploy(ctx, physicalName, candidates[:i])
+			return nil, fmt.Errorf("failed to create endpoint in waverless: %w", err)
+		}
 	}
 
 	if err := s.repo.Create(ctx, endpoint); err != nil {
-		client.DeleteEndpoint(ctx, physicalName)
+		s.undeploy(ctx, physicalName, candidates)
 		return nil, err
 	}
+	for i := range placements {
+		placements[i].EndpointID = endpoint.ID
+		if err := s.placementRepo.Create(ctx, &placements[i]); err != nil {
+			for j := 0; j < i; j++ {
+				s.placementRepo.Delete(ctx, placements[j].ID)
+			}
+			s.undeploy(ctx, physicalName, candidates)
+			s.repo.SoftDelete(ctx, endpoint.ID)
+			return nil, err
+		}
+	}
 	s.repo.Update(ctx, endpoint.ID, map[string]interface{}{"status": "running"})
 	endpoint.Status = "running"
 	return endpoint, nil
 }
 
-func (s *EndpointService) selectBestCluster(ctx context.Context, specName, preferRegion string) (*ClusterCandidate, error) {
+// selectClusters 按评分选择至多 n 个不同的可用集群 (跳过 exclude 中的集群), n <= 0 时返回全部
+func (s *EndpointService) selectClusters(ctx context.Context, orgID, specName, preferRegion string, n int, exclude map[string]bool) ([]ClusterCandidate, error) {
 	// 获取规格定价信息
 	specPricing, err := s.specRepo.GetByName(ctx, specName)
 	if err != nil {
@@ -129,21 +228,43 @@ func (s *EndpointService) selectBestCluster(ctx context.Context, specName, prefe
 		return nil, errors.New("no available cluster for this spec")
 	}
 
+	now := time.Now()
+	reserved := map[string]bool{}
+	if s.commitmentService != nil {
+		reserved = s.commitmentService.BackingClusters(ctx, orgID, specName, now)
+	}
+
 	var candidates []ClusterCandidate
+	minPrice := int64(-1)
 	for _, cs := range clusterSpecs {
+		if exclude[cs.ClusterID] {
+			continue
+		}
 		cluster, err := s.clusterRepo.GetByID(ctx, cs.ClusterID)
 		if err != nil || cluster.Status != "active" {
 			continue
 		}
+		price := specPricing.PricePerHour
+		if s.pricingService != nil {
+			if p, _, err := s.pricingService.ResolvePrice(ctx, cs.ClusterID, specName, specPricing.Currency, specPricing.PricePerHour, now); err != nil {
+				logger.WarnCtx(ctx, "resolve price for cluster %s error: %v", cs.ClusterID, err)
+			} else {
+				price = p
+			}
+		}
+		if minPrice < 0 || price < minPrice {
+			minPrice = price
+		}
 		candidates = append(candidates, ClusterCandidate{
-			Cluster: cluster, ClusterSpec: &cs, SpecPricing: specPricing,
+			Cluster: cluster, ClusterSpec: &cs, SpecPricing: specPricing, EffectivePrice: price,
+			Reserved: reserved[cs.ClusterID],
 		})
 	}
 	if len(candidates) == 0 {
 		return nil, errors.New("no active cluster available")
 	}
 
-	// 评分：可用性 50%，区域偏好 30%，优先级 20%
+	// 评分：可用性 40%，区域偏好 25%，优先级 15%，价格 20%
 	for i := range candidates {
 		c := &candidates[i]
 		availScore := float64(c.ClusterSpec.AvailableCapacity) / float64(c.ClusterSpec.TotalCapacity+1)
@@ -152,17 +273,43 @@ func (s *EndpointService) selectBestCluster(ctx context.Context, specName, prefe
 			regionScore = 1.0
 		}
 		priorityScore := float64(c.Cluster.Priority) / 100.0
-		c.Score = availScore*0.5 + regionScore*0.3 + priorityScore*0.2
+		priceScore := 1.0
+		if c.EffectivePrice > 0 {
+			priceScore = float64(minPrice) / float64(c.EffectivePrice)
+		}
+		c.Score = availScore*0.4 + regionScore*0.25 + priorityScore*0.15 + priceScore*0.2
+	}
+	// 承载预留承诺且有可用容量的集群优先, 其余按评分
+	sort.Slice(candidates, func(i, j int) bool {
+		ri := candidates[i].Reserved && candidates[i].ClusterSpec.AvailableCapacity > 0
+		rj := candidates[j].Reserved && candidates[j].ClusterSpec.AvailableCapacity > 0
+		if ri != rj {
+			return ri
+		}
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	// 同一集群可能有多个对应该规格的集群规格, 只取评分最高的
+	var selected []ClusterCandidate
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if n > 0 && len(selected) == n {
+			break
+		}
+		if seen[c.Cluster.ClusterID] {
+			continue
+		}
+		seen[c.Cluster.ClusterID] = true
+		selected = append(selected, c)
 	}
-	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
-	return &candidates[0], nil
+	return selected, nil
 }
 
 func (s *EndpointService) getWaverlessClient(cluster *model.Cluster) *waverless.Client {
 	if client, ok := s.waverlessClients.Load(cluster.ClusterID); ok {
 		return client.(*waverless.Client)
 	}
-	client := waverless.NewClient(cluster.APIEndpoint, cluster.APIKey)
+	client := waverless.NewClient(cluster.ClusterID, cluster.APIEndpoint, cluster.APIKey)
 	s.waverlessClients.Store(cluster.ClusterID, client)
 	return client
 }
@@ -171,8 +318,8 @@ func (s *EndpointService) GetWaverlessClient(cluster *model.Cluster) *waverless.
 	return s.getWaverlessClient(cluster)
 }
 
-func (s *EndpointService) GetByLogicalName(ctx context.Context, userID, logicalName string) (*model.UserEndpoint, error) {
-	return s.repo.GetByLogicalName(ctx, userID, logicalName)
+func (s *EndpointService) GetByLogicalName(ctx context.Context, orgID, logicalName string) (*model.UserEndpoint, error) {
+	return s.repo.GetByLogicalName(ctx, orgID, logicalName)
 }
 
 func (s *EndpointService) GetEndpointDetail(ctx context.Context, endpoint *model.UserEndpoint) (map[string]interface{}, error) {
@@ -183,76 +330,269 @@ func (s *EndpointService) GetEndpointDetail(ctx context.Context, endpoint *model
 	return s.getWaverlessClient(cluster).GetEndpoint(ctx, endpoint.PhysicalName)
 }
 
-func (s *EndpointService) List(ctx context.Context, userID string) ([]model.UserEndpoint, error) {
-	return s.repo.ListByUser(ctx, userID)
+// DeployedEnv 获取 waverless 当前部署的环境变量 (waverless 只覆盖不删除环境变量, 可能多于本地记录),
+// 获取失败或未返回 env 时使用本地记录
+func (s *EndpointService) DeployedEnv(ctx context.Context, endpoint *model.UserEndpoint) map[string]string {
+	detail, err := s.GetEndpointDetail(ctx, endpoint)
+	if err != nil {
+		logger.WarnCtx(ctx, "get deployed env of endpoint %s error, using local record: %v", endpoint.LogicalName, err)
+	}
+	return detailEnv(detail, endpoint)
+}
+
+// detailEnv 取 waverless endpoint 详情中的环境变量, 未返回 env 时使用本地记录
+func detailEnv(detail map[string]interface{}, endpoint *model.UserEndpoint) map[string]string {
+	env, ok := detail["env"].(map[string]interface{})
+	if !ok {
+		return envStrings(endpoint.Env)
+	}
+	m := make(map[string]string, len(env))
+	for k, v := range env {
+		m[k] = fmt.Sprint(v)
+	}
+	return m
+}
+
+func (s *EndpointService) List(ctx context.Context, orgID string) ([]model.UserEndpoint, error) {
+	return s.repo.ListByOrg(ctx, orgID)
 }
 
 func (s *EndpointService) ListAll(ctx context.Context) ([]model.UserEndpoint, error) {
 	return s.repo.ListAll(ctx)
 }
 
-func (s *EndpointService) Delete(ctx context.Context, userID, logicalName string) error {
-	endpoint, err := s.repo.GetByLogicalName(ctx, userID, logicalName)
+// Delete 删除所有集群上的部署; 集群不可用时标记为 orphaned, 集群恢复后由故障转移任务删除
+func (s *EndpointService) Delete(ctx context.Context, orgID, logicalName string) error {
+	endpoint, err := s.repo.GetByLogicalName(ctx, orgID, logicalName)
 	if err != nil {
 		return err
 	}
-	cluster, err := s.clusterService.GetCluster(ctx, endpoint.ClusterID)
+	placements, err := s.placementRepo.ListByEndpoint(ctx, endpoint.ID)
 	if err != nil {
 		return err
 	}
-	if err := s.getWaverlessClient(cluster).DeleteEndpoint(ctx, endpoint.PhysicalName); err != nil {
-		return fmt.Errorf("failed to delete endpoint in waverless: %w", err)
+	for i := range placements {
+		p := &placements[i]
+		if p.Status == model.PlacementStatusOrphaned {
+			continue
+		}
+		cluster, err := s.clusterService.GetCluster(ctx, p.ClusterID)
+		if err != nil || cluster.Status != "active" {
+			if err := s.placementRepo.Orphan(ctx, p, time.Now()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.getWaverlessClient(cluster).DeleteEndpoint(ctx, endpoint.PhysicalName); err != nil && !waverless.IsNotFound(err) {
+			return fmt.Errorf("failed to delete endpoint in waverless: %w", err)
+		}
+		if err := s.placementRepo.Delete(ctx, p.ID); err != nil {
+			return err
+		}
 	}
 	return s.repo.SoftDelete(ctx, endpoint.ID)
 }
 
-// ScaleEndpoint 调整 Endpoint 副本数
+// ScaleEndpoint 调整 Endpoint 副本数, 按副本分布策略分配到可用集群
 func (s *EndpointService) ScaleEndpoint(ctx context.Context, endpoint *model.UserEndpoint, replicas int) error {
-	cluster, err := s.clusterService.GetCluster(ctx, endpoint.ClusterID)
+	targets, err := s.healthyPlacements(ctx, endpoint.ID)
 	if err != nil {
 		return err
 	}
-	if err := s.getWaverlessClient(cluster).UpdateEndpointDeployment(ctx, endpoint.PhysicalName, replicas, "", nil); err != nil {
-		return err
+	shares := distributeReplicas(endpoint.ReplicaPolicy, len(targets), replicas, endpoint.MinReplicas, endpoint.MaxReplicas)
+	for i, t := range targets {
+		if err := s.getWaverlessClient(t.cluster).UpdateEndpointDeployment(ctx, endpoint.PhysicalName, shares[i].replicas, "", nil); err != nil {
+			return err
+		}
+		if err := s.placementRepo.Update(ctx, t.placement.ID, map[string]interface{}{"replicas": shares[i].replicas}); err != nil {
+			return err
+		}
 	}
 	return s.repo.Update(ctx, endpoint.ID, map[string]interface{}{"replicas": replicas})
 }
 
-func (s *EndpointService) UpdateDeployment(ctx context.Context, userID, logicalName string, replicas int, image string, env map[string]string) error {
-	endpoint, err := s.repo.GetByLogicalName(ctx, userID, logicalName)
-	if err != nil {
+// Suspend 缩容到 0 并标记为 suspended, 记录停机原因; 用户重新扩容后恢复
+func (s *EndpointService) Suspend(ctx context.Context, endpoint *model.UserEndpoint, reason string) error {
+	if err := s.ScaleEndpoint(ctx, endpoint, 0); err != nil {
 		return err
 	}
-	cluster, err := s.clusterService.GetCluster(ctx, endpoint.ClusterID)
+	now := time.Now()
+	if err := s.repo.Update(ctx, endpoint.ID, map[string]interface{}{
+		"status":         model.EndpointStatusSuspended,
+		"suspend_reason": reason,
+		"suspended_at":   now,
+	}); err != nil {
+		return err
+	}
+	endpoint.Replicas = 0
+	endpoint.Status = model.EndpointStatusSuspended
+	endpoint.SuspendReason = reason
+	endpoint.SuspendedAt = &now
+	return nil
+}
+
+func (s *EndpointService) UpdateDeployment(ctx context.Context, orgID, logicalName string, replicas int, image string, env map[string]string) error {
+	endpoint, err := s.repo.GetByLogicalName(ctx, orgID, logicalName)
 	if err != nil {
 		return err
 	}
-	if err := s.getWaverlessClient(cluster).UpdateEndpointDeployment(ctx, endpoint.PhysicalName, replicas, image, env); err != nil {
+	targets, err := s.healthyPlacements(ctx, endpoint.ID)
+	if err != nil {
 		return err
 	}
+	shares := distributeReplicas(endpoint.ReplicaPolicy, len(targets), replicas, endpoint.MinReplicas, endpoint.MaxReplicas)
+	for i, t := range targets {
+		share := -1 // -1 表示不更新
+		if replicas >= 0 {
+			share = shares[i].replicas
+		}
+		if err := s.getWaverlessClient(t.cluster).UpdateEndpointDeployment(ctx, endpoint.PhysicalName, share, image, env); err != nil {
+			return err
+		}
+		if replicas >= 0 {
+			if err := s.placementRepo.Update(ctx, t.placement.ID, map[string]interface{}{"replicas": share}); err != nil {
+				return err
+			}
+		}
+	}
 	updates := map[string]interface{}{}
+	if replicas >= 0 {
+		updates["replicas"] = replicas
+	}
 	if image != "" {
 		updates["image"] = image
 	}
+	// waverless 按 key 合并 env, 本地记录同样合并, 保证版本快照是完整的部署 env
+	if len(env) > 0 {
+		merged := envStrings(endpoint.Env)
+		if merged == nil {
+			merged = make(map[string]string, len(env))
+		}
+		for k, v := range env {
+			merged[k] = v
+		}
+		updates["env"] = envJSON(merged)
+	}
+	// 停机的 endpoint 重新扩容后恢复运行
+	if replicas > 0 && endpoint.Status == model.EndpointStatusSuspended {
+		updates["status"] = model.EndpointStatusRunning
+		updates["suspend_reason"] = ""
+		updates["suspended_at"] = nil
+	}
 	if len(updates) > 0 {
 		return s.repo.Update(ctx, endpoint.ID, updates)
 	}
 	return nil
 }
 
-// UpdateConfig 更新 Endpoint 配置
-func (s *EndpointService) UpdateConfig(ctx context.Context, userID, logicalName string, config map[string]interface{}) error {
-	endpoint, err := s.repo.GetByLogicalName(ctx, userID, logicalName)
+// UpdateTags 整体替换 Endpoint 标签 (只影响之后的计费流水)
+func (s *EndpointService) UpdateTags(ctx context.Context, orgID, logicalName string, tags map[string]string) error {
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+	endpoint, err := s.repo.GetByLogicalName(ctx, orgID, logicalName)
 	if err != nil {
 		return err
 	}
-	cluster, err := s.clusterService.GetCluster(ctx, endpoint.ClusterID)
+	var value interface{}
+	if len(tags) > 0 {
+		value = model.StringMap(tags)
+	}
+	return s.repo.Update(ctx, endpoint.ID, map[string]interface{}{"tags": value})
+}
+
+// UpdatePreemptionPolicy 修改 spot worker 被抢占时进行中任务的处理方式
+func (s *EndpointService) UpdatePreemptionPolicy(ctx context.Context, orgID, logicalName, policy string) error {
+	if err := ValidatePreemptionPolicy(policy); err != nil {
+		return err
+	}
+	endpoint, err := s.repo.GetByLogicalName(ctx, orgID, logicalName)
 	if err != nil {
 		return err
 	}
-	if err := s.getWaverlessClient(cluster).UpdateEndpointConfig(ctx, endpoint.PhysicalName, config); err != nil {
+	return s.repo.Update(ctx, endpoint.ID, map[string]interface{}{"preemption_policy": policy})
+}
+
+// ValidatePreemptionPolicy 校验抢占处理方式
+func ValidatePreemptionPolicy(policy string) error {
+	if policy != model.PreemptionPolicyResubmit && policy != model.PreemptionPolicyFail {
+		return fmt.Errorf("preemption_policy must be %s or %s", model.PreemptionPolicyResubmit, model.PreemptionPolicyFail)
+	}
+	return nil
+}
+
+var tagKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9_.:/-]{1,63}$`)
+
+const (
+	maxEndpointTags = 20
+	maxTagValueLen  = 255
+)
+
+// ValidateTags 校验标签: key 只允许字母数字及 _.:/-, 便于按 key 分组查询
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > maxEndpointTags {
+		return fmt.Errorf("at most %d tags are allowed", maxEndpointTags)
+	}
+	for k, v := range tags {
+		if !tagKeyPattern.MatchString(k) {
+			return fmt.Errorf("invalid tag key %q", k)
+		}
+		if len(v) > maxTagValueLen {
+			return fmt.Errorf("tag %q value exceeds %d characters", k, maxTagValueLen)
+		}
+	}
+	return nil
+}
+
+// UpdateConfig 更新 Endpoint 配置
+func (s *EndpointService) UpdateConfig(ctx context.Context, orgID, logicalName string, config map[string]interface{}) error {
+	endpoint, err := s.repo.GetByLogicalName(ctx, orgID, logicalName)
+	if err != nil {
 		return err
 	}
+	minReplicas, minSet := intValue(config["minReplicas"])
+	if !minSet {
+		minReplicas = endpoint.MinReplicas
+	}
+	maxReplicas, maxSet := intValue(config["maxReplicas"])
+	if !maxSet {
+		maxReplicas = endpoint.MaxReplicas
+	}
+	if maxSet {
+		if err := ValidatePlacements(endpoint.PlacementCount, endpoint.ReplicaPolicy, maxReplicas); err != nil {
+			return err
+		}
+	}
+
+	// 最小/最大副本数按副本分布策略分配到可用集群, 其余配置原样下发
+	targets, err := s.healthyPlacements(ctx, endpoint.ID)
+	if err != nil {
+		return err
+	}
+	shares := distributeReplicas(endpoint.ReplicaPolicy, len(targets), endpoint.Replicas, minReplicas, maxReplicas)
+	for i, t := range targets {
+		clusterConfig := make(map[string]interface{}, len(config))
+		for k, v := range config {
+			clusterConfig[k] = v
+		}
+		placementUpdates := map[string]interface{}{}
+		if minSet {
+			clusterConfig["minReplicas"] = shares[i].minReplicas
+			placementUpdates["min_replicas"] = shares[i].minReplicas
+		}
+		if maxSet {
+			clusterConfig["maxReplicas"] = shares[i].maxReplicas
+			placementUpdates["max_replicas"] = shares[i].maxReplicas
+		}
+		if err := s.getWaverlessClient(t.cluster).UpdateEndpointConfig(ctx, endpoint.PhysicalName, clusterConfig); err != nil {
+			return err
+		}
+		if len(placementUpdates) > 0 {
+			if err := s.placementRepo.Update(ctx, t.placement.ID, placementUpdates); err != nil {
+				return err
+			}
+		}
+	}
 	// 更新本地数据库
 	updates := map[string]interface{}{}
 	if v, ok := config["minReplicas"]; ok {
@@ -278,3 +618,375 @@ func (s *EndpointService) GetSpecPrice(ctx context.Context, specName string) (in
 	}
 	return spec.PricePerHour, nil
 }
+
+// maxEndpointPlacements 单个 endpoint 最多同时部署的集群数
+const maxEndpointPlacements = 5
+
+// ValidatePlacements 校验跨集群部署配置: spread 策略下每个集群至少可扩容到 1 个副本
+func ValidatePlacements(placements int, policy string, maxReplicas int) error {
+	if placements < 1 || placements > maxEndpointPlacements {
+		return fmt.Errorf("placements must be between 1 and %d", maxEndpointPlacements)
+	}
+	if policy != model.ReplicaPolicySpread && policy != model.ReplicaPolicyPrimary {
+		return fmt.Errorf("replica_policy must be %s or %s", model.ReplicaPolicySpread, model.ReplicaPolicyPrimary)
+	}
+	if placements > 1 && policy == model.ReplicaPolicySpread && maxReplicas < placements {
+		return fmt.Errorf("max_replicas must be at least %d to spread replicas across %d clusters", placements, placements)
+	}
+	return nil
+}
+
+// replicaShare 分配到单个集群的副本配置
+type replicaShare struct {
+	replicas    int
+	minReplicas int
+	maxReplicas int
+}
+
+// distributeReplicas 按副本分布策略将副本配置分配到 n 个集群 (按 rank 排序):
+// spread 均分, 余数分给靠前的集群; primary 全部分配给主集群, 热备集群 0 副本但可扩容到 maxReplicas
+func distributeReplicas(policy string, n, replicas, minReplicas, maxReplicas int) []replicaShare {
+	shares := make([]replicaShare, n)
+	for i := range shares {
+		if policy == model.ReplicaPolicyPrimary {
+			if i == 0 {
+				shares[i] = replicaShare{replicas, minReplicas, maxReplicas}
+			} else {
+				shares[i] = replicaShare{0, 0, maxReplicas}
+			}
+			continue
+		}
+		shares[i] = replicaShare{splitEven(replicas, n, i), splitEven(minReplicas, n, i), splitEven(maxReplicas, n, i)}
+	}
+	return shares
+}
+
+// splitEven total 均分为 n 份时第 i 份的数量
+func splitEven(total, n, i int) int {
+	if total <= 0 {
+		return 0
+	}
+	v := total / n
+	if i < total%n {
+		v++
+	}
+	return v
+}
+
+// targetReplicas endpoint 的目标总副本数 (未设置时为最小副本数, 停机时为 0)
+func targetReplicas(endpoint *model.UserEndpoint) int {
+	if endpoint.Status == model.EndpointStatusSuspended {
+		return 0
+	}
+	if endpoint.Replicas > 0 {
+		return endpoint.Replicas
+	}
+	return endpoint.MinReplicas
+}
+
+func envJSON(env map[string]string) model.JSONMap {
+	m := make(model.JSONMap, len(env))
+	for k, v := range env {
+		m[k] = v
+	}
+	return m
+}
+
+func envStrings(env model.JSONMap) map[string]string {
+	if len(env) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(env))
+	for k, v := range env {
+		m[k] = fmt.Sprint(v)
+	}
+	return m
+}
+
+// intValue 解析 JSON 配置中的整数值
+func intValue(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int(n), true
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// placementTarget active placement 及其所在集群
+type placementTarget struct {
+	placement *model.EndpointPlacement
+	cluster   *model.Cluster
+}
+
+// healthyPlacements endpoint 所在集群为 active 的 placement, 按 rank 排序
+func (s *EndpointService) healthyPlacements(ctx context.Context, endpointID int64) ([]placementTarget, error) {
+	placements, err := s.placementRepo.ListByEndpoint(ctx, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	var targets []placementTarget
+	for i := range placements {
+		if placements[i].Status != model.PlacementStatusActive {
+			continue
+		}
+		cluster, err := s.clusterService.GetCluster(ctx, placements[i].ClusterID)
+		if err != nil || cluster.Status != "active" {
+			continue
+		}
+		targets = append(targets, placementTarget{placement: &placements[i], cluster: cluster})
+	}
+	return targets, nil
+}
+
+// ListPlacements endpoint 的全部 placement (含待清理的 orphaned)
+func (s *EndpointService) ListPlacements(ctx context.Context, endpointID int64) ([]model.EndpointPlacement, error) {
+	return s.placementRepo.ListByEndpoint(ctx, endpointID)
+}
+
+// RouteClusters 任务路由: 返回 endpoint 可用 placement 所在集群, 按尝试顺序排序.
+// primary 策略按 rank (主集群优先), spread 策略按各集群当前副本数加权随机排序
+func (s *EndpointService) RouteClusters(ctx context.Context, endpoint *model.UserEndpoint) ([]*model.Cluster, error) {
+	targets, err := s.healthyPlacements(ctx, endpoint.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("endpoint %s has no healthy placement", endpoint.LogicalName)
+	}
+	if endpoint.ReplicaPolicy != model.ReplicaPolicyPrimary {
+		weightedShuffle(targets)
+	}
+	clusters := make([]*model.Cluster, len(targets))
+	for i, t := range targets {
+		clusters[i] = t.cluster
+	}
+	return clusters, nil
+}
+
+// weightedShuffle 按权重随机排序, 0 副本的集群也保留少量权重以触发扩容
+func weightedShuffle(targets []placementTarget) {
+	weight := func(t placementTarget) int { return t.placement.CurrentReplicas + 1 }
+	for i := 0; i < len(targets)-1; i++ {
+		total := 0
+		for _, t := range targets[i:] {
+			total += weight(t)
+		}
+		r := rand.Intn(total)
+		for j := i; j < len(targets); j++ {
+			if r -= weight(targets[j]); r < 0 {
+				targets[i], targets[j] = targets[j], targets[i]
+				break
+			}
+		}
+	}
+}
+
+// deployPlacement 按 endpoint 配置在 placement 所在集群创建部署
+func (s *EndpointService) deployPlacement(ctx context.Context, endpoint *model.UserEndpoint, cluster *model.Cluster, p *model.EndpointPlacement, cred *waverless.RegistryCredential) error {
+	return s.getWaverlessClient(cluster).CreateEndpoint(ctx, &waverless.CreateEndpointRequest{
+		Endpoint: endpoint.PhysicalName, SpecName: p.ClusterSpecName, Image: endpoint.Image,
+		Replicas: p.Replicas, MinReplicas: p.MinReplicas, MaxReplicas: p.MaxReplicas,
+		TaskTimeout: endpoint.TaskTimeout, Env: envStrings(endpoint.Env), Spot: endpoint.Spot,
+		RegistryCredential: cred,
+	})
+}
+
+// undeploy 回滚已创建的部署
+func (s *EndpointService) undeploy(ctx context.Context, physicalName string, candidates []ClusterCandidate) {
+	for _, c := range candidates {
+		if err := s.getWaverlessClient(c.Cluster).DeleteEndpoint(ctx, physicalName); err != nil {
+			logger.WarnCtx(ctx, "rollback endpoint %s on cluster %s error: %v", physicalName, c.Cluster.ClusterID, err)
+		}
+	}
+}
+
+// registryCredential endpoint 创建时指定的镜像仓库凭证
+func (s *EndpointService) registryCredential(ctx context.Context, endpoint *model.UserEndpoint) (*waverless.RegistryCredential, error) {
+	if endpoint.RegistryCredentialID == nil || s.registryCredentialRepo == nil {
+		return nil, nil
+	}
+	cred, err := s.registryCredentialRepo.GetByID(ctx, *endpoint.RegistryCredentialID)
+	if err != nil {
+		return nil, fmt.Errorf("registry credential %d not found", *endpoint.RegistryCredentialID)
+	}
+	password, err := cred.DecryptPassword()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt registry credential")
+	}
+	return &waverless.RegistryCredential{Registry: cred.Registry, Username: cred.Username, Password: password}, nil
+}
+
+// FailoverPlacements 跨集群故障转移, 在集群健康检查后执行:
+// 所在集群不可用的 placement 标记为 orphaned (其上 worker 停止计费), placement 不足的 endpoint 在其他可用集群补足,
+// 集群恢复后删除 orphaned placement 上的部署
+func (s *EndpointService) FailoverPlacements(ctx context.Context) {
+	failed, err := s.placementRepo.ListOnUnavailableClusters(ctx)
+	if err != nil {
+		logger.ErrorCtx(ctx, "list placements on unavailable clusters error: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range failed {
+		if err := s.placementRepo.Orphan(ctx, &failed[i], now); err != nil {
+			logger.ErrorCtx(ctx, "orphan placement %d error: %v", failed[i].ID, err)
+			continue
+		}
+		logger.WarnCtx(ctx, "endpoint %d placement on cluster %s orphaned, cluster unavailable", failed[i].EndpointID, failed[i].ClusterID)
+	}
+
+	ids, err := s.placementRepo.ListUnderPlacedEndpointIDs(ctx)
+	if err != nil {
+		logger.ErrorCtx(ctx, "list under-placed endpoints error: %v", err)
+	}
+	for _, id := range ids {
+		if err := s.replacePlacements(ctx, id); err != nil {
+			logger.WarnCtx(ctx, "replace placements of endpoint %d error: %v", id, err)
+		}
+	}
+
+	s.cleanupOrphanedPlacements(ctx)
+}
+
+// replacePlacements 在未部署过的可用集群补足 placement, 并按副本分布策略重新分配副本.
+// 新 placement 排在存活 placement 之后, 主集群下线时由 rank 最小的存活集群接任
+func (s *EndpointService) replacePlacements(ctx context.Context, endpointID int64) error {
+	endpoint, err := s.repo.GetByID(ctx, endpointID)
+	if err != nil {
+		return err
+	}
+	placements, err := s.placementRepo.ListByEndpoint(ctx, endpointID)
+	if err != nil {
+		return err
+	}
+	exclude := make(map[string]bool)
+	var active []model.EndpointPlacement
+	for _, p := range placements {
+		exclude[p.ClusterID] = true
+		if p.Status == model.PlacementStatusActive {
+			active = append(active, p)
+		}
+	}
+	missing := endpoint.PlacementCount - len(active)
+	if missing <= 0 {
+		return nil
+	}
+
+	// 无可用集群时仍调整存活 placement (primary 策略下由热备接任), 下一轮重试补足
+	candidates, selectErr := s.selectClusters(ctx, endpoint.OrgID, endpoint.SpecName, endpoint.PreferRegion, missing, exclude)
+	if selectErr != nil {
+		candidates = nil
+	}
+	var cred *waverless.RegistryCredential
+	if len(candidates) > 0 {
+		if cred, err = s.registryCredential(ctx, endpoint); err != nil {
+			return err
+		}
+	}
+
+	shares := distributeReplicas(endpoint.ReplicaPolicy, len(active)+len(candidates), targetReplicas(endpoint), endpoint.MinReplicas, endpoint.MaxReplicas)
+	for i := range active {
+		if err := s.applyShare(ctx, endpoint, &active[i], i, shares[i]); err != nil {
+			return fmt.Errorf("rebalance placement on cluster %s: %w", active[i].ClusterID, err)
+		}
+	}
+	primary := ""
+	if len(active) > 0 {
+		primary = active[0].ClusterID
+	}
+	for j, c := range candidates {
+		i := len(active) + j
+		p := &model.EndpointPlacement{
+			EndpointID: endpoint.ID, ClusterID: c.Cluster.ClusterID, ClusterSpecName: c.ClusterSpec.ClusterSpecName, Rank: i,
+			Replicas: shares[i].replicas, MinReplicas: shares[i].minReplicas, MaxReplicas: shares[i].maxReplicas,
+			Status: model.PlacementStatusActive,
+		}
+		if err := s.deployPlacement(ctx, endpoint, c.Cluster, p, cred); err != nil {
+			return fmt.Errorf("deploy to cluster %s: %w", c.Cluster.ClusterID, err)
+		}
+		if err := s.placementRepo.Create(ctx, p); err != nil {
+			s.getWaverlessClient(c.Cluster).DeleteEndpoint(ctx, endpoint.PhysicalName)
+			return err
+		}
+		logger.InfoCtx(ctx, "endpoint %s placed on cluster %s", endpoint.LogicalName, c.Cluster.ClusterID)
+		if primary == "" {
+			primary = c.Cluster.ClusterID
+		}
+	}
+	if primary != "" && primary != endpoint.ClusterID {
+		if err := s.repo.Update(ctx, endpoint.ID, map[string]interface{}{"cluster_id": primary}); err != nil {
+			return err
+		}
+	}
+	return selectErr
+}
+
+// applyShare 调整 placement 的 rank 及副本配置, 副本配置变化时同步到集群
+func (s *EndpointService) applyShare(ctx context.Context, endpoint *model.UserEndpoint, p *model.EndpointPlacement, rank int, share replicaShare) error {
+	updates := map[string]interface{}{}
+	if p.Rank != rank {
+		updates["placement_rank"] = rank
+	}
+	if p.Replicas != share.replicas || p.MinReplicas != share.minReplicas || p.MaxReplicas != share.maxReplicas {
+		cluster, err := s.clusterService.GetCluster(ctx, p.ClusterID)
+		if err != nil {
+			return err
+		}
+		client := s.getWaverlessClient(cluster)
+		if err := client.UpdateEndpointConfig(ctx, endpoint.PhysicalName, map[string]interface{}{
+			"minReplicas": share.minReplicas,
+			"maxReplicas": share.maxReplicas,
+		}); err != nil {
+			return err
+		}
+		if err := client.UpdateEndpointDeployment(ctx, endpoint.PhysicalName, share.replicas, "", nil); err != nil {
+			return err
+		}
+		updates["replicas"] = share.replicas
+		updates["min_replicas"] = share.minReplicas
+		updates["max_replicas"] = share.maxReplicas
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return s.placementRepo.Update(ctx, p.ID, updates)
+}
+
+// cleanupOrphanedPlacements 删除已恢复集群上 orphaned placement 的部署
+func (s *EndpointService) cleanupOrphanedPlacements(ctx context.Context) {
+	orphaned, err := s.placementRepo.ListOrphanedOnActiveClusters(ctx)
+	if err != nil {
+		logger.ErrorCtx(ctx, "list orphaned placements error: %v", err)
+		return
+	}
+	for i := range orphaned {
+		p := &orphaned[i]
+		endpoint, err := s.repo.GetByID(ctx, p.EndpointID)
+		if err != nil {
+			continue
+		}
+		// 同名 endpoint 已重新部署到该集群时只删除记录, 保留部署
+		inUse, err := s.placementRepo.ActiveOnCluster(ctx, p.ClusterID, endpoint.PhysicalName)
+		if err != nil {
+			continue
+		}
+		if !inUse {
+			cluster, err := s.clusterService.GetCluster(ctx, p.ClusterID)
+			if err != nil {
+				continue
+			}
+			if err := s.getWaverlessClient(cluster).DeleteEndpoint(ctx, endpoint.PhysicalName); err != nil && !waverless.IsNotFound(err) {
+				logger.WarnCtx(ctx, "delete orphaned endpoint %s on cluster %s error: %v", endpoint.PhysicalName, p.ClusterID, err)
+				continue
+			}
+		}
+		if err := s.placementRepo.Delete(ctx, p.ID); err != nil {
+			logger.ErrorCtx(ctx, "delete orphaned placement %d error: %v", p.ID, err)
+			continue
+		}
+		logger.InfoCtx(ctx, "orphaned placement of endpoint %s on cluster %s removed", endpoint.LogicalName, p.ClusterID)
+	}
+}
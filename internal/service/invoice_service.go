@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+// InvoiceService 组织月度账单 (按 UTC 自然月, 以 billing_period_start 归属月份)
+type InvoiceService struct {
+	repo       *mysql.InvoiceRepo
+	currencies *CurrencyService
+}
+
+func NewInvoiceService(repo *mysql.InvoiceRepo, currencies *CurrencyService) *InvoiceService {
+	return &InvoiceService{repo: repo, currencies: currencies}
+}
+
+// MonthStart 返回 t 所在月份的开始时间 (UTC)
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (s *InvoiceService) List(ctx context.Context, orgID string, limit, offset int) ([]model.Invoice, int64, error) {
+	return s.repo.ListByOrg(ctx, orgID, limit, offset)
+}
+
+// Get 获取账单及明细
+func (s *InvoiceService) Get(ctx context.Context, orgID string, id int64) (*model.Invoice, []model.InvoiceLineItem, error) {
+	invoice, err := s.repo.GetByID(ctx, orgID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err := s.repo.ListItems(ctx, invoice.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return invoice, items, nil
+}
+
+// GenerateDraft 根据计费流水和调账生成/刷新组织指定月份的草稿账单, 已关账的账单直接返回
+func (s *InvoiceService) GenerateDraft(ctx context.Context, orgID string, month time.Time) (*model.Invoice, error) {
+	periodStart := MonthStart(month)
+	periodEnd := periodStart.AddDate(0, 1, 0)
+
+	invoice, err := s.repo.GetByOrgPeriod(ctx, orgID, periodStart)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		// 组织已有流水后计费币种不可修改, 账单币种即流水币种
+		currency := model.DefaultCurrency
+		if s.currencies != nil {
+			if currency, err = s.currencies.OrgCurrency(ctx, orgID); err != nil {
+				return nil, err
+			}
+		}
+		invoice = &model.Invoice{
+			InvoiceNumber: invoiceNumber(orgID, periodStart),
+			OrgID:         orgID,
+			PeriodStart:   periodStart,
+			PeriodEnd:     periodEnd,
+			Currency:      currency,
+			Status:        model.InvoiceStatusDraft,
+		}
+	}
+	if invoice.Status == model.InvoiceStatusFinalized {
+		return invoice, nil
+	}
+
+	items, err := s.repo.AggregateLineItems(ctx, orgID, periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+	// 调账 (退款为负, 补扣为正) 计入总额, 不计入时长
+	adjustments, err := s.repo.AggregateAdjustments(ctx, orgID, periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, adjustments...)
+	invoice.TotalAmount, invoice.TotalSeconds = 0, 0
+	for _, item := range items {
+		invoice.TotalAmount += item.Amount
+		invoice.TotalSeconds += item.DurationSeconds
+	}
+
+	if err := s.repo.SaveDraft(ctx, invoice, items); err != nil {
+		if errors.Is(err, mysql.ErrInvoiceFinalized) {
+			// 并发关账, 返回最新记录
+			return s.repo.GetByOrgPeriod(ctx, orgID, periodStart)
+		}
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// RefreshDrafts 刷新指定月份所有有用量组织的草稿账单
+func (s *InvoiceService) RefreshDrafts(ctx context.Context, month time.Time) error {
+	return s.eachOrg(ctx, month, func(orgID string) error {
+		_, err := s.GenerateDraft(ctx, orgID, month)
+		return err
+	})
+}
+
+// CloseMonth 关账: 生成指定月份所有组织的最终账单, 已关账的跳过
+func (s *InvoiceService) CloseMonth(ctx context.Context, month time.Time) error {
+	return s.eachOrg(ctx, month, func(orgID string) error {
+		invoice, err := s.GenerateDraft(ctx, orgID, month)
+		if err != nil {
+			return err
+		}
+		if invoice.Status == model.InvoiceStatusFinalized {
+			return nil
+		}
+		if err := s.repo.Finalize(ctx, invoice.ID, time.Now()); err != nil && !errors.Is(err, mysql.ErrInvoiceFinalized) {
+			return err
+		}
+		logger.InfoCtx(ctx, "[Invoice] finalized invoice %s, amount %d", invoice.InvoiceNumber, invoice.TotalAmount)
+		return nil
+	})
+}
+
+func (s *InvoiceService) eachOrg(ctx context.Context, month time.Time, fn func(orgID string) error) error {
+	periodStart := MonthStart(month)
+	orgIDs, err := s.repo.ListOrgsWithUsage(ctx, periodStart, periodStart.AddDate(0, 1, 0))
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, orgID := range orgIDs {
+		if err := fn(orgID); err != nil {
+			logger.ErrorCtx(ctx, "[Invoice] org %s month %s error: %v", orgID, periodStart.Format("2006-01"), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orgs failed", failed, len(orgIDs))
+	}
+	return nil
+}
+
+// invoiceNumber 账单编号: INV-<YYYYMM>-<ORG_ID>
+func invoiceNumber(orgID string, periodStart time.Time) string {
+	return fmt.Sprintf("INV-%s-%s", periodStart.Format("200601"), strings.ToUpper(orgID))
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/archive"
+	"github.com/wavespeedai/waverless-portal/pkg/config"
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+)
+
+// ledgerExportName 导出水位名称及对象 key 前缀
+const ledgerExportName = "billing_transactions"
+
+// ErrLedgerStorageUnavailable 未配置可用的导出存储
+var ErrLedgerStorageUnavailable = errors.New("ledger export storage not available")
+
+// LedgerExportService 计费流水按天 (created_at 的 UTC 日期) 导出到本地目录或 S3 兼容存储:
+// 每轮从水位之后增量导出分片, 每个日分区写入 manifest.json 列出全部分片及 sha256 校验和
+type LedgerExportService struct {
+	repo      *mysql.LedgerExportRepo
+	storage   archive.Storage // 为空时只能查询状态
+	format    string
+	formatErr error // 配置了不支持的格式 (如 parquet) 时导出及重导均返回该错误
+	batchSize int
+	settle    time.Duration
+}
+
+func NewLedgerExportService(repo *mysql.LedgerExportRepo, storage archive.Storage) *LedgerExportService {
+	s := &LedgerExportService{
+		repo:      repo,
+		storage:   storage,
+		format:    archive.FormatCSV,
+		batchSize: 50000,
+		settle:    5 * time.Minute,
+	}
+	if config.GlobalConfig != nil {
+		cfg := config.GlobalConfig.Billing.LedgerExport
+		if cfg.Target.Format != "" {
+			s.format = cfg.Target.Format
+		}
+		s.formatErr = archive.ValidateFormat(s.format)
+		if cfg.BatchSize > 0 {
+			s.batchSize = cfg.BatchSize
+		}
+		if cfg.SettleSeconds > 0 {
+			s.settle = time.Duration(cfg.SettleSeconds) * time.Second
+		}
+	}
+	return s
+}
+
+// LedgerManifest 日分区 manifest
+type LedgerManifest struct {
+	Table       string               `json:"table"`
+	Day         string               `json:"day"`
+	Format      string               `json:"format"`
+	GeneratedAt time.Time            `json:"generated_at"`
+	RowCount    int64                `json:"row_count"`
+	TotalAmount int64                `json:"total_amount"` // amount 列之和 (不区分币种, 用于核对)
+	Parts       []LedgerManifestPart `json:"parts"`
+}
+
+// LedgerManifestPart manifest 中的分片
+type LedgerManifestPart struct {
+	Key       string `json:"key"`
+	FirstID   int64  `json:"first_id"`
+	LastID    int64  `json:"last_id"`
+	RowCount  int    `json:"row_count"`
+	SizeBytes int64  `json:"size_bytes"`
+	SHA256    string `json:"sha256"`
+}
+
+// LedgerExportStatus 导出状态
+type LedgerExportStatus struct {
+	Watermark *model.LedgerExportWatermark
+	Exports   []model.LedgerExport
+	Total     int64
+}
+
+// Run 执行一轮导出: 增量分片、管理员要求的整天重导, 最后为分片有变化的日分区写 manifest
+func (s *LedgerExportService) Run(ctx context.Context) error {
+	if s.formatErr != nil {
+		return s.formatErr
+	}
+	if s.storage == nil {
+		return ErrLedgerStorageUnavailable
+	}
+	if err := s.exportIncremental(ctx); err != nil {
+		return err
+	}
+	if err := s.exportReruns(ctx); err != nil {
+		return err
+	}
+	return s.writeManifests(ctx)
+}
+
+// exportIncremental 从水位之后按批导出, 每批按日拆分为分片, 分片记录与水位推进同事务
+func (s *LedgerExportService) exportIncremental(ctx context.Context) error {
+	before := time.Now().Add(-s.settle)
+	for ctx.Err() == nil {
+		wm, err := s.repo.GetWatermark(ctx, ledgerExportName)
+		if err != nil {
+			return err
+		}
+		txs, err := s.repo.ListTransactionsAfter(ctx, wm.LastID, before, s.batchSize)
+		if err != nil || len(txs) == 0 {
+			return err
+		}
+
+		var parts []model.LedgerExportPart
+		for _, group := range groupByDay(txs) {
+			part, err := s.uploadPart(ctx, group, "")
+			if err != nil {
+				return err
+			}
+			parts = append(parts, *part)
+		}
+		lastID := txs[len(txs)-1].ID
+		if err := s.repo.CommitParts(ctx, ledgerExportName, wm.LastID, lastID, s.format, parts); err != nil {
+			if errors.Is(err, mysql.ErrLedgerExportConflict) {
+				// 其他副本已导出该批次
+				logger.WarnCtx(ctx, "[LedgerExport] watermark moved from %d, stop this round", wm.LastID)
+				return nil
+			}
+			return err
+		}
+		logger.InfoCtx(ctx, "[LedgerExport] exported %d transactions (%d, %d] in %d parts", len(txs), wm.LastID, lastID, len(parts))
+		if len(txs) < s.batchSize {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// exportReruns 重新导出被要求重导的日分区中水位以内的流水, 替换原有分片
+func (s *LedgerExportService) exportReruns(ctx context.Context) error {
+	days, err := s.repo.ListByStatus(ctx, model.LedgerExportRerunRequested)
+	if err != nil {
+		return err
+	}
+	for _, export := range days {
+		if err := s.rerunDay(ctx, export.Day); err != nil {
+			if errors.Is(err, mysql.ErrLedgerExportConflict) {
+				continue
+			}
+			return fmt.Errorf("rerun %s: %w", export.Day.Format("2006-01-02"), err)
+		}
+	}
+	return nil
+}
+
+func (s *LedgerExportService) rerunDay(ctx context.Context, day time.Time) error {
+	wm, err := s.repo.GetWatermark(ctx, ledgerExportName)
+	if err != nil {
+		return err
+	}
+	// 重导分片使用独立的 key, 新 manifest 写入前旧 manifest 引用的文件保持不变
+	tag := fmt.Sprintf("r%d", time.Now().Unix())
+
+	var parts []model.LedgerExportPart
+	afterID := int64(0)
+	for {
+		txs, err := s.repo.ListDayTransactions(ctx, day, afterID, wm.LastID, s.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(txs) == 0 {
+			break
+		}
+		part, err := s.uploadPart(ctx, txs, tag)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, *part)
+		afterID = txs[len(txs)-1].ID
+		if len(txs) < s.batchSize {
+			break
+		}
+	}
+	if err := s.repo.ReplaceDayParts(ctx, day, wm.LastID, s.format, parts); err != nil {
+		return err
+	}
+	logger.InfoCtx(ctx, "[LedgerExport] re-exported %s up to transaction %d in %d parts", day.Format("2006-01-02"), wm.LastID, len(parts))
+	return nil
+}
+
+// uploadPart 编码并上传一个分片及其 .sha256 校验文件 (同一 key 重复上传会覆盖)
+func (s *LedgerExportService) uploadPart(ctx context.Context, txs []model.BillingTransaction, tag string) (*model.LedgerExportPart, error) {
+	file, err := archive.Encode(s.format, txs)
+	if err != nil {
+		return nil, err
+	}
+	day := ledgerDay(txs[0].CreatedAt)
+	firstID, lastID := txs[0].ID, txs[len(txs)-1].ID
+	name := fmt.Sprintf("part-%d-%d", firstID, lastID)
+	if tag != "" {
+		name += "-" + tag
+	}
+	key := ledgerDayPrefix(day) + name + file.Ext()
+	if err := s.storage.Put(ctx, key, file.Data, "application/gzip"); err != nil {
+		return nil, fmt.Errorf("upload ledger part %s: %w", key, err)
+	}
+	if err := s.storage.Put(ctx, key+".sha256", file.ChecksumFile(path.Base(key)), "text/plain"); err != nil {
+		return nil, fmt.Errorf("upload ledger checksum %s: %w", key, err)
+	}
+
+	var amount int64
+	for i := range txs {
+		amount += txs[i].Amount
+	}
+	return &model.LedgerExportPart{
+		Day: day, ObjectKey: key, FirstID: firstID, LastID: lastID, RowCount: len(txs),
+		TotalAmount: amount, SizeBytes: int64(len(file.Data)), SHA256: file.SHA256,
+	}, nil
+}
+
+// writeManifests 为分片有变化或上次写入失败的日分区重新生成 manifest
+func (s *LedgerExportService) writeManifests(ctx context.Context) error {
+	exports, err := s.repo.ListByStatus(ctx, model.LedgerExportPending, model.LedgerExportFailed)
+	if err != nil {
+		return err
+	}
+	for i := range exports {
+		if err := s.writeManifest(ctx, &exports[i]); err != nil {
+			logger.ErrorCtx(ctx, "[LedgerExport] write manifest for %s error: %v", exports[i].Day.Format("2006-01-02"), err)
+			if markErr := s.repo.MarkFailed(ctx, exports[i].Day, err.Error()); markErr != nil {
+				logger.ErrorCtx(ctx, "[LedgerExport] mark %s failed error: %v", exports[i].Day.Format("2006-01-02"), markErr)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *LedgerExportService) writeManifest(ctx context.Context, export *model.LedgerExport) error {
+	parts, err := s.repo.ListDayParts(ctx, export.Day)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	manifest := LedgerManifest{
+		Table:       ledgerExportName,
+		Day:         export.Day.Format("2006-01-02"),
+		Format:      export.Format,
+		GeneratedAt: now,
+		Parts:       make([]LedgerManifestPart, 0, len(parts)),
+	}
+	for _, p := range parts {
+		manifest.RowCount += int64(p.RowCount)
+		manifest.TotalAmount += p.TotalAmount
+		manifest.Parts = append(manifest.Parts, LedgerManifestPart{
+			Key: p.ObjectKey, FirstID: p.FirstID, LastID: p.LastID, RowCount: p.RowCount, SizeBytes: p.SizeBytes, SHA256: p.SHA256,
+		})
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	sha := hex.EncodeToString(sum[:])
+
+	key := ledgerDayPrefix(export.Day) + "manifest.json"
+	if err := s.storage.Put(ctx, key, data, "application/json"); err != nil {
+		return err
+	}
+	if err := s.storage.Put(ctx, key+".sha256", []byte(sha+"  manifest.json\n"), "text/plain"); err != nil {
+		return err
+	}
+	if _, err := s.repo.MarkManifest(ctx, export, key, sha, now); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RequestRerun 要求重新导出某天 (UTC) 的流水, 由下一轮导出执行
+func (s *LedgerExportService) RequestRerun(ctx context.Context, day time.Time) error {
+	if s.formatErr != nil {
+		return s.formatErr
+	}
+	day = ledgerDay(day)
+	if day.After(ledgerDay(time.Now())) {
+		return errors.New("day must not be in the future")
+	}
+	return s.repo.RequestRerun(ctx, day, s.format)
+}
+
+// Status 导出水位及日分区列表
+func (s *LedgerExportService) Status(ctx context.Context, status string, limit, offset int) (*LedgerExportStatus, error) {
+	wm, err := s.repo.GetWatermark(ctx, ledgerExportName)
+	if err != nil {
+		return nil, err
+	}
+	exports, total, err := s.repo.List(ctx, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &LedgerExportStatus{Watermark: wm, Exports: exports, Total: total}, nil
+}
+
+// GetDay 日分区及其分片
+func (s *LedgerExportService) GetDay(ctx context.Context, day time.Time) (*model.LedgerExport, []model.LedgerExportPart, error) {
+	day = ledgerDay(day)
+	export, err := s.repo.GetByDay(ctx, day)
+	if err != nil {
+		return nil, nil, err
+	}
+	parts, err := s.repo.ListDayParts(ctx, day)
+	if err != nil {
+		return nil, nil, err
+	}
+	return export, parts, nil
+}
+
+// groupByDay 按创建日期拆分一批流水 (保持 ID 顺序)
+func groupByDay(txs []model.BillingTransaction) [][]model.BillingTransaction {
+	index := make(map[time.Time]int)
+	var groups [][]model.BillingTransaction
+	for _, tx := range txs {
+		day := ledgerDay(tx.CreatedAt)
+		i, ok := index[day]
+		if !ok {
+			i = len(groups)
+			index[day] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], tx)
+	}
+	return groups
+}
+
+// ledgerDay t 所在的 UTC 日期
+func ledgerDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ledgerDayPrefix 日分区的对象 key 前缀, 如 billing_transactions/dt=2026-10-16/
+func ledgerDayPrefix(day time.Time) string {
+	return fmt.Sprintf("%s/dt=%s/", ledgerExportName, day.Format("2006-01-02"))
+}
@@ -0,0 +1,461 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+// 清单中 endpoint 的变更动作
+const (
+	ManifestActionCreate    = "create"
+	ManifestActionUpdate    = "update"
+	ManifestActionDelete    = "delete" // 不在清单中的 endpoint, 仅 prune 时删除
+	ManifestActionUnchanged = "unchanged"
+)
+
+// Manifest 声明式 endpoint 清单 (YAML/JSON), 描述组织内 endpoint 的目标状态
+type Manifest struct {
+	Endpoints []EndpointManifest `json:"endpoints" yaml:"endpoints"`
+}
+
+// EndpointManifest 单个 endpoint 的目标配置. spec, registry_credential 及跨集群/计费相关字段创建后不可修改
+type EndpointManifest struct {
+	Name               string            `json:"name" yaml:"name"`
+	Spec               string            `json:"spec" yaml:"spec"`
+	Image              string            `json:"image" yaml:"image"`
+	Env                map[string]string `json:"env" yaml:"env"` // 完整环境变量, 不能删除已部署的变量 (waverless 只支持覆盖)
+	RegistryCredential string            `json:"registry_credential" yaml:"registry_credential"`
+	Replicas           *int              `json:"replicas" yaml:"replicas"` // 为空时不管理副本数 (由 autoscaler 调整)
+	// Autoscaler 完整 autoscaler 配置 (minReplicas, maxReplicas, taskTimeout 等), 原样下发到 waverless
+	Autoscaler map[string]interface{} `json:"autoscaler" yaml:"autoscaler"`
+
+	Tags             map[string]string `json:"tags" yaml:"tags"` // 为空时不管理标签
+	PreemptionPolicy string            `json:"preemption_policy" yaml:"preemption_policy"`
+
+	// 仅创建时生效
+	PreferRegion  string `json:"prefer_region" yaml:"prefer_region"`
+	Spot          bool   `json:"spot" yaml:"spot"`
+	BillingMode   string `json:"billing_mode" yaml:"billing_mode"`
+	Placements    int    `json:"placements" yaml:"placements"`
+	ReplicaPolicy string `json:"replica_policy" yaml:"replica_policy"`
+}
+
+// ManifestPlan 清单与当前状态的差异
+type ManifestPlan struct {
+	OrgID     string              `json:"-"`
+	Endpoints []EndpointPlanEntry `json:"endpoints"`
+}
+
+// EndpointPlanEntry 单个 endpoint 的变更计划
+type EndpointPlanEntry struct {
+	Name    string           `json:"name"`
+	Action  string           `json:"action"` // create, update, delete, unchanged
+	Changes []RevisionChange `json:"changes,omitempty"`
+	Error   string           `json:"error,omitempty"` // 无法应用的原因, 或 apply 时的失败原因
+
+	manifest *EndpointManifest
+	endpoint *model.UserEndpoint
+	scaleUp  bool
+}
+
+// HasErrors 计划中是否有无法应用的 endpoint
+func (p *ManifestPlan) HasErrors() bool {
+	for _, e := range p.Endpoints {
+		if e.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ScalesUp 计划是否会创建 endpoint 或增加副本数 (需检查余额及预算)
+func (p *ManifestPlan) ScalesUp() bool {
+	for _, e := range p.Endpoints {
+		if e.scaleUp {
+			return true
+		}
+	}
+	return false
+}
+
+// ManifestService 按声明式清单 plan/apply endpoint: 对比清单与 portal 及 waverless 当前状态, 创建/更新 (可选删除) endpoint
+type ManifestService struct {
+	endpointService        *EndpointService
+	revisionService        *RevisionService
+	rolloutRepo            *mysql.RolloutRepo
+	registryCredentialRepo *mysql.RegistryCredentialRepo
+}
+
+func NewManifestService(endpointService *EndpointService, revisionService *RevisionService, rolloutRepo *mysql.RolloutRepo, registryCredentialRepo *mysql.RegistryCredentialRepo) *ManifestService {
+	return &ManifestService{endpointService: endpointService, revisionService: revisionService, rolloutRepo: rolloutRepo, registryCredentialRepo: registryCredentialRepo}
+}
+
+// Plan 对比清单与组织当前 endpoint, prune 时清单中没有的 endpoint 计划删除
+func (s *ManifestService) Plan(ctx context.Context, orgID string, m *Manifest, prune bool) (*ManifestPlan, error) {
+	existing, err := s.endpointService.List(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*model.UserEndpoint, len(existing))
+	for i := range existing {
+		byName[existing[i].LogicalName] = &existing[i]
+	}
+
+	plan := &ManifestPlan{OrgID: orgID}
+	seen := make(map[string]bool, len(m.Endpoints))
+	for i := range m.Endpoints {
+		em := &m.Endpoints[i]
+		entry := EndpointPlanEntry{Name: em.Name, manifest: em}
+		if err := normalizeManifest(em); err != nil {
+			entry.Error = err.Error()
+		} else if seen[em.Name] {
+			entry.Error = "duplicate endpoint name in manifest"
+		} else if endpoint, ok := byName[em.Name]; ok {
+			entry.endpoint = endpoint
+			if err := s.planUpdate(ctx, &entry); err != nil {
+				return nil, err
+			}
+		} else {
+			s.planCreate(&entry)
+		}
+		seen[em.Name] = true
+		plan.Endpoints = append(plan.Endpoints, entry)
+	}
+
+	if prune {
+		for i := range existing {
+			if !seen[existing[i].LogicalName] {
+				plan.Endpoints = append(plan.Endpoints, EndpointPlanEntry{
+					Name: existing[i].LogicalName, Action: ManifestActionDelete, endpoint: &existing[i],
+				})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// normalizeManifest 校验必填字段, autoscaler 配置经 JSON 转换统一数值类型 (YAML 整数解析为 int)
+func normalizeManifest(em *EndpointManifest) error {
+	if em.Name == "" {
+		return errors.New("name is required")
+	}
+	if em.Image == "" {
+		return errors.New("image is required")
+	}
+	if em.Spec == "" {
+		return errors.New("spec is required")
+	}
+	if em.Tags != nil {
+		if err := ValidateTags(em.Tags); err != nil {
+			return err
+		}
+	}
+	if em.PreemptionPolicy != "" {
+		if err := ValidatePreemptionPolicy(em.PreemptionPolicy); err != nil {
+			return err
+		}
+	}
+	if len(em.Autoscaler) > 0 {
+		data, err := json.Marshal(em.Autoscaler)
+		if err != nil {
+			return fmt.Errorf("invalid autoscaler config: %w", err)
+		}
+		var config map[string]interface{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("invalid autoscaler config: %w", err)
+		}
+		em.Autoscaler = config
+	}
+	return nil
+}
+
+func (s *ManifestService) planCreate(entry *EndpointPlanEntry) {
+	em := entry.manifest
+	entry.Action = ManifestActionCreate
+	entry.scaleUp = true
+	add := func(field string, to interface{}) {
+		entry.Changes = append(entry.Changes, RevisionChange{Field: field, To: to})
+	}
+	add("spec", em.Spec)
+	add("image", em.Image)
+	if em.Replicas != nil {
+		add("replicas", *em.Replicas)
+	}
+	if em.RegistryCredential != "" {
+		add("registry_credential", em.RegistryCredential)
+	}
+	for _, k := range sortedKeys(em.Env) {
+		add("env."+k, em.Env[k])
+	}
+	for _, k := range sortedKeys(em.Autoscaler) {
+		add("autoscaler."+k, em.Autoscaler[k])
+	}
+	for _, k := range sortedKeys(em.Tags) {
+		add("tags."+k, em.Tags[k])
+	}
+}
+
+// planUpdate 对比 endpoint 当前状态: image、env 及 autoscaler 配置优先取 waverless 中的实际值, 取不到时使用 portal 记录.
+// waverless 只覆盖不删除环境变量, 清单缺少已部署的环境变量时报错, 避免 apply 后仍残留在部署中而之后的 plan 无法发现
+func (s *ManifestService) planUpdate(ctx context.Context, entry *EndpointPlanEntry) error {
+	em, endpoint := entry.manifest, entry.endpoint
+
+	if msg, err := s.immutableChange(ctx, em, endpoint); err != nil {
+		return err
+	} else if msg != "" {
+		entry.Error = msg
+		return nil
+	}
+
+	detail, _ := s.endpointService.GetEndpointDetail(ctx, endpoint)
+	var revisionConfig model.JSONMap
+	if latest, err := s.revisionService.Latest(ctx, endpoint.ID); err == nil {
+		revisionConfig = latest.Config
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	add := func(field string, from, to interface{}) {
+		if fmt.Sprint(from) != fmt.Sprint(to) {
+			entry.Changes = append(entry.Changes, RevisionChange{Field: field, From: from, To: to})
+		}
+	}
+
+	image := endpoint.Image
+	if v, ok := detail["image"].(string); ok && v != "" {
+		image = v
+	}
+	add("image", image, em.Image)
+	if em.Replicas != nil {
+		add("replicas", endpoint.Replicas, *em.Replicas)
+		entry.scaleUp = *em.Replicas > endpoint.Replicas
+	}
+
+	env := detailEnv(detail, endpoint)
+	var removedEnv []string
+	for _, k := range sortedKeys(mergeKeys(env, em.Env)) {
+		from, to := interface{}(nil), interface{}(nil)
+		if v, ok := env[k]; ok {
+			from = v
+		}
+		if v, ok := em.Env[k]; ok {
+			to = v
+		} else {
+			removedEnv = append(removedEnv, k)
+		}
+		add("env."+k, from, to)
+	}
+
+	columns := map[string]interface{}{
+		"minReplicas": endpoint.MinReplicas,
+		"maxReplicas": endpoint.MaxReplicas,
+		"taskTimeout": endpoint.TaskTimeout,
+	}
+	for _, k := range sortedKeys(em.Autoscaler) {
+		var current interface{}
+		if v, ok := detail[k]; ok {
+			current = v
+		} else if v, ok := columns[k]; ok {
+			current = v
+		} else {
+			current = revisionConfig[k]
+		}
+		add("autoscaler."+k, current, em.Autoscaler[k])
+	}
+
+	if em.Tags != nil {
+		for _, k := range sortedKeys(mergeKeys(endpoint.Tags, em.Tags)) {
+			from, to := interface{}(nil), interface{}(nil)
+			if v, ok := endpoint.Tags[k]; ok {
+				from = v
+			}
+			if v, ok := em.Tags[k]; ok {
+				to = v
+			}
+			add("tags."+k, from, to)
+		}
+	}
+	if em.PreemptionPolicy != "" {
+		add("preemption_policy", endpoint.PreemptionPolicy, em.PreemptionPolicy)
+	}
+
+	entry.Action = ManifestActionUnchanged
+	if len(entry.Changes) > 0 {
+		entry.Action = ManifestActionUpdate
+		if _, err := s.rolloutRepo.GetInProgress(ctx, endpoint.ID); err == nil {
+			entry.Error = ErrRolloutInProgress.Error()
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	if len(removedEnv) > 0 && entry.Error == "" {
+		entry.Error = fmt.Sprintf("env %s cannot be removed from a deployed endpoint, keep them in the manifest or recreate the endpoint", strings.Join(removedEnv, ", "))
+	}
+	return nil
+}
+
+// immutableChange 清单修改了创建后不可变的字段时返回原因
+func (s *ManifestService) immutableChange(ctx context.Context, em *EndpointManifest, endpoint *model.UserEndpoint) (string, error) {
+	switch {
+	case em.Spec != endpoint.SpecName:
+		return fmt.Sprintf("spec cannot be changed from %s to %s, recreate the endpoint", endpoint.SpecName, em.Spec), nil
+	case em.Spot != endpoint.Spot:
+		return "spot cannot be changed after creation", nil
+	case em.BillingMode != "" && em.BillingMode != endpoint.BillingMode:
+		return "billing_mode cannot be changed after creation", nil
+	case em.Placements != 0 && em.Placements != endpoint.PlacementCount:
+		return "placements cannot be changed after creation", nil
+	case em.ReplicaPolicy != "" && em.ReplicaPolicy != endpoint.ReplicaPolicy:
+		return "replica_policy cannot be changed after creation", nil
+	case em.PreferRegion != "" && em.PreferRegion != endpoint.PreferRegion:
+		return "prefer_region cannot be changed after creation", nil
+	}
+
+	current := ""
+	if endpoint.RegistryCredentialID != nil {
+		cred, err := s.registryCredentialRepo.GetByID(ctx, *endpoint.RegistryCredentialID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", err
+		}
+		if err == nil {
+			current = cred.Name
+		}
+	}
+	if em.RegistryCredential != current {
+		return "registry_credential cannot be changed after creation", nil
+	}
+	return "", nil
+}
+
+// Apply 按计划创建/更新/删除 endpoint. 单个 endpoint 失败时记录到对应条目的 Error 并继续处理其余 endpoint,
+// 返回是否全部成功
+func (s *ManifestService) Apply(ctx context.Context, userID string, plan *ManifestPlan) bool {
+	ok := true
+	for i := range plan.Endpoints {
+		entry := &plan.Endpoints[i]
+		var err error
+		switch entry.Action {
+		case ManifestActionCreate:
+			err = s.applyCreate(ctx, userID, plan.OrgID, entry.manifest)
+		case ManifestActionUpdate:
+			err = s.applyUpdate(ctx, userID, plan.OrgID, entry)
+		case ManifestActionDelete:
+			err = s.endpointService.Delete(ctx, plan.OrgID, entry.Name)
+		}
+		if err != nil {
+			entry.Error = err.Error()
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (s *ManifestService) applyCreate(ctx context.Context, userID, orgID string, em *EndpointManifest) error {
+	req := &CreateEndpointRequest{
+		LogicalName: em.Name, SpecName: em.Spec, Image: em.Image, Env: em.Env,
+		PreferRegion: em.PreferRegion, RegistryCredentialName: em.RegistryCredential, Tags: em.Tags,
+		Spot: em.Spot, PreemptionPolicy: em.PreemptionPolicy, BillingMode: em.BillingMode,
+		Placements: em.Placements, ReplicaPolicy: em.ReplicaPolicy,
+	}
+	if em.Replicas != nil {
+		req.Replicas = *em.Replicas
+	}
+	req.MinReplicas, _ = intValue(em.Autoscaler["minReplicas"])
+	req.MaxReplicas, _ = intValue(em.Autoscaler["maxReplicas"])
+	req.TaskTimeout, _ = intValue(em.Autoscaler["taskTimeout"])
+	if _, err := s.endpointService.Create(ctx, userID, orgID, req); err != nil {
+		return err
+	}
+	// 其余 autoscaler 配置创建后下发
+	if hasExtraConfig(em.Autoscaler) {
+		if err := s.endpointService.UpdateConfig(ctx, orgID, em.Name, em.Autoscaler); err != nil {
+			return err
+		}
+	}
+	s.revisionService.Record(ctx, orgID, em.Name, model.RevisionSourceManifest, userID, em.Autoscaler, nil)
+	return nil
+}
+
+func (s *ManifestService) applyUpdate(ctx context.Context, userID, orgID string, entry *EndpointPlanEntry) error {
+	em := entry.manifest
+	var deployment, config, tags, policy bool
+	for _, c := range entry.Changes {
+		switch field := c.Field; {
+		case field == "image" || field == "replicas" || strings.HasPrefix(field, "env."):
+			deployment = true
+		case strings.HasPrefix(field, "autoscaler."):
+			config = true
+		case strings.HasPrefix(field, "tags."):
+			tags = true
+		case field == "preemption_policy":
+			policy = true
+		}
+	}
+
+	if deployment {
+		replicas := -1
+		if em.Replicas != nil {
+			replicas = *em.Replicas
+		}
+		if err := s.endpointService.UpdateDeployment(ctx, orgID, em.Name, replicas, em.Image, em.Env); err != nil {
+			return err
+		}
+	}
+	if config {
+		if err := s.endpointService.UpdateConfig(ctx, orgID, em.Name, em.Autoscaler); err != nil {
+			return err
+		}
+	}
+	if tags {
+		if err := s.endpointService.UpdateTags(ctx, orgID, em.Name, em.Tags); err != nil {
+			return err
+		}
+	}
+	if policy {
+		if err := s.endpointService.UpdatePreemptionPolicy(ctx, orgID, em.Name, em.PreemptionPolicy); err != nil {
+			return err
+		}
+	}
+	if deployment || config {
+		s.revisionService.Record(ctx, orgID, em.Name, model.RevisionSourceManifest, userID, em.Autoscaler, nil)
+	}
+	return nil
+}
+
+// hasExtraConfig autoscaler 配置中是否有创建接口不支持的 key
+func hasExtraConfig(config map[string]interface{}) bool {
+	for k := range config {
+		if k != "minReplicas" && k != "maxReplicas" && k != "taskTimeout" {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func mergeKeys[V any](a, b map[string]V) map[string]bool {
+	keys := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
@@ -0,0 +1,448 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"github.com/wavespeedai/waverless-portal/pkg/waverless"
+)
+
+const (
+	// migrationReadyTimeout 目标集群副本就绪超时, 超时后迁移失败并删除目标部署
+	migrationReadyTimeout = 15 * time.Minute
+	// migrationDrainTimeout 源集群排空超时, 超时后不再等待进行中的任务直接删除源部署
+	migrationDrainTimeout = 30 * time.Minute
+	// autoMigrationCooldown 同一 endpoint 两次自动迁移的最小间隔
+	autoMigrationCooldown = 24 * time.Hour
+	// autoMigrationPriceRatio 目标集群价格不高于当前集群的该比例时才自动迁移
+	autoMigrationPriceRatio = 0.9
+)
+
+var (
+	ErrMigrationInProgress     = errors.New("endpoint already has a migration in progress")
+	ErrMigrationNotCancellable = errors.New("migration can only be cancelled before task routing is switched")
+)
+
+// MigrationService endpoint 跨集群迁移: 在目标集群创建部署, 副本就绪后切换任务路由, 源集群排空后删除部署
+type MigrationService struct {
+	repo            *mysql.MigrationRepo
+	endpointRepo    *mysql.EndpointRepo
+	placementRepo   *mysql.PlacementRepo
+	clusterRepo     *mysql.ClusterRepo
+	taskRepo        *mysql.TaskRepo
+	preferencesRepo *mysql.PreferencesRepo
+	rolloutRepo     *mysql.RolloutRepo
+	endpointService *EndpointService
+	clusterService  *ClusterService
+	pricingService  *PricingService
+}
+
+func NewMigrationService(repo *mysql.MigrationRepo, endpointRepo *mysql.EndpointRepo, placementRepo *mysql.PlacementRepo, clusterRepo *mysql.ClusterRepo, taskRepo *mysql.TaskRepo, preferencesRepo *mysql.PreferencesRepo, rolloutRepo *mysql.RolloutRepo, endpointService *EndpointService, clusterService *ClusterService, pricingService *PricingService) *MigrationService {
+	return &MigrationService{repo: repo, endpointRepo: endpointRepo, placementRepo: placementRepo, clusterRepo: clusterRepo, taskRepo: taskRepo, preferencesRepo: preferencesRepo, rolloutRepo: rolloutRepo, endpointService: endpointService, clusterService: clusterService, pricingService: pricingService}
+}
+
+// Start 发起迁移, sourceClusterID 为空时迁移主集群上的部署; 由后台任务推进
+func (s *MigrationService) Start(ctx context.Context, endpoint *model.UserEndpoint, sourceClusterID, targetClusterID, reason, requestedBy string) (*model.EndpointMigration, error) {
+	if endpoint.Status != model.EndpointStatusRunning && endpoint.Status != model.EndpointStatusSuspended {
+		return nil, fmt.Errorf("endpoint in status %s cannot be migrated", endpoint.Status)
+	}
+	if _, err := s.repo.GetInProgress(ctx, endpoint.ID); err == nil {
+		return nil, ErrMigrationInProgress
+	}
+	// 镜像发布的新版本部署在主集群, 发布结束前不迁移
+	if _, err := s.rolloutRepo.GetInProgress(ctx, endpoint.ID); err == nil {
+		return nil, ErrRolloutInProgress
+	}
+	if sourceClusterID == "" {
+		sourceClusterID = endpoint.ClusterID
+	}
+	if targetClusterID == "" || targetClusterID == sourceClusterID {
+		return nil, errors.New("target cluster must differ from the source cluster")
+	}
+
+	placements, err := s.placementRepo.ListByEndpoint(ctx, endpoint.ID)
+	if err != nil {
+		return nil, err
+	}
+	exclude := make(map[string]bool)
+	var source *model.EndpointPlacement
+	for i := range placements {
+		exclude[placements[i].ClusterID] = true
+		if placements[i].ClusterID == sourceClusterID && placements[i].Status == model.PlacementStatusActive {
+			source = &placements[i]
+		}
+	}
+	if source == nil {
+		return nil, fmt.Errorf("endpoint has no active placement on cluster %s", sourceClusterID)
+	}
+	if exclude[targetClusterID] {
+		return nil, fmt.Errorf("endpoint is already placed on cluster %s", targetClusterID)
+	}
+
+	candidates, err := s.endpointService.selectClusters(ctx, endpoint.OrgID, endpoint.SpecName, endpoint.PreferRegion, 0, exclude)
+	if err != nil {
+		return nil, err
+	}
+	var target *ClusterCandidate
+	for i := range candidates {
+		if candidates[i].Cluster.ClusterID == targetClusterID {
+			target = &candidates[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("cluster %s is not available for spec %s", targetClusterID, endpoint.SpecName)
+	}
+
+	m := &model.EndpointMigration{
+		EndpointID: endpoint.ID, OrgID: endpoint.OrgID,
+		SourceClusterID: sourceClusterID, TargetClusterID: targetClusterID, TargetSpecName: target.ClusterSpec.ClusterSpecName,
+		Reason: reason, Status: model.MigrationStatusPending, RequestedBy: requestedBy,
+	}
+	if err := s.repo.Create(ctx, m); err != nil {
+		return nil, err
+	}
+	logger.InfoCtx(ctx, "endpoint %s migration %d from cluster %s to %s requested (%s)", endpoint.LogicalName, m.ID, sourceClusterID, targetClusterID, reason)
+	return m, nil
+}
+
+// List 获取 endpoint 的迁移记录 (最新在前)
+func (s *MigrationService) List(ctx context.Context, endpointID int64, limit int) ([]model.EndpointMigration, error) {
+	return s.repo.ListByEndpoint(ctx, endpointID, limit)
+}
+
+// ListInProgress 获取所有进行中的迁移
+func (s *MigrationService) ListInProgress(ctx context.Context) ([]model.EndpointMigration, error) {
+	return s.repo.ListInProgress(ctx)
+}
+
+// Cancel 取消尚未切换任务路由的迁移, 删除目标集群上的部署
+func (s *MigrationService) Cancel(ctx context.Context, endpoint *model.UserEndpoint, id int64) (*model.EndpointMigration, error) {
+	m, err := s.repo.GetByID(ctx, endpoint.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if m.Status != model.MigrationStatusPending && m.Status != model.MigrationStatusDeploying {
+		return nil, ErrMigrationNotCancellable
+	}
+	if err := s.abort(ctx, m, endpoint, model.MigrationStatusCancelled, ""); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Advance 推进迁移一步, 等待中的步骤直接返回, 由下一轮继续
+func (s *MigrationService) Advance(ctx context.Context, m *model.EndpointMigration) error {
+	endpoint, err := s.endpointRepo.GetByID(ctx, m.EndpointID)
+	if err != nil {
+		return err
+	}
+	// endpoint 删除时已删除所有集群上的部署
+	if endpoint.DeletedAt != nil {
+		return s.finish(ctx, m, model.MigrationStatusCancelled, "endpoint deleted")
+	}
+	placements, err := s.placementRepo.ListByEndpoint(ctx, endpoint.ID)
+	if err != nil {
+		return err
+	}
+	var source, target *model.EndpointPlacement
+	for i := range placements {
+		switch placements[i].ClusterID {
+		case m.SourceClusterID:
+			source = &placements[i]
+		case m.TargetClusterID:
+			target = &placements[i]
+		}
+	}
+
+	switch m.Status {
+	case model.MigrationStatusPending:
+		return s.deploy(ctx, m, endpoint, source)
+	case model.MigrationStatusDeploying:
+		return s.switchRouting(ctx, m, endpoint, source, target)
+	case model.MigrationStatusDraining:
+		return s.drain(ctx, m, endpoint, source)
+	}
+	return nil
+}
+
+// deploy 在目标集群按源 placement 的副本配置创建部署 (暂不路由任务)
+func (s *MigrationService) deploy(ctx context.Context, m *model.EndpointMigration, endpoint *model.UserEndpoint, source *model.EndpointPlacement) error {
+	if source == nil || source.Status != model.PlacementStatusActive {
+		return s.abort(ctx, m, endpoint, model.MigrationStatusFailed, "source placement is no longer active")
+	}
+	cluster, err := s.clusterService.GetCluster(ctx, m.TargetClusterID)
+	if err != nil || cluster.Status != "active" {
+		return s.abort(ctx, m, endpoint, model.MigrationStatusFailed, "target cluster is not available")
+	}
+	cred, err := s.endpointService.registryCredential(ctx, endpoint)
+	if err != nil {
+		return s.abort(ctx, m, endpoint, model.MigrationStatusFailed, err.Error())
+	}
+
+	p := &model.EndpointPlacement{
+		EndpointID: endpoint.ID, ClusterID: m.TargetClusterID, ClusterSpecName: m.TargetSpecName, Rank: source.Rank,
+		Replicas: source.Replicas, MinReplicas: source.MinReplicas, MaxReplicas: source.MaxReplicas,
+		Status: model.PlacementStatusProvisioning,
+	}
+	// 先占用 placement 记录, 防止故障转移同时部署到目标集群
+	if err := s.placementRepo.Create(ctx, p); err != nil {
+		return s.abort(ctx, m, endpoint, model.MigrationStatusFailed, "endpoint is already placed on the target cluster")
+	}
+	if err := s.endpointService.deployPlacement(ctx, endpoint, cluster, p, cred); err != nil {
+		s.placementRepo.Delete(ctx, p.ID)
+		return s.abort(ctx, m, endpoint, model.MigrationStatusFailed, fmt.Sprintf("deploy to target cluster: %v", err))
+	}
+	now := time.Now()
+	if _, err := s.repo.Transition(ctx, m.ID, m.Status, map[string]interface{}{
+		"status": model.MigrationStatusDeploying, "started_at": now,
+	}); err != nil {
+		return err
+	}
+	logger.InfoCtx(ctx, "endpoint %s migration %d deployed on cluster %s", endpoint.LogicalName, m.ID, m.TargetClusterID)
+	return nil
+}
+
+// switchRouting 目标集群副本就绪后接替源 placement 路由任务, 源 placement 进入排空
+func (s *MigrationService) switchRouting(ctx context.Context, m *model.EndpointMigration, endpoint *model.UserEndpoint, source, target *model.EndpointPlacement) error {
+	// 上一轮已切换但未更新迁移状态
+	if target != nil && target.Status == model.PlacementStatusActive && source != nil && source.Status == model.PlacementStatusDraining {
+		return s.markSwitched(ctx, m, endpoint, target)
+	}
+	if target == nil || target.Status != model.PlacementStatusProvisioning {
+		return s.abort(ctx, m, endpoint, model.MigrationStatusFailed, "target placement was lost (cluster unavailable)")
+	}
+	if source == nil || source.Status != model.PlacementStatusActive {
+		return s.abort(ctx, m, endpoint, model.MigrationStatusFailed, "source placement is no longer active")
+	}
+	if m.StartedAt != nil && time.Since(*m.StartedAt) > migrationReadyTimeout {
+		return s.abort(ctx, m, endpoint, model.MigrationStatusFailed, fmt.Sprintf("target replicas not ready within %s", migrationReadyTimeout))
+	}
+
+	// 迁移期间的扩缩容只作用于源 placement, 同步到目标集群
+	share := replicaShare{source.Replicas, source.MinReplicas, source.MaxReplicas}
+	if err := s.endpointService.applyShare(ctx, endpoint, target, source.Rank, share); err != nil {
+		return err
+	}
+	cluster, err := s.clusterService.GetCluster(ctx, m.TargetClusterID)
+	if err != nil {
+		return err
+	}
+	client := s.endpointService.GetWaverlessClient(cluster)
+	detail, err := client.GetEndpoint(ctx, endpoint.PhysicalName)
+	if err != nil {
+		return err
+	}
+	// 迁移期间镜像变更时同步到目标集群, 滚动更新后再切换
+	if image, ok := detail["image"].(string); ok && image != endpoint.Image {
+		return client.UpdateEndpointDeployment(ctx, endpoint.PhysicalName, -1, endpoint.Image, envStrings(endpoint.Env))
+	}
+	if ready, _ := detail["readyReplicas"].(float64); int(ready) < source.Replicas {
+		return nil
+	}
+
+	target.Rank, target.Replicas, target.MinReplicas, target.MaxReplicas = source.Rank, source.Replicas, source.MinReplicas, source.MaxReplicas
+	if err := s.placementRepo.Promote(ctx, target, source); err != nil {
+		return s.abort(ctx, m, endpoint, model.MigrationStatusFailed, err.Error())
+	}
+	return s.markSwitched(ctx, m, endpoint, target)
+}
+
+// markSwitched 源集群为主集群时更新 endpoint 的主集群, 迁移进入排空
+func (s *MigrationService) markSwitched(ctx context.Context, m *model.EndpointMigration, endpoint *model.UserEndpoint, target *model.EndpointPlacement) error {
+	if endpoint.ClusterID == m.SourceClusterID || target.Rank == 0 {
+		if err := s.endpointRepo.Update(ctx, endpoint.ID, map[string]interface{}{"cluster_id": m.TargetClusterID}); err != nil {
+			return err
+		}
+	}
+	if _, err := s.repo.Transition(ctx, m.ID, m.Status, map[string]interface{}{
+		"status": model.MigrationStatusDraining, "switched_at": time.Now(),
+	}); err != nil {
+		return err
+	}
+	logger.InfoCtx(ctx, "endpoint %s migration %d switched routing to cluster %s", endpoint.LogicalName, m.ID, m.TargetClusterID)
+	return nil
+}
+
+// drain 源集群上进行中的任务结束 (或超时) 后删除源部署
+func (s *MigrationService) drain(ctx context.Context, m *model.EndpointMigration, endpoint *model.UserEndpoint, source *model.EndpointPlacement) error {
+	// 源集群下线时 placement 已标记为 orphaned, 由故障转移任务在集群恢复后清理
+	if source == nil || source.Status != model.PlacementStatusDraining {
+		return s.finish(ctx, m, model.MigrationStatusCompleted, "")
+	}
+	inFlight, err := s.taskRepo.CountInFlight(ctx, endpoint.ID, source.ClusterID)
+	if err != nil {
+		return err
+	}
+	if inFlight > 0 && m.SwitchedAt != nil && time.Since(*m.SwitchedAt) < migrationDrainTimeout {
+		return nil
+	}
+	cluster, err := s.clusterService.GetCluster(ctx, source.ClusterID)
+	if err != nil {
+		return err
+	}
+	if err := s.endpointService.GetWaverlessClient(cluster).DeleteEndpoint(ctx, endpoint.PhysicalName); err != nil && !waverless.IsNotFound(err) {
+		return err
+	}
+	if err := s.placementRepo.Remove(ctx, source, time.Now()); err != nil {
+		return err
+	}
+	if inFlight > 0 {
+		logger.WarnCtx(ctx, "endpoint %s migration %d removed cluster %s with %d tasks still in flight", endpoint.LogicalName, m.ID, source.ClusterID, inFlight)
+	}
+	return s.finish(ctx, m, model.MigrationStatusCompleted, "")
+}
+
+// abort 迁移失败或取消: 删除尚未路由任务的目标部署 (集群不可用时标记为 orphaned 待清理)
+func (s *MigrationService) abort(ctx context.Context, m *model.EndpointMigration, endpoint *model.UserEndpoint, status, reason string) error {
+	placements, err := s.placementRepo.ListByEndpoint(ctx, endpoint.ID)
+	if err != nil {
+		return err
+	}
+	for i := range placements {
+		p := &placements[i]
+		if p.ClusterID != m.TargetClusterID || p.Status != model.PlacementStatusProvisioning {
+			continue
+		}
+		cluster, err := s.clusterService.GetCluster(ctx, p.ClusterID)
+		if err == nil && cluster.Status == "active" {
+			err = s.endpointService.GetWaverlessClient(cluster).DeleteEndpoint(ctx, endpoint.PhysicalName)
+		}
+		if err != nil && !waverless.IsNotFound(err) {
+			logger.WarnCtx(ctx, "delete migration target of endpoint %s on cluster %s error: %v", endpoint.LogicalName, p.ClusterID, err)
+			err = s.placementRepo.Orphan(ctx, p, time.Now())
+		} else {
+			err = s.placementRepo.Remove(ctx, p, time.Now())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if status == model.MigrationStatusFailed {
+		logger.WarnCtx(ctx, "endpoint %s migration %d to cluster %s failed: %s", endpoint.LogicalName, m.ID, m.TargetClusterID, reason)
+	}
+	return s.finish(ctx, m, status, reason)
+}
+
+// finish 结束迁移
+func (s *MigrationService) finish(ctx context.Context, m *model.EndpointMigration, status, reason string) error {
+	now := time.Now()
+	ok, err := s.repo.Transition(ctx, m.ID, m.Status, map[string]interface{}{
+		"status": status, "error": reason, "completed_at": now,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("migration %d changed concurrently", m.ID)
+	}
+	m.Status, m.Error, m.CompletedAt = status, reason, &now
+	if status == model.MigrationStatusCompleted {
+		logger.InfoCtx(ctx, "endpoint %d migration %d to cluster %s completed", m.EndpointID, m.ID, m.TargetClusterID)
+	}
+	return nil
+}
+
+// PlanAutoMigrations 为开启自动迁移的用户发起迁移:
+// 所在集群规格不可用时迁移到评分最高的可用集群 (auto_migrate_for_health),
+// 其他集群价格不高于当前集群 90% 时迁移到最便宜的集群 (auto_migrate_for_price, 按任务计费的 endpoint 除外)
+func (s *MigrationService) PlanAutoMigrations(ctx context.Context) (int, error) {
+	endpoints, err := s.endpointRepo.ListAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	prefsByUser := make(map[string]*model.UserPreferences)
+	started := 0
+	for i := range endpoints {
+		endpoint := &endpoints[i]
+		if endpoint.Status != model.EndpointStatusRunning {
+			continue
+		}
+		prefs, ok := prefsByUser[endpoint.UserID]
+		if !ok {
+			if prefs, err = s.preferencesRepo.Get(ctx, endpoint.UserID); err != nil {
+				prefs = nil
+			}
+			prefsByUser[endpoint.UserID] = prefs
+		}
+		if prefs == nil || (!prefs.AutoMigrateForHealth && !prefs.AutoMigrateForPrice) {
+			continue
+		}
+		if _, err := s.repo.GetInProgress(ctx, endpoint.ID); err == nil {
+			continue
+		}
+		if recent, err := s.repo.HasEndedSince(ctx, endpoint.ID, now.Add(-autoMigrationCooldown)); err != nil || recent {
+			continue
+		}
+
+		source, target, reason := s.planMigration(ctx, endpoint, prefs, now)
+		if target == "" {
+			continue
+		}
+		if _, err := s.Start(ctx, endpoint, source, target, reason, "system"); err != nil {
+			logger.WarnCtx(ctx, "auto migrate endpoint %s to cluster %s error: %v", endpoint.LogicalName, target, err)
+			continue
+		}
+		started++
+	}
+	return started, nil
+}
+
+// planMigration 选出需要迁移的 placement 及目标集群, 无需迁移时 target 为空
+func (s *MigrationService) planMigration(ctx context.Context, endpoint *model.UserEndpoint, prefs *model.UserPreferences, now time.Time) (source, target, reason string) {
+	placements, err := s.placementRepo.ListByEndpoint(ctx, endpoint.ID)
+	if err != nil {
+		return "", "", ""
+	}
+	exclude := make(map[string]bool)
+	for _, p := range placements {
+		exclude[p.ClusterID] = true
+	}
+	candidates, err := s.endpointService.selectClusters(ctx, endpoint.OrgID, endpoint.SpecName, endpoint.PreferRegion, 0, exclude)
+	if err != nil || len(candidates) == 0 {
+		return "", "", ""
+	}
+
+	for _, p := range placements {
+		if p.Status != model.PlacementStatusActive {
+			continue
+		}
+		if prefs.AutoMigrateForHealth {
+			spec, err := s.clusterRepo.GetSpecByClusterSpecName(ctx, p.ClusterID, p.ClusterSpecName)
+			if err == nil && !spec.IsAvailable {
+				return p.ClusterID, candidates[0].Cluster.ClusterID, model.MigrationReasonHealth
+			}
+		}
+		if prefs.AutoMigrateForPrice && !endpoint.TaskBilled() {
+			current := s.clusterPrice(ctx, endpoint, p.ClusterID, now)
+			cheapest, cheapestPrice := "", current
+			for _, c := range candidates {
+				if price := s.clusterPrice(ctx, endpoint, c.Cluster.ClusterID, now); price < cheapestPrice {
+					cheapest, cheapestPrice = c.Cluster.ClusterID, price
+				}
+			}
+			if cheapest != "" && float64(cheapestPrice) <= float64(current)*autoMigrationPriceRatio {
+				return p.ClusterID, cheapest, model.MigrationReasonPrice
+			}
+		}
+	}
+	return "", "", ""
+}
+
+// clusterPrice endpoint 在集群上的实际计费价格 (锁定价格叠加集群覆盖价格)
+func (s *MigrationService) clusterPrice(ctx context.Context, endpoint *model.UserEndpoint, clusterID string, at time.Time) int64 {
+	if s.pricingService == nil {
+		return endpoint.PricePerHour
+	}
+	price, _, err := s.pricingService.ResolvePrice(ctx, clusterID, endpoint.SpecName, endpoint.BillingCurrency(), endpoint.PricePerHour, at)
+	if err != nil {
+		logger.WarnCtx(ctx, "resolve price for cluster %s error: %v", clusterID, err)
+	}
+	return price
+}
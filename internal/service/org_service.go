@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotOrgMember     = errors.New("not a member of this organization")
+	ErrOrgRoleForbidden = errors.New("insufficient organization role")
+)
+
+// OrgService 组织成员及角色管理
+type OrgService struct {
+	repo     *mysql.OrgMemberRepo
+	userRepo *mysql.UserRepo
+}
+
+func NewOrgService(repo *mysql.OrgMemberRepo, userRepo *mysql.UserRepo) *OrgService {
+	return &OrgService{repo: repo, userRepo: userRepo}
+}
+
+// Authorize 获取用户在组织中的成员身份; 非成员但在主站为组织 owner/admin (siteRole, 来自登录 JWT) 时按主站角色加入,
+// 其余成员由迁移回填或 owner/admin 添加
+func (s *OrgService) Authorize(ctx context.Context, orgID, userID, email, siteRole string) (*model.OrgMember, error) {
+	if orgID == "" {
+		return nil, ErrNotOrgMember
+	}
+	member, err := s.repo.Get(ctx, orgID, userID)
+	if err == nil {
+		return member, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if siteRole != model.OrgRoleOwner && siteRole != model.OrgRoleAdmin {
+		return nil, ErrNotOrgMember
+	}
+	member = &model.OrgMember{OrgID: orgID, UserID: userID, Email: email, Role: siteRole}
+	if err := s.repo.Create(ctx, member); err != nil {
+		// 并发创建时以已有记录为准
+		if existing, getErr := s.repo.Get(ctx, orgID, userID); getErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	logger.InfoCtx(ctx, "[Org] user %s joined org %s as %s from main site role", userID, orgID, siteRole)
+	return member, nil
+}
+
+func (s *OrgService) ListMembers(ctx context.Context, orgID string) ([]model.OrgMember, error) {
+	return s.repo.List(ctx, orgID)
+}
+
+// AddMember 按邮箱添加成员 (用户需已登录过 Portal)
+func (s *OrgService) AddMember(ctx context.Context, actor *model.OrgMember, email, role string) (*model.OrgMember, error) {
+	if err := validateOrgRole(role); err != nil {
+		return nil, err
+	}
+	if err := checkManage(actor, "", role); err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("user %s not found", email)
+	}
+	if _, err := s.repo.Get(ctx, actor.OrgID, user.UserID); err == nil {
+		return nil, errors.New("user is already a member")
+	}
+
+	member := &model.OrgMember{OrgID: actor.OrgID, UserID: user.UserID, Email: user.Email, Role: role, InvitedBy: actor.UserID}
+	if err := s.repo.Create(ctx, member); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// UpdateRole 修改成员角色, 组织至少保留一个 owner
+func (s *OrgService) UpdateRole(ctx context.Context, actor *model.OrgMember, userID, role string) error {
+	if err := validateOrgRole(role); err != nil {
+		return err
+	}
+	target, err := s.repo.Get(ctx, actor.OrgID, userID)
+	if err != nil {
+		return ErrNotOrgMember
+	}
+	if err := checkManage(actor, target.Role, role); err != nil {
+		return err
+	}
+	if target.Role == model.OrgRoleOwner && role != model.OrgRoleOwner {
+		if err := s.checkLastOwner(ctx, actor.OrgID); err != nil {
+			return err
+		}
+	}
+	return s.repo.UpdateRole(ctx, actor.OrgID, userID, role)
+}
+
+// RemoveMember 移除成员, 组织至少保留一个 owner
+func (s *OrgService) RemoveMember(ctx context.Context, actor *model.OrgMember, userID string) error {
+	target, err := s.repo.Get(ctx, actor.OrgID, userID)
+	if err != nil {
+		return ErrNotOrgMember
+	}
+	if err := checkManage(actor, target.Role, ""); err != nil {
+		return err
+	}
+	if target.Role == model.OrgRoleOwner {
+		if err := s.checkLastOwner(ctx, actor.OrgID); err != nil {
+			return err
+		}
+	}
+	return s.repo.Delete(ctx, actor.OrgID, userID)
+}
+
+func (s *OrgService) checkLastOwner(ctx context.Context, orgID string) error {
+	owners, err := s.repo.Count(ctx, orgID, model.OrgRoleOwner)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return errors.New("organization must keep at least one owner")
+	}
+	return nil
+}
+
+// checkManage admin 只能管理 viewer/developer, owner 可管理所有角色
+func checkManage(actor *model.OrgMember, currentRole, newRole string) error {
+	if !actor.HasRole(model.OrgRoleAdmin) {
+		return ErrOrgRoleForbidden
+	}
+	if actor.Role == model.OrgRoleOwner {
+		return nil
+	}
+	for _, role := range []string{currentRole, newRole} {
+		if model.OrgRoleLevel(role) >= model.OrgRoleLevel(model.OrgRoleAdmin) {
+			return ErrOrgRoleForbidden
+		}
+	}
+	return nil
+}
+
+func validateOrgRole(role string) error {
+	if model.OrgRoleLevel(role) == 0 {
+		return fmt.Errorf("role must be one of %s, %s, %s, %s", model.OrgRoleOwner, model.OrgRoleAdmin, model.OrgRoleDeveloper, model.OrgRoleViewer)
+	}
+	return nil
+}
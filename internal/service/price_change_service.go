@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/config"
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+)
+
+// PriceChangeService 规格计划调价: 提前通知, 到生效时间后把已有 endpoint 迁移到新价格并记录价格历史
+type PriceChangeService struct {
+	repo       *mysql.PriceChangeRepo
+	specRepo   *mysql.SpecRepo
+	currencies *CurrencyService
+}
+
+func NewPriceChangeService(repo *mysql.PriceChangeRepo, specRepo *mysql.SpecRepo, currencies *CurrencyService) *PriceChangeService {
+	return &PriceChangeService{repo: repo, specRepo: specRepo, currencies: currencies}
+}
+
+// Schedule 创建计划调价, 生效时间必须不早于通知期结束 (NoticeDays 为 0 时使用配置的最短通知天数)
+func (s *PriceChangeService) Schedule(ctx context.Context, change *model.SpecPriceChange) error {
+	spec, err := s.specRepo.GetByName(ctx, change.SpecName)
+	if err != nil {
+		return fmt.Errorf("spec %s not found", change.SpecName)
+	}
+	if change.Currency == "" {
+		change.Currency = spec.Currency
+	}
+	if change.Currency, err = NormalizeCurrency(change.Currency); err != nil {
+		return err
+	}
+	if change.Currency != spec.Currency {
+		// 非基础币种调价只修改已有标价, 首次标价使用规格多币种标价接口
+		listed, err := s.currencies.HasListedPrice(ctx, change.SpecName, change.Currency)
+		if err != nil {
+			return err
+		}
+		if !listed {
+			return fmt.Errorf("spec %s has no %s price, set it via spec prices first", change.SpecName, change.Currency)
+		}
+	}
+	if change.PricePerHour <= 0 {
+		return errors.New("price_per_hour must be positive")
+	}
+	if change.SpotPricePerHour != nil && *change.SpotPricePerHour < 0 {
+		return errors.New("spot_price_per_hour must not be negative")
+	}
+
+	minNotice := priceChangeNoticeDays()
+	if change.NoticeDays == 0 {
+		change.NoticeDays = minNotice
+	}
+	if change.NoticeDays < minNotice {
+		return fmt.Errorf("notice_days must be at least %d", minNotice)
+	}
+	if earliest := time.Now().AddDate(0, 0, change.NoticeDays); change.EffectiveAt.Before(earliest) {
+		return fmt.Errorf("effective_at must be after %s (%d days notice)", earliest.UTC().Format(time.RFC3339), change.NoticeDays)
+	}
+
+	change.ID = 0
+	change.Status = model.PriceChangeStatusScheduled
+	change.AppliedAt = nil
+	change.AffectedEndpoints = 0
+	return s.repo.Create(ctx, change)
+}
+
+func (s *PriceChangeService) Get(ctx context.Context, id int64) (*model.SpecPriceChange, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *PriceChangeService) List(ctx context.Context, specName, status string) ([]model.SpecPriceChange, error) {
+	return s.repo.List(ctx, specName, status)
+}
+
+// ListScheduledForOrg 影响组织 endpoint 的待生效调价 (调价通知)
+func (s *PriceChangeService) ListScheduledForOrg(ctx context.Context, orgID string) ([]model.SpecPriceChange, error) {
+	return s.repo.ListScheduledForOrg(ctx, orgID)
+}
+
+// Cancel 取消尚未生效的调价
+func (s *PriceChangeService) Cancel(ctx context.Context, id int64) error {
+	ok, err := s.repo.Cancel(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("price change is not scheduled")
+	}
+	return nil
+}
+
+func (s *PriceChangeService) ListHistory(ctx context.Context, orgID, endpointName string, limit, offset int) ([]mysql.EndpointPriceHistoryWithName, int64, error) {
+	return s.repo.ListHistoryByOrg(ctx, orgID, endpointName, limit, offset)
+}
+
+// ApplyDue 应用已到生效时间的调价
+func (s *PriceChangeService) ApplyDue(ctx context.Context) {
+	now := time.Now()
+	changes, err := s.repo.ListDue(ctx, now)
+	if err != nil {
+		logger.ErrorCtx(ctx, "[PriceChange] list due changes error: %v", err)
+		return
+	}
+	for _, change := range changes {
+		n, err := s.repo.Apply(ctx, change.ID, now, s.reprice(ctx))
+		if err != nil {
+			logger.ErrorCtx(ctx, "[PriceChange] apply change %d of spec %s error: %v", change.ID, change.SpecName, err)
+			continue
+		}
+		logger.InfoCtx(ctx, "[PriceChange] applied change %d of spec %s effective %v, %d endpoints repriced",
+			change.ID, change.SpecName, change.EffectiveAt, n)
+	}
+}
+
+// reprice endpoint 币种与调价币种相同时直接使用新价格; 基础币种调价时, 未单独标价币种的 endpoint
+// 按生效时间的汇率换算; 其余 endpoint 由各自币种的标价决定, 不受此次调价影响
+func (s *PriceChangeService) reprice(ctx context.Context) mysql.RepriceFunc {
+	return func(change *model.SpecPriceChange, baseCurrency string, endpoint *model.UserEndpoint, price int64) (int64, bool, error) {
+		currency := endpoint.BillingCurrency()
+		if currency == change.Currency {
+			return price, true, nil
+		}
+		if change.Currency != baseCurrency || s.currencies == nil {
+			return 0, false, nil
+		}
+		listed, err := s.currencies.HasListedPrice(ctx, change.SpecName, currency)
+		if err != nil || listed {
+			return 0, false, err
+		}
+		converted, err := s.currencies.Convert(ctx, price, change.Currency, currency, change.EffectiveAt)
+		return converted, err == nil, err
+	}
+}
+
+// BasePriceSegments 按 endpoint 锁定价格的变更历史拆分计费时段 [start, end)
+func (s *PriceChangeService) BasePriceSegments(ctx context.Context, endpoint *model.UserEndpoint, start, end time.Time) ([]PriceSegment, error) {
+	history, err := s.repo.ListHistoryAfter(ctx, endpoint.ID, start)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return []PriceSegment{{Start: start, End: end, PricePerHour: endpoint.PricePerHour}}, nil
+	}
+
+	// start 时的价格为其后第一次变更前的价格
+	price := history[0].OldPricePerHour
+	var segments []PriceSegment
+	cur := start
+	for _, h := range history {
+		b := h.EffectiveFrom.Truncate(time.Second)
+		if !b.Before(end) {
+			break
+		}
+		if b.After(cur) {
+			segments = append(segments, PriceSegment{Start: cur, End: b, PricePerHour: price})
+			cur = b
+		}
+		price = h.NewPricePerHour
+	}
+	return append(segments, PriceSegment{Start: cur, End: end, PricePerHour: price}), nil
+}
+
+// priceChangeNoticeDays 调价最短通知天数
+func priceChangeNoticeDays() int {
+	if config.GlobalConfig == nil || config.GlobalConfig.Billing.PriceChange.NoticeDays <= 0 {
+		return 30
+	}
+	return config.GlobalConfig.Billing.PriceChange.NoticeDays
+}
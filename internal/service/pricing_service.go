@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+)
+
+// PricingService 解析集群覆盖价格 (cluster_pricing_overrides), 覆盖价格按生效时汇率换算为 endpoint 币种
+type PricingService struct {
+	repo        *mysql.PricingRepo
+	clusterRepo *mysql.ClusterRepo
+	specRepo    *mysql.SpecRepo
+	currencies  *CurrencyService
+}
+
+func NewPricingService(repo *mysql.PricingRepo, clusterRepo *mysql.ClusterRepo, specRepo *mysql.SpecRepo, currencies *CurrencyService) *PricingService {
+	return &PricingService{repo: repo, clusterRepo: clusterRepo, specRepo: specRepo, currencies: currencies}
+}
+
+// PriceSegment 计费时段内价格一致的一段 [Start, End)
+type PriceSegment struct {
+	Start        time.Time
+	End          time.Time
+	PricePerHour int64
+	OverrideID   *int64 // 为空表示使用基础价格
+}
+
+// Seconds 时段秒数
+func (p PriceSegment) Seconds() int64 {
+	return int64(p.End.Sub(p.Start).Seconds())
+}
+
+// ResolvePrice 获取 at 时刻集群规格在 currency 下的实际价格, 无生效覆盖时返回 basePrice (已是该币种)
+func (s *PricingService) ResolvePrice(ctx context.Context, clusterID, specName, currency string, basePrice int64, at time.Time) (int64, *int64, error) {
+	overrides, err := s.repo.ListOverridesInWindow(ctx, clusterID, specName, at, at.Add(time.Second))
+	if err != nil {
+		return basePrice, nil, err
+	}
+	if o := pickOverride(overrides, at); o != nil {
+		price, err := s.overridePrice(ctx, o, currency, at)
+		if err != nil {
+			return basePrice, nil, err
+		}
+		id := o.ID
+		return price, &id, nil
+	}
+	return basePrice, nil, nil
+}
+
+// overridePrice 覆盖价格换算为 currency (按 at 时刻汇率)
+func (s *PricingService) overridePrice(ctx context.Context, o *model.ClusterPricingOverride, currency string, at time.Time) (int64, error) {
+	if s.currencies == nil || o.Currency == currency || currency == "" {
+		return o.PricePerHour, nil
+	}
+	return s.currencies.Convert(ctx, o.PricePerHour, o.Currency, currency, at)
+}
+
+// SplitPeriod 按覆盖价格的生效边界拆分计费时段 [start, end), 价格均为 currency
+func (s *PricingService) SplitPeriod(ctx context.Context, clusterID, specName, currency string, basePrice int64, start, end time.Time) ([]PriceSegment, error) {
+	overrides, err := s.repo.ListOverridesInWindow(ctx, clusterID, specName, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(overrides) == 0 {
+		return []PriceSegment{{Start: start, End: end, PricePerHour: basePrice}}, nil
+	}
+
+	// 收集时段内的所有边界 (精确到秒)
+	points := []time.Time{start, end}
+	for _, o := range overrides {
+		for _, t := range []*time.Time{o.EffectiveFrom, o.EffectiveUntil} {
+			if t == nil {
+				continue
+			}
+			b := t.Truncate(time.Second)
+			if b.After(start) && b.Before(end) {
+				points = append(points, b)
+			}
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Before(points[j]) })
+
+	var segments []PriceSegment
+	for i := 0; i+1 < len(points); i++ {
+		a, b := points[i], points[i+1]
+		if !b.After(a) {
+			continue
+		}
+		seg := PriceSegment{Start: a, End: b, PricePerHour: basePrice}
+		if o := pickOverride(overrides, a); o != nil {
+			price, err := s.overridePrice(ctx, o, currency, a)
+			if err != nil {
+				return nil, err
+			}
+			id := o.ID
+			seg.PricePerHour = price
+			seg.OverrideID = &id
+		}
+		// 与上一段价格相同则合并
+		if n := len(segments); n > 0 && segments[n-1].PricePerHour == seg.PricePerHour && sameOverride(segments[n-1].OverrideID, seg.OverrideID) {
+			segments[n-1].End = b
+			continue
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// pickOverride 选出 t 时刻生效的覆盖价格, 多条重叠时以最晚开始的为准
+func pickOverride(overrides []model.ClusterPricingOverride, t time.Time) *model.ClusterPricingOverride {
+	var best *model.ClusterPricingOverride
+	for i := range overrides {
+		o := &overrides[i]
+		if !o.ActiveAt(t) {
+			continue
+		}
+		if best == nil || startsAfter(o, best) {
+			best = o
+		}
+	}
+	return best
+}
+
+func startsAfter(a, b *model.ClusterPricingOverride) bool {
+	switch {
+	case a.EffectiveFrom == nil && b.EffectiveFrom == nil:
+		return a.ID > b.ID
+	case a.EffectiveFrom == nil:
+		return false
+	case b.EffectiveFrom == nil:
+		return true
+	case a.EffectiveFrom.Equal(*b.EffectiveFrom):
+		return a.ID > b.ID
+	}
+	return a.EffectiveFrom.After(*b.EffectiveFrom)
+}
+
+func sameOverride(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// ListOverrides 列出覆盖价格
+func (s *PricingService) ListOverrides(ctx context.Context, clusterID, specName string) ([]model.ClusterPricingOverride, error) {
+	return s.repo.ListOverrides(ctx, clusterID, specName)
+}
+
+func (s *PricingService) GetOverride(ctx context.Context, id int64) (*model.ClusterPricingOverride, error) {
+	return s.repo.GetOverride(ctx, id)
+}
+
+// CreateOverride 创建覆盖价格
+func (s *PricingService) CreateOverride(ctx context.Context, override *model.ClusterPricingOverride) error {
+	if err := s.validateOverride(ctx, override); err != nil {
+		return err
+	}
+	return s.repo.CreateOverride(ctx, override)
+}
+
+// UpdateOverride 更新覆盖价格
+func (s *PricingService) UpdateOverride(ctx context.Context, override *model.ClusterPricingOverride) error {
+	if err := s.validateOverride(ctx, override); err != nil {
+		return err
+	}
+	return s.repo.UpdateOverride(ctx, override.ID, map[string]interface{}{
+		"cluster_id":      override.ClusterID,
+		"spec_name":       override.SpecName,
+		"price_per_hour":  override.PricePerHour,
+		"currency":        override.Currency,
+		"effective_from":  override.EffectiveFrom,
+		"effective_until": override.EffectiveUntil,
+		"reason":          override.Reason,
+	})
+}
+
+func (s *PricingService) DeleteOverride(ctx context.Context, id int64) error {
+	return s.repo.DeleteOverride(ctx, id)
+}
+
+func (s *PricingService) validateOverride(ctx context.Context, o *model.ClusterPricingOverride) error {
+	if o.PricePerHour < 0 {
+		return errors.New("price_per_hour must not be negative")
+	}
+	currency, err := NormalizeCurrency(o.Currency)
+	if err != nil {
+		return err
+	}
+	o.Currency = currency
+	if o.EffectiveFrom != nil && o.EffectiveUntil != nil && !o.EffectiveUntil.After(*o.EffectiveFrom) {
+		return errors.New("effective_until must be after effective_from")
+	}
+	if _, err := s.clusterRepo.GetByID(ctx, o.ClusterID); err != nil {
+		return errors.New("cluster not found")
+	}
+	if _, err := s.specRepo.GetByName(ctx, o.SpecName); err != nil {
+		return errors.New("spec not found")
+	}
+	return nil
+}
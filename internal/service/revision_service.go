@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+// ErrRollbackEnvRemoval 回滚目标缺少当前已部署的环境变量 (waverless 只支持覆盖, 无法删除)
+var ErrRollbackEnvRemoval = errors.New("target revision does not set environment variables that are currently deployed, which cannot be removed")
+
+// scalingConfigColumns 单独保存在 revision 列中的扩缩容配置 key
+var scalingConfigColumns = []string{"minReplicas", "maxReplicas", "taskTimeout"}
+
+// RevisionService endpoint 配置历史: 每次修改部署或扩缩容配置生成不可变 revision, 支持对比及回滚
+type RevisionService struct {
+	repo            *mysql.RevisionRepo
+	endpointRepo    *mysql.EndpointRepo
+	rolloutRepo     *mysql.RolloutRepo
+	endpointService *EndpointService
+}
+
+func NewRevisionService(repo *mysql.RevisionRepo, endpointRepo *mysql.EndpointRepo, rolloutRepo *mysql.RolloutRepo, endpointService *EndpointService) *RevisionService {
+	return &RevisionService{repo: repo, endpointRepo: endpointRepo, rolloutRepo: rolloutRepo, endpointService: endpointService}
+}
+
+// Record 按 endpoint 当前配置生成 revision. config 为本次下发的 autoscaler 配置, 与上一 revision 的配置合并;
+// 除回滚外, 与上一 revision 完全相同时不生成, 返回 nil
+func (s *RevisionService) Record(ctx context.Context, orgID, logicalName, source, author string, config map[string]interface{}, rollbackOf *int) (*model.EndpointRevision, error) {
+	rev, err := s.record(ctx, orgID, logicalName, source, author, config, rollbackOf)
+	if err != nil {
+		// 配置已下发, 记录失败不影响本次修改
+		logger.ErrorCtx(ctx, "failed to record %s revision for endpoint %s: %v", source, logicalName, err)
+	}
+	return rev, err
+}
+
+func (s *RevisionService) record(ctx context.Context, orgID, logicalName, source, author string, config map[string]interface{}, rollbackOf *int) (*model.EndpointRevision, error) {
+	endpoint, err := s.endpointRepo.GetByLogicalName(ctx, orgID, logicalName)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := s.repo.Latest(ctx, endpoint.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		latest = nil
+	}
+
+	merged := model.JSONMap{}
+	if latest != nil {
+		for k, v := range latest.Config {
+			merged[k] = v
+		}
+	}
+	for k, v := range config {
+		merged[k] = v
+	}
+	for _, k := range scalingConfigColumns {
+		delete(merged, k)
+	}
+
+	rev := &model.EndpointRevision{
+		EndpointID: endpoint.ID, OrgID: endpoint.OrgID,
+		Image: endpoint.Image, Env: endpoint.Env, Replicas: endpoint.Replicas,
+		MinReplicas: endpoint.MinReplicas, MaxReplicas: endpoint.MaxReplicas, TaskTimeout: endpoint.TaskTimeout,
+		Source: source, RollbackOf: rollbackOf, Author: author,
+	}
+	if len(merged) > 0 {
+		rev.Config = merged
+	}
+	if latest != nil && rollbackOf == nil && len(diffRevisions(latest, rev)) == 0 {
+		return nil, nil
+	}
+	if err := s.repo.Create(ctx, rev); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+func (s *RevisionService) List(ctx context.Context, endpointID int64, limit int) ([]model.EndpointRevision, error) {
+	return s.repo.ListByEndpoint(ctx, endpointID, limit)
+}
+
+// Latest 获取 endpoint 最新的 revision
+func (s *RevisionService) Latest(ctx context.Context, endpointID int64) (*model.EndpointRevision, error) {
+	return s.repo.Latest(ctx, endpointID)
+}
+
+func (s *RevisionService) Get(ctx context.Context, endpointID int64, revision int) (*model.EndpointRevision, error) {
+	return s.repo.GetByRevision(ctx, endpointID, revision)
+}
+
+// RevisionChange revision 之间一个字段的差异, env/config 按 key 展开 (如 env.MODEL_PATH)
+type RevisionChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// Diff 对比两个 revision, 返回从 from 到 to 的变更
+func (s *RevisionService) Diff(ctx context.Context, endpointID int64, from, to int) ([]RevisionChange, error) {
+	fromRev, err := s.repo.GetByRevision(ctx, endpointID, from)
+	if err != nil {
+		return nil, err
+	}
+	toRev, err := s.repo.GetByRevision(ctx, endpointID, to)
+	if err != nil {
+		return nil, err
+	}
+	return diffRevisions(fromRev, toRev), nil
+}
+
+func diffRevisions(from, to *model.EndpointRevision) []RevisionChange {
+	changes := []RevisionChange{}
+	add := func(field string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, RevisionChange{Field: field, From: a, To: b})
+		}
+	}
+	add("image", from.Image, to.Image)
+	add("replicas", from.Replicas, to.Replicas)
+	add("min_replicas", from.MinReplicas, to.MinReplicas)
+	add("max_replicas", from.MaxReplicas, to.MaxReplicas)
+	add("task_timeout", from.TaskTimeout, to.TaskTimeout)
+	diffMap := func(prefix string, a, b model.JSONMap) {
+		keys := map[string]bool{}
+		for k := range a {
+			keys[k] = true
+		}
+		for k := range b {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			add(prefix+"."+k, a[k], b[k])
+		}
+	}
+	diffMap("env", from.Env, to.Env)
+	diffMap("config", from.Config, to.Config)
+	return changes
+}
+
+// Rollback 将 revision 中保存的部署及扩缩容配置重新下发到 waverless, 并生成新的 rollback revision.
+// waverless 只支持覆盖环境变量, 目标 revision 缺少当前已部署的环境变量时拒绝回滚 (ErrRollbackEnvRemoval), 保证回滚后部署与 revision 一致
+func (s *RevisionService) Rollback(ctx context.Context, endpoint *model.UserEndpoint, revision int, author string) (*model.EndpointRevision, error) {
+	rev, err := s.repo.GetByRevision(ctx, endpoint.ID, revision)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.rolloutRepo.GetInProgress(ctx, endpoint.ID); err == nil {
+		return nil, ErrRolloutInProgress
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var missing []string
+	for k := range s.endpointService.DeployedEnv(ctx, endpoint) {
+		if _, ok := rev.Env[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("%w: %s", ErrRollbackEnvRemoval, strings.Join(missing, ", "))
+	}
+
+	if err := s.endpointService.UpdateDeployment(ctx, endpoint.OrgID, endpoint.LogicalName, rev.Replicas, rev.Image, envStrings(rev.Env)); err != nil {
+		return nil, fmt.Errorf("failed to restore deployment: %w", err)
+	}
+	config := make(map[string]interface{}, len(rev.Config)+len(scalingConfigColumns))
+	for k, v := range rev.Config {
+		config[k] = v
+	}
+	config["minReplicas"] = rev.MinReplicas
+	config["maxReplicas"] = rev.MaxReplicas
+	config["taskTimeout"] = rev.TaskTimeout
+	if err := s.endpointService.UpdateConfig(ctx, endpoint.OrgID, endpoint.LogicalName, config); err != nil {
+		return nil, fmt.Errorf("failed to restore config: %w", err)
+	}
+
+	return s.Record(ctx, endpoint.OrgID, endpoint.LogicalName, model.RevisionSourceRollback, author, config, &rev.Revision)
+}
@@ -0,0 +1,501 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"github.com/wavespeedai/waverless-portal/pkg/waverless"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCanaryTrafficPercent       = 10
+	defaultRolloutAnalysisMinutes     = 10
+	defaultRolloutMinTasks            = 20
+	defaultRolloutMaxFailureRateDelta = 0.05
+	// rolloutReadyTimeout 新版本部署就绪超时
+	rolloutReadyTimeout = 15 * time.Minute
+	// rolloutPromoteTimeout 全量时原 endpoint 滚动更新超时, 超时后恢复原镜像
+	rolloutPromoteTimeout = 15 * time.Minute
+)
+
+var (
+	ErrRolloutInProgress = errors.New("endpoint already has a rollout in progress")
+	ErrRolloutState      = errors.New("operation not allowed in the current rollout status")
+)
+
+// RolloutService endpoint 镜像发布: 新镜像部署为同级 physical endpoint, 按比例分流任务,
+// 对比新旧版本的失败率后自动全量 (原 endpoint 滚动更新为新镜像) 或回滚 (删除新版本部署)
+type RolloutService struct {
+	repo            *mysql.RolloutRepo
+	endpointRepo    *mysql.EndpointRepo
+	taskRepo        *mysql.TaskRepo
+	migrationRepo   *mysql.MigrationRepo
+	endpointService *EndpointService
+	clusterService  *ClusterService
+	revisionService *RevisionService
+}
+
+func NewRolloutService(repo *mysql.RolloutRepo, endpointRepo *mysql.EndpointRepo, taskRepo *mysql.TaskRepo, migrationRepo *mysql.MigrationRepo, endpointService *EndpointService, clusterService *ClusterService, revisionService *RevisionService) *RolloutService {
+	return &RolloutService{repo: repo, endpointRepo: endpointRepo, taskRepo: taskRepo, migrationRepo: migrationRepo, endpointService: endpointService, clusterService: clusterService, revisionService: revisionService}
+}
+
+type CreateRolloutRequest struct {
+	Image               string            `json:"image"`
+	Env                 map[string]string `json:"env"`                    // 为空时沿用 endpoint 的环境变量
+	Strategy            string            `json:"strategy"`               // canary (默认), blue_green
+	TrafficPercent      int               `json:"traffic_percent"`        // canary 分流比例 (1-99), 默认 10; blue_green 固定 100
+	Replicas            int               `json:"replicas"`               // 新版本副本数, 默认按分流比例计算
+	AnalysisMinutes     int               `json:"analysis_minutes"`       // 观察时长, 默认 10 分钟
+	MinTasks            int               `json:"min_tasks"`              // 判定所需的新/原版本最少完成任务数, 默认 20
+	MaxFailureRateDelta *float64          `json:"max_failure_rate_delta"` // 新版本失败率最多比原版本高出的比例, 默认 0.05
+	AutoPromote         *bool             `json:"auto_promote"`           // 观察通过后自动全量, 默认 true
+}
+
+// Start 发起镜像发布: 在主集群部署新版本, 就绪后由后台任务开始分流
+func (s *RolloutService) Start(ctx context.Context, endpoint *model.UserEndpoint, req *CreateRolloutRequest, requestedBy string) (*model.EndpointRollout, error) {
+	if req.Image == "" {
+		return nil, errors.New("image is required")
+	}
+	if endpoint.Status != model.EndpointStatusRunning {
+		return nil, fmt.Errorf("endpoint in status %s cannot be rolled out", endpoint.Status)
+	}
+	if req.Image == endpoint.Image && len(req.Env) == 0 {
+		return nil, errors.New("image is already deployed")
+	}
+	if req.Strategy == "" {
+		req.Strategy = model.RolloutStrategyCanary
+	}
+	switch req.Strategy {
+	case model.RolloutStrategyCanary:
+		if req.TrafficPercent == 0 {
+			req.TrafficPercent = defaultCanaryTrafficPercent
+		}
+		if req.TrafficPercent < 1 || req.TrafficPercent > 99 {
+			return nil, errors.New("traffic_percent must be between 1 and 99")
+		}
+	case model.RolloutStrategyBlueGreen:
+		req.TrafficPercent = 100
+	default:
+		return nil, fmt.Errorf("strategy must be %s or %s", model.RolloutStrategyCanary, model.RolloutStrategyBlueGreen)
+	}
+	if req.AnalysisMinutes == 0 {
+		req.AnalysisMinutes = defaultRolloutAnalysisMinutes
+	}
+	if req.MinTasks == 0 {
+		req.MinTasks = defaultRolloutMinTasks
+	}
+	delta := defaultRolloutMaxFailureRateDelta
+	if req.MaxFailureRateDelta != nil {
+		delta = *req.MaxFailureRateDelta
+	}
+	if req.AnalysisMinutes < 1 || req.MinTasks < 1 || delta < 0 || delta > 1 {
+		return nil, errors.New("analysis_minutes and min_tasks must be positive, max_failure_rate_delta between 0 and 1")
+	}
+	if req.Replicas < 0 || req.Replicas > endpoint.MaxReplicas {
+		return nil, fmt.Errorf("replicas must be between 0 and %d", endpoint.MaxReplicas)
+	}
+
+	if _, err := s.repo.GetInProgress(ctx, endpoint.ID); err == nil {
+		return nil, ErrRolloutInProgress
+	}
+	if _, err := s.migrationRepo.GetInProgress(ctx, endpoint.ID); err == nil {
+		return nil, ErrMigrationInProgress
+	}
+
+	// 新版本部署在主集群, 与主集群 placement 使用相同的集群规格
+	targets, err := s.endpointService.healthyPlacements(ctx, endpoint.ID)
+	if err != nil {
+		return nil, err
+	}
+	var primary *placementTarget
+	for i := range targets {
+		if targets[i].placement.ClusterID == endpoint.ClusterID {
+			primary = &targets[i]
+			break
+		}
+	}
+	if primary == nil {
+		return nil, fmt.Errorf("primary cluster %s is not available", endpoint.ClusterID)
+	}
+
+	replicas := req.Replicas
+	if replicas == 0 {
+		replicas = rolloutReplicas(targetReplicas(endpoint), req.TrafficPercent)
+	}
+	autoPromote := req.AutoPromote == nil || *req.AutoPromote
+	r := &model.EndpointRollout{
+		EndpointID: endpoint.ID, OrgID: endpoint.OrgID, Strategy: req.Strategy, ClusterID: primary.cluster.ClusterID,
+		Image: req.Image, Replicas: replicas, PreviousImage: endpoint.Image, PreviousEnv: endpoint.Env,
+		TrafficPercent: req.TrafficPercent, AnalysisMinutes: req.AnalysisMinutes, MinTasks: req.MinTasks,
+		MaxFailureRateDelta: delta, AutoPromote: autoPromote,
+		Status: model.RolloutStatusDeploying, RequestedBy: requestedBy,
+	}
+	if len(req.Env) > 0 {
+		r.Env = envJSON(req.Env)
+	}
+	if err := s.repo.Create(ctx, r); err != nil {
+		return nil, err
+	}
+	r.CanaryPhysicalName = fmt.Sprintf("%s-rollout-%d", endpoint.PhysicalName, r.ID)
+	if err := s.repo.Update(ctx, r.ID, map[string]interface{}{"canary_physical_name": r.CanaryPhysicalName}); err != nil {
+		return nil, err
+	}
+
+	cred, err := s.endpointService.registryCredential(ctx, endpoint)
+	if err == nil {
+		err = s.endpointService.deployPlacement(ctx, s.canaryEndpoint(endpoint, r), primary.cluster, s.canaryPlacement(endpoint, r, primary.placement), cred)
+	}
+	if err != nil {
+		s.finish(ctx, r, model.RolloutStatusFailed, fmt.Sprintf("deploy new version: %v", err))
+		return nil, fmt.Errorf("failed to deploy new version: %w", err)
+	}
+	logger.InfoCtx(ctx, "endpoint %s rollout %d (%s) of image %s started", endpoint.LogicalName, r.ID, r.Strategy, r.Image)
+	return r, nil
+}
+
+// rolloutInProgress 发布是否进行中
+func rolloutInProgress(r *model.EndpointRollout) bool {
+	for _, status := range model.RolloutInProgressStatuses {
+		if r.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloutReplicas 按分流比例计算新版本副本数 (至少 1 个)
+func rolloutReplicas(total, percent int) int {
+	n := (total*percent + 99) / 100
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// canaryEndpoint 新版本部署使用的 endpoint 配置
+func (s *RolloutService) canaryEndpoint(endpoint *model.UserEndpoint, r *model.EndpointRollout) *model.UserEndpoint {
+	canary := *endpoint
+	canary.PhysicalName = r.CanaryPhysicalName
+	canary.Image = r.Image
+	if len(r.Env) > 0 {
+		canary.Env = r.Env
+	}
+	return &canary
+}
+
+// canaryPlacement 新版本部署的副本配置: canary 固定副本数, blue_green 可扩容到 endpoint 的最大副本数
+func (s *RolloutService) canaryPlacement(endpoint *model.UserEndpoint, r *model.EndpointRollout, primary *model.EndpointPlacement) *model.EndpointPlacement {
+	maxReplicas := r.Replicas
+	if r.Strategy == model.RolloutStrategyBlueGreen && endpoint.MaxReplicas > maxReplicas {
+		maxReplicas = endpoint.MaxReplicas
+	}
+	return &model.EndpointPlacement{
+		EndpointID: endpoint.ID, ClusterID: r.ClusterID, ClusterSpecName: primary.ClusterSpecName,
+		Replicas: r.Replicas, MinReplicas: r.Replicas, MaxReplicas: maxReplicas,
+	}
+}
+
+func (s *RolloutService) Get(ctx context.Context, endpointID, id int64) (*model.EndpointRollout, error) {
+	return s.repo.GetByID(ctx, endpointID, id)
+}
+
+// List 获取 endpoint 的发布记录 (最新在前)
+func (s *RolloutService) List(ctx context.Context, endpointID int64, limit int) ([]model.EndpointRollout, error) {
+	return s.repo.ListByEndpoint(ctx, endpointID, limit)
+}
+
+// ListInProgress 获取所有进行中的发布
+func (s *RolloutService) ListInProgress(ctx context.Context) ([]model.EndpointRollout, error) {
+	return s.repo.ListInProgress(ctx)
+}
+
+// EnsureNoRollout endpoint 有进行中的发布时返回 ErrRolloutInProgress;
+// 用户修改镜像/环境变量前调用, 避免被发布的全量或回滚覆盖 (发布流程直接调用 UpdateDeployment, 不经过该检查)
+func (s *RolloutService) EnsureNoRollout(ctx context.Context, endpointID int64) error {
+	if _, err := s.repo.GetInProgress(ctx, endpointID); err == nil {
+		return ErrRolloutInProgress
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return nil
+}
+
+// SetTraffic 调整 canary 发布分流到新版本的比例
+func (s *RolloutService) SetTraffic(ctx context.Context, endpoint *model.UserEndpoint, id int64, percent int) (*model.EndpointRollout, error) {
+	r, err := s.repo.GetByID(ctx, endpoint.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if r.Strategy != model.RolloutStrategyCanary || (r.Status != model.RolloutStatusDeploying && r.Status != model.RolloutStatusProgressing) {
+		return nil, ErrRolloutState
+	}
+	if percent < 1 || percent > 99 {
+		return nil, errors.New("traffic_percent must be between 1 and 99")
+	}
+	ok, err := s.repo.Transition(ctx, r.ID, r.Status, map[string]interface{}{"traffic_percent": percent})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRolloutState
+	}
+	r.TrafficPercent = percent
+	return r, nil
+}
+
+// Promote 手动全量 (观察中的发布)
+func (s *RolloutService) Promote(ctx context.Context, endpoint *model.UserEndpoint, id int64) (*model.EndpointRollout, error) {
+	r, err := s.repo.GetByID(ctx, endpoint.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status != model.RolloutStatusProgressing {
+		return nil, ErrRolloutState
+	}
+	if err := s.promote(ctx, r, endpoint, "promoted manually"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Rollback 手动回滚进行中的发布
+func (s *RolloutService) Rollback(ctx context.Context, endpoint *model.UserEndpoint, id int64) (*model.EndpointRollout, error) {
+	r, err := s.repo.GetByID(ctx, endpoint.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !rolloutInProgress(r) {
+		return nil, ErrRolloutState
+	}
+	if err := s.rollback(ctx, r, endpoint, model.RolloutStatusRolledBack, "rolled back manually"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Route 任务分流: 按比例选中时返回新版本所在集群及 physical name, 否则返回 nil 走原 endpoint
+func (s *RolloutService) Route(ctx context.Context, endpoint *model.UserEndpoint) (*model.EndpointRollout, *model.Cluster) {
+	r, err := s.repo.GetInProgress(ctx, endpoint.ID)
+	if err != nil || r.ReadyAt == nil || r.CanaryPhysicalName == "" {
+		return nil, nil
+	}
+	if rand.Intn(100) >= r.TrafficPercent {
+		return nil, nil
+	}
+	cluster, err := s.clusterService.GetCluster(ctx, r.ClusterID)
+	if err != nil || cluster.Status != "active" {
+		return nil, nil
+	}
+	return r, cluster
+}
+
+// Advance 推进发布一步, 等待中的步骤直接返回, 由下一轮继续
+func (s *RolloutService) Advance(ctx context.Context, r *model.EndpointRollout) error {
+	endpoint, err := s.endpointRepo.GetByID(ctx, r.EndpointID)
+	if err != nil {
+		return err
+	}
+	if endpoint.DeletedAt != nil {
+		return s.rollback(ctx, r, endpoint, model.RolloutStatusRolledBack, "endpoint deleted")
+	}
+	switch r.Status {
+	case model.RolloutStatusDeploying:
+		return s.waitReady(ctx, r, endpoint)
+	case model.RolloutStatusProgressing:
+		return s.analyze(ctx, r, endpoint)
+	case model.RolloutStatusPromoting:
+		return s.waitPromoted(ctx, r, endpoint)
+	}
+	return nil
+}
+
+// waitReady 新版本副本就绪后开始分流
+func (s *RolloutService) waitReady(ctx context.Context, r *model.EndpointRollout, endpoint *model.UserEndpoint) error {
+	if time.Since(r.CreatedAt) > rolloutReadyTimeout {
+		return s.rollback(ctx, r, endpoint, model.RolloutStatusFailed, fmt.Sprintf("new version not ready within %s", rolloutReadyTimeout))
+	}
+	cluster, err := s.clusterService.GetCluster(ctx, r.ClusterID)
+	if err != nil {
+		return err
+	}
+	detail, err := s.endpointService.GetWaverlessClient(cluster).GetEndpoint(ctx, r.CanaryPhysicalName)
+	if err != nil {
+		return err
+	}
+	if ready, _ := detail["readyReplicas"].(float64); int(ready) < r.Replicas || ready < 1 {
+		return nil
+	}
+	if _, err := s.repo.Transition(ctx, r.ID, r.Status, map[string]interface{}{
+		"status": model.RolloutStatusProgressing, "ready_at": time.Now(),
+	}); err != nil {
+		return err
+	}
+	logger.InfoCtx(ctx, "endpoint %s rollout %d ready, routing %d%% of tasks to %s", endpoint.LogicalName, r.ID, r.TrafficPercent, r.CanaryPhysicalName)
+	return nil
+}
+
+// analyze 对比新旧版本失败率: 新版本失败率超出原版本 max_failure_rate_delta 时回滚,
+// 观察期满且新版本完成任务数足够时全量 (auto_promote 关闭时等待手动操作).
+// 新旧版本完成任务数都需达到 min_tasks 才对比, 原版本样本不足时不自动回滚或全量
+func (s *RolloutService) analyze(ctx context.Context, r *model.EndpointRollout, endpoint *model.UserEndpoint) error {
+	now := time.Now()
+	window := time.Duration(r.AnalysisMinutes) * time.Minute
+	canaryTotal, canaryFailed, err := s.taskRepo.CountOutcomes(ctx, endpoint.ID, &r.ID, *r.ReadyAt, now)
+	if err != nil {
+		return err
+	}
+	// canary 对比就绪后同期原版本的任务; blue_green 就绪后原版本不再接收任务, 对比就绪前同样时长的任务
+	baseFrom, baseTo := *r.ReadyAt, now
+	if r.Strategy == model.RolloutStrategyBlueGreen {
+		baseFrom, baseTo = r.ReadyAt.Add(-window), *r.ReadyAt
+	}
+	baseTotal, baseFailed, err := s.taskRepo.CountOutcomes(ctx, endpoint.ID, nil, baseFrom, baseTo)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Update(ctx, r.ID, map[string]interface{}{
+		"canary_tasks": canaryTotal, "canary_failed": canaryFailed,
+		"baseline_tasks": baseTotal, "baseline_failed": baseFailed,
+	}); err != nil {
+		return err
+	}
+	r.CanaryTasks, r.CanaryFailed, r.BaselineTasks, r.BaselineFailed = canaryTotal, canaryFailed, baseTotal, baseFailed
+
+	if canaryTotal < int64(r.MinTasks) {
+		return nil
+	}
+	if baseTotal < int64(r.MinTasks) {
+		if r.AutoPromote && now.Sub(*r.ReadyAt) >= window && r.Reason == "" {
+			reason := fmt.Sprintf("baseline has %d completed tasks, fewer than %d required for comparison; waiting for manual promote or rollback", baseTotal, r.MinTasks)
+			logger.WarnCtx(ctx, "endpoint %s rollout %d: %s", endpoint.LogicalName, r.ID, reason)
+			if err := s.repo.Update(ctx, r.ID, map[string]interface{}{"reason": reason}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	canaryRate, baseRate := FailureRate(canaryTotal, canaryFailed), FailureRate(baseTotal, baseFailed)
+	if canaryRate-baseRate > r.MaxFailureRateDelta {
+		return s.rollback(ctx, r, endpoint, model.RolloutStatusRolledBack,
+			fmt.Sprintf("failure rate %.2f%% exceeds baseline %.2f%% by more than %.2f%%", canaryRate*100, baseRate*100, r.MaxFailureRateDelta*100))
+	}
+	if !r.AutoPromote || now.Sub(*r.ReadyAt) < window {
+		return nil
+	}
+	return s.promote(ctx, r, endpoint, fmt.Sprintf("failure rate %.2f%% within %.2f%% of baseline %.2f%%", canaryRate*100, r.MaxFailureRateDelta*100, baseRate*100))
+}
+
+// FailureRate 失败率, 无任务时为 0
+func FailureRate(total, failed int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(failed) / float64(total)
+}
+
+// promote 原 endpoint 滚动更新为新镜像, 期间新版本继续按比例接收任务
+func (s *RolloutService) promote(ctx context.Context, r *model.EndpointRollout, endpoint *model.UserEndpoint, reason string) error {
+	if err := s.endpointService.UpdateDeployment(ctx, endpoint.OrgID, endpoint.LogicalName, -1, r.Image, envStrings(r.Env)); err != nil {
+		return err
+	}
+	s.revisionService.Record(ctx, endpoint.OrgID, endpoint.LogicalName, model.RevisionSourceRollout, r.RequestedBy, nil, nil)
+	now := time.Now()
+	ok, err := s.repo.Transition(ctx, r.ID, r.Status, map[string]interface{}{
+		"status": model.RolloutStatusPromoting, "promoted_at": now, "reason": reason,
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRolloutState
+	}
+	r.Status, r.PromotedAt, r.Reason = model.RolloutStatusPromoting, &now, reason
+	logger.InfoCtx(ctx, "endpoint %s rollout %d promoting image %s: %s", endpoint.LogicalName, r.ID, r.Image, reason)
+	return nil
+}
+
+// waitPromoted 原 endpoint 各集群更新为新镜像并就绪后删除新版本部署; 超时则恢复原镜像
+func (s *RolloutService) waitPromoted(ctx context.Context, r *model.EndpointRollout, endpoint *model.UserEndpoint) error {
+	if r.PromotedAt != nil && time.Since(*r.PromotedAt) > rolloutPromoteTimeout {
+		return s.rollback(ctx, r, endpoint, model.RolloutStatusFailed, fmt.Sprintf("endpoint not updated within %s", rolloutPromoteTimeout))
+	}
+	targets, err := s.endpointService.healthyPlacements(ctx, endpoint.ID)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		detail, err := s.endpointService.GetWaverlessClient(t.cluster).GetEndpoint(ctx, endpoint.PhysicalName)
+		if err != nil {
+			return err
+		}
+		image, _ := detail["image"].(string)
+		ready, _ := detail["readyReplicas"].(float64)
+		if image != r.Image || int(ready) < t.placement.Replicas {
+			return nil
+		}
+	}
+	if err := s.deleteCanary(ctx, r); err != nil {
+		return err
+	}
+	if err := s.finish(ctx, r, model.RolloutStatusCompleted, r.Reason); err != nil {
+		return err
+	}
+	logger.InfoCtx(ctx, "endpoint %s rollout %d completed, image %s promoted", endpoint.LogicalName, r.ID, r.Image)
+	return nil
+}
+
+// rollback 删除新版本部署; 已开始全量时恢复原 endpoint 的镜像
+func (s *RolloutService) rollback(ctx context.Context, r *model.EndpointRollout, endpoint *model.UserEndpoint, status, reason string) error {
+	if r.Status == model.RolloutStatusPromoting && endpoint.DeletedAt == nil {
+		if err := s.endpointService.UpdateDeployment(ctx, endpoint.OrgID, endpoint.LogicalName, -1, r.PreviousImage, envStrings(r.PreviousEnv)); err != nil {
+			return err
+		}
+		s.revisionService.Record(ctx, endpoint.OrgID, endpoint.LogicalName, model.RevisionSourceRollout, r.RequestedBy, nil, nil)
+	}
+	if err := s.deleteCanary(ctx, r); err != nil {
+		return err
+	}
+	if err := s.finish(ctx, r, status, reason); err != nil {
+		return err
+	}
+	logger.WarnCtx(ctx, "endpoint %s rollout %d of image %s %s: %s", endpoint.LogicalName, r.ID, r.Image, status, reason)
+	return nil
+}
+
+// deleteCanary 删除新版本部署
+func (s *RolloutService) deleteCanary(ctx context.Context, r *model.EndpointRollout) error {
+	if r.CanaryPhysicalName == "" {
+		return nil
+	}
+	cluster, err := s.clusterService.GetCluster(ctx, r.ClusterID)
+	if err != nil {
+		return err
+	}
+	if err := s.endpointService.GetWaverlessClient(cluster).DeleteEndpoint(ctx, r.CanaryPhysicalName); err != nil && !waverless.IsNotFound(err) {
+		return fmt.Errorf("failed to delete new version: %w", err)
+	}
+	return nil
+}
+
+// finish 结束发布, 新版本的 worker 标记下线
+func (s *RolloutService) finish(ctx context.Context, r *model.EndpointRollout, status, reason string) error {
+	now := time.Now()
+	ok, err := s.repo.Finish(ctx, r, map[string]interface{}{
+		"status": status, "reason": reason, "completed_at": now,
+	}, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrRolloutState
+	}
+	r.Status, r.Reason, r.CompletedAt = status, reason, &now
+	return nil
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/config"
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"github.com/wavespeedai/waverless-portal/pkg/wavespeed"
+	"gorm.io/gorm"
+)
+
+// RunwayService 按组织当前消耗速度预测余额可用时长, 余额转负后经过宽限期/透支额度再停机
+type RunwayService struct {
+	repo            *mysql.RunwayRepo
+	workerRepo      *mysql.WorkerRepo
+	endpointRepo    *mysql.EndpointRepo
+	preferencesRepo *mysql.PreferencesRepo
+	endpointService *EndpointService
+	pricingService  *PricingService
+	currencies      *CurrencyService
+}
+
+func NewRunwayService(repo *mysql.RunwayRepo, workerRepo *mysql.WorkerRepo, endpointRepo *mysql.EndpointRepo, preferencesRepo *mysql.PreferencesRepo, endpointService *EndpointService, pricingService *PricingService, currencies *CurrencyService) *RunwayService {
+	return &RunwayService{repo: repo, workerRepo: workerRepo, endpointRepo: endpointRepo, preferencesRepo: preferencesRepo, endpointService: endpointService, pricingService: pricingService, currencies: currencies}
+}
+
+// RunwayForecast 组织余额预测
+type RunwayForecast struct {
+	OrgID          string  `json:"org_id"`
+	Balance        int64   `json:"balance"`
+	BurnRate       int64   `json:"burn_rate"`    // 每小时消耗 (与主站余额相同, 按默认币种换算)
+	RunwayHours    float64 `json:"runway_hours"` // -1 表示当前无消耗
+	RunningWorkers int     `json:"running_workers"`
+}
+
+// Forecast 获取余额并按运行中 worker 的实时价格计算消耗速度 (主站余额为默认币种, 其他币种的 endpoint 按当前汇率换算)
+func (s *RunwayService) Forecast(ctx context.Context, orgID string) (*RunwayForecast, error) {
+	balance, err := wavespeed.GetOrgBalanceInternal(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return s.forecast(ctx, orgID, balance, time.Now())
+}
+
+func (s *RunwayService) forecast(ctx context.Context, orgID string, balance int64, now time.Time) (*RunwayForecast, error) {
+	workers, err := s.workerRepo.ListRunningByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &RunwayForecast{OrgID: orgID, Balance: balance, RunningWorkers: len(workers)}
+	prices := make(map[int64]int64)
+	for _, w := range workers {
+		price, ok := prices[w.EndpointID]
+		if !ok {
+			endpoint, err := s.endpointRepo.GetByID(ctx, w.EndpointID)
+			if err != nil {
+				continue
+			}
+			price = endpoint.PricePerHour
+			if endpoint.TaskBilled() {
+				// 按任务计费的 endpoint 不按 worker 运行时长消耗
+				price = 0
+			} else if s.pricingService != nil && !endpoint.Spot {
+				if p, _, err := s.pricingService.ResolvePrice(ctx, endpoint.ClusterID, endpoint.SpecName, endpoint.BillingCurrency(), endpoint.PricePerHour, now); err == nil {
+					price = p
+				}
+			}
+			if s.currencies != nil && price > 0 {
+				converted, err := s.currencies.Convert(ctx, price, endpoint.BillingCurrency(), model.DefaultCurrency, now)
+				if err != nil {
+					logger.WarnCtx(ctx, "[Runway] convert burn rate of endpoint %d error: %v", endpoint.ID, err)
+				} else {
+					price = converted
+				}
+			}
+			prices[w.EndpointID] = price
+		}
+		f.BurnRate += price
+	}
+
+	f.RunwayHours = runwayHours(balance, f.BurnRate)
+	return f, nil
+}
+
+// CheckAll 检查所有有运行中或已停机 endpoint 的组织 (包括本轮无计费的空闲组织)
+func (s *RunwayService) CheckAll(ctx context.Context, extraOrgIDs map[string]bool) {
+	orgIDs, err := s.endpointRepo.ListActiveOrgIDs(ctx)
+	if err != nil {
+		logger.ErrorCtx(ctx, "[Runway] list active orgs error: %v", err)
+	}
+	checked := make(map[string]bool, len(orgIDs)+len(extraOrgIDs))
+	for _, orgID := range orgIDs {
+		checked[orgID] = true
+		s.Check(ctx, orgID)
+	}
+	for orgID := range extraOrgIDs {
+		if !checked[orgID] {
+			s.Check(ctx, orgID)
+		}
+	}
+}
+
+// Check 更新组织余额预测: 可用时长低于阈值时告警, 余额转负超过宽限期或透支额度后停机
+func (s *RunwayService) Check(ctx context.Context, orgID string) {
+	balance, err := wavespeed.GetOrgBalanceInternal(ctx, orgID)
+	if err != nil {
+		logger.ErrorCtx(ctx, "[Runway] get balance for org %s error: %v", orgID, err)
+		return
+	}
+
+	now := time.Now()
+	f, err := s.forecast(ctx, orgID, balance, now)
+	if err != nil {
+		logger.ErrorCtx(ctx, "[Runway] forecast for org %s error: %v", orgID, err)
+		return
+	}
+
+	state, err := s.repo.GetState(ctx, orgID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.ErrorCtx(ctx, "[Runway] get state for org %s error: %v", orgID, err)
+			return
+		}
+		state = &model.OrgBillingState{OrgID: orgID}
+	}
+	state.Balance, state.BurnRate, state.RunwayHours = f.Balance, f.BurnRate, f.RunwayHours
+
+	if f.Balance >= 0 {
+		state.NegativeSince = nil
+		state.SuspendedAt = nil
+		s.checkThresholds(ctx, state, f)
+	} else {
+		if state.NegativeSince == nil {
+			state.NegativeSince = &now
+			s.recordAlert(ctx, f, model.RunwayActionNegative, 0,
+				fmt.Sprintf("balance is negative, grace period %v, negative allowance %.2f USD", gracePeriod(), float64(negativeAllowance())/1000000))
+		}
+		// 停机后每轮仍检查, 防止余额未恢复时 endpoint 被重新扩容
+		if reason := suspendReason(f.Balance, *state.NegativeSince, now); reason != "" {
+			if s.suspendOrg(ctx, orgID, reason) && state.SuspendedAt == nil {
+				state.SuspendedAt = &now
+				s.recordAlert(ctx, f, model.RunwayActionSuspend, 0, reason)
+			}
+		}
+	}
+
+	if err := s.repo.SaveState(ctx, state); err != nil {
+		logger.ErrorCtx(ctx, "[Runway] save state for org %s error: %v", orgID, err)
+	}
+}
+
+// GetState 获取组织最近一次预测状态
+func (s *RunwayService) GetState(ctx context.Context, orgID string) (*model.OrgBillingState, error) {
+	return s.repo.GetState(ctx, orgID)
+}
+
+func (s *RunwayService) ListAlerts(ctx context.Context, orgID string, limit int) ([]model.RunwayAlert, error) {
+	return s.repo.ListAlerts(ctx, orgID, limit)
+}
+
+// checkThresholds 可用时长每跌破一个更低阈值告警一次, 回升到最高阈值以上后重置
+func (s *RunwayService) checkThresholds(ctx context.Context, state *model.OrgBillingState, f *RunwayForecast) {
+	thresholds := runwayThresholds()
+	if len(thresholds) == 0 {
+		return
+	}
+	if f.RunwayHours < 0 || f.RunwayHours > thresholds[0] {
+		state.LastAlertThreshold = 0
+		return
+	}
+
+	// 找到当前已跌破的最低阈值
+	crossed := 0.0
+	for _, t := range thresholds {
+		if f.RunwayHours <= t {
+			crossed = t
+		}
+	}
+	if state.LastAlertThreshold == 0 || crossed < state.LastAlertThreshold {
+		state.LastAlertThreshold = crossed
+		s.recordAlert(ctx, f, model.RunwayActionWarn, crossed,
+			fmt.Sprintf("balance runway %.1fh is below %.0fh at current burn rate", f.RunwayHours, crossed))
+	}
+}
+
+func (s *RunwayService) recordAlert(ctx context.Context, f *RunwayForecast, action string, threshold float64, message string) {
+	logger.WarnCtx(ctx, "[Runway] org %s %s: %s (balance %d, burn rate %d/h)", f.OrgID, action, message, f.Balance, f.BurnRate)
+	if err := s.repo.CreateAlert(ctx, &model.RunwayAlert{
+		OrgID: f.OrgID, Action: action, ThresholdHours: threshold, RunwayHours: f.RunwayHours,
+		Balance: f.Balance, BurnRate: f.BurnRate, Message: message,
+	}); err != nil {
+		logger.ErrorCtx(ctx, "[Runway] record alert for org %s error: %v", f.OrgID, err)
+	}
+}
+
+// suspendOrg 停机组织下所有 endpoint, 至少停机了一个 endpoint 时返回 true;
+// 与自动迁移一致按 endpoint 创建者的偏好判断, 关闭 auto_suspend_on_low_balance 的用户创建的 endpoint 仅告警不停机
+func (s *RunwayService) suspendOrg(ctx context.Context, orgID, reason string) bool {
+	endpoints, err := s.endpointRepo.ListByOrg(ctx, orgID)
+	if err != nil {
+		logger.ErrorCtx(ctx, "[Runway] list endpoints for org %s error: %v", orgID, err)
+		return false
+	}
+	suspended := 0
+	autoSuspend := make(map[string]bool)
+	for i := range endpoints {
+		ep := &endpoints[i]
+		if ep.Replicas == 0 {
+			continue
+		}
+		enabled, cached := autoSuspend[ep.UserID]
+		if !cached {
+			enabled = s.autoSuspendEnabled(ctx, ep.UserID)
+			autoSuspend[ep.UserID] = enabled
+		}
+		if !enabled {
+			logger.InfoCtx(ctx, "[Runway] org %s %s, endpoint %d owner %s disabled auto suspend, skipping", orgID, reason, ep.ID, ep.UserID)
+			continue
+		}
+		logger.InfoCtx(ctx, "[Runway] org %s %s, suspending endpoint %d", orgID, reason, ep.ID)
+		if err := s.endpointService.Suspend(ctx, ep, reason); err != nil {
+			logger.ErrorCtx(ctx, "[Runway] suspend endpoint %d error: %v", ep.ID, err)
+			continue
+		}
+		suspended++
+	}
+	return suspended > 0
+}
+
+// autoSuspendEnabled 用户是否开启余额不足自动停机 (未设置偏好时默认开启)
+func (s *RunwayService) autoSuspendEnabled(ctx context.Context, userID string) bool {
+	if s.preferencesRepo == nil {
+		return true
+	}
+	prefs, err := s.preferencesRepo.Get(ctx, userID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.WarnCtx(ctx, "[Runway] get preferences for user %s error: %v", userID, err)
+		}
+		return true
+	}
+	return prefs.AutoSuspendOnLowBalance
+}
+
+// suspendReason 余额为负时判断是否需要停机, 返回停机原因 (空表示仍在宽限期内)
+func suspendReason(balance int64, negativeSince, now time.Time) string {
+	grace, allowance := gracePeriod(), negativeAllowance()
+	switch {
+	case grace == 0 && allowance == 0:
+		return "insufficient balance"
+	case allowance > 0 && balance < -allowance:
+		return "insufficient balance: negative allowance exceeded"
+	case grace > 0 && now.Sub(negativeSince) >= grace:
+		return "insufficient balance: grace period expired"
+	}
+	return ""
+}
+
+func runwayHours(balance, burnRate int64) float64 {
+	if burnRate <= 0 {
+		return -1
+	}
+	if balance <= 0 {
+		return 0
+	}
+	return math.Round(float64(balance)/float64(burnRate)*100) / 100
+}
+
+// runwayThresholds 告警阈值, 从高到低
+func runwayThresholds() []float64 {
+	thresholds := []float64{24, 6, 1}
+	if config.GlobalConfig != nil && len(config.GlobalConfig.Billing.Runway.AlertThresholdsHours) > 0 {
+		thresholds = append([]float64(nil), config.GlobalConfig.Billing.Runway.AlertThresholdsHours...)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(thresholds)))
+	return thresholds
+}
+
+func gracePeriod() time.Duration {
+	if config.GlobalConfig == nil {
+		return 0
+	}
+	return time.Duration(config.GlobalConfig.Billing.Runway.GracePeriodMinutes) * time.Minute
+}
+
+// negativeAllowance 透支额度 (单位: 1/1000000 USD)
+func negativeAllowance() int64 {
+	if config.GlobalConfig == nil {
+		return 0
+	}
+	return int64(config.GlobalConfig.Billing.Runway.NegativeAllowance * 1000000)
+}
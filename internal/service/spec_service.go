@@ -2,21 +2,49 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 )
 
 type SpecService struct {
-	repo *mysql.SpecRepo
+	repo       *mysql.SpecRepo
+	currencies *CurrencyService
 }
 
-func NewSpecService(repo *mysql.SpecRepo) *SpecService {
-	return &SpecService{repo: repo}
+func NewSpecService(repo *mysql.SpecRepo, currencies *CurrencyService) *SpecService {
+	return &SpecService{repo: repo, currencies: currencies}
 }
 
-func (s *SpecService) ListSpecs(ctx context.Context, specType string) ([]mysql.SpecWithAvailability, error) {
-	return s.repo.ListWithAvailability(ctx, specType)
+// ListSpecs 列出可用规格, currency 非空时价格为该币种 (标价或按当前汇率换算)
+func (s *SpecService) ListSpecs(ctx context.Context, specType, currency string) ([]mysql.SpecWithAvailability, error) {
+	specs, err := s.repo.ListWithAvailability(ctx, specType)
+	if err != nil || currency == "" || s.currencies == nil {
+		return specs, err
+	}
+	now := time.Now()
+	for i := range specs {
+		sp := &specs[i]
+		prices, err := s.currencies.SpecPrices(ctx, &model.SpecPricing{
+			SpecName: sp.SpecName, PricePerHour: sp.PricePerHour, SpotPricePerHour: sp.SpotPricePerHour,
+			TaskPricePerSecond: sp.TaskPricePerSecond, Currency: sp.Currency,
+		}, currency, now)
+		if err != nil {
+			return nil, err
+		}
+		sp.PricePerHour, sp.SpotPricePerHour, sp.TaskPricePerSecond = prices.PricePerHour, prices.SpotPricePerHour, prices.TaskPricePerSecond
+		sp.Currency = prices.Currency
+	}
+	return specs, nil
+}
+
+// OrgCurrency 组织计费币种
+func (s *SpecService) OrgCurrency(ctx context.Context, orgID string) (string, error) {
+	if s.currencies == nil {
+		return model.DefaultCurrency, nil
+	}
+	return s.currencies.OrgCurrency(ctx, orgID)
 }
 
 func (s *SpecService) GetSpec(ctx context.Context, specName string) (*model.SpecPricing, error) {
@@ -39,10 +67,19 @@ func (s *SpecService) DeleteSpec(ctx context.Context, id int64) error {
 	return s.repo.Delete(ctx, id)
 }
 
-func (s *SpecService) EstimateCost(ctx context.Context, specName string, hours float64, replicas int) (int64, error) {
+// EstimateCost 按规格在 currency 下的价格估算成本, 返回金额及币种
+func (s *SpecService) EstimateCost(ctx context.Context, specName, currency string, hours float64, replicas int) (int64, string, error) {
 	spec, err := s.repo.GetByName(ctx, specName)
 	if err != nil {
-		return 0, err
+		return 0, "", err
+	}
+	price, currency := spec.PricePerHour, spec.Currency
+	if s.currencies != nil {
+		prices, err := s.currencies.SpecPrices(ctx, spec, currency, time.Now())
+		if err != nil {
+			return 0, "", err
+		}
+		price, currency = prices.PricePerHour, prices.Currency
 	}
-	return int64(float64(spec.PricePerHour) * hours * float64(replicas)), nil
+	return int64(float64(price) * hours * float64(replicas)), currency, nil
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/wavespeedai/waverless-portal/pkg/logger"
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql"
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 	"github.com/wavespeedai/waverless-portal/pkg/waverless"
@@ -16,82 +17,133 @@ type TaskService struct {
 	taskRepo        *mysql.TaskRepo
 	endpointService *EndpointService
 	clusterService  *ClusterService
+	rolloutService  *RolloutService
 }
 
-func NewTaskService(taskRepo *mysql.TaskRepo, endpointService *EndpointService, clusterService *ClusterService) *TaskService {
-	return &TaskService{taskRepo: taskRepo, endpointService: endpointService, clusterService: clusterService}
+func NewTaskService(taskRepo *mysql.TaskRepo, endpointService *EndpointService, clusterService *ClusterService, rolloutService *RolloutService) *TaskService {
+	return &TaskService{taskRepo: taskRepo, endpointService: endpointService, clusterService: clusterService, rolloutService: rolloutService}
 }
 
+// SubmitTask 提交任务到 endpoint 的可用集群, 提交失败时依次尝试其他可用集群;
+// 镜像发布进行中时按比例分流到新版本, 新版本提交失败时回到原 endpoint
 func (s *TaskService) SubmitTask(ctx context.Context, userID, orgID, logicalName string, input map[string]interface{}) (*waverless.TaskResponse, error) {
-	endpoint, err := s.endpointService.GetByLogicalName(ctx, userID, logicalName)
+	endpoint, err := s.endpointService.GetByLogicalName(ctx, orgID, logicalName)
 	if err != nil {
 		return nil, fmt.Errorf("endpoint not found: %w", err)
 	}
-	cluster, err := s.clusterService.GetCluster(ctx, endpoint.ClusterID)
+	inputJSON, _ := json.Marshal(input)
+	if rollout, cluster := s.rolloutService.Route(ctx, endpoint); rollout != nil {
+		resp, err := s.endpointService.GetWaverlessClient(cluster).SubmitTask(ctx, rollout.CanaryPhysicalName, input)
+		if err == nil {
+			now := time.Now()
+			s.taskRepo.Create(ctx, &model.TaskRouting{
+				TaskID: resp.ID, UserID: userID, OrgID: orgID, EndpointID: endpoint.ID, ClusterID: cluster.ClusterID,
+				Input: datatypes.JSON(inputJSON), Status: "PENDING", SubmittedAt: now, CreatedAt: &now, RolloutID: &rollout.ID,
+			})
+			return resp, nil
+		}
+		logger.WarnCtx(ctx, "submit task to rollout %d of endpoint %s error: %v", rollout.ID, endpoint.LogicalName, err)
+	}
+
+	clusters, err := s.endpointService.RouteClusters(ctx, endpoint)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := s.endpointService.GetWaverlessClient(cluster).SubmitTask(ctx, endpoint.PhysicalName, input)
+	var resp *waverless.TaskResponse
+	var cluster *model.Cluster
+	for _, cluster = range clusters {
+		resp, err = s.endpointService.GetWaverlessClient(cluster).SubmitTask(ctx, endpoint.PhysicalName, input)
+		if err == nil {
+			break
+		}
+		logger.WarnCtx(ctx, "submit task to endpoint %s on cluster %s error: %v", endpoint.LogicalName, cluster.ClusterID, err)
+	}
 	if err != nil {
 		return nil, err
 	}
-	inputJSON, _ := json.Marshal(input)
 	now := time.Now()
 	s.taskRepo.Create(ctx, &model.TaskRouting{
-		TaskID: resp.ID, UserID: userID, OrgID: orgID, EndpointID: endpoint.ID, ClusterID: endpoint.ClusterID,
+		TaskID: resp.ID, UserID: userID, OrgID: orgID, EndpointID: endpoint.ID, ClusterID: cluster.ClusterID,
 		Input: datatypes.JSON(inputJSON), Status: "PENDING", SubmittedAt: now, CreatedAt: &now,
 	})
 	return resp, nil
 }
 
+// SubmitTaskSync 同步执行任务, 路由到首选的可用集群 (失败不重试其他集群, 避免任务重复执行);
+// 镜像发布进行中时按比例分流到新版本
 func (s *TaskService) SubmitTaskSync(ctx context.Context, userID, orgID, logicalName string, input map[string]interface{}) (*waverless.TaskResponse, error) {
-	endpoint, err := s.endpointService.GetByLogicalName(ctx, userID, logicalName)
+	endpoint, err := s.endpointService.GetByLogicalName(ctx, orgID, logicalName)
 	if err != nil {
 		return nil, fmt.Errorf("endpoint not found: %w", err)
 	}
-	cluster, err := s.clusterService.GetCluster(ctx, endpoint.ClusterID)
-	if err != nil {
-		return nil, err
+	physicalName := endpoint.PhysicalName
+	var cluster *model.Cluster
+	var rolloutID *int64
+	if rollout, c := s.rolloutService.Route(ctx, endpoint); rollout != nil {
+		physicalName, cluster, rolloutID = rollout.CanaryPhysicalName, c, &rollout.ID
+	} else {
+		clusters, err := s.endpointService.RouteClusters(ctx, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		cluster = clusters[0]
 	}
-	resp, err := s.endpointService.GetWaverlessClient(cluster).SubmitTaskSync(ctx, endpoint.PhysicalName, input)
+	resp, err := s.endpointService.GetWaverlessClient(cluster).SubmitTaskSync(ctx, physicalName, input)
 	if err != nil {
 		return nil, err
 	}
 	inputJSON, _ := json.Marshal(input)
 	now := time.Now()
 	s.taskRepo.Create(ctx, &model.TaskRouting{
-		TaskID: resp.ID, UserID: userID, OrgID: orgID, EndpointID: endpoint.ID, ClusterID: endpoint.ClusterID,
+		TaskID: resp.ID, UserID: userID, OrgID: orgID, EndpointID: endpoint.ID, ClusterID: cluster.ClusterID,
 		Input: datatypes.JSON(inputJSON), Status: resp.Status, WorkerID: resp.WorkerID, SubmittedAt: now, CreatedAt: &now,
-		ExecutionTimeMs: resp.ExecutionTime,
+		ExecutionTimeMs: resp.ExecutionTime, RolloutID: rolloutID,
 	})
 	return resp, nil
 }
 
-func (s *TaskService) GetTaskStatus(ctx context.Context, userID, taskID string) (*waverless.TaskResponse, error) {
-	routing, err := s.taskRepo.GetByTaskID(ctx, taskID, userID)
+// GetTaskStatus 获取任务状态, 任务因 worker 被抢占重新提交时返回新任务的状态
+func (s *TaskService) GetTaskStatus(ctx context.Context, orgID, taskID string) (*waverless.TaskResponse, error) {
+	routing, err := s.getRouting(ctx, orgID, taskID)
 	if err != nil {
-		return nil, fmt.Errorf("task not found: %w", err)
+		return nil, err
 	}
 	cluster, err := s.clusterService.GetCluster(ctx, routing.ClusterID)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := s.endpointService.GetWaverlessClient(cluster).GetTaskStatus(ctx, taskID)
+	resp, err := s.endpointService.GetWaverlessClient(cluster).GetTaskStatus(ctx, routing.TaskID)
 	if err != nil {
 		return nil, err
 	}
-	s.taskRepo.Update(ctx, taskID, resp.Status, resp.WorkerID, resp.ExecutionTime)
+	s.taskRepo.Update(ctx, routing.TaskID, resp.Status, resp.WorkerID, resp.ExecutionTime)
 	return resp, nil
 }
 
-func (s *TaskService) CancelTask(ctx context.Context, userID, taskID string) error {
-	routing, err := s.taskRepo.GetByTaskID(ctx, taskID, userID)
+func (s *TaskService) CancelTask(ctx context.Context, orgID, taskID string) error {
+	routing, err := s.getRouting(ctx, orgID, taskID)
 	if err != nil {
-		return fmt.Errorf("task not found: %w", err)
+		return err
 	}
 	cluster, err := s.clusterService.GetCluster(ctx, routing.ClusterID)
 	if err != nil {
 		return err
 	}
-	return s.endpointService.GetWaverlessClient(cluster).CancelTask(ctx, taskID)
+	return s.endpointService.GetWaverlessClient(cluster).CancelTask(ctx, routing.TaskID)
+}
+
+// getRouting 获取任务路由, 沿重新提交记录跟随到最新的任务
+func (s *TaskService) getRouting(ctx context.Context, orgID, taskID string) (*model.TaskRouting, error) {
+	routing, err := s.taskRepo.GetByTaskID(ctx, taskID, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("task not found: %w", err)
+	}
+	for routing.ResubmittedTaskID != "" {
+		next, err := s.taskRepo.GetByTaskID(ctx, routing.ResubmittedTaskID, orgID)
+		if err != nil {
+			break
+		}
+		routing = next
+	}
+	return routing, nil
 }
@@ -0,0 +1,31 @@
+-- Portal 数据库迁移: 计费消息 outbox
+-- 创建时间: 2026-10-16
+-- 计费流水与 MQ 消息在同一事务内写入, 由 dispatcher 重试投递直到 RocketMQ 确认
+
+-- 1. billing_transactions 增加投递状态
+ALTER TABLE billing_transactions
+    ADD COLUMN delivery_status VARCHAR(20) DEFAULT 'pending' COMMENT '主站扣款消息投递状态: pending, sent, failed',
+    ADD INDEX idx_delivery_status (delivery_status);
+
+-- 历史流水已按旧逻辑直接发送, 视为已投递
+UPDATE billing_transactions SET delivery_status = 'sent';
+
+-- 2. 计费消息发件箱
+CREATE TABLE billing_outbox (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    transaction_id BIGINT NOT NULL COMMENT '关联 billing_transactions.id',
+    topic VARCHAR(100) NOT NULL,
+    tag VARCHAR(100) NOT NULL,
+    message_key VARCHAR(255) NOT NULL COMMENT '幂等 key',
+    payload TEXT NOT NULL COMMENT '消息体 JSON',
+    status VARCHAR(20) DEFAULT 'pending' COMMENT 'pending, sent, failed',
+    attempts INT DEFAULT 0 COMMENT '已投递次数',
+    next_retry_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '下次投递时间',
+    last_error TEXT,
+    sent_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_message_key (message_key),
+    INDEX idx_outbox_transaction (transaction_id),
+    INDEX idx_outbox_due (status, next_retry_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='计费消息发件箱';
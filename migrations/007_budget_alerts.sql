@@ -0,0 +1,17 @@
+-- Portal 数据库迁移: 用户预算告警
+-- 创建时间: 2026-10-16
+-- user_preferences 中的日/月预算由 BillingJob 强制执行, 达到阈值记录告警, 超限停机
+
+CREATE TABLE budget_alerts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id VARCHAR(100) NOT NULL,
+    period_type VARCHAR(20) NOT NULL COMMENT 'daily, monthly',
+    period_start TIMESTAMP NOT NULL COMMENT '预算周期开始时间',
+    threshold INT NOT NULL COMMENT '触发阈值(百分比), 100 表示超限',
+    spent BIGINT NOT NULL COMMENT '触发时已消费 (1000000 = 1 USD)',
+    budget_limit BIGINT NOT NULL COMMENT '预算上限 (1000000 = 1 USD)',
+    action VARCHAR(20) NOT NULL COMMENT 'warn, suspend',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_budget_alert (user_id, period_type, period_start, threshold),
+    INDEX idx_user_alert (user_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='预算告警记录';
@@ -0,0 +1,10 @@
+-- Portal 数据库迁移: 集群覆盖价格按生效时间窗口生效
+-- 创建时间: 2026-10-16
+-- 同一集群规格允许多条不同时间窗口的覆盖价格, 计费时段跨越边界时拆分为多条流水
+
+ALTER TABLE cluster_pricing_overrides
+    DROP INDEX uk_cluster_spec,
+    ADD INDEX idx_cluster_spec_effective (cluster_id, spec_name, effective_from);
+
+ALTER TABLE billing_transactions
+    ADD COLUMN pricing_override_id BIGINT NULL COMMENT '使用的集群覆盖价格 ID, 为空表示基础价格' AFTER price_per_hour;
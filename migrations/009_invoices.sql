@@ -0,0 +1,39 @@
+-- Portal 数据库迁移: 组织月度账单
+-- 创建时间: 2026-10-16
+-- 账单由 InvoiceJob 按 UTC 自然月从 billing_transactions 汇总生成, 关账后不可修改
+
+CREATE TABLE invoices (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    invoice_number VARCHAR(150) NOT NULL COMMENT '账单编号 INV-YYYYMM-ORG_ID',
+    org_id VARCHAR(100) NOT NULL,
+    period_start TIMESTAMP NOT NULL COMMENT '账单周期开始 (含)',
+    period_end TIMESTAMP NOT NULL COMMENT '账单周期结束 (不含)',
+    total_amount BIGINT NOT NULL DEFAULT 0 COMMENT '总金额 (1000000 = 1 USD)',
+    total_seconds BIGINT NOT NULL DEFAULT 0,
+    currency VARCHAR(10) DEFAULT 'USD',
+    status VARCHAR(20) NOT NULL DEFAULT 'draft' COMMENT 'draft, finalized',
+    finalized_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_invoice_number (invoice_number),
+    UNIQUE KEY uk_org_period (org_id, period_start),
+    INDEX idx_invoice_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='组织月度账单';
+
+CREATE TABLE invoice_line_items (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    invoice_id BIGINT NOT NULL,
+    endpoint_id BIGINT NOT NULL,
+    endpoint_name VARCHAR(255),
+    spec_name VARCHAR(100),
+    gpu_type VARCHAR(100),
+    duration_seconds BIGINT NOT NULL,
+    amount BIGINT NOT NULL COMMENT '金额 (1000000 = 1 USD)',
+    transaction_count BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_invoice_item (invoice_id),
+    FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='账单明细 (按 endpoint + 规格 + GPU 类型汇总)';
+
+-- 账单按计费时段归属月份
+ALTER TABLE billing_transactions ADD INDEX idx_org_period (org_id, billing_period_start);
@@ -0,0 +1,26 @@
+-- Portal 数据库迁移: 管理员调账 (退款/补扣)
+-- 创建时间: 2026-10-16
+-- 调账记录关联原始计费流水, 只增不改; 每条调账通过 billing_outbox 投递独立幂等 key 的 MQ 消息
+
+CREATE TABLE billing_adjustments (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    transaction_id BIGINT NOT NULL COMMENT '原始 billing_transactions.id',
+    user_id VARCHAR(100) NOT NULL,
+    org_id VARCHAR(100),
+    endpoint_id BIGINT NOT NULL,
+    worker_id VARCHAR(255),
+    type VARCHAR(20) NOT NULL COMMENT 'credit, debit',
+    amount BIGINT NOT NULL COMMENT '调账金额, 负数为退款 (1000000 = 1 USD)',
+    reason VARCHAR(500) NOT NULL,
+    admin_email VARCHAR(255) NOT NULL COMMENT '操作管理员',
+    idempotency_key VARCHAR(255) NOT NULL COMMENT '主站消息幂等 key',
+    delivery_status VARCHAR(20) DEFAULT 'pending' COMMENT 'pending, sent, failed',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_adjustment_key (idempotency_key),
+    INDEX idx_adjustment_transaction (transaction_id),
+    INDEX idx_adjustment_user (user_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='管理员调账记录';
+
+ALTER TABLE billing_outbox
+    ADD COLUMN adjustment_id BIGINT NOT NULL DEFAULT 0 COMMENT '关联 billing_adjustments.id, 0 表示计费流水消息' AFTER transaction_id,
+    ADD INDEX idx_outbox_adjustment (adjustment_id);
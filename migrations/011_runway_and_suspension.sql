@@ -0,0 +1,31 @@
+-- Portal 数据库迁移: 余额可用时长预测与停机宽限
+-- 创建时间: 2026-10-16
+-- BillingJob 按组织消耗速度预测余额可用时长, 余额转负后经过宽限期/透支额度才停机, endpoint 标记为 suspended 并记录原因
+
+CREATE TABLE org_billing_states (
+    org_id VARCHAR(100) PRIMARY KEY,
+    balance BIGINT NOT NULL COMMENT '最近一次余额 (1000000 = 1 USD)',
+    burn_rate BIGINT NOT NULL COMMENT '每小时消耗 (1000000 = 1 USD)',
+    runway_hours DOUBLE NOT NULL COMMENT '剩余可用小时, -1 表示无消耗',
+    last_alert_threshold DOUBLE NOT NULL DEFAULT 0 COMMENT '已告警的最低阈值(小时), 0 表示未告警',
+    negative_since TIMESTAMP NULL COMMENT '余额转负时间 (宽限期起点)',
+    suspended_at TIMESTAMP NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='组织余额预测状态';
+
+CREATE TABLE runway_alerts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    org_id VARCHAR(100) NOT NULL,
+    action VARCHAR(20) NOT NULL COMMENT 'warn, negative, suspend',
+    threshold_hours DOUBLE NOT NULL,
+    runway_hours DOUBLE NOT NULL,
+    balance BIGINT NOT NULL,
+    burn_rate BIGINT NOT NULL,
+    message VARCHAR(500),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_org_runway_alert (org_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='余额预测告警记录';
+
+ALTER TABLE user_endpoints
+    ADD COLUMN suspend_reason VARCHAR(255) NULL COMMENT '停机原因' AFTER status,
+    ADD COLUMN suspended_at TIMESTAMP NULL AFTER suspend_reason;
@@ -0,0 +1,33 @@
+-- Portal 数据库迁移: 规格计费策略
+-- 创建时间: 2026-10-16
+-- 规格可绑定计费策略 (取整/最小出账时长/最低消费/冷启动免费/空闲折扣), 策略只增不改, 流水记录所用策略版本
+
+CREATE TABLE billing_policies (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    version INT NOT NULL,
+    rounding VARCHAR(20) NOT NULL DEFAULT 'second' COMMENT 'second, minute',
+    min_billable_seconds BIGINT NOT NULL DEFAULT 60 COMMENT '运行中 worker 满多少秒出账',
+    minimum_charge_seconds BIGINT NOT NULL DEFAULT 0 COMMENT '每个 worker 生命周期最低计费秒数',
+    cold_start_free_seconds BIGINT NOT NULL DEFAULT 0 COMMENT '冷启动免费时长上限(秒)',
+    idle_discount_percent INT NOT NULL DEFAULT 0 COMMENT '空闲时长折扣 0-100',
+    description VARCHAR(500),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_policy_version (name, version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='计费策略 (按版本)';
+
+ALTER TABLE spec_pricing
+    ADD COLUMN billing_policy_id BIGINT NULL COMMENT '计费策略, 为空使用默认策略' AFTER max_price;
+
+ALTER TABLE billing_transactions
+    ADD COLUMN billing_policy_id BIGINT NULL COMMENT '计费策略, 为空表示默认策略' AFTER pricing_override_id,
+    ADD COLUMN billing_policy_version INT NOT NULL DEFAULT 0 AFTER billing_policy_id,
+    ADD COLUMN billed_seconds BIGINT NOT NULL DEFAULT 0 COMMENT '实际计费秒数 (含取整/最低消费, 不含免费时长)' AFTER billing_policy_version,
+    ADD COLUMN free_seconds BIGINT NOT NULL DEFAULT 0 COMMENT '冷启动免费秒数' AFTER billed_seconds,
+    ADD COLUMN idle_seconds BIGINT NOT NULL DEFAULT 0 COMMENT '按空闲折扣计费的秒数' AFTER free_seconds;
+
+ALTER TABLE workers
+    ADD COLUMN billed_execution_ms BIGINT NOT NULL DEFAULT 0 COMMENT '已出账的任务执行时长(ms), 用于计算空闲时长' AFTER total_execution_time_ms;
+
+-- 已有 worker 的历史执行时长视为已出账
+UPDATE workers SET billed_execution_ms = total_execution_time_ms WHERE total_execution_time_ms IS NOT NULL;
@@ -0,0 +1,9 @@
+-- Portal 数据库迁移: Endpoint 成本分摊标签
+-- 创建时间: 2026-10-16
+-- Endpoint 支持 key/value 标签, 计费时快照到流水, 修改标签不影响历史归属
+
+ALTER TABLE user_endpoints
+    ADD COLUMN tags JSON NULL COMMENT '成本分摊标签' AFTER env;
+
+ALTER TABLE billing_transactions
+    ADD COLUMN tags JSON NULL COMMENT '计费时 endpoint 标签快照' AFTER worker_id;
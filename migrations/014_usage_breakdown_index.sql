@@ -0,0 +1,6 @@
+-- Portal 数据库迁移: 用量明细查询索引
+-- 创建时间: 2026-10-16
+-- 用量明细/时间序列按用户及计费周期开始时间过滤
+
+ALTER TABLE billing_transactions
+    ADD INDEX idx_user_period (user_id, billing_period_start);
@@ -0,0 +1,38 @@
+-- Portal 数据库迁移: 分级数据保留与归档
+-- 创建时间: 2026-10-16
+-- CleanupJob 按表配置保留天数, 计费流水删除前写入日汇总, 需要归档的表先上传 gzip 压缩的 JSONL/CSV 文件并记录校验和
+
+CREATE TABLE billing_daily_rollups (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    day DATE NOT NULL COMMENT 'UTC 日期',
+    user_id VARCHAR(100) NOT NULL,
+    org_id VARCHAR(100) NOT NULL DEFAULT '',
+    endpoint_id BIGINT NOT NULL,
+    cluster_id VARCHAR(100) NOT NULL,
+    gpu_type VARCHAR(100) NOT NULL DEFAULT '',
+    amount BIGINT NOT NULL COMMENT '金额 (1000000 = 1 USD)',
+    duration_seconds BIGINT NOT NULL,
+    transaction_count BIGINT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_billing_rollup (day, user_id, org_id, endpoint_id, cluster_id, gpu_type),
+    INDEX idx_rollup_user (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='已清理计费流水的日汇总';
+
+CREATE TABLE data_archives (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    source_table VARCHAR(100) NOT NULL,
+    storage VARCHAR(20) NOT NULL COMMENT 'local, s3',
+    object_key VARCHAR(500) NOT NULL,
+    format VARCHAR(20) NOT NULL COMMENT 'jsonl, csv',
+    first_id BIGINT NOT NULL,
+    last_id BIGINT NOT NULL,
+    row_count INT NOT NULL,
+    min_time TIMESTAMP NOT NULL,
+    max_time TIMESTAMP NOT NULL,
+    cutoff TIMESTAMP NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 VARCHAR(64) NOT NULL COMMENT '压缩文件校验和',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_archive_object (object_key),
+    INDEX idx_archive_table (source_table, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='数据归档文件记录';
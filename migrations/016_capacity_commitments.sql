@@ -0,0 +1,38 @@
+-- Portal 数据库迁移: 预留容量承诺
+-- 创建时间: 2026-10-16
+-- 管理员按组织/规格售卖预留实例小时, BillingJob 先按承诺单价抵扣, 不足部分按需计费; 调度时优先承载预留的集群
+
+CREATE TABLE capacity_commitments (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    org_id VARCHAR(100) NOT NULL,
+    spec_name VARCHAR(100) NOT NULL,
+    cluster_id VARCHAR(100) NOT NULL DEFAULT '' COMMENT '承载预留的集群, 空表示任意集群',
+    total_seconds BIGINT NOT NULL COMMENT '承诺实例时长(秒)',
+    used_seconds BIGINT NOT NULL DEFAULT 0,
+    price_per_hour BIGINT NOT NULL COMMENT '承诺单价 (1000000 = 1 USD), 0 表示已预付',
+    start_at TIMESTAMP NOT NULL,
+    end_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' COMMENT 'active, cancelled',
+    note VARCHAR(500),
+    admin_email VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_commitment_org_spec (org_id, spec_name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='预留容量承诺';
+
+CREATE TABLE commitment_usages (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    commitment_id BIGINT NOT NULL,
+    transaction_id BIGINT NOT NULL,
+    endpoint_id BIGINT NOT NULL,
+    worker_id VARCHAR(255) NOT NULL,
+    seconds BIGINT NOT NULL,
+    amount BIGINT NOT NULL COMMENT '按承诺单价计算的金额',
+    period_start TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_usage_commitment (commitment_id, created_at),
+    INDEX idx_usage_transaction (transaction_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='预留承诺抵扣明细';
+
+ALTER TABLE billing_transactions
+    ADD COLUMN committed_seconds BIGINT NOT NULL DEFAULT 0 COMMENT '预留承诺抵扣秒数' AFTER pricing_override_id;
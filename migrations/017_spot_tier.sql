@@ -0,0 +1,21 @@
+-- Portal 数据库迁移: 抢占式 (spot) 规格档位
+-- 创建时间: 2026-10-16
+-- 规格可配置折扣 spot 价格, endpoint 按需选用; worker 被抢占时计费截止到抢占时间, 进行中任务按 endpoint 设置重新提交或标记失败
+
+ALTER TABLE spec_pricing
+    ADD COLUMN spot_price_per_hour BIGINT NOT NULL DEFAULT 0 COMMENT 'spot 每小时价格 (1000000 = 1 USD), 0 表示不提供' AFTER currency;
+
+ALTER TABLE user_endpoints
+    ADD COLUMN spot BOOLEAN NOT NULL DEFAULT FALSE COMMENT '抢占式档位' AFTER currency,
+    ADD COLUMN preemption_policy VARCHAR(20) NOT NULL DEFAULT 'resubmit' COMMENT '被抢占时进行中任务的处理: resubmit, fail' AFTER spot;
+
+ALTER TABLE workers
+    ADD COLUMN preempted BOOLEAN NOT NULL DEFAULT FALSE AFTER pod_terminated_at,
+    ADD COLUMN preempted_at TIMESTAMP NULL COMMENT '抢占时间, 计费截止于此' AFTER preempted,
+    ADD COLUMN termination_reason VARCHAR(50) NULL AFTER preempted_at;
+
+ALTER TABLE task_routing
+    ADD COLUMN resubmitted_task_id VARCHAR(255) NULL COMMENT 'worker 被抢占后重新提交的任务 ID' AFTER execution_time_ms;
+
+ALTER TABLE billing_transactions
+    ADD COLUMN spot BOOLEAN NOT NULL DEFAULT FALSE COMMENT '抢占式档位' AFTER tags;
@@ -0,0 +1,33 @@
+-- Portal 数据库迁移: 规格计划调价
+-- 创建时间: 2026-10-16
+-- 管理员按生效时间和通知期计划调价, 生效时已有 endpoint 迁移到新价格并记录价格历史, BillingJob 在调价边界拆分计费时段
+
+CREATE TABLE spec_price_changes (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    spec_name VARCHAR(100) NOT NULL,
+    price_per_hour BIGINT NOT NULL COMMENT '新按需价格 (1000000 = 1 USD)',
+    spot_price_per_hour BIGINT NULL COMMENT '新 spot 价格, NULL 表示不变',
+    effective_at TIMESTAMP NOT NULL,
+    notice_days INT NOT NULL COMMENT '提前通知天数',
+    status VARCHAR(20) NOT NULL DEFAULT 'scheduled' COMMENT 'scheduled, applied, cancelled',
+    applied_at TIMESTAMP NULL,
+    affected_endpoints INT DEFAULT 0 COMMENT '迁移到新价格的 endpoint 数',
+    reason VARCHAR(500),
+    admin_email VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_price_change_spec (spec_name),
+    INDEX idx_price_change_due (status, effective_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='规格计划调价';
+
+CREATE TABLE endpoint_price_history (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    endpoint_id BIGINT NOT NULL,
+    change_id BIGINT NOT NULL COMMENT '关联 spec_price_changes.id',
+    old_price_per_hour BIGINT NOT NULL,
+    new_price_per_hour BIGINT NOT NULL,
+    effective_from TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_price_history_endpoint (endpoint_id, effective_from),
+    INDEX idx_price_history_change (change_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='Endpoint 锁定价格变更历史';
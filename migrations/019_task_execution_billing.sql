@@ -0,0 +1,18 @@
+-- Portal 数据库迁移: 按任务执行时长计费
+-- 创建时间: 2026-10-16
+-- endpoint 可选择按任务执行时长计费 (每秒价格创建时锁定), 任务进入终态后由 TaskSyncJob 出账, BillingJob 不再按 worker 时长计费
+
+ALTER TABLE spec_pricing
+    ADD COLUMN task_price_per_second BIGINT NOT NULL DEFAULT 0 COMMENT '按任务计费每秒价格 (1000000 = 1 USD), 0 表示不提供' AFTER spot_price_per_hour;
+
+ALTER TABLE user_endpoints
+    ADD COLUMN billing_mode VARCHAR(20) NOT NULL DEFAULT 'worker_time' COMMENT '计费方式: worker_time, task_execution' AFTER preemption_policy,
+    ADD COLUMN task_price_per_second BIGINT NOT NULL DEFAULT 0 COMMENT '按任务计费每秒价格 (创建时锁定)' AFTER billing_mode;
+
+ALTER TABLE task_routing
+    ADD COLUMN billed_at TIMESTAMP NULL COMMENT '按任务计费的出账时间' AFTER resubmitted_task_id,
+    ADD INDEX idx_task_routing_billed_at (billed_at);
+
+ALTER TABLE billing_transactions
+    ADD COLUMN task_id VARCHAR(255) NULL COMMENT '按任务计费的任务 ID' AFTER worker_id,
+    ADD INDEX idx_task_billing (task_id);
@@ -0,0 +1,69 @@
+-- Portal 数据库迁移: 组织成员及角色
+-- 创建时间: 2026-10-16
+-- endpoint、任务及镜像仓库凭证归属组织, 成员按 owner/admin/developer/viewer 角色访问; 预算和偏好仍按用户
+
+CREATE TABLE IF NOT EXISTS org_members (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    org_id VARCHAR(100) NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    email VARCHAR(255),
+    role VARCHAR(20) NOT NULL COMMENT 'owner, admin, developer, viewer',
+    invited_by VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_org_member (org_id, user_id),
+    INDEX idx_member_user (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='组织成员表';
+
+-- 已有用户按所属组织加入为 developer, 每个组织最早的用户升为 owner
+INSERT IGNORE INTO org_members (org_id, user_id, email, role)
+SELECT org_id, user_id, email, 'developer' FROM user_balances
+WHERE org_id IS NOT NULL AND org_id != '';
+
+INSERT IGNORE INTO org_members (org_id, user_id, role)
+SELECT DISTINCT org_id, user_id, 'developer' FROM user_endpoints
+WHERE org_id IS NOT NULL AND org_id != '';
+
+UPDATE org_members m
+JOIN (
+    SELECT ub.org_id, MIN(ub.user_id) AS user_id
+    FROM user_balances ub
+    JOIN (
+        SELECT org_id, MIN(created_at) AS created_at FROM user_balances
+        WHERE org_id IS NOT NULL AND org_id != ''
+        GROUP BY org_id
+    ) first ON first.org_id = ub.org_id AND first.created_at = ub.created_at
+    GROUP BY ub.org_id
+) o ON o.org_id = m.org_id AND o.user_id = m.user_id
+SET m.role = 'owner';
+
+-- endpoint 名称改为组织内唯一: 同组织重名的 endpoint 追加 ID 后缀
+UPDATE user_endpoints e
+JOIN (
+    SELECT id FROM (
+        SELECT e2.id FROM user_endpoints e2
+        JOIN user_endpoints e3 ON e3.org_id = e2.org_id AND e3.logical_name = e2.logical_name AND e3.id < e2.id
+    ) dup
+) d ON d.id = e.id
+SET e.logical_name = CONCAT(e.logical_name, '-', e.id);
+
+ALTER TABLE user_endpoints
+    DROP INDEX uk_user_endpoint,
+    ADD UNIQUE KEY uk_org_endpoint (org_id, logical_name),
+    ADD INDEX idx_org (org_id);
+
+-- 镜像仓库凭证名称改为组织内唯一
+UPDATE registry_credentials c
+JOIN (
+    SELECT id FROM (
+        SELECT c2.id FROM registry_credentials c2
+        JOIN registry_credentials c3 ON c3.org_id = c2.org_id AND c3.name = c2.name AND c3.id < c2.id
+    ) dup
+) d ON d.id = c.id
+SET c.name = CONCAT(c.name, '-', c.id);
+
+ALTER TABLE registry_credentials
+    DROP INDEX uk_user_name,
+    ADD UNIQUE KEY uk_org_name (org_id, name);
+
+ALTER TABLE task_routing ADD INDEX idx_task_routing_org_id (org_id);
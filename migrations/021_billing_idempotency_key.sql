@@ -0,0 +1,34 @@
+-- Portal 数据库迁移: 计费流水幂等 key
+-- 创建时间: 2026-10-16
+-- billing_transactions 增加 billing_key 唯一约束 (portal-<worker>-<start> / portal-task-<task>), 多副本或重试重复出账由数据库拒绝
+
+ALTER TABLE billing_transactions
+    ADD COLUMN billing_key VARCHAR(255) NULL COMMENT '计费幂等 key, 同主站扣费消息 key' AFTER task_id;
+
+-- 与 Go 侧 billing_period_start.Unix() 一致, 按 UTC 计算 epoch 秒, 不受服务器时区影响
+SET time_zone = '+00:00';
+
+UPDATE billing_transactions
+SET billing_key = IF(task_id IS NOT NULL AND task_id != '',
+    CONCAT('portal-task-', task_id),
+    CONCAT('portal-', worker_id, '-', UNIX_TIMESTAMP(billing_period_start)));
+
+-- 已存在的重复流水 (同一 key 多条) 需人工核对主站扣款后处理, 迁移前可执行以下查询生成报告:
+--   SELECT billing_key, COUNT(*) AS duplicates, MIN(id) AS kept_id,
+--          GROUP_CONCAT(id ORDER BY id) AS transaction_ids, SUM(amount) AS total_amount
+--   FROM billing_transactions GROUP BY billing_key HAVING COUNT(*) > 1;
+-- 迁移后可通过 billing_key LIKE '%#dup-%' 查找
+
+-- 保留每组最早的一条, 其余追加 #dup-<id> 后缀以便唯一约束生效
+UPDATE billing_transactions t
+JOIN (
+    SELECT id FROM (
+        SELECT t2.id FROM billing_transactions t2
+        JOIN billing_transactions t3 ON t3.billing_key = t2.billing_key AND t3.id < t2.id
+    ) dup
+) d ON d.id = t.id
+SET t.billing_key = CONCAT(t.billing_key, '#dup-', t.id);
+
+ALTER TABLE billing_transactions
+    MODIFY COLUMN billing_key VARCHAR(255) NOT NULL COMMENT '计费幂等 key, 同主站扣费消息 key',
+    ADD UNIQUE KEY uk_billing_key (billing_key);
@@ -0,0 +1,45 @@
+-- Portal 数据库迁移: 计费流水导出
+-- 创建时间: 2026-10-16
+-- 按流水创建日期 (UTC) 分区增量导出 billing_transactions 到本地目录或 S3, 记录水位、分片及每日 manifest 状态
+
+CREATE TABLE IF NOT EXISTS ledger_export_watermarks (
+    name VARCHAR(100) PRIMARY KEY COMMENT '导出源, 如 billing_transactions',
+    last_id BIGINT NOT NULL DEFAULT 0 COMMENT '已导出的最大流水 ID',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='流水导出水位表';
+
+CREATE TABLE IF NOT EXISTS ledger_exports (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    day DATE NOT NULL COMMENT '流水创建日期 (UTC)',
+    format VARCHAR(20) NOT NULL COMMENT 'csv, jsonl',
+    status VARCHAR(20) NOT NULL COMMENT 'pending, completed, failed, rerun_requested',
+    part_count INT NOT NULL DEFAULT 0,
+    row_count BIGINT NOT NULL DEFAULT 0,
+    total_amount BIGINT NOT NULL DEFAULT 0 COMMENT '1000000 = 1 USD',
+    manifest_key VARCHAR(500),
+    manifest_sha256 VARCHAR(64),
+    error_message TEXT,
+    exported_at TIMESTAMP NULL COMMENT '最近一次 manifest 写入时间',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_ledger_export_day (day),
+    INDEX idx_ledger_export_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='流水导出日分区表';
+
+CREATE TABLE IF NOT EXISTS ledger_export_parts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    day DATE NOT NULL,
+    object_key VARCHAR(500) NOT NULL,
+    first_id BIGINT NOT NULL,
+    last_id BIGINT NOT NULL,
+    row_count INT NOT NULL,
+    total_amount BIGINT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 VARCHAR(64) NOT NULL COMMENT '压缩文件的校验和',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_ledger_part_object (object_key),
+    INDEX idx_ledger_part_day (day)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='流水导出分片表';
+
+-- 整天重导按 created_at 过滤
+ALTER TABLE billing_transactions ADD INDEX idx_created_at (created_at);
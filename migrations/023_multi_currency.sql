@@ -0,0 +1,47 @@
+-- Portal 数据库迁移: 多币种计价与计费
+-- 创建时间: 2026-10-16
+-- 组织选择计费币种, endpoint 创建时按该币种锁价 (规格标价或按生效汇率换算), 流水/调账/承诺记录币种
+
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    base_currency VARCHAR(10) NOT NULL,
+    quote_currency VARCHAR(10) NOT NULL,
+    rate DECIMAL(24,12) NOT NULL COMMENT '1 base_currency = rate quote_currency',
+    effective_at TIMESTAMP NOT NULL COMMENT '生效时间, 直到同币种对的下一条',
+    admin_email VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_exchange_rate (base_currency, quote_currency, effective_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='汇率表';
+
+CREATE TABLE IF NOT EXISTS spec_currency_prices (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    spec_name VARCHAR(100) NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    price_per_hour BIGINT NOT NULL COMMENT '1000000 = 1 该币种',
+    spot_price_per_hour BIGINT DEFAULT 0,
+    task_price_per_second BIGINT DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_spec_currency (spec_name, currency)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='规格多币种标价表, 未配置的币种按汇率换算基础价格';
+
+CREATE TABLE IF NOT EXISTS org_billing_settings (
+    org_id VARCHAR(100) PRIMARY KEY,
+    currency VARCHAR(10) NOT NULL DEFAULT 'USD' COMMENT '组织已有 endpoint、承诺或流水后不可修改',
+    updated_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='组织计费设置表';
+
+-- 已有数据均为 USD
+ALTER TABLE billing_transactions
+    ADD COLUMN currency VARCHAR(10) NOT NULL DEFAULT 'USD' COMMENT 'endpoint 锁价币种' AFTER amount;
+
+ALTER TABLE billing_adjustments
+    ADD COLUMN currency VARCHAR(10) NOT NULL DEFAULT 'USD' COMMENT '与原始流水币种相同' AFTER amount;
+
+ALTER TABLE capacity_commitments
+    ADD COLUMN currency VARCHAR(10) NOT NULL DEFAULT 'USD' COMMENT '组织计费币种' AFTER price_per_hour;
+
+ALTER TABLE spec_price_changes
+    ADD COLUMN currency VARCHAR(10) NOT NULL DEFAULT 'USD' COMMENT '调价币种, 非规格基础币种时更新该币种标价' AFTER spot_price_per_hour;
@@ -0,0 +1,34 @@
+-- Portal 数据库迁移: endpoint 跨集群部署及故障转移
+-- 创建时间: 2026-10-16
+-- endpoint 可同时部署在多个集群 (按副本分布策略分配副本), 集群下线时自动替换其上的部署
+
+CREATE TABLE IF NOT EXISTS endpoint_placements (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    endpoint_id BIGINT NOT NULL,
+    cluster_id VARCHAR(100) NOT NULL,
+    cluster_spec_name VARCHAR(100) NOT NULL COMMENT '集群内部的 spec 名称',
+    placement_rank INT DEFAULT 0 COMMENT '0 为主集群',
+    replicas INT DEFAULT 0 COMMENT '分配到该集群的目标副本数',
+    min_replicas INT DEFAULT 0,
+    max_replicas INT DEFAULT 0,
+    current_replicas INT DEFAULT 0,
+    status VARCHAR(20) DEFAULT 'active' COMMENT 'active, orphaned (集群下线后已替换, 集群恢复后删除部署)',
+    orphaned_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_endpoint_cluster (endpoint_id, cluster_id),
+    INDEX idx_cluster (cluster_id),
+    INDEX idx_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='endpoint 集群部署表';
+
+ALTER TABLE user_endpoints
+    ADD COLUMN placement_count INT DEFAULT 1 COMMENT '同时部署的集群数' AFTER cluster_id,
+    ADD COLUMN replica_policy VARCHAR(20) DEFAULT 'spread' COMMENT '副本分布策略: spread, primary' AFTER placement_count;
+
+-- 已有 endpoint 均部署在单个集群
+INSERT IGNORE INTO endpoint_placements (endpoint_id, cluster_id, cluster_spec_name, placement_rank, replicas, min_replicas, max_replicas, current_replicas, status)
+SELECT ue.id, ue.cluster_id,
+       COALESCE((SELECT MIN(cs.cluster_spec_name) FROM cluster_specs cs WHERE cs.cluster_id = ue.cluster_id AND cs.spec_name = ue.spec_name), ue.spec_name),
+       0, ue.replicas, ue.min_replicas, ue.max_replicas, ue.current_replicas, 'active'
+FROM user_endpoints ue
+WHERE ue.deleted_at IS NULL AND ue.status != 'deleted';
@@ -0,0 +1,30 @@
+-- Portal 数据库迁移: endpoint 跨集群迁移
+-- 创建时间: 2026-10-16
+-- endpoint 可在线迁移到其他集群 (目标集群就绪后切换任务路由, 排空后删除源部署), 支持按价格/健康状况自动迁移
+
+CREATE TABLE IF NOT EXISTS endpoint_migrations (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    endpoint_id BIGINT NOT NULL,
+    org_id VARCHAR(100),
+    source_cluster_id VARCHAR(100) NOT NULL,
+    target_cluster_id VARCHAR(100) NOT NULL,
+    target_cluster_spec_name VARCHAR(100) COMMENT '目标集群内部的 spec 名称',
+    reason VARCHAR(20) NOT NULL COMMENT 'manual, price, health',
+    status VARCHAR(20) NOT NULL COMMENT 'pending, deploying, draining, completed, failed, cancelled',
+    error TEXT,
+    requested_by VARCHAR(255) COMMENT '发起用户, 自动迁移为 system',
+    started_at TIMESTAMP NULL COMMENT '目标集群部署创建时间',
+    switched_at TIMESTAMP NULL COMMENT '任务路由切换时间',
+    completed_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_endpoint (endpoint_id),
+    INDEX idx_org (org_id),
+    INDEX idx_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='endpoint 跨集群迁移表';
+
+ALTER TABLE endpoint_placements
+    MODIFY COLUMN status VARCHAR(20) DEFAULT 'active' COMMENT 'active, orphaned, provisioning (迁移目标), draining (迁移源)';
+
+ALTER TABLE user_preferences
+    ADD COLUMN auto_migrate_for_health BOOLEAN DEFAULT false COMMENT '所在集群规格不可用时自动迁移' AFTER auto_migrate_for_price;
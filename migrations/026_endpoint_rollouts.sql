@@ -0,0 +1,45 @@
+-- Portal 数据库迁移: endpoint 镜像发布 (canary / blue_green)
+-- 创建时间: 2026-10-17
+-- 新镜像部署为同级 physical endpoint, 按比例分流任务并对比失败率, 自动全量或回滚
+
+CREATE TABLE IF NOT EXISTS endpoint_rollouts (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    endpoint_id BIGINT NOT NULL,
+    org_id VARCHAR(100),
+    strategy VARCHAR(20) NOT NULL COMMENT 'canary, blue_green',
+    cluster_id VARCHAR(100) NOT NULL COMMENT '新版本部署所在集群 (endpoint 主集群)',
+    canary_physical_name VARCHAR(255) COMMENT '新版本的同级 physical endpoint 名称',
+    image VARCHAR(500) NOT NULL,
+    env JSON COMMENT '为空时沿用 endpoint 的环境变量',
+    replicas INT DEFAULT 1,
+    previous_image VARCHAR(500) COMMENT '回滚时恢复',
+    previous_env JSON,
+    traffic_percent INT DEFAULT 10 COMMENT '分流到新版本的任务比例',
+    analysis_minutes INT DEFAULT 10 COMMENT '新版本就绪后的观察时长',
+    min_tasks INT DEFAULT 20 COMMENT '判定所需的新版本最少完成任务数',
+    max_failure_rate_delta DOUBLE DEFAULT 0.05 COMMENT '新版本失败率最多比原版本高出的比例',
+    auto_promote BOOLEAN DEFAULT true COMMENT '观察通过后自动全量',
+    canary_tasks BIGINT DEFAULT 0,
+    canary_failed BIGINT DEFAULT 0,
+    baseline_tasks BIGINT DEFAULT 0,
+    baseline_failed BIGINT DEFAULT 0,
+    status VARCHAR(20) NOT NULL COMMENT 'deploying, progressing, promoting, completed, rolled_back, failed',
+    reason TEXT,
+    requested_by VARCHAR(255),
+    ready_at TIMESTAMP NULL COMMENT '新版本就绪开始接收任务的时间',
+    promoted_at TIMESTAMP NULL,
+    completed_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_endpoint (endpoint_id),
+    INDEX idx_org (org_id),
+    INDEX idx_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='endpoint 镜像发布表';
+
+ALTER TABLE workers
+    ADD COLUMN rollout_id BIGINT NULL COMMENT '所属镜像发布 (新版本 worker)' AFTER cluster_id,
+    ADD INDEX idx_rollout_id (rollout_id);
+
+ALTER TABLE task_routing
+    ADD COLUMN rollout_id BIGINT NULL COMMENT '分流到新版本时的镜像发布 ID',
+    ADD INDEX idx_rollout_id (rollout_id);
@@ -0,0 +1,29 @@
+-- Portal 数据库迁移: endpoint 配置历史
+-- 创建时间: 2026-10-17
+-- 每次修改 endpoint 部署 (image, env, replicas) 或扩缩容配置生成不可变 revision, 支持对比及回滚
+
+CREATE TABLE IF NOT EXISTS endpoint_revisions (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    endpoint_id BIGINT NOT NULL,
+    org_id VARCHAR(100),
+    revision INT NOT NULL COMMENT 'endpoint 内从 1 递增',
+    image VARCHAR(500) NOT NULL,
+    env JSON,
+    replicas INT DEFAULT 0,
+    min_replicas INT DEFAULT 0,
+    max_replicas INT DEFAULT 0,
+    task_timeout INT DEFAULT 0,
+    config JSON COMMENT '其余 autoscaler 配置 (累计下发的全部 key)',
+    source VARCHAR(20) NOT NULL COMMENT 'create, update, config, rollback, rollout',
+    rollback_of INT NULL COMMENT '回滚的目标 revision',
+    author VARCHAR(255) COMMENT '操作用户, 系统操作为 system',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uk_endpoint_revision (endpoint_id, revision),
+    INDEX idx_org (org_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='endpoint 配置历史表';
+
+-- 已有 endpoint 以当前配置作为 revision 1
+INSERT IGNORE INTO endpoint_revisions (endpoint_id, org_id, revision, image, env, replicas, min_replicas, max_replicas, task_timeout, source, author)
+SELECT ue.id, ue.org_id, 1, ue.image, ue.env, ue.replicas, ue.min_replicas, ue.max_replicas, ue.task_timeout, 'create', ue.user_id
+FROM user_endpoints ue
+WHERE ue.deleted_at IS NULL AND ue.status != 'deleted';
@@ -0,0 +1,6 @@
+-- Portal 数据库迁移: 声明式 endpoint 清单
+-- 创建时间: 2026-10-17
+-- 通过清单 apply 修改的 endpoint 记录 manifest 来源的 revision
+
+ALTER TABLE endpoint_revisions
+    MODIFY COLUMN source VARCHAR(20) NOT NULL COMMENT 'create, update, config, rollback, rollout, manifest';
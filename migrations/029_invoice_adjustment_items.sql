@@ -0,0 +1,8 @@
+-- Portal 数据库迁移: 账单计入调账
+-- 创建时间: 2026-10-17
+-- 账单明细增加类型区分用量与调账 (credit/debit), 调账按创建时间归属月份
+
+ALTER TABLE invoice_line_items
+    ADD COLUMN item_type VARCHAR(20) NOT NULL DEFAULT 'usage' COMMENT 'usage, credit, debit' AFTER invoice_id;
+
+ALTER TABLE billing_adjustments ADD INDEX idx_adjustment_org (org_id, created_at);
@@ -0,0 +1,9 @@
+-- Portal 数据库迁移: 计费日汇总区分币种
+-- 创建时间: 2026-10-17
+-- 日汇总按币种分开写入, 不同币种的金额不再相加; 仅汇总计费成功的流水 (已有数据均为 USD)
+
+ALTER TABLE billing_daily_rollups
+    ADD COLUMN currency VARCHAR(10) NOT NULL DEFAULT 'USD' COMMENT '流水币种' AFTER gpu_type,
+    MODIFY COLUMN amount BIGINT NOT NULL COMMENT '金额 (1000000 = 1 Currency)',
+    DROP INDEX uk_billing_rollup,
+    ADD UNIQUE KEY uk_billing_rollup (day, user_id, org_id, endpoint_id, cluster_id, gpu_type, currency);
@@ -0,0 +1,18 @@
+-- Portal 数据库迁移: 预算按组织执行
+-- 创建时间: 2026-10-17
+-- 成员预算在每个组织内分别统计, 超限只停机成员在该组织创建的 endpoint; 告警记录所属组织
+
+ALTER TABLE budget_alerts
+    ADD COLUMN org_id VARCHAR(100) NOT NULL DEFAULT '' AFTER id;
+
+-- 已有告警归属用户所在组织
+UPDATE budget_alerts a
+JOIN user_balances ub ON ub.user_id = a.user_id
+SET a.org_id = ub.org_id
+WHERE ub.org_id IS NOT NULL AND ub.org_id != '';
+
+ALTER TABLE budget_alerts
+    DROP INDEX uk_budget_alert,
+    ADD UNIQUE KEY uk_budget_alert (org_id, user_id, period_type, period_start, threshold),
+    DROP INDEX idx_user_alert,
+    ADD INDEX idx_user_alert (org_id, user_id, created_at);
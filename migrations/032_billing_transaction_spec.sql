@@ -0,0 +1,12 @@
+-- Portal 数据库迁移: 流水记录计费时的规格
+-- 创建时间: 2026-10-17
+-- 按规格统计用量以计费时的规格为准, endpoint 之后更换规格不影响历史流水
+
+ALTER TABLE billing_transactions
+    ADD COLUMN spec_name VARCHAR(100) NOT NULL DEFAULT '' COMMENT '计费时的规格' AFTER tags;
+
+-- 已有流水按 endpoint 当前规格回填
+UPDATE billing_transactions bt
+JOIN user_endpoints ue ON ue.id = bt.endpoint_id
+SET bt.spec_name = ue.spec_name
+WHERE bt.spec_name = '';
@@ -0,0 +1,20 @@
+-- Portal 数据库迁移: 预留承诺按 GPU 小时计量
+-- 创建时间: 2026-10-17
+-- 承诺数量/单价由实例小时改为 GPU 小时 (worker 每秒消耗规格 GPU 数), 已有承诺按规格 GPU 数换算, 总价值不变
+
+UPDATE capacity_commitments c
+JOIN spec_pricing sp ON sp.spec_name = c.spec_name
+SET c.total_seconds = c.total_seconds * sp.gpu_count,
+    c.used_seconds = c.used_seconds * sp.gpu_count,
+    c.price_per_hour = ROUND(c.price_per_hour / sp.gpu_count)
+WHERE sp.gpu_count > 1;
+
+UPDATE commitment_usages u
+JOIN capacity_commitments c ON c.id = u.commitment_id
+JOIN spec_pricing sp ON sp.spec_name = c.spec_name
+SET u.seconds = u.seconds * sp.gpu_count
+WHERE sp.gpu_count > 1;
+
+ALTER TABLE capacity_commitments
+    MODIFY COLUMN total_seconds BIGINT NOT NULL COMMENT '承诺 GPU 时长(秒), CPU 规格为实例时长',
+    MODIFY COLUMN price_per_hour BIGINT NOT NULL COMMENT '承诺每 GPU 小时单价 (1000000 = 1 USD), 0 表示已预付';
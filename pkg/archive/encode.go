@@ -0,0 +1,162 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 归档文件格式
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// ValidateFormat 检查归档文件格式; Parquet 尚未实现, 配置为 parquet 时明确报错而不是回退到其他格式
+func ValidateFormat(format string) error {
+	switch format {
+	case "", FormatJSONL, FormatCSV:
+		return nil
+	case "parquet":
+		return fmt.Errorf("archive format parquet is not supported yet, use %s or %s", FormatCSV, FormatJSONL)
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+// File gzip 压缩后的归档文件
+type File struct {
+	Format string
+	Data   []byte
+	SHA256 string // 压缩后内容的 sha256
+}
+
+// Ext 文件扩展名
+func (f *File) Ext() string {
+	return "." + f.Format + ".gz"
+}
+
+// ChecksumFile sha256sum 格式的校验文件内容
+func (f *File) ChecksumFile(name string) []byte {
+	return []byte(f.SHA256 + "  " + name + "\n")
+}
+
+// Encode 将结构体切片编码为 gzip 压缩的 JSONL 或 CSV (列名取自 json tag)
+func Encode(format string, rows interface{}) (*File, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("rows must be a slice, got %s", v.Kind())
+	}
+	if format == "" {
+		format = FormatJSONL
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	switch format {
+	case FormatJSONL:
+		enc := json.NewEncoder(zw)
+		for i := 0; i < v.Len(); i++ {
+			if err := enc.Encode(v.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+	case FormatCSV:
+		if err := writeCSV(zw, v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ValidateFormat(format)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return &File{Format: format, Data: buf.Bytes(), SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+func writeCSV(w *gzip.Writer, rows reflect.Value) error {
+	elem := rows.Type().Elem()
+	if elem.Kind() != reflect.Struct {
+		return fmt.Errorf("csv rows must be structs, got %s", elem.Kind())
+	}
+
+	// 列: 导出字段的 json 名称
+	var fields []int
+	var header []string
+	for i := 0; i < elem.NumField(); i++ {
+		f := elem.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, i)
+		header = append(header, name)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(fields))
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i)
+		for j, idx := range fields {
+			s, err := csvValue(row.Field(idx))
+			if err != nil {
+				return err
+			}
+			record[j] = s
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	}
+	if (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		return "", nil
+	}
+	// map/JSON 等复杂类型以 JSON 文本存储
+	b, err := json.Marshal(v.Interface())
+	return string(b), err
+}
@@ -0,0 +1,67 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/wavespeedai/waverless-portal/pkg/config"
+)
+
+// 归档存储类型
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// Storage 归档文件存储 (同一 key 重复写入会覆盖, 保证批次重试幂等)
+type Storage interface {
+	Name() string
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+}
+
+// NewStorage 根据配置创建归档存储
+func NewStorage(cfg *config.ArchiveConfig) (Storage, error) {
+	if err := ValidateFormat(cfg.Format); err != nil {
+		return nil, err
+	}
+	switch cfg.Storage {
+	case "", StorageLocal:
+		dir := cfg.LocalDir
+		if dir == "" {
+			dir = "./data/archive"
+		}
+		return &LocalStorage{dir: dir}, nil
+	case StorageS3:
+		s, err := NewS3Storage(&cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive storage %q", cfg.Storage)
+	}
+}
+
+// LocalStorage 本地目录存储
+type LocalStorage struct {
+	dir string
+}
+
+func (s *LocalStorage) Name() string {
+	return StorageLocal
+}
+
+// Put 先写临时文件再重命名, 避免留下不完整的归档文件
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -13,21 +13,23 @@ var GlobalConfig *Config
 
 // Config Portal 配置结构
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	MySQL    MySQLConfig    `mapstructure:"mysql"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	Logger   LoggerConfig   `mapstructure:"logger"`
-	Billing  BillingConfig  `mapstructure:"billing"`
-	MainSite MainSiteConfig `mapstructure:"main_site"`
-	RocketMQ RocketMQConfig `mapstructure:"rocketmq"`
+	Server    ServerConfig    `mapstructure:"server"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	MySQL     MySQLConfig     `mapstructure:"mysql"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	Logger    LoggerConfig    `mapstructure:"logger"`
+	Billing   BillingConfig   `mapstructure:"billing"`
+	Retention RetentionConfig `mapstructure:"retention"`
+	MainSite  MainSiteConfig  `mapstructure:"main_site"`
+	RocketMQ  RocketMQConfig  `mapstructure:"rocketmq"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port int    `mapstructure:"port"`
-	Mode string `mapstructure:"mode"` // debug, release
-	Host string `mapstructure:"host"`
+	Port        int    `mapstructure:"port"`
+	Mode        string `mapstructure:"mode"` // debug, release
+	Host        string `mapstructure:"host"`
+	MetricsPort int    `mapstructure:"metrics_port"` // Prometheus 指标内部监听端口 (不对外暴露), 0 表示不单独监听, 仅可通过管理员接口访问
 }
 
 // JWTConfig JWT 配置
@@ -73,8 +75,89 @@ type LoggerFileConfig struct {
 
 // BillingConfig 计费配置
 type BillingConfig struct {
-	Enabled         bool `mapstructure:"enabled"`
-	IntervalSeconds int  `mapstructure:"interval_seconds"` // 计费间隔(秒)
+	Enabled         bool               `mapstructure:"enabled"`
+	IntervalSeconds int                `mapstructure:"interval_seconds"` // 计费间隔(秒)
+	Outbox          OutboxConfig       `mapstructure:"outbox"`
+	Budget          BudgetConfig       `mapstructure:"budget"`
+	Invoice         InvoiceConfig      `mapstructure:"invoice"`
+	Runway          RunwayConfig       `mapstructure:"runway"`
+	PriceChange     PriceChangeConfig  `mapstructure:"price_change"`
+	LedgerExport    LedgerExportConfig `mapstructure:"ledger_export"`
+}
+
+// LedgerExportConfig 计费流水导出配置 (按天分区写入本地目录或 S3 兼容存储, 供财务/数仓使用)
+type LedgerExportConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	IntervalMinutes int           `mapstructure:"interval_minutes"` // 导出间隔(分钟)
+	BatchSize       int           `mapstructure:"batch_size"`       // 每个分片文件的最大行数
+	SettleSeconds   int           `mapstructure:"settle_seconds"`   // 只导出创建超过该时长的流水, 避免跳过尚未提交的事务
+	Target          ArchiveConfig `mapstructure:"target"`           // 文件格式 (csv/jsonl, 暂不支持 parquet) 及存储 (local/s3)
+}
+
+// PriceChangeConfig 计划调价配置
+type PriceChangeConfig struct {
+	NoticeDays int `mapstructure:"notice_days"` // 调价至少提前通知天数
+}
+
+// RunwayConfig 余额预测与停机宽限配置
+type RunwayConfig struct {
+	AlertThresholdsHours []float64 `mapstructure:"alert_thresholds_hours"` // 剩余可用时长告警阈值(小时)
+	GracePeriodMinutes   int       `mapstructure:"grace_period_minutes"`   // 余额转负后的宽限时长, 0 表示不限时长
+	NegativeAllowance    float64   `mapstructure:"negative_allowance"`     // 允许透支额度(USD), 0 表示不限额度; 两者都为 0 时余额转负立即停机
+}
+
+// InvoiceConfig 月度账单配置
+type InvoiceConfig struct {
+	IntervalSeconds int `mapstructure:"interval_seconds"`  // 刷新草稿账单间隔(秒)
+	CloseDelayHours int `mapstructure:"close_delay_hours"` // 月末后延迟关账的小时数, 等待最后一轮计费完成
+}
+
+// BudgetConfig 用户预算控制配置
+type BudgetConfig struct {
+	WarnThresholds []int  `mapstructure:"warn_thresholds"` // 告警阈值(预算百分比), 达到 100% 时停机
+	Timezone       string `mapstructure:"timezone"`        // 日/月预算周期的时区, 默认 UTC
+}
+
+// OutboxConfig 计费消息投递配置
+type OutboxConfig struct {
+	IntervalSeconds   int `mapstructure:"interval_seconds"`    // 扫描间隔(秒)
+	BatchSize         int `mapstructure:"batch_size"`          // 每次扫描的消息数
+	BaseBackoffSecond int `mapstructure:"base_backoff_second"` // 首次重试间隔(秒), 之后指数增长
+	MaxBackoffSecond  int `mapstructure:"max_backoff_second"`  // 最大重试间隔(秒)
+	MaxAttempts       int `mapstructure:"max_attempts"`        // 超过后标记为 failed (仍按最大间隔继续重试)
+}
+
+// RetentionConfig 数据保留与归档配置
+type RetentionConfig struct {
+	IntervalHours int                             `mapstructure:"interval_hours"` // 清理间隔(小时)
+	BatchSize     int                             `mapstructure:"batch_size"`     // 每批归档/删除的行数
+	Tables        map[string]TableRetentionConfig `mapstructure:"tables"`         // 按表配置, key 为表名
+	Archive       ArchiveConfig                   `mapstructure:"archive"`
+}
+
+// TableRetentionConfig 单表保留策略
+type TableRetentionConfig struct {
+	RetentionDays int  `mapstructure:"retention_days"` // 保留天数, 0 表示永久保留
+	Archive       bool `mapstructure:"archive"`        // 删除前是否归档
+}
+
+// ArchiveConfig 归档文件配置
+type ArchiveConfig struct {
+	Format   string   `mapstructure:"format"`    // jsonl, csv (gzip 压缩)
+	Storage  string   `mapstructure:"storage"`   // local, s3
+	LocalDir string   `mapstructure:"local_dir"` // storage=local 时的目录
+	S3       S3Config `mapstructure:"s3"`
+}
+
+// S3Config S3 兼容存储配置
+type S3Config struct {
+	Endpoint     string `mapstructure:"endpoint"` // 如 https://s3.us-east-1.amazonaws.com 或 http://minio:9000
+	Region       string `mapstructure:"region"`
+	Bucket       string `mapstructure:"bucket"`
+	AccessKey    string `mapstructure:"access_key"`
+	SecretKey    string `mapstructure:"secret_key"`
+	Prefix       string `mapstructure:"prefix"`         // 对象 key 前缀
+	UsePathStyle bool   `mapstructure:"use_path_style"` // MinIO 等需要 path-style
 }
 
 // MainSiteConfig 主站配置
@@ -0,0 +1,65 @@
+package invoice
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+)
+
+// WriteCSV 导出账单明细 CSV (金额单位: USD)
+func WriteCSV(w io.Writer, inv *model.Invoice, items []model.InvoiceLineItem) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{
+		{"invoice_number", inv.InvoiceNumber},
+		{"org_id", inv.OrgID},
+		{"period_start", inv.PeriodStart.UTC().Format("2006-01-02")},
+		{"period_end", inv.PeriodEnd.UTC().Format("2006-01-02")},
+		{"status", inv.Status},
+		{"currency", currency(inv)},
+		{},
+		{"item_type", "endpoint_id", "endpoint_name", "spec_name", "gpu_type", "transactions", "duration_seconds", "hours", "amount"},
+	}
+	for _, item := range items {
+		rows = append(rows, []string{
+			itemType(item),
+			strconv.FormatInt(item.EndpointID, 10),
+			item.EndpointName,
+			item.SpecName,
+			item.GPUType,
+			strconv.FormatInt(item.TransactionCount, 10),
+			strconv.FormatInt(item.DurationSeconds, 10),
+			fmt.Sprintf("%.4f", float64(item.DurationSeconds)/3600),
+			formatAmount(item.Amount, 6),
+		})
+	}
+	rows = append(rows, []string{"total", "", "", "", "", "", strconv.FormatInt(inv.TotalSeconds, 10),
+		fmt.Sprintf("%.4f", float64(inv.TotalSeconds)/3600), formatAmount(inv.TotalAmount, 6)})
+
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// formatAmount 金额转换为 USD 字符串 (1000000 = 1 USD)
+func formatAmount(amount int64, decimals int) string {
+	return strconv.FormatFloat(float64(amount)/1000000, 'f', decimals, 64)
+}
+
+// itemType 明细类型, 兼容新增字段前生成的明细
+func itemType(item model.InvoiceLineItem) string {
+	if item.ItemType == "" {
+		return model.InvoiceItemUsage
+	}
+	return item.ItemType
+}
+
+func currency(inv *model.Invoice) string {
+	if inv.Currency == "" {
+		return "USD"
+	}
+	return inv.Currency
+}
@@ -0,0 +1,129 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+)
+
+// PDF 版面 (A4, 单位: pt), 使用等宽字体 Courier 对齐表格列
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	margin       = 40
+	fontSize     = 9
+	lineHeight   = 12
+	linesPerPage = (pageHeight - 2*margin) / lineHeight
+)
+
+// WritePDF 导出账单 PDF
+func WritePDF(w io.Writer, inv *model.Invoice, items []model.InvoiceLineItem) error {
+	_, err := w.Write(renderPDF(invoiceLines(inv, items)))
+	return err
+}
+
+// invoiceLines 生成账单的文本行
+func invoiceLines(inv *model.Invoice, items []model.InvoiceLineItem) []string {
+	cur := currency(inv)
+	lines := []string{
+		"INVOICE " + inv.InvoiceNumber,
+		"",
+		"Organization: " + inv.OrgID,
+		fmt.Sprintf("Period:       %s - %s (UTC)", inv.PeriodStart.UTC().Format("2006-01-02"), inv.PeriodEnd.UTC().Format("2006-01-02")),
+		"Status:       " + inv.Status,
+		"",
+	}
+
+	header := fmt.Sprintf("%-28s %-18s %-14s %10s %14s", "Endpoint", "Spec", "GPU", "Hours", "Amount ("+cur+")")
+	lines = append(lines, header, strings.Repeat("-", len(header)))
+	for _, item := range items {
+		spec := item.SpecName
+		if t := itemType(item); t != model.InvoiceItemUsage {
+			spec = "Adjustment: " + t
+		}
+		lines = append(lines, fmt.Sprintf("%-28s %-18s %-14s %10.2f %14s",
+			truncate(item.EndpointName, 28), truncate(spec, 18), truncate(item.GPUType, 14),
+			float64(item.DurationSeconds)/3600, formatAmount(item.Amount, 2)))
+	}
+	lines = append(lines, strings.Repeat("-", len(header)))
+	lines = append(lines, fmt.Sprintf("%-62s %10.2f %14s", "Total", float64(inv.TotalSeconds)/3600, formatAmount(inv.TotalAmount, 2)))
+	return lines
+}
+
+// renderPDF 将文本行排版为多页 PDF (PDF 1.4, 内置字体无需嵌入)
+func renderPDF(lines []string) []byte {
+	var pages [][]string
+	for len(lines) > linesPerPage {
+		pages = append(pages, lines[:linesPerPage])
+		lines = lines[linesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// 对象编号: 1 catalog, 2 pages, 3 font, 之后每页 page + content 各一个
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	)
+	for i, pageLines := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", fontSize, lineHeight, margin, pageHeight-margin)
+		for _, line := range pageLines {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", escapeText(line))
+		}
+		fmt.Fprintf(&content, "T*\n(page %d/%d) Tj\nET\n", i+1, len(pages))
+		stream := content.String()
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(stream), stream),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// escapeText 转义 PDF 字符串, 非 ASCII 字符替换为 ?
+func escapeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "~"
+}
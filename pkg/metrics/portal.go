@@ -0,0 +1,101 @@
+package metrics
+
+import "time"
+
+// 后台任务
+var (
+	JobRunDuration = NewHistogramVec("portal_job_run_duration_seconds",
+		"Duration of one background job run.", DefBuckets, "job")
+	JobRuns = NewCounterVec("portal_job_runs_total",
+		"Number of completed background job runs.", "job")
+	JobLastRun = NewGaugeVec("portal_job_last_run_timestamp_seconds",
+		"Unix time the background job last completed a run.", "job")
+	JobItemsProcessed = NewCounterVec("portal_job_items_processed_total",
+		"Items (workers, tasks, endpoints) processed by background jobs.", "job")
+	JobErrors = NewCounterVec("portal_job_errors_total",
+		"Errors encountered by background jobs.", "job")
+)
+
+// 计费 (金额为对应币种的小数金额)
+var (
+	BilledAmount = NewCounterVec("portal_billed_amount_total",
+		"Amount billed, in units of the currency.", "job", "currency")
+	BilledSeconds = NewCounterVec("portal_billed_seconds_total",
+		"Seconds billed.", "job")
+	RunBilledAmount = NewHistogramVec("portal_job_run_billed_amount",
+		"Amount billed per job run, in units of the currency.",
+		[]float64{0, .01, .1, 1, 10, 100, 1000, 10000}, "job", "currency")
+	RunBilledSeconds = NewHistogramVec("portal_job_run_billed_seconds",
+		"Seconds billed per job run.",
+		[]float64{0, 60, 600, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600}, "job")
+)
+
+// MQ
+var (
+	MQSent = NewCounterVec("portal_mq_messages_sent_total",
+		"Messages delivered to the message queue.", "topic", "tag")
+	MQSendFailures = NewCounterVec("portal_mq_send_failures_total",
+		"Failed message queue sends.", "topic", "tag")
+)
+
+// Waverless 集群 API
+var (
+	WaverlessRequestDuration = NewHistogramVec("portal_waverless_request_duration_seconds",
+		"Latency of waverless API calls.", DefBuckets, "cluster", "method")
+	WaverlessRequestErrors = NewCounterVec("portal_waverless_request_errors_total",
+		"Failed waverless API calls (transport errors and HTTP status >= 400).", "cluster", "method")
+)
+
+// JobRun 记录一次后台任务运行: 耗时、处理数及本轮计费量 (按币种)
+type JobRun struct {
+	job     string
+	start   time.Time
+	billing bool
+	seconds int64
+	amounts map[string]int64
+}
+
+// StartJobRun 开始记录一次运行, 结束时调用 Done
+func StartJobRun(job string) *JobRun {
+	return &JobRun{job: job, start: time.Now(), amounts: make(map[string]int64)}
+}
+
+// StartBillingRun 开始记录一次出账运行, 未出账的轮次也记录为 0, 便于发现出账停滞
+func StartBillingRun(job string) *JobRun {
+	r := StartJobRun(job)
+	r.billing = true
+	return r
+}
+
+// Processed 本轮处理了 n 个对象
+func (r *JobRun) Processed(n int) {
+	JobItemsProcessed.Add(float64(n), r.job)
+}
+
+// Error 本轮遇到一次错误
+func (r *JobRun) Error() {
+	JobErrors.Inc(r.job)
+}
+
+// Billed 本轮出账 amount (单位: 1/1000000 currency) 及 seconds 秒 (同一轮内需串行调用)
+func (r *JobRun) Billed(currency string, amount, seconds int64) {
+	r.amounts[currency] += amount
+	r.seconds += seconds
+	BilledAmount.Add(float64(amount)/1000000, r.job, currency)
+	BilledSeconds.Add(float64(seconds), r.job)
+}
+
+// Done 记录本轮耗时及计费量
+func (r *JobRun) Done() {
+	now := time.Now()
+	JobRunDuration.Observe(now.Sub(r.start).Seconds(), r.job)
+	JobRuns.Inc(r.job)
+	JobLastRun.Set(float64(now.Unix()), r.job)
+	if !r.billing {
+		return
+	}
+	RunBilledSeconds.Observe(float64(r.seconds), r.job)
+	for currency, amount := range r.amounts {
+		RunBilledAmount.Observe(float64(amount)/1000000, r.job, currency)
+	}
+}
@@ -3,6 +3,8 @@ package rocketmq
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/apache/rocketmq-client-go/v2"
@@ -15,6 +17,8 @@ import (
 const (
 	TopicMeteringBilling = "TOPIC_METERING_BILLING"
 	TagDeductExec        = "DEDUCT_EXEC"
+	TagDeductTask        = "DEDUCT_TASK"    // 按任务执行时长扣费, 消息带 task_id
+	TagBillingAdjust     = "BILLING_ADJUST" // 管理员调账, Amount 为负表示退款
 )
 
 var globalProducer rocketmq.Producer
@@ -26,10 +30,19 @@ type BillingMessage struct {
 	RequestID   string    `json:"request_id"`   // 幂等 key
 	EndpointID  int64     `json:"endpoint_id"`
 	WorkerID    string    `json:"worker_id"`
-	Amount      int64     `json:"amount"`       // 微美元
+	Amount      int64     `json:"amount"`       // 1/1000000 Currency
+	Currency    string    `json:"currency,omitempty"`
 	DurationSec int64     `json:"duration_sec"` // 计费时长
 	Service     string    `json:"service"`
 	Timestamp   time.Time `json:"timestamp"`
+
+	// 调账消息字段
+	AdjustmentID      int64  `json:"adjustment_id,omitempty"`
+	OriginalRequestID string `json:"original_request_id,omitempty"` // 原始扣费消息的幂等 key
+	Reason            string `json:"reason,omitempty"`
+
+	// 按任务计费消息字段
+	TaskID string `json:"task_id,omitempty"`
 }
 
 // Init 初始化 RocketMQ Producer
@@ -65,35 +78,59 @@ func Close() {
 	}
 }
 
+// Enabled 是否已初始化 Producer
+func Enabled() bool {
+	return globalProducer != nil
+}
+
+// NewBillingPayload 构造计费消息体, 供 outbox 持久化
+func NewBillingPayload(msg *BillingMessage) ([]byte, error) {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return json.Marshal(msg)
+}
+
 // SendBillingMessage 发送计费消息
 func SendBillingMessage(ctx context.Context, msg *BillingMessage) error {
 	if globalProducer == nil {
 		return nil // MQ 未初始化，跳过
 	}
 
-	if msg.Timestamp.IsZero() {
-		msg.Timestamp = time.Now()
+	body, err := NewBillingPayload(msg)
+	if err != nil {
+		return err
 	}
 
-	body, err := json.Marshal(msg)
-	if err != nil {
+	if err := SendRaw(ctx, TopicMeteringBilling, TagDeductExec, msg.RequestID, body); err != nil {
 		return err
 	}
 
+	logger.InfoCtx(ctx, "[RocketMQ] billing message sent: request_id=%s, org_id=%s, amount=%d",
+		msg.RequestID, msg.OrgID, msg.Amount)
+	return nil
+}
+
+// SendRaw 同步发送已序列化的消息 (outbox dispatcher 使用), 未初始化时返回错误
+func SendRaw(ctx context.Context, topic, tag, key string, body []byte) error {
+	if globalProducer == nil {
+		return errors.New("rocketmq producer not initialized")
+	}
+
 	mqMsg := &primitive.Message{
-		Topic: TopicMeteringBilling,
+		Topic: topic,
 		Body:  body,
 	}
-	mqMsg.WithTag(TagDeductExec)
-	mqMsg.WithKeys([]string{msg.RequestID})
+	mqMsg.WithTag(tag)
+	mqMsg.WithKeys([]string{key})
 
-	_, err = globalProducer.SendSync(ctx, mqMsg)
+	result, err := globalProducer.SendSync(ctx, mqMsg)
 	if err != nil {
-		logger.ErrorCtx(ctx, "[RocketMQ] send billing message failed: %v", err)
+		logger.ErrorCtx(ctx, "[RocketMQ] send message failed: key=%s, err=%v", key, err)
 		return err
 	}
-
-	logger.InfoCtx(ctx, "[RocketMQ] billing message sent: request_id=%s, org_id=%s, amount=%d",
-		msg.RequestID, msg.OrgID, msg.Amount)
+	if result.Status != primitive.SendOK {
+		return fmt.Errorf("send message not acked: key=%s, status=%d", key, result.Status)
+	}
 	return nil
 }
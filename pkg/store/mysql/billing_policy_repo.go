@@ -0,0 +1,48 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+type BillingPolicyRepo struct {
+	db *gorm.DB
+}
+
+func NewBillingPolicyRepo(db *gorm.DB) *BillingPolicyRepo {
+	return &BillingPolicyRepo{db: db}
+}
+
+func (r *BillingPolicyRepo) GetByID(ctx context.Context, id int64) (*model.BillingPolicy, error) {
+	var policy model.BillingPolicy
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&policy).Error
+	return &policy, err
+}
+
+// List 列出策略, latestOnly 为 true 时每个名称只返回最新版本
+func (r *BillingPolicyRepo) List(ctx context.Context, latestOnly bool) ([]model.BillingPolicy, error) {
+	var policies []model.BillingPolicy
+	query := r.db.WithContext(ctx)
+	if latestOnly {
+		query = query.Where("version = (SELECT MAX(p2.version) FROM billing_policies p2 WHERE p2.name = billing_policies.name)")
+	}
+	err := query.Order("name, version DESC").Find(&policies).Error
+	return policies, err
+}
+
+func (r *BillingPolicyRepo) Create(ctx context.Context, policy *model.BillingPolicy) error {
+	return r.db.WithContext(ctx).Create(policy).Error
+}
+
+// CreateVersion 创建新版本并将引用旧版本的规格切换到新版本
+func (r *BillingPolicyRepo) CreateVersion(ctx context.Context, oldID int64, policy *model.BillingPolicy) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(policy).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.SpecPricing{}).Where("billing_policy_id = ?", oldID).
+			Update("billing_policy_id", policy.ID).Error
+	})
+}
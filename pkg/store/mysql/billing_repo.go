@@ -2,10 +2,13 @@ package mysql
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type BillingRepo struct {
@@ -16,43 +19,285 @@ func NewBillingRepo(db *gorm.DB) *BillingRepo {
 	return &BillingRepo{db: db}
 }
 
-// Billing transactions
+// ErrDuplicateBilling 相同 billing_key 的流水已存在 (其他副本或之前的重试已出账)
+var ErrDuplicateBilling = errors.New("billing transaction already recorded")
+
+// CreateTransaction 创建计费流水, billing_key 为空时使用 MessageKey; 重复出账返回 ErrDuplicateBilling
 func (r *BillingRepo) CreateTransaction(ctx context.Context, tx *model.BillingTransaction) error {
-	return r.db.WithContext(ctx).Create(tx).Error
+	if tx.BillingKey == "" {
+		tx.BillingKey = tx.MessageKey()
+	}
+	err := r.db.WithContext(ctx).Create(tx).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicateBilling
+	}
+	return err
+}
+
+// GetLastPeriodEnd worker 已出账流水的最晚结束时间, 无流水时返回 nil
+func (r *BillingRepo) GetLastPeriodEnd(ctx context.Context, workerID string) (*time.Time, error) {
+	var end *time.Time
+	err := r.db.WithContext(ctx).Model(&model.BillingTransaction{}).
+		Where("worker_id = ? AND (task_id IS NULL OR task_id = '')", workerID).
+		Select("MAX(billing_period_end)").
+		Scan(&end).Error
+	return end, err
 }
 
 // BillingTransactionWithEndpoint 带 endpoint 信息的计费记录
 type BillingTransactionWithEndpoint struct {
 	model.BillingTransaction
 	EndpointName string `gorm:"column:endpoint_name"`
-	SpecName     string `gorm:"column:spec_name"`
 }
 
-func (r *BillingRepo) ListTransactions(ctx context.Context, userID string, limit, offset int) ([]BillingTransactionWithEndpoint, int64, error) {
+// ListTransactions 列出组织的计费流水
+func (r *BillingRepo) ListTransactions(ctx context.Context, orgID string, limit, offset int) ([]BillingTransactionWithEndpoint, int64, error) {
 	var records []BillingTransactionWithEndpoint
 	var total int64
-	r.db.WithContext(ctx).Model(&model.BillingTransaction{}).Where("user_id = ?", userID).Count(&total)
+	r.db.WithContext(ctx).Model(&model.BillingTransaction{}).Where("org_id = ?", orgID).Count(&total)
 	err := r.db.WithContext(ctx).
 		Table("billing_transactions bt").
-		Select("bt.*, ue.logical_name as endpoint_name, ue.spec_name").
+		Select("bt.*, ue.logical_name as endpoint_name").
 		Joins("LEFT JOIN user_endpoints ue ON bt.endpoint_id = ue.id").
-		Where("bt.user_id = ?", userID).
+		Where("bt.org_id = ?", orgID).
 		Order("bt.created_at DESC").
 		Limit(limit).Offset(offset).
 		Find(&records).Error
 	return records, total, err
 }
 
-func (r *BillingRepo) GetUsageStats(ctx context.Context, userID string, from, to time.Time) (totalAmount int64, totalSeconds int64, err error) {
-	var result struct {
-		TotalAmount  int64 `gorm:"column:total_amount"`
-		TotalSeconds int64 `gorm:"column:total_seconds"`
+// CurrencyAmount 按币种汇总的金额
+type CurrencyAmount struct {
+	Currency string `gorm:"column:currency"`
+	Amount   int64  `gorm:"column:amount"`
+}
+
+// GetMemberUsageByCurrency 按币种统计成员在组织内 (其创建的 endpoint) [from, to] 的计费金额
+func (r *BillingRepo) GetMemberUsageByCurrency(ctx context.Context, orgID, userID string, from, to time.Time) ([]CurrencyAmount, error) {
+	var rows []CurrencyAmount
+	err := r.db.WithContext(ctx).Model(&model.BillingTransaction{}).
+		Select("currency, COALESCE(SUM(amount), 0) as amount").
+		Where("org_id = ? AND user_id = ? AND created_at BETWEEN ? AND ? AND status = ?", orgID, userID, from, to, "success").
+		Group("currency").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// CurrencyUsageStats 按币种汇总的计费金额及时长
+type CurrencyUsageStats struct {
+	Currency     string `gorm:"column:currency"`
+	TotalAmount  int64  `gorm:"column:total_amount"`
+	TotalSeconds int64  `gorm:"column:total_seconds"`
+}
+
+// GetOrgUsageStats 按币种统计组织在 [from, to] 内的计费金额及时长
+func (r *BillingRepo) GetOrgUsageStats(ctx context.Context, orgID string, from, to time.Time) ([]CurrencyUsageStats, error) {
+	var rows []CurrencyUsageStats
+	err := r.db.WithContext(ctx).Model(&model.BillingTransaction{}).
+		Select("currency, COALESCE(SUM(amount), 0) as total_amount, COALESCE(SUM(duration_seconds), 0) as total_seconds").
+		Where("org_id = ? AND created_at BETWEEN ? AND ? AND status = ?", orgID, from, to, "success").
+		Group("currency").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// SumEndpointAmount 汇总 endpoint 在 [from, to) 内的计费金额 (按计费时段开始时间)
+func (r *BillingRepo) SumEndpointAmount(ctx context.Context, endpointID int64, from, to time.Time) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).Model(&model.BillingTransaction{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("endpoint_id = ? AND billing_period_start >= ? AND billing_period_start < ?", endpointID, from, to).
+		Scan(&total).Error
+	return total, err
+}
+
+// TagUsage 按标签值汇总的用量
+type TagUsage struct {
+	TagValue         *string `gorm:"column:tag_value"` // 为空表示流水无该标签
+	Currency         string  `gorm:"column:currency"`
+	Amount           int64   `gorm:"column:amount"`
+	AdjustmentAmount int64   `gorm:"column:adjustment_amount"`
+	DurationSeconds  int64   `gorm:"column:duration_seconds"`
+	TransactionCount int64   `gorm:"column:transaction_count"`
+	EndpointCount    int64   `gorm:"column:endpoint_count"`
+}
+
+// GetUsageByTag 按流水上的标签快照 (tagKey 对应的值) 及币种汇总 [from, to] 内的用量, 调账计入原始流水所属分组;
+// EndpointCount 为该标签值下所有币种的 endpoint 去重数
+func (r *BillingRepo) GetUsageByTag(ctx context.Context, orgID, tagKey string, from, to time.Time) ([]TagUsage, error) {
+	var rows []TagUsage
+	err := r.db.WithContext(ctx).
+		Table("billing_transactions bt").
+		Select(`JSON_UNQUOTE(JSON_EXTRACT(bt.tags, ?)) as tag_value,
+			bt.currency as currency,
+			COALESCE(SUM(bt.amount), 0) as amount,
+			COALESCE(SUM(adj.amount), 0) as adjustment_amount,
+			COALESCE(SUM(bt.duration_seconds), 0) as duration_seconds,
+			COUNT(*) as transaction_count`, `$."`+tagKey+`"`).
+		Joins("LEFT JOIN (SELECT transaction_id, SUM(amount) as amount FROM billing_adjustments GROUP BY transaction_id) adj ON adj.transaction_id = bt.id").
+		Where("bt.org_id = ? AND bt.created_at BETWEEN ? AND ? AND bt.status = ?", orgID, from, to, "success").
+		Group("tag_value, bt.currency").
+		Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return rows, err
+	}
+
+	var counts []struct {
+		TagValue      *string `gorm:"column:tag_value"`
+		EndpointCount int64   `gorm:"column:endpoint_count"`
 	}
 	err = r.db.WithContext(ctx).Model(&model.BillingTransaction{}).
-		Select("COALESCE(SUM(amount), 0) as total_amount, COALESCE(SUM(duration_seconds), 0) as total_seconds").
-		Where("user_id = ? AND created_at BETWEEN ? AND ? AND status = ?", userID, from, to, "success").
-		Scan(&result).Error
-	return result.TotalAmount, result.TotalSeconds, err
+		Select("JSON_UNQUOTE(JSON_EXTRACT(tags, ?)) as tag_value, COUNT(DISTINCT endpoint_id) as endpoint_count", `$."`+tagKey+`"`).
+		Where("org_id = ? AND created_at BETWEEN ? AND ? AND status = ?", orgID, from, to, "success").
+		Group("tag_value").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	byTag := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		byTag[TagValueKey(c.TagValue)] = c.EndpointCount
+	}
+	for i := range rows {
+		rows[i].EndpointCount = byTag[TagValueKey(rows[i].TagValue)]
+	}
+	return rows, nil
+}
+
+// TagValueKey 标签值的 map key (区分未打标签与空字符串)
+func TagValueKey(v *string) string {
+	if v == nil {
+		return "\x00"
+	}
+	return "=" + *v
+}
+
+// Billing outbox
+func (r *BillingRepo) CreateOutbox(ctx context.Context, msg *model.BillingOutbox) error {
+	return r.db.WithContext(ctx).Create(msg).Error
+}
+
+// ListDueOutbox 获取到期待投递的消息 (pending 和 failed 都会继续重试)
+func (r *BillingRepo) ListDueOutbox(ctx context.Context, now time.Time, limit int) ([]model.BillingOutbox, error) {
+	var msgs []model.BillingOutbox
+	err := r.db.WithContext(ctx).
+		Where("status IN ? AND next_retry_at <= ?", []string{model.DeliveryStatusPending, model.DeliveryStatusFailed}, now).
+		Order("next_retry_at").
+		Limit(limit).
+		Find(&msgs).Error
+	return msgs, err
+}
+
+// ClaimOutbox 抢占消息 (多副本部署时避免同一消息被并发投递), 返回是否抢占成功
+func (r *BillingRepo) ClaimOutbox(ctx context.Context, msg *model.BillingOutbox, leaseUntil time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&model.BillingOutbox{}).
+		Where("id = ? AND next_retry_at = ? AND status != ?", msg.ID, msg.NextRetryAt, model.DeliveryStatusSent).
+		Update("next_retry_at", leaseUntil)
+	return result.RowsAffected == 1, result.Error
+}
+
+// MarkOutboxSent 标记消息已投递, 同步更新流水投递状态
+func (r *BillingRepo) MarkOutboxSent(ctx context.Context, msg *model.BillingOutbox, sentAt time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.BillingOutbox{}).Where("id = ?", msg.ID).Updates(map[string]interface{}{
+			"status":     model.DeliveryStatusSent,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"sent_at":    sentAt,
+			"last_error": "",
+		}).Error; err != nil {
+			return err
+		}
+		return updateDeliveryStatus(tx, msg, model.DeliveryStatusSent)
+	})
+}
+
+// MarkOutboxRetry 记录投递失败并安排下次重试, status 为 pending 或 failed
+func (r *BillingRepo) MarkOutboxRetry(ctx context.Context, msg *model.BillingOutbox, status string, nextRetryAt time.Time, lastError string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.BillingOutbox{}).Where("id = ?", msg.ID).Updates(map[string]interface{}{
+			"status":        status,
+			"attempts":      gorm.Expr("attempts + 1"),
+			"next_retry_at": nextRetryAt,
+			"last_error":    lastError,
+		}).Error; err != nil {
+			return err
+		}
+		return updateDeliveryStatus(tx, msg, status)
+	})
+}
+
+// updateDeliveryStatus 同步消息关联的流水或调账记录的投递状态
+func updateDeliveryStatus(tx *gorm.DB, msg *model.BillingOutbox, status string) error {
+	if msg.AdjustmentID > 0 {
+		return tx.Model(&model.BillingAdjustment{}).Where("id = ?", msg.AdjustmentID).
+			Update("delivery_status", status).Error
+	}
+	return tx.Model(&model.BillingTransaction{}).Where("id = ?", msg.TransactionID).
+		Update("delivery_status", status).Error
+}
+
+// Billing adjustments
+
+// GetTransactionForUpdate 获取并锁定计费流水 (需在事务中调用)
+func (r *BillingRepo) GetTransactionForUpdate(ctx context.Context, id int64) (*model.BillingTransaction, error) {
+	var tx model.BillingTransaction
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&tx).Error
+	return &tx, err
+}
+
+func (r *BillingRepo) CreateAdjustment(ctx context.Context, adj *model.BillingAdjustment) error {
+	return r.db.WithContext(ctx).Create(adj).Error
+}
+
+func (r *BillingRepo) GetAdjustmentByKey(ctx context.Context, key string) (*model.BillingAdjustment, error) {
+	var adj model.BillingAdjustment
+	err := r.db.WithContext(ctx).Where("idempotency_key = ?", key).First(&adj).Error
+	return &adj, err
+}
+
+// ListAdjustments 调账记录列表, userID 为空时不过滤
+func (r *BillingRepo) ListAdjustments(ctx context.Context, userID string, limit, offset int) ([]model.BillingAdjustment, int64, error) {
+	var adjs []model.BillingAdjustment
+	var total int64
+	query := r.db.WithContext(ctx).Model(&model.BillingAdjustment{})
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	query.Count(&total)
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&adjs).Error
+	return adjs, total, err
+}
+
+// SumAdjustmentsByTransactions 按原始流水汇总调账金额
+func (r *BillingRepo) SumAdjustmentsByTransactions(ctx context.Context, transactionIDs []int64) (map[int64]int64, error) {
+	sums := make(map[int64]int64)
+	if len(transactionIDs) == 0 {
+		return sums, nil
+	}
+	var rows []struct {
+		TransactionID int64 `gorm:"column:transaction_id"`
+		Amount        int64 `gorm:"column:amount"`
+	}
+	err := r.db.WithContext(ctx).Model(&model.BillingAdjustment{}).
+		Select("transaction_id, SUM(amount) as amount").
+		Where("transaction_id IN ?", transactionIDs).
+		Group("transaction_id").
+		Scan(&rows).Error
+	for _, row := range rows {
+		sums[row.TransactionID] = row.Amount
+	}
+	return sums, err
+}
+
+// GetAdjustmentStats 统计组织在 [from, to] 内的调账金额 (负数为净退款)
+func (r *BillingRepo) GetAdjustmentStats(ctx context.Context, orgID string, from, to time.Time) ([]CurrencyAmount, error) {
+	var rows []CurrencyAmount
+	err := r.db.WithContext(ctx).Model(&model.BillingAdjustment{}).
+		Select("currency, COALESCE(SUM(amount), 0) as amount").
+		Where("org_id = ? AND created_at BETWEEN ? AND ?", orgID, from, to).
+		Group("currency").
+		Scan(&rows).Error
+	return rows, err
 }
 
 // Transaction support
@@ -61,3 +306,113 @@ func (r *BillingRepo) Transaction(ctx context.Context, fn func(tx *BillingRepo,
 		return fn(&BillingRepo{db: tx}, &UserRepo{db: tx})
 	})
 }
+
+// 用量明细可分组的维度
+const (
+	UsageDimEndpoint = "endpoint"
+	UsageDimSpec     = "spec"
+	UsageDimGPUType  = "gpu_type"
+	UsageDimCluster  = "cluster"
+)
+
+var usageDimColumns = map[string]string{
+	UsageDimEndpoint: "bt.endpoint_id",
+	UsageDimSpec:     "bt.spec_name",
+	UsageDimGPUType:  "bt.gpu_type",
+	UsageDimCluster:  "bt.cluster_id",
+}
+
+// TZOffset 时区偏移区间: Unix 秒 Until 之前使用 Offset 秒 (Until 为 0 表示之后全部)
+type TZOffset struct {
+	Until  int64
+	Offset int
+}
+
+// UsageBreakdownQuery 用量明细查询
+type UsageBreakdownQuery struct {
+	OrgID      string
+	From, To   time.Time // 按 billing_period_start 过滤 [From, To)
+	Dimensions []string
+	// 时间桶大小 (秒), 0 表示不按时间分组; 按本地时间切分, Offsets 为时区偏移区间
+	BucketSeconds int64
+	Offsets       []TZOffset
+}
+
+// UsageBreakdownRow 用量明细行
+type UsageBreakdownRow struct {
+	Bucket           *int64 `gorm:"column:bucket"` // 本地时间的桶序号 (本地时间秒 / BucketSeconds)
+	Currency         string `gorm:"column:currency"`
+	EndpointID       int64  `gorm:"column:endpoint_id"`
+	EndpointName     string `gorm:"column:endpoint_name"`
+	SpecName         string `gorm:"column:spec_name"`
+	GPUType          string `gorm:"column:gpu_type"`
+	ClusterID        string `gorm:"column:cluster_id"`
+	Amount           int64  `gorm:"column:amount"`
+	AdjustmentAmount int64  `gorm:"column:adjustment_amount"`
+	DurationSeconds  int64  `gorm:"column:duration_seconds"`
+	TransactionCount int64  `gorm:"column:transaction_count"`
+}
+
+// GetUsageBreakdown 按维度、本地时间桶及币种汇总流水, 调账计入原始流水所在分组
+func (r *BillingRepo) GetUsageBreakdown(ctx context.Context, q *UsageBreakdownQuery) ([]UsageBreakdownRow, error) {
+	selects := []string{
+		"bt.currency as currency",
+		"COALESCE(SUM(bt.amount), 0) as amount",
+		"COALESCE(SUM(adj.amount), 0) as adjustment_amount",
+		"COALESCE(SUM(bt.duration_seconds), 0) as duration_seconds",
+		"COUNT(*) as transaction_count",
+	}
+	groups := []string{"bt.currency"}
+	var args []interface{}
+
+	if q.BucketSeconds > 0 {
+		// 以 session 时间计算的 epoch 秒 (DSN loc=UTC, 与写入时一致)
+		epoch := "TIMESTAMPDIFF(SECOND, '1970-01-01 00:00:00', bt.billing_period_start)"
+		offset := "0"
+		if len(q.Offsets) > 0 {
+			offset = "CASE"
+			for _, o := range q.Offsets {
+				if o.Until == 0 {
+					break
+				}
+				offset += " WHEN " + epoch + " < ? THEN ?"
+				args = append(args, o.Until, o.Offset)
+			}
+			offset += " ELSE ? END"
+			args = append(args, q.Offsets[len(q.Offsets)-1].Offset)
+		}
+		selects = append(selects, "FLOOR(("+epoch+" + "+offset+") / ?) as bucket")
+		args = append(args, q.BucketSeconds)
+		groups = append(groups, "bucket")
+	}
+
+	for _, dim := range q.Dimensions {
+		col, ok := usageDimColumns[dim]
+		if !ok {
+			continue
+		}
+		groups = append(groups, col)
+		switch dim {
+		case UsageDimEndpoint:
+			selects = append(selects, "bt.endpoint_id as endpoint_id", "MAX(ue.logical_name) as endpoint_name")
+		case UsageDimSpec:
+			selects = append(selects, "bt.spec_name as spec_name")
+		case UsageDimGPUType:
+			selects = append(selects, "bt.gpu_type as gpu_type")
+		case UsageDimCluster:
+			selects = append(selects, "bt.cluster_id as cluster_id")
+		}
+	}
+
+	query := r.db.WithContext(ctx).
+		Table("billing_transactions bt").
+		Select(strings.Join(selects, ", "), args...).
+		Joins("LEFT JOIN user_endpoints ue ON bt.endpoint_id = ue.id").
+		Joins("LEFT JOIN (SELECT transaction_id, SUM(amount) as amount FROM billing_adjustments GROUP BY transaction_id) adj ON adj.transaction_id = bt.id").
+		Where("bt.org_id = ? AND bt.billing_period_start >= ? AND bt.billing_period_start < ? AND bt.status = ?", q.OrgID, q.From, q.To, "success")
+	query = query.Group(strings.Join(groups, ", "))
+
+	var rows []UsageBreakdownRow
+	err := query.Scan(&rows).Error
+	return rows, err
+}
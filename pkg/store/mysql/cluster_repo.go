@@ -60,6 +60,13 @@ func (r *ClusterRepo) GetSpecByClusterAndName(ctx context.Context, clusterID, sp
 	return &spec, err
 }
 
+// GetSpecByClusterSpecName 根据集群内部的 spec 名称获取集群规格
+func (r *ClusterRepo) GetSpecByClusterSpecName(ctx context.Context, clusterID, clusterSpecName string) (*model.ClusterSpec, error) {
+	var spec model.ClusterSpec
+	err := r.db.WithContext(ctx).Where("cluster_id = ? AND cluster_spec_name = ?", clusterID, clusterSpecName).First(&spec).Error
+	return &spec, err
+}
+
 func (r *ClusterRepo) ListSpecsByCluster(ctx context.Context, clusterID string) ([]model.ClusterSpec, error) {
 	var specs []model.ClusterSpec
 	err := r.db.WithContext(ctx).Where("cluster_id = ?", clusterID).Find(&specs).Error
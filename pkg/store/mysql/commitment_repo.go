@@ -0,0 +1,92 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CommitmentRepo struct {
+	db *gorm.DB
+}
+
+func NewCommitmentRepo(db *gorm.DB) *CommitmentRepo {
+	return &CommitmentRepo{db: db}
+}
+
+// Commitments 与计费流水同事务的承诺 repo
+func (r *BillingRepo) Commitments() *CommitmentRepo {
+	return &CommitmentRepo{db: r.db}
+}
+
+func (r *CommitmentRepo) Create(ctx context.Context, c *model.CapacityCommitment) error {
+	return r.db.WithContext(ctx).Create(c).Error
+}
+
+func (r *CommitmentRepo) GetByID(ctx context.Context, id int64) (*model.CapacityCommitment, error) {
+	var c model.CapacityCommitment
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&c).Error
+	return &c, err
+}
+
+func (r *CommitmentRepo) Update(ctx context.Context, id int64, updates map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&model.CapacityCommitment{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// List 列出承诺 (orgID 为空表示全部)
+func (r *CommitmentRepo) List(ctx context.Context, orgID string, limit, offset int) ([]model.CapacityCommitment, int64, error) {
+	var list []model.CapacityCommitment
+	var total int64
+	query := r.db.WithContext(ctx).Model(&model.CapacityCommitment{})
+	if orgID != "" {
+		query = query.Where("org_id = ?", orgID)
+	}
+	query.Count(&total)
+	err := query.Order("end_at DESC, id DESC").Limit(limit).Offset(offset).Find(&list).Error
+	return list, total, err
+}
+
+// ListActive 获取组织某规格在 at 时可抵扣的承诺
+func (r *CommitmentRepo) ListActive(ctx context.Context, orgID, specName string, at time.Time) ([]model.CapacityCommitment, error) {
+	var list []model.CapacityCommitment
+	err := r.db.WithContext(ctx).
+		Where("org_id = ? AND spec_name = ? AND status = ? AND start_at <= ? AND end_at > ? AND used_seconds < total_seconds",
+			orgID, specName, model.CommitmentStatusActive, at, at).
+		Order("end_at ASC, id ASC").
+		Find(&list).Error
+	return list, err
+}
+
+// LockNextActive 锁定下一个可抵扣的承诺 (最早到期优先), 没有时返回 gorm.ErrRecordNotFound
+func (r *CommitmentRepo) LockNextActive(ctx context.Context, orgID, specName, clusterID string, at time.Time) (*model.CapacityCommitment, error) {
+	var c model.CapacityCommitment
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("org_id = ? AND spec_name = ? AND status = ? AND start_at <= ? AND end_at > ? AND used_seconds < total_seconds AND (cluster_id = '' OR cluster_id = ?)",
+			orgID, specName, model.CommitmentStatusActive, at, at, clusterID).
+		Order("end_at ASC, id ASC").
+		First(&c).Error
+	return &c, err
+}
+
+// AddUsedSeconds 增加已用秒数
+func (r *CommitmentRepo) AddUsedSeconds(ctx context.Context, id, seconds int64) error {
+	return r.db.WithContext(ctx).Model(&model.CapacityCommitment{}).Where("id = ?", id).
+		Update("used_seconds", gorm.Expr("used_seconds + ?", seconds)).Error
+}
+
+func (r *CommitmentRepo) CreateUsage(ctx context.Context, usage *model.CommitmentUsage) error {
+	return r.db.WithContext(ctx).Create(usage).Error
+}
+
+func (r *CommitmentRepo) ListUsages(ctx context.Context, commitmentID int64, limit, offset int) ([]model.CommitmentUsage, int64, error) {
+	var list []model.CommitmentUsage
+	var total int64
+	query := r.db.WithContext(ctx).Model(&model.CommitmentUsage{}).Where("commitment_id = ?", commitmentID)
+	query.Count(&total)
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&list).Error
+	return list, total, err
+}
@@ -0,0 +1,105 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CurrencyRepo struct {
+	db *gorm.DB
+}
+
+func NewCurrencyRepo(db *gorm.DB) *CurrencyRepo {
+	return &CurrencyRepo{db: db}
+}
+
+// Exchange rates
+
+func (r *CurrencyRepo) CreateRate(ctx context.Context, rate *model.ExchangeRate) error {
+	return r.db.WithContext(ctx).Create(rate).Error
+}
+
+// GetEffectiveRate 获取 at 时刻生效的汇率 (生效时间不晚于 at 的最后一条)
+func (r *CurrencyRepo) GetEffectiveRate(ctx context.Context, base, quote string, at time.Time) (*model.ExchangeRate, error) {
+	var rate model.ExchangeRate
+	err := r.db.WithContext(ctx).
+		Where("base_currency = ? AND quote_currency = ? AND effective_at <= ?", base, quote, at).
+		Order("effective_at DESC").
+		First(&rate).Error
+	return &rate, err
+}
+
+// ListRates 按生效时间倒序列出汇率, base/quote 为空时不过滤
+func (r *CurrencyRepo) ListRates(ctx context.Context, base, quote string, limit, offset int) ([]model.ExchangeRate, int64, error) {
+	var rates []model.ExchangeRate
+	var total int64
+	query := r.db.WithContext(ctx).Model(&model.ExchangeRate{})
+	if base != "" {
+		query = query.Where("base_currency = ?", base)
+	}
+	if quote != "" {
+		query = query.Where("quote_currency = ?", quote)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("effective_at DESC, id DESC").Limit(limit).Offset(offset).Find(&rates).Error
+	return rates, total, err
+}
+
+// Spec currency prices
+
+func (r *CurrencyRepo) GetSpecPrice(ctx context.Context, specName, currency string) (*model.SpecCurrencyPrice, error) {
+	var price model.SpecCurrencyPrice
+	err := r.db.WithContext(ctx).Where("spec_name = ? AND currency = ?", specName, currency).First(&price).Error
+	return &price, err
+}
+
+func (r *CurrencyRepo) ListSpecPrices(ctx context.Context, specName string) ([]model.SpecCurrencyPrice, error) {
+	var prices []model.SpecCurrencyPrice
+	err := r.db.WithContext(ctx).Where("spec_name = ?", specName).Order("currency ASC").Find(&prices).Error
+	return prices, err
+}
+
+// UpsertSpecPrice 创建或更新规格某币种的标价
+func (r *CurrencyRepo) UpsertSpecPrice(ctx context.Context, price *model.SpecCurrencyPrice) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "spec_name"}, {Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price_per_hour", "spot_price_per_hour", "task_price_per_second", "updated_at"}),
+	}).Create(price).Error
+}
+
+func (r *CurrencyRepo) DeleteSpecPrice(ctx context.Context, specName, currency string) (bool, error) {
+	result := r.db.WithContext(ctx).Where("spec_name = ? AND currency = ?", specName, currency).Delete(&model.SpecCurrencyPrice{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Org billing settings
+
+func (r *CurrencyRepo) GetOrgSettings(ctx context.Context, orgID string) (*model.OrgBillingSettings, error) {
+	var settings model.OrgBillingSettings
+	err := r.db.WithContext(ctx).Where("org_id = ?", orgID).First(&settings).Error
+	return &settings, err
+}
+
+func (r *CurrencyRepo) SaveOrgSettings(ctx context.Context, settings *model.OrgBillingSettings) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "org_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"currency", "updated_by", "updated_at"}),
+	}).Create(settings).Error
+}
+
+// OrgHasBillingData 组织是否已有 endpoint、预留承诺或计费流水 (此后计费币种不可修改)
+func (r *CurrencyRepo) OrgHasBillingData(ctx context.Context, orgID string) (bool, error) {
+	var found int
+	err := r.db.WithContext(ctx).Raw(`SELECT
+		EXISTS(SELECT 1 FROM user_endpoints WHERE org_id = ?) OR
+		EXISTS(SELECT 1 FROM capacity_commitments WHERE org_id = ?) OR
+		EXISTS(SELECT 1 FROM billing_transactions WHERE org_id = ?)`, orgID, orgID, orgID).
+		Scan(&found).Error
+	return found > 0, err
+}
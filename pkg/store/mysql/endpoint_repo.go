@@ -21,10 +21,11 @@ func (r *EndpointRepo) GetByID(ctx context.Context, id int64) (*model.UserEndpoi
 	return &endpoint, err
 }
 
-func (r *EndpointRepo) GetByLogicalName(ctx context.Context, userID, logicalName string) (*model.UserEndpoint, error) {
+// GetByLogicalName 按组织及逻辑名称获取 endpoint
+func (r *EndpointRepo) GetByLogicalName(ctx context.Context, orgID, logicalName string) (*model.UserEndpoint, error) {
 	var endpoint model.UserEndpoint
 	err := r.db.WithContext(ctx).
-		Where("user_id = ? AND logical_name = ? AND deleted_at IS NULL", userID, logicalName).
+		Where("org_id = ? AND logical_name = ? AND deleted_at IS NULL", orgID, logicalName).
 		First(&endpoint).Error
 	return &endpoint, err
 }
@@ -46,6 +47,15 @@ func (r *EndpointRepo) ListByUser(ctx context.Context, userID string) ([]model.U
 	return endpoints, err
 }
 
+func (r *EndpointRepo) ListByOrg(ctx context.Context, orgID string) ([]model.UserEndpoint, error) {
+	var endpoints []model.UserEndpoint
+	err := r.db.WithContext(ctx).
+		Where("org_id = ? AND deleted_at IS NULL AND status != 'deleted'", orgID).
+		Order("created_at DESC").
+		Find(&endpoints).Error
+	return endpoints, err
+}
+
 func (r *EndpointRepo) ListAll(ctx context.Context) ([]model.UserEndpoint, error) {
 	var endpoints []model.UserEndpoint
 	err := r.db.WithContext(ctx).
@@ -54,6 +64,15 @@ func (r *EndpointRepo) ListAll(ctx context.Context) ([]model.UserEndpoint, error
 	return endpoints, err
 }
 
+// ListActiveOrgIDs 获取有运行中 (目标副本数大于 0) 或已停机 endpoint 的组织
+func (r *EndpointRepo) ListActiveOrgIDs(ctx context.Context) ([]string, error) {
+	var orgIDs []string
+	err := r.db.WithContext(ctx).Model(&model.UserEndpoint{}).
+		Where("deleted_at IS NULL AND status != 'deleted' AND org_id <> '' AND (replicas > 0 OR status = ?)", model.EndpointStatusSuspended).
+		Distinct().Pluck("org_id", &orgIDs).Error
+	return orgIDs, err
+}
+
 func (r *EndpointRepo) Create(ctx context.Context, endpoint *model.UserEndpoint) error {
 	return r.db.WithContext(ctx).Create(endpoint).Error
 }
@@ -0,0 +1,149 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+// ErrInvoiceFinalized 账单已关账, 不可修改
+var ErrInvoiceFinalized = errors.New("invoice already finalized")
+
+type InvoiceRepo struct {
+	db *gorm.DB
+}
+
+func NewInvoiceRepo(db *gorm.DB) *InvoiceRepo {
+	return &InvoiceRepo{db: db}
+}
+
+func (r *InvoiceRepo) GetByID(ctx context.Context, orgID string, id int64) (*model.Invoice, error) {
+	var invoice model.Invoice
+	err := r.db.WithContext(ctx).Where("id = ? AND org_id = ?", id, orgID).First(&invoice).Error
+	return &invoice, err
+}
+
+func (r *InvoiceRepo) GetByOrgPeriod(ctx context.Context, orgID string, periodStart time.Time) (*model.Invoice, error) {
+	var invoice model.Invoice
+	err := r.db.WithContext(ctx).Where("org_id = ? AND period_start = ?", orgID, periodStart).First(&invoice).Error
+	return &invoice, err
+}
+
+func (r *InvoiceRepo) ListByOrg(ctx context.Context, orgID string, limit, offset int) ([]model.Invoice, int64, error) {
+	var invoices []model.Invoice
+	var total int64
+	r.db.WithContext(ctx).Model(&model.Invoice{}).Where("org_id = ?", orgID).Count(&total)
+	err := r.db.WithContext(ctx).Where("org_id = ?", orgID).
+		Order("period_start DESC").
+		Limit(limit).Offset(offset).
+		Find(&invoices).Error
+	return invoices, total, err
+}
+
+func (r *InvoiceRepo) ListItems(ctx context.Context, invoiceID int64) ([]model.InvoiceLineItem, error) {
+	var items []model.InvoiceLineItem
+	err := r.db.WithContext(ctx).Where("invoice_id = ?", invoiceID).Order("item_type = 'usage' DESC, endpoint_name, spec_name, gpu_type").Find(&items).Error
+	return items, err
+}
+
+// ListOrgsWithUsage 获取 [from, to) 内有计费流水或调账的组织
+func (r *InvoiceRepo) ListOrgsWithUsage(ctx context.Context, from, to time.Time) ([]string, error) {
+	var orgIDs []string
+	err := r.db.WithContext(ctx).Raw(`SELECT org_id FROM billing_transactions
+			WHERE billing_period_start >= ? AND billing_period_start < ? AND status = ? AND org_id <> ''
+		UNION
+		SELECT org_id FROM billing_adjustments
+			WHERE created_at >= ? AND created_at < ? AND org_id <> ''`,
+		from, to, "success", from, to).
+		Scan(&orgIDs).Error
+	return orgIDs, err
+}
+
+// AggregateLineItems 按 endpoint + 规格 + GPU 类型汇总组织在 [from, to) 内的计费流水
+func (r *InvoiceRepo) AggregateLineItems(ctx context.Context, orgID string, from, to time.Time) ([]model.InvoiceLineItem, error) {
+	var items []model.InvoiceLineItem
+	err := r.db.WithContext(ctx).
+		Table("billing_transactions bt").
+		Select(`bt.endpoint_id, COALESCE(MAX(ue.logical_name), '') as endpoint_name, bt.spec_name, bt.gpu_type,
+			SUM(bt.duration_seconds) as duration_seconds, SUM(bt.amount) as amount, COUNT(*) as transaction_count`).
+		Joins("LEFT JOIN user_endpoints ue ON bt.endpoint_id = ue.id").
+		Where("bt.org_id = ? AND bt.billing_period_start >= ? AND bt.billing_period_start < ? AND bt.status = ?", orgID, from, to, "success").
+		Group("bt.endpoint_id, bt.spec_name, bt.gpu_type").
+		Order("endpoint_name, spec_name, bt.gpu_type").
+		Scan(&items).Error
+	for i := range items {
+		items[i].ItemType = model.InvoiceItemUsage
+	}
+	return items, err
+}
+
+// AggregateAdjustments 按 endpoint + 调账类型汇总组织在 [from, to) 内的调账 (以调账时间归属月份)
+func (r *InvoiceRepo) AggregateAdjustments(ctx context.Context, orgID string, from, to time.Time) ([]model.InvoiceLineItem, error) {
+	var items []model.InvoiceLineItem
+	err := r.db.WithContext(ctx).
+		Table("billing_adjustments ba").
+		Select(`ba.type as item_type, ba.endpoint_id, COALESCE(MAX(ue.logical_name), '') as endpoint_name, COALESCE(MAX(ue.spec_name), '') as spec_name,
+			SUM(ba.amount) as amount, COUNT(*) as transaction_count`).
+		Joins("LEFT JOIN user_endpoints ue ON ba.endpoint_id = ue.id").
+		Where("ba.org_id = ? AND ba.created_at >= ? AND ba.created_at < ?", orgID, from, to).
+		Group("ba.endpoint_id, ba.type").
+		Order("endpoint_name, ba.type").
+		Scan(&items).Error
+	return items, err
+}
+
+// SaveDraft 保存草稿账单并整体替换明细, 已关账的账单返回 ErrInvoiceFinalized
+func (r *InvoiceRepo) SaveDraft(ctx context.Context, invoice *model.Invoice, items []model.InvoiceLineItem) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if invoice.ID == 0 {
+			if err := tx.Create(invoice).Error; err != nil {
+				return err
+			}
+		} else {
+			result := tx.Model(&model.Invoice{}).
+				Where("id = ? AND status = ?", invoice.ID, model.InvoiceStatusDraft).
+				Updates(map[string]interface{}{
+					"total_amount":  invoice.TotalAmount,
+					"total_seconds": invoice.TotalSeconds,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrInvoiceFinalized
+			}
+			if err := tx.Where("invoice_id = ?", invoice.ID).Delete(&model.InvoiceLineItem{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for i := range items {
+			items[i].ID = 0
+			items[i].InvoiceID = invoice.ID
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Create(&items).Error
+	})
+}
+
+// Finalize 关账 (仅 draft 状态可关账)
+func (r *InvoiceRepo) Finalize(ctx context.Context, id int64, finalizedAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&model.Invoice{}).
+		Where("id = ? AND status = ?", id, model.InvoiceStatusDraft).
+		Updates(map[string]interface{}{
+			"status":       model.InvoiceStatusFinalized,
+			"finalized_at": finalizedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvoiceFinalized
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrLedgerExportConflict 水位或日分区状态已被其他副本修改, 本次导出结果丢弃
+var ErrLedgerExportConflict = errors.New("ledger export state changed concurrently")
+
+type LedgerExportRepo struct {
+	db *gorm.DB
+}
+
+func NewLedgerExportRepo(db *gorm.DB) *LedgerExportRepo {
+	return &LedgerExportRepo{db: db}
+}
+
+// GetWatermark 获取导出水位, 未导出过时为 0
+func (r *LedgerExportRepo) GetWatermark(ctx context.Context, name string) (*model.LedgerExportWatermark, error) {
+	wm := model.LedgerExportWatermark{Name: name}
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(&wm).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &wm, nil
+	}
+	return &wm, err
+}
+
+// ListTransactionsAfter 按 ID 顺序获取水位之后、创建时间早于 before 的一批流水
+func (r *LedgerExportRepo) ListTransactionsAfter(ctx context.Context, afterID int64, before time.Time, limit int) ([]model.BillingTransaction, error) {
+	var txs []model.BillingTransaction
+	err := r.db.WithContext(ctx).
+		Where("id > ? AND created_at < ?", afterID, before).
+		Order("id ASC").Limit(limit).
+		Find(&txs).Error
+	return txs, err
+}
+
+// ListDayTransactions 按 ID 顺序获取某天 (UTC) 创建的流水, ID 范围 (afterID, maxID]
+func (r *LedgerExportRepo) ListDayTransactions(ctx context.Context, day time.Time, afterID, maxID int64, limit int) ([]model.BillingTransaction, error) {
+	var txs []model.BillingTransaction
+	err := r.db.WithContext(ctx).
+		Where("created_at >= ? AND created_at < ? AND id > ? AND id <= ?", day, day.AddDate(0, 0, 1), afterID, maxID).
+		Order("id ASC").Limit(limit).
+		Find(&txs).Error
+	return txs, err
+}
+
+// CommitParts 在一个事务内记录增量分片并推进水位 (水位须仍为 fromID)
+func (r *LedgerExportRepo) CommitParts(ctx context.Context, name string, fromID, toID int64, format string, parts []model.LedgerExportPart) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.LedgerExportWatermark{Name: name}).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&model.LedgerExportWatermark{}).
+			Where("name = ? AND last_id = ?", name, fromID).
+			Update("last_id", toID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrLedgerExportConflict
+		}
+		return insertParts(tx, format, parts)
+	})
+}
+
+// ReplaceDayParts 重新导出某天: 替换 last_id 不超过 maxID 的分片 (之后的增量分片保留), 日分区须仍为 rerun_requested
+func (r *LedgerExportRepo) ReplaceDayParts(ctx context.Context, day time.Time, maxID int64, format string, parts []model.LedgerExportPart) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.LedgerExport{}).
+			Where("day = ? AND status = ?", day, model.LedgerExportRerunRequested).
+			Updates(map[string]interface{}{"status": model.LedgerExportPending, "format": format})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrLedgerExportConflict
+		}
+		if err := tx.Where("day = ? AND last_id <= ?", day, maxID).Delete(&model.LedgerExportPart{}).Error; err != nil {
+			return err
+		}
+		if err := insertParts(tx, format, parts); err != nil {
+			return err
+		}
+		return refreshDay(tx, day)
+	})
+}
+
+// insertParts 写入分片并刷新所属日分区的汇总, 日分区置为待写 manifest
+func insertParts(tx *gorm.DB, format string, parts []model.LedgerExportPart) error {
+	days := make(map[time.Time]bool)
+	for i := range parts {
+		if err := tx.Create(&parts[i]).Error; err != nil {
+			return err
+		}
+		days[parts[i].Day] = true
+	}
+	for day := range days {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.LedgerExport{
+			Day: day, Format: format, Status: model.LedgerExportPending,
+		}).Error; err != nil {
+			return err
+		}
+		if err := refreshDay(tx, day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshDay 按分片重新汇总日分区 (待重新导出的状态保持不变)
+func refreshDay(tx *gorm.DB, day time.Time) error {
+	return tx.Exec(`UPDATE ledger_exports e SET
+			part_count = (SELECT COUNT(*) FROM ledger_export_parts p WHERE p.day = e.day),
+			row_count = (SELECT COALESCE(SUM(p.row_count), 0) FROM ledger_export_parts p WHERE p.day = e.day),
+			total_amount = (SELECT COALESCE(SUM(p.total_amount), 0) FROM ledger_export_parts p WHERE p.day = e.day),
+			status = IF(e.status = ?, e.status, ?),
+			updated_at = NOW()
+		WHERE e.day = ?`, model.LedgerExportRerunRequested, model.LedgerExportPending, day).Error
+}
+
+// ListDayParts 日分区的全部分片
+func (r *LedgerExportRepo) ListDayParts(ctx context.Context, day time.Time) ([]model.LedgerExportPart, error) {
+	var parts []model.LedgerExportPart
+	err := r.db.WithContext(ctx).Where("day = ?", day).Order("first_id ASC").Find(&parts).Error
+	return parts, err
+}
+
+// ListByStatus 获取指定状态的日分区
+func (r *LedgerExportRepo) ListByStatus(ctx context.Context, statuses ...string) ([]model.LedgerExport, error) {
+	var exports []model.LedgerExport
+	err := r.db.WithContext(ctx).Where("status IN ?", statuses).Order("day ASC").Find(&exports).Error
+	return exports, err
+}
+
+// MarkManifest 记录已写入的 manifest; 写入期间分片有变化时不更新, 下一轮重新生成
+func (r *LedgerExportRepo) MarkManifest(ctx context.Context, export *model.LedgerExport, key, sha string, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&model.LedgerExport{}).
+		Where("day = ? AND status IN ? AND part_count = ? AND row_count = ?",
+			export.Day, []string{model.LedgerExportPending, model.LedgerExportFailed}, export.PartCount, export.RowCount).
+		Updates(map[string]interface{}{
+			"status":          model.LedgerExportCompleted,
+			"manifest_key":    key,
+			"manifest_sha256": sha,
+			"error_message":   "",
+			"exported_at":     at,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkFailed 记录 manifest 写入失败
+func (r *LedgerExportRepo) MarkFailed(ctx context.Context, day time.Time, errMsg string) error {
+	return r.db.WithContext(ctx).Model(&model.LedgerExport{}).
+		Where("day = ? AND status IN ?", day, []string{model.LedgerExportPending, model.LedgerExportFailed}).
+		Updates(map[string]interface{}{"status": model.LedgerExportFailed, "error_message": errMsg}).Error
+}
+
+// RequestRerun 标记某天需要重新导出 (尚无记录时创建)
+func (r *LedgerExportRepo) RequestRerun(ctx context.Context, day time.Time, format string) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"status": model.LedgerExportRerunRequested}),
+	}).Create(&model.LedgerExport{Day: day, Format: format, Status: model.LedgerExportRerunRequested}).Error
+}
+
+// GetByDay 获取日分区
+func (r *LedgerExportRepo) GetByDay(ctx context.Context, day time.Time) (*model.LedgerExport, error) {
+	var export model.LedgerExport
+	err := r.db.WithContext(ctx).Where("day = ?", day).First(&export).Error
+	return &export, err
+}
+
+// List 按日期倒序列出日分区, status 为空时不过滤
+func (r *LedgerExportRepo) List(ctx context.Context, status string, limit, offset int) ([]model.LedgerExport, int64, error) {
+	var exports []model.LedgerExport
+	var total int64
+	query := r.db.WithContext(ctx).Model(&model.LedgerExport{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("day DESC").Limit(limit).Offset(offset).Find(&exports).Error
+	return exports, total, err
+}
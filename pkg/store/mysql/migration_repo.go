@@ -0,0 +1,73 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+type MigrationRepo struct {
+	db *gorm.DB
+}
+
+func NewMigrationRepo(db *gorm.DB) *MigrationRepo {
+	return &MigrationRepo{db: db}
+}
+
+func (r *MigrationRepo) Create(ctx context.Context, m *model.EndpointMigration) error {
+	return r.db.WithContext(ctx).Create(m).Error
+}
+
+func (r *MigrationRepo) GetByID(ctx context.Context, endpointID, id int64) (*model.EndpointMigration, error) {
+	var m model.EndpointMigration
+	err := r.db.WithContext(ctx).Where("id = ? AND endpoint_id = ?", id, endpointID).First(&m).Error
+	return &m, err
+}
+
+// GetInProgress 获取 endpoint 进行中的迁移
+func (r *MigrationRepo) GetInProgress(ctx context.Context, endpointID int64) (*model.EndpointMigration, error) {
+	var m model.EndpointMigration
+	err := r.db.WithContext(ctx).
+		Where("endpoint_id = ? AND status IN ?", endpointID, model.MigrationInProgressStatuses).
+		First(&m).Error
+	return &m, err
+}
+
+// ListInProgress 获取所有进行中的迁移
+func (r *MigrationRepo) ListInProgress(ctx context.Context) ([]model.EndpointMigration, error) {
+	var migrations []model.EndpointMigration
+	err := r.db.WithContext(ctx).
+		Where("status IN ?", model.MigrationInProgressStatuses).
+		Order("id ASC").
+		Find(&migrations).Error
+	return migrations, err
+}
+
+func (r *MigrationRepo) ListByEndpoint(ctx context.Context, endpointID int64, limit int) ([]model.EndpointMigration, error) {
+	var migrations []model.EndpointMigration
+	err := r.db.WithContext(ctx).
+		Where("endpoint_id = ?", endpointID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&migrations).Error
+	return migrations, err
+}
+
+// HasEndedSince endpoint 在 since 之后是否有结束的迁移 (自动迁移冷却)
+func (r *MigrationRepo) HasEndedSince(ctx context.Context, endpointID int64, since time.Time) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.EndpointMigration{}).
+		Where("endpoint_id = ? AND completed_at >= ?", endpointID, since).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Transition 仅在状态仍为 from 时更新, 返回是否更新 (防止多副本重复推进)
+func (r *MigrationRepo) Transition(ctx context.Context, id int64, from string, updates map[string]interface{}) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.EndpointMigration{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
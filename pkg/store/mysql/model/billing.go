@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -9,29 +10,61 @@ type BillingTransaction struct {
 	ID int64 `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
 
 	// 关联信息
-	UserID     string `gorm:"column:user_id;type:varchar(100);not null;index:idx_user_billing" json:"user_id"`
-	OrgID      string `gorm:"column:org_id;type:varchar(100);index:idx_org_billing" json:"org_id"`
+	UserID     string `gorm:"column:user_id;type:varchar(100);not null;index:idx_user_billing;index:idx_user_period" json:"user_id"`
+	OrgID      string `gorm:"column:org_id;type:varchar(100);index:idx_org_billing;index:idx_org_period" json:"org_id"`
 	EndpointID int64  `gorm:"column:endpoint_id;not null;index:idx_endpoint_billing" json:"endpoint_id"`
 	ClusterID  string `gorm:"column:cluster_id;type:varchar(100);not null;index:idx_cluster_billing" json:"cluster_id"`
 	WorkerID   string `gorm:"column:worker_id;type:varchar(255);not null;index:idx_worker_billing" json:"worker_id"`
 
+	// 按任务执行时长计费的任务 ID (按 worker 时长计费时为空)
+	TaskID string `gorm:"column:task_id;type:varchar(255);index:idx_task_billing" json:"task_id"`
+
+	// 计费幂等 key (同 MessageKey), 数据库唯一约束保证同一 worker 时段/任务只出账一次
+	BillingKey string `gorm:"column:billing_key;type:varchar(255);not null;uniqueIndex:uk_billing_key" json:"billing_key"`
+
+	// 计费时 endpoint 标签快照 (标签修改不影响历史流水)
+	Tags StringMap `gorm:"column:tags;type:json" json:"tags"`
+
+	// 计费时 endpoint 的规格快照 (规格变更不影响历史流水)
+	SpecName string `gorm:"column:spec_name;type:varchar(100);not null;default:''" json:"spec_name"`
+
 	// GPU 规格信息
 	GPUType  string `gorm:"column:gpu_type;type:varchar(100)" json:"gpu_type"`
 	GPUCount int    `gorm:"column:gpu_count" json:"gpu_count"`
 
 	// 计费周期
-	BillingPeriodStart time.Time `gorm:"column:billing_period_start;not null;index:idx_worker_billing" json:"billing_period_start"`
+	BillingPeriodStart time.Time `gorm:"column:billing_period_start;not null;index:idx_worker_billing;index:idx_org_period;index:idx_user_period" json:"billing_period_start"`
 	BillingPeriodEnd   time.Time `gorm:"column:billing_period_end;not null" json:"billing_period_end"`
 	DurationSeconds    int64     `gorm:"column:duration_seconds;not null" json:"duration_seconds"`
 
-	// 计费信息 (单位: 1/1000000 USD, 即 1000000 = 1 USD)
-	PricePerHour int64 `gorm:"column:price_per_hour;type:bigint;not null" json:"price_per_hour"` // 每小时价格
-	Amount       int64 `gorm:"column:amount;type:bigint;not null" json:"amount"`                 // 本次扣费金额
+	// 计费信息 (单位: 1/1000000 Currency, 如 1000000 = 1 USD)
+	PricePerHour int64  `gorm:"column:price_per_hour;type:bigint;not null" json:"price_per_hour"` // 每小时价格
+	Amount       int64  `gorm:"column:amount;type:bigint;not null" json:"amount"`                 // 本次扣费金额
+	Currency     string `gorm:"column:currency;type:varchar(10);not null;default:'USD'" json:"currency"`
+
+	// 抢占式 (spot) 档位的 worker
+	Spot bool `gorm:"column:spot;default:false" json:"spot"`
+
+	// 本时段使用的集群覆盖价格 (为空表示 endpoint 锁定价格)
+	PricingOverrideID *int64 `gorm:"column:pricing_override_id" json:"pricing_override_id"`
+
+	// 由预留容量承诺抵扣的 worker 秒数 (抵扣部分按承诺单价计入 Amount, 明细见 commitment_usages, 按 GPU 秒记录)
+	CommittedSeconds int64 `gorm:"column:committed_seconds;default:0" json:"committed_seconds"`
+
+	// 计费策略 (为空表示默认策略) 及策略作用结果
+	BillingPolicyID      *int64 `gorm:"column:billing_policy_id" json:"billing_policy_id"`
+	BillingPolicyVersion int    `gorm:"column:billing_policy_version;default:0" json:"billing_policy_version"`
+	BilledSeconds        int64  `gorm:"column:billed_seconds;default:0" json:"billed_seconds"` // 实际计费秒数 (含取整/最低消费, 不含免费时长)
+	FreeSeconds          int64  `gorm:"column:free_seconds;default:0" json:"free_seconds"`     // 冷启动免费秒数
+	IdleSeconds          int64  `gorm:"column:idle_seconds;default:0" json:"idle_seconds"`     // 按空闲折扣计费的秒数
 
 	// 扣费状态
 	Status       string `gorm:"column:status;type:varchar(50);default:'success'" json:"status"`
 	ErrorMessage string `gorm:"column:error_message;type:text" json:"error_message"`
 
+	// 主站扣款消息投递状态: pending, sent, failed
+	DeliveryStatus string `gorm:"column:delivery_status;type:varchar(20);default:'pending';index:idx_delivery_status" json:"delivery_status"`
+
 	// 时间戳
 	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;index:idx_user_billing,idx_org_billing,idx_endpoint_billing,idx_cluster_billing" json:"created_at"`
 }
@@ -40,3 +73,79 @@ type BillingTransaction struct {
 func (BillingTransaction) TableName() string {
 	return "billing_transactions"
 }
+
+// MessageKey 主站扣费消息的幂等 key
+func (t *BillingTransaction) MessageKey() string {
+	if t.TaskID != "" {
+		return fmt.Sprintf("portal-task-%s", t.TaskID)
+	}
+	return fmt.Sprintf("portal-%s-%d", t.WorkerID, t.BillingPeriodStart.Unix())
+}
+
+// 投递状态
+const (
+	DeliveryStatusPending = "pending"
+	DeliveryStatusSent    = "sent"
+	DeliveryStatusFailed  = "failed"
+)
+
+// BillingOutbox 计费消息发件箱 (与流水同事务写入, 由 dispatcher 异步投递到 RocketMQ)
+type BillingOutbox struct {
+	ID            int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	TransactionID int64  `gorm:"column:transaction_id;not null;index:idx_outbox_transaction" json:"transaction_id"`        // 关联 billing_transactions.id
+	AdjustmentID  int64  `gorm:"column:adjustment_id;not null;default:0;index:idx_outbox_adjustment" json:"adjustment_id"` // 关联 billing_adjustments.id, 0 表示计费流水消息
+	Topic         string `gorm:"column:topic;type:varchar(100);not null" json:"topic"`
+	Tag           string `gorm:"column:tag;type:varchar(100);not null" json:"tag"`
+	MessageKey    string `gorm:"column:message_key;type:varchar(255);not null;uniqueIndex:uk_message_key" json:"message_key"` // 幂等 key
+	Payload       string `gorm:"column:payload;type:text;not null" json:"payload"`                                            // 消息体 JSON
+
+	// 投递状态
+	Status      string     `gorm:"column:status;type:varchar(20);default:'pending';index:idx_outbox_due" json:"status"` // pending, sent, failed
+	Attempts    int        `gorm:"column:attempts;default:0" json:"attempts"`
+	NextRetryAt time.Time  `gorm:"column:next_retry_at;not null;index:idx_outbox_due" json:"next_retry_at"`
+	LastError   string     `gorm:"column:last_error;type:text" json:"last_error"`
+	SentAt      *time.Time `gorm:"column:sent_at" json:"sent_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (BillingOutbox) TableName() string {
+	return "billing_outbox"
+}
+
+// 调账类型
+const (
+	AdjustmentTypeCredit = "credit" // 退款/赠送, Amount 为负
+	AdjustmentTypeDebit  = "debit"  // 补扣, Amount 为正
+)
+
+// BillingAdjustment 管理员调账记录 (关联原始计费流水, 只增不改)
+type BillingAdjustment struct {
+	ID            int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	TransactionID int64  `gorm:"column:transaction_id;not null;index:idx_adjustment_transaction" json:"transaction_id"` // 原始 billing_transactions.id
+	UserID        string `gorm:"column:user_id;type:varchar(100);not null;index:idx_adjustment_user" json:"user_id"`
+	OrgID         string `gorm:"column:org_id;type:varchar(100);index:idx_adjustment_org" json:"org_id"`
+	EndpointID    int64  `gorm:"column:endpoint_id;not null" json:"endpoint_id"`
+	WorkerID      string `gorm:"column:worker_id;type:varchar(255)" json:"worker_id"`
+
+	// 调账金额 (单位: 1/1000000 Currency, 与原始流水币种相同), 负数为退款, 正数为补扣
+	Type     string `gorm:"column:type;type:varchar(20);not null" json:"type"` // credit, debit
+	Amount   int64  `gorm:"column:amount;type:bigint;not null" json:"amount"`
+	Currency string `gorm:"column:currency;type:varchar(10);not null;default:'USD'" json:"currency"`
+
+	Reason     string `gorm:"column:reason;type:varchar(500);not null" json:"reason"`
+	AdminEmail string `gorm:"column:admin_email;type:varchar(255);not null" json:"admin_email"`
+
+	// 主站消息幂等 key 及投递状态
+	IdempotencyKey string `gorm:"column:idempotency_key;type:varchar(255);not null;uniqueIndex:uk_adjustment_key" json:"idempotency_key"`
+	DeliveryStatus string `gorm:"column:delivery_status;type:varchar(20);default:'pending'" json:"delivery_status"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;index:idx_adjustment_user;index:idx_adjustment_org" json:"created_at"`
+}
+
+// TableName 表名
+func (BillingAdjustment) TableName() string {
+	return "billing_adjustments"
+}
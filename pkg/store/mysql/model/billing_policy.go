@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+)
+
+// 计费取整方式
+const (
+	BillingRoundingSecond = "second" // 按秒计费
+	BillingRoundingMinute = "minute" // 按分钟计费, worker 结束时不足一分钟按一分钟
+)
+
+// BillingPolicy 计费策略 (挂在 SpecPricing 上; 只增不改, 修改即生成新版本)
+type BillingPolicy struct {
+	ID      int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Name    string `gorm:"column:name;type:varchar(100);not null;uniqueIndex:uk_policy_version" json:"name"`
+	Version int    `gorm:"column:version;not null;uniqueIndex:uk_policy_version" json:"version"`
+
+	// 取整: second, minute
+	Rounding string `gorm:"column:rounding;type:varchar(20);not null;default:'second'" json:"rounding"`
+
+	// 运行中 worker 累计满多少秒才出账 (已终止的 worker 立即出账)
+	MinBillableSeconds int64 `gorm:"column:min_billable_seconds;not null;default:60" json:"min_billable_seconds"`
+
+	// 每个 worker 生命周期的最低计费秒数, worker 结束时不足部分补足
+	MinimumChargeSeconds int64 `gorm:"column:minimum_charge_seconds;not null;default:0" json:"minimum_charge_seconds"`
+
+	// 冷启动免费时长上限 (秒), 实际免费时长取 min(上限, ColdStartDurationMs)
+	ColdStartFreeSeconds int64 `gorm:"column:cold_start_free_seconds;not null;default:0" json:"cold_start_free_seconds"`
+
+	// 空闲时长折扣 (0-100, 0 表示不打折), 空闲时长 = 计费时长 - 任务执行时长
+	IdleDiscountPercent int `gorm:"column:idle_discount_percent;not null;default:0" json:"idle_discount_percent"`
+
+	Description string    `gorm:"column:description;type:varchar(500)" json:"description"`
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// TableName 表名
+func (BillingPolicy) TableName() string {
+	return "billing_policies"
+}
+
+// DefaultBillingPolicy 规格未配置策略时使用: 按秒计费, 运行中满 60 秒出账, 金额向下取整
+func DefaultBillingPolicy() *BillingPolicy {
+	return &BillingPolicy{Name: "default", Rounding: BillingRoundingSecond, MinBillableSeconds: 60}
+}
+
+// RoundingUnit 计费取整单位 (秒)
+func (p *BillingPolicy) RoundingUnit() int64 {
+	if p.Rounding == BillingRoundingMinute {
+		return 60
+	}
+	return 1
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// 预算周期
+const (
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodMonthly = "monthly"
+)
+
+// BudgetAlert 预算告警记录 (成员在同一组织同一周期同一阈值只记录一次)
+type BudgetAlert struct {
+	ID          int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	OrgID       string    `gorm:"column:org_id;type:varchar(100);not null;default:'';uniqueIndex:uk_budget_alert;index:idx_user_alert" json:"org_id"`
+	UserID      string    `gorm:"column:user_id;type:varchar(100);not null;uniqueIndex:uk_budget_alert;index:idx_user_alert" json:"user_id"`
+	PeriodType  string    `gorm:"column:period_type;type:varchar(20);not null;uniqueIndex:uk_budget_alert" json:"period_type"` // daily, monthly
+	PeriodStart time.Time `gorm:"column:period_start;not null;uniqueIndex:uk_budget_alert" json:"period_start"`
+	Threshold   int       `gorm:"column:threshold;not null;uniqueIndex:uk_budget_alert" json:"threshold"` // 百分比, 100 表示超限
+
+	// 触发时的消费与预算 (单位: 1/1000000 组织计费币种)
+	Spent       int64 `gorm:"column:spent;type:bigint;not null" json:"spent"`
+	BudgetLimit int64 `gorm:"column:budget_limit;type:bigint;not null" json:"budget_limit"`
+
+	Action string `gorm:"column:action;type:varchar(20);not null" json:"action"` // warn, suspend
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;index:idx_user_alert" json:"created_at"`
+}
+
+// TableName 表名
+func (BudgetAlert) TableName() string {
+	return "budget_alerts"
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"time"
+)
+
+// 预留容量承诺状态
+const (
+	CommitmentStatusActive    = "active"
+	CommitmentStatusCancelled = "cancelled"
+)
+
+// CapacityCommitment 预留容量承诺: 组织按折扣价预购某规格的 GPU 小时数 (CPU 规格按实例小时), 计费时优先抵扣,
+// 抵扣部分按承诺单价随流水向主站扣款, 单价为 0 表示已预付不再扣款
+type CapacityCommitment struct {
+	ID       int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	OrgID    string `gorm:"column:org_id;type:varchar(100);not null;index:idx_commitment_org_spec" json:"org_id"`
+	SpecName string `gorm:"column:spec_name;type:varchar(100);not null;index:idx_commitment_org_spec" json:"spec_name"`
+
+	// 承载预留的集群, 为空表示任意集群; 非空时只抵扣该集群上的 worker, 调度时优先该集群
+	ClusterID string `gorm:"column:cluster_id;type:varchar(100);not null;default:''" json:"cluster_id"`
+
+	// 承诺数量及已用量 (GPU 秒, worker 每秒消耗规格 GPU 数)
+	TotalSeconds int64 `gorm:"column:total_seconds;not null" json:"total_seconds"`
+	UsedSeconds  int64 `gorm:"column:used_seconds;not null;default:0" json:"used_seconds"`
+
+	// 承诺内每 GPU 小时单价 (单位: 1/1000000 Currency, 0 表示已预付), 币种为组织计费币种
+	PricePerHour int64  `gorm:"column:price_per_hour;type:bigint;not null" json:"price_per_hour"`
+	Currency     string `gorm:"column:currency;type:varchar(10);not null;default:'USD'" json:"currency"`
+
+	// 期限 [StartAt, EndAt)
+	StartAt time.Time `gorm:"column:start_at;not null" json:"start_at"`
+	EndAt   time.Time `gorm:"column:end_at;not null" json:"end_at"`
+
+	Status     string `gorm:"column:status;type:varchar(20);not null;default:'active'" json:"status"`
+	Note       string `gorm:"column:note;type:varchar(500)" json:"note"`
+	AdminEmail string `gorm:"column:admin_email;type:varchar(255)" json:"admin_email"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (CapacityCommitment) TableName() string {
+	return "capacity_commitments"
+}
+
+// RemainingSeconds 剩余可抵扣秒数
+func (c *CapacityCommitment) RemainingSeconds() int64 {
+	if c.UsedSeconds >= c.TotalSeconds {
+		return 0
+	}
+	return c.TotalSeconds - c.UsedSeconds
+}
+
+// ActiveAt 在时间 t 是否可抵扣
+func (c *CapacityCommitment) ActiveAt(t time.Time) bool {
+	return c.Status == CommitmentStatusActive && !t.Before(c.StartAt) && t.Before(c.EndAt) && c.RemainingSeconds() > 0
+}
+
+// CommitmentUsage 承诺抵扣明细 (每条计费流水一条)
+type CommitmentUsage struct {
+	ID            int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	CommitmentID  int64     `gorm:"column:commitment_id;not null;index:idx_usage_commitment" json:"commitment_id"`
+	TransactionID int64     `gorm:"column:transaction_id;not null;index:idx_usage_transaction" json:"transaction_id"`
+	EndpointID    int64     `gorm:"column:endpoint_id;not null" json:"endpoint_id"`
+	WorkerID      string    `gorm:"column:worker_id;type:varchar(255);not null" json:"worker_id"`
+	Seconds       int64     `gorm:"column:seconds;not null" json:"seconds"`           // GPU 秒
+	Amount        int64     `gorm:"column:amount;type:bigint;not null" json:"amount"` // 按承诺单价计算的金额 (计入流水金额)
+	PeriodStart   time.Time `gorm:"column:period_start;not null" json:"period_start"`
+	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime;index:idx_usage_commitment" json:"created_at"`
+}
+
+// TableName 表名
+func (CommitmentUsage) TableName() string {
+	return "commitment_usages"
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"time"
+)
+
+// DefaultCurrency 未配置计费币种时使用的币种
+const DefaultCurrency = "USD"
+
+// ExchangeRate 汇率: 1 BaseCurrency = Rate QuoteCurrency, 自 EffectiveAt 起生效直到下一条
+type ExchangeRate struct {
+	ID            int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	BaseCurrency  string    `gorm:"column:base_currency;type:varchar(10);not null;uniqueIndex:uk_exchange_rate" json:"base_currency"`
+	QuoteCurrency string    `gorm:"column:quote_currency;type:varchar(10);not null;uniqueIndex:uk_exchange_rate" json:"quote_currency"`
+	Rate          float64   `gorm:"column:rate;type:decimal(24,12);not null" json:"rate"`
+	EffectiveAt   time.Time `gorm:"column:effective_at;not null;uniqueIndex:uk_exchange_rate" json:"effective_at"`
+	AdminEmail    string    `gorm:"column:admin_email;type:varchar(255)" json:"admin_email"`
+	CreatedAt     time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// TableName 表名
+func (ExchangeRate) TableName() string {
+	return "exchange_rates"
+}
+
+// SpecCurrencyPrice 规格在非基础币种下的标价 (单位: 1/1000000 该币种), 未配置的币种按汇率换算基础价格
+type SpecCurrencyPrice struct {
+	ID                 int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	SpecName           string    `gorm:"column:spec_name;type:varchar(100);not null;uniqueIndex:uk_spec_currency" json:"spec_name"`
+	Currency           string    `gorm:"column:currency;type:varchar(10);not null;uniqueIndex:uk_spec_currency" json:"currency"`
+	PricePerHour       int64     `gorm:"column:price_per_hour;type:bigint;not null" json:"price_per_hour"`
+	SpotPricePerHour   int64     `gorm:"column:spot_price_per_hour;type:bigint;default:0" json:"spot_price_per_hour"`
+	TaskPricePerSecond int64     `gorm:"column:task_price_per_second;type:bigint;default:0" json:"task_price_per_second"`
+	CreatedAt          time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt          time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (SpecCurrencyPrice) TableName() string {
+	return "spec_currency_prices"
+}
+
+// OrgBillingSettings 组织计费设置: 计费币种 (endpoint 创建时锁定, 组织已有 endpoint、承诺或流水后不可修改)
+type OrgBillingSettings struct {
+	OrgID     string    `gorm:"column:org_id;type:varchar(100);primaryKey" json:"org_id"`
+	Currency  string    `gorm:"column:currency;type:varchar(10);not null;default:'USD'" json:"currency"`
+	UpdatedBy string    `gorm:"column:updated_by;type:varchar(255)" json:"updated_by"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (OrgBillingSettings) TableName() string {
+	return "org_billing_settings"
+}
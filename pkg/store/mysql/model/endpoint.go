@@ -30,15 +30,66 @@ func (j *JSONMap) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, j)
 }
 
+// StringMap 字符串键值 JSON 类型 (如成本分摊标签)
+type StringMap map[string]string
+
+// Value 实现 driver.Valuer 接口
+func (m StringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// Scan 实现 sql.Scanner 接口
+func (m *StringMap) Scan(value interface{}) error {
+	if value == nil {
+		*m = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(bytes, m)
+}
+
+// Endpoint 状态
+const (
+	EndpointStatusRunning   = "running"
+	EndpointStatusSuspended = "suspended"
+)
+
+// spot worker 被抢占时进行中任务的处理方式
+const (
+	PreemptionPolicyResubmit = "resubmit" // 重新提交到 endpoint
+	PreemptionPolicyFail     = "fail"     // 标记失败
+)
+
+// TerminationReasonPreempted worker 因 spot 抢占终止
+const TerminationReasonPreempted = "preempted"
+
+// TaskStatusPreempted 所在 worker 被抢占且已重新提交的任务状态
+const TaskStatusPreempted = "PREEMPTED"
+
+// Endpoint 计费方式
+const (
+	BillingModeWorkerTime    = "worker_time"    // 按 worker 运行时长计费 (默认)
+	BillingModeTaskExecution = "task_execution" // 按任务执行时长计费, 空闲 worker 不计费
+)
+
+// TaskTerminalStatuses 任务终态, 按任务计费的 endpoint 在任务进入终态后出账
+var TaskTerminalStatuses = []string{"COMPLETED", "FAILED", "CANCELLED", "TIMEOUT"}
+
 // UserEndpoint 用户 Endpoint 表
 type UserEndpoint struct {
 	ID     int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
-	UserID string `gorm:"column:user_id;type:varchar(100);not null;uniqueIndex:uk_user_endpoint;index:idx_user" json:"user_id"` // 主站用户 UUID
-	OrgID  string `gorm:"column:org_id;type:varchar(100);index:idx_org" json:"org_id"`                                          // 组织 ID
+	UserID string `gorm:"column:user_id;type:varchar(100);not null;index:idx_user" json:"user_id"`                 // 创建者 (主站用户 UUID)
+	OrgID  string `gorm:"column:org_id;type:varchar(100);uniqueIndex:uk_org_endpoint;index:idx_org" json:"org_id"` // 所属组织 ID, 组织成员按角色访问
 
 	// Endpoint 名称
-	LogicalName  string `gorm:"column:logical_name;type:varchar(255);not null;uniqueIndex:uk_user_endpoint" json:"logical_name"` // 用户看到的名字: my-model
-	PhysicalName string `gorm:"column:physical_name;type:varchar(255);not null" json:"physical_name"`                            // Waverless 中的实际名字: user-{uuid}-my-model
+	LogicalName  string `gorm:"column:logical_name;type:varchar(255);not null;uniqueIndex:uk_org_endpoint" json:"logical_name"` // 用户看到的名字: my-model
+	PhysicalName string `gorm:"column:physical_name;type:varchar(255);not null" json:"physical_name"`                           // Waverless 中的实际名字: user-{uuid}-my-model
 
 	// 规格信息(支持 GPU 和 CPU)
 	SpecName string `gorm:"column:spec_name;type:varchar(100);not null;index:idx_spec_name" json:"spec_name"` // GPU-A100-40GB 或 CPU-16C-32G
@@ -52,9 +103,13 @@ type UserEndpoint struct {
 	CPUCores int `gorm:"column:cpu_cores;not null" json:"cpu_cores"` // CPU 核心数
 	RAMGB    int `gorm:"column:ram_gb;not null" json:"ram_gb"`       // 内存大小
 
-	// 部署集群(Portal 自动选择)
+	// 部署集群(Portal 自动选择): 主集群, 全部部署集群见 endpoint_placements
 	ClusterID string `gorm:"column:cluster_id;type:varchar(100);not null;index:idx_cluster" json:"cluster_id"`
 
+	// 跨集群部署: 部署集群数及副本分布策略, 集群下线时自动替换
+	PlacementCount int    `gorm:"column:placement_count;default:1" json:"placement_count"`
+	ReplicaPolicy  string `gorm:"column:replica_policy;type:varchar(20);default:'spread'" json:"replica_policy"` // spread, primary
+
 	// 副本配置
 	Replicas        int `gorm:"column:replicas;default:0" json:"replicas"` // 目标副本数
 	MinReplicas     int `gorm:"column:min_replicas;not null" json:"min_replicas"`
@@ -67,15 +122,29 @@ type UserEndpoint struct {
 	TaskTimeout          int     `gorm:"column:task_timeout;default:3600" json:"task_timeout"`
 	Env                  JSONMap `gorm:"column:env;type:json" json:"env"` // 环境变量
 
-	// 价格信息(创建时锁定, 单位: 1/1000000 USD)
+	// 成本分摊标签 (如 team=search, project=rag), 计费时快照到流水
+	Tags StringMap `gorm:"column:tags;type:json" json:"tags"`
+
+	// 价格信息(创建时按组织计费币种锁定, 单位: 1/1000000 Currency)
 	PricePerHour int64  `gorm:"column:price_per_hour;type:bigint" json:"price_per_hour"`
 	Currency     string `gorm:"column:currency;type:varchar(10);default:'USD'" json:"currency"`
 
+	// 抢占式档位: 按 spec 的 spot 价格锁价, worker 可能被抢占
+	Spot             bool   `gorm:"column:spot;default:false" json:"spot"`
+	PreemptionPolicy string `gorm:"column:preemption_policy;type:varchar(20);default:'resubmit'" json:"preemption_policy"` // resubmit, fail
+
+	// 计费方式: worker_time 按 worker 时长, task_execution 按任务执行时长 (每秒价格创建时锁定)
+	BillingMode        string `gorm:"column:billing_mode;type:varchar(20);default:'worker_time'" json:"billing_mode"`
+	TaskPricePerSecond int64  `gorm:"column:task_price_per_second;type:bigint;default:0" json:"task_price_per_second"`
+
 	// 调度偏好
 	PreferRegion string `gorm:"column:prefer_region;type:varchar(100)" json:"prefer_region"` // 用户偏好区域
 
 	// 状态
 	Status string `gorm:"column:status;type:varchar(50);default:'deploying';index:idx_status" json:"status"` // deploying, running, suspended, deleted
+	// 停机原因 (status 为 suspended 时有值, 如余额不足/预算超限)
+	SuspendReason string     `gorm:"column:suspend_reason;type:varchar(255)" json:"suspend_reason"`
+	SuspendedAt   *time.Time `gorm:"column:suspended_at" json:"suspended_at"`
 
 	// 时间戳
 	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
@@ -87,3 +156,16 @@ type UserEndpoint struct {
 func (UserEndpoint) TableName() string {
 	return "user_endpoints"
 }
+
+// TaskBilled 是否按任务执行时长计费
+func (e *UserEndpoint) TaskBilled() bool {
+	return e.BillingMode == BillingModeTaskExecution
+}
+
+// BillingCurrency 锁定价格的币种, 历史数据为空时为默认币种
+func (e *UserEndpoint) BillingCurrency() string {
+	if e.Currency == "" {
+		return DefaultCurrency
+	}
+	return e.Currency
+}
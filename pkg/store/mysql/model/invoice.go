@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+)
+
+// 账单状态
+const (
+	InvoiceStatusDraft     = "draft"     // 当月未结束或未关账, 可重新生成
+	InvoiceStatusFinalized = "finalized" // 已关账, 不可修改
+)
+
+// Invoice 组织月度账单
+type Invoice struct {
+	ID            int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	InvoiceNumber string `gorm:"column:invoice_number;type:varchar(150);not null;uniqueIndex:uk_invoice_number" json:"invoice_number"`
+	OrgID         string `gorm:"column:org_id;type:varchar(100);not null;uniqueIndex:uk_org_period" json:"org_id"`
+
+	// 账单周期 [PeriodStart, PeriodEnd)
+	PeriodStart time.Time `gorm:"column:period_start;not null;uniqueIndex:uk_org_period" json:"period_start"`
+	PeriodEnd   time.Time `gorm:"column:period_end;not null" json:"period_end"`
+
+	// 汇总 (单位: 1/1000000 Currency)
+	TotalAmount  int64  `gorm:"column:total_amount;type:bigint;not null;default:0" json:"total_amount"`
+	TotalSeconds int64  `gorm:"column:total_seconds;not null;default:0" json:"total_seconds"`
+	Currency     string `gorm:"column:currency;type:varchar(10);default:'USD'" json:"currency"`
+
+	// 状态: draft, finalized
+	Status      string     `gorm:"column:status;type:varchar(20);not null;default:'draft';index:idx_invoice_status" json:"status"`
+	FinalizedAt *time.Time `gorm:"column:finalized_at" json:"finalized_at"`
+
+	// 时间戳
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (Invoice) TableName() string {
+	return "invoices"
+}
+
+// 账单明细类型
+const (
+	InvoiceItemUsage  = "usage"              // 计费流水
+	InvoiceItemCredit = AdjustmentTypeCredit // 调账退款/赠送
+	InvoiceItemDebit  = AdjustmentTypeDebit  // 调账补扣
+)
+
+// InvoiceLineItem 账单明细 (用量按 endpoint + 规格 + GPU 类型汇总 billing_transactions, 调账按 endpoint + 调账类型汇总 billing_adjustments)
+type InvoiceLineItem struct {
+	ID        int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	InvoiceID int64  `gorm:"column:invoice_id;not null;index:idx_invoice_item" json:"invoice_id"`
+	ItemType  string `gorm:"column:item_type;type:varchar(20);not null;default:'usage'" json:"item_type"` // usage, credit, debit
+
+	// 分组维度 (生成时快照)
+	EndpointID   int64  `gorm:"column:endpoint_id;not null" json:"endpoint_id"`
+	EndpointName string `gorm:"column:endpoint_name;type:varchar(255)" json:"endpoint_name"`
+	SpecName     string `gorm:"column:spec_name;type:varchar(100)" json:"spec_name"`
+	GPUType      string `gorm:"column:gpu_type;type:varchar(100)" json:"gpu_type"`
+
+	// 用量 (金额单位: 1/1000000 账单币种)
+	DurationSeconds  int64 `gorm:"column:duration_seconds;not null" json:"duration_seconds"`
+	Amount           int64 `gorm:"column:amount;type:bigint;not null" json:"amount"`
+	TransactionCount int64 `gorm:"column:transaction_count;not null" json:"transaction_count"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// TableName 表名
+func (InvoiceLineItem) TableName() string {
+	return "invoice_line_items"
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+)
+
+// 流水导出日分区状态
+const (
+	LedgerExportPending        = "pending"         // 分片已变更, manifest 尚未写入
+	LedgerExportCompleted      = "completed"       // manifest 与分片一致
+	LedgerExportFailed         = "failed"          // manifest 写入失败, 下一轮重试
+	LedgerExportRerunRequested = "rerun_requested" // 管理员要求重新导出整天
+)
+
+// LedgerExport 计费流水导出的日分区 (按流水 created_at 的 UTC 日期)
+type LedgerExport struct {
+	ID     int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Day    time.Time `gorm:"column:day;type:date;not null;uniqueIndex:uk_ledger_export_day" json:"day"`
+	Format string    `gorm:"column:format;type:varchar(20);not null" json:"format"` // csv, jsonl
+	Status string    `gorm:"column:status;type:varchar(20);not null;index:idx_ledger_export_status" json:"status"`
+
+	// 当前分片汇总
+	PartCount   int   `gorm:"column:part_count;not null;default:0" json:"part_count"`
+	RowCount    int64 `gorm:"column:row_count;not null;default:0" json:"row_count"`
+	TotalAmount int64 `gorm:"column:total_amount;type:bigint;not null;default:0" json:"total_amount"` // amount 列之和 (不区分币种)
+
+	ManifestKey    string     `gorm:"column:manifest_key;type:varchar(500)" json:"manifest_key"`
+	ManifestSHA256 string     `gorm:"column:manifest_sha256;type:varchar(64)" json:"manifest_sha256"`
+	ErrorMessage   string     `gorm:"column:error_message;type:text" json:"error_message"`
+	ExportedAt     *time.Time `gorm:"column:exported_at" json:"exported_at"` // 最近一次 manifest 写入时间
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (LedgerExport) TableName() string {
+	return "ledger_exports"
+}
+
+// LedgerExportPart 日分区内的一个分片文件 (ID 连续区间)
+type LedgerExportPart struct {
+	ID          int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Day         time.Time `gorm:"column:day;type:date;not null;index:idx_ledger_part_day" json:"day"`
+	ObjectKey   string    `gorm:"column:object_key;type:varchar(500);not null;uniqueIndex:uk_ledger_part_object" json:"object_key"`
+	FirstID     int64     `gorm:"column:first_id;not null" json:"first_id"`
+	LastID      int64     `gorm:"column:last_id;not null" json:"last_id"`
+	RowCount    int       `gorm:"column:row_count;not null" json:"row_count"`
+	TotalAmount int64     `gorm:"column:total_amount;type:bigint;not null" json:"total_amount"`
+	SizeBytes   int64     `gorm:"column:size_bytes;not null" json:"size_bytes"`
+	SHA256      string    `gorm:"column:sha256;type:varchar(64);not null" json:"sha256"` // 压缩文件的校验和
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// TableName 表名
+func (LedgerExportPart) TableName() string {
+	return "ledger_export_parts"
+}
+
+// LedgerExportWatermark 增量导出水位: 已导出的最大流水 ID
+type LedgerExportWatermark struct {
+	Name      string    `gorm:"column:name;type:varchar(100);primaryKey" json:"name"`
+	LastID    int64     `gorm:"column:last_id;not null;default:0" json:"last_id"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (LedgerExportWatermark) TableName() string {
+	return "ledger_export_watermarks"
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// Endpoint 迁移状态
+const (
+	MigrationStatusPending   = "pending"   // 待在目标集群创建部署
+	MigrationStatusDeploying = "deploying" // 目标集群部署中, 等待副本就绪
+	MigrationStatusDraining  = "draining"  // 任务已切换到目标集群, 源集群排空进行中的任务
+	MigrationStatusCompleted = "completed"
+	MigrationStatusFailed    = "failed"
+	MigrationStatusCancelled = "cancelled"
+)
+
+// MigrationInProgressStatuses 进行中的迁移状态, 同一 endpoint 同时只能有一个
+var MigrationInProgressStatuses = []string{MigrationStatusPending, MigrationStatusDeploying, MigrationStatusDraining}
+
+// Endpoint 迁移原因
+const (
+	MigrationReasonManual = "manual" // 用户通过 API 发起
+	MigrationReasonPrice  = "price"  // 自动迁移到更便宜的集群
+	MigrationReasonHealth = "health" // 源集群规格不可用, 自动迁移到可用集群
+)
+
+// EndpointMigration endpoint 在集群间的迁移: 目标集群创建部署 -> 副本就绪 -> 切换任务路由 -> 排空并删除源部署
+type EndpointMigration struct {
+	ID              int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	EndpointID      int64  `gorm:"column:endpoint_id;not null;index:idx_endpoint" json:"endpoint_id"`
+	OrgID           string `gorm:"column:org_id;type:varchar(100);index:idx_org" json:"org_id"`
+	SourceClusterID string `gorm:"column:source_cluster_id;type:varchar(100);not null" json:"source_cluster_id"`
+	TargetClusterID string `gorm:"column:target_cluster_id;type:varchar(100);not null" json:"target_cluster_id"`
+	TargetSpecName  string `gorm:"column:target_cluster_spec_name;type:varchar(100)" json:"target_cluster_spec_name"` // 目标集群内部的 spec 名称
+	Reason          string `gorm:"column:reason;type:varchar(20);not null" json:"reason"`                             // manual, price, health
+	Status          string `gorm:"column:status;type:varchar(20);not null;index:idx_status" json:"status"`
+	Error           string `gorm:"column:error;type:text" json:"error,omitempty"`
+	RequestedBy     string `gorm:"column:requested_by;type:varchar(255)" json:"requested_by"`
+
+	StartedAt   *time.Time `gorm:"column:started_at" json:"started_at"`     // 目标集群部署创建时间
+	SwitchedAt  *time.Time `gorm:"column:switched_at" json:"switched_at"`   // 任务路由切换时间
+	CompletedAt *time.Time `gorm:"column:completed_at" json:"completed_at"` // 结束 (完成/失败/取消) 时间
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (EndpointMigration) TableName() string {
+	return "endpoint_migrations"
+}
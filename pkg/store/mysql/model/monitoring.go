@@ -12,6 +12,7 @@ type Worker struct {
 	WorkerID             string         `gorm:"uniqueIndex;not null" json:"worker_id"`
 	EndpointID           int64          `gorm:"index;not null" json:"endpoint_id"`
 	ClusterID            string         `gorm:"index;not null" json:"cluster_id"`
+	RolloutID            *int64         `gorm:"index" json:"rollout_id"` // 属于镜像发布的新版本部署时有值
 	UserID               string         `gorm:"index;not null" json:"user_id"`
 	PodName              string         `json:"pod_name"`
 	Status               string         `gorm:"default:STARTING" json:"status"` // STARTING, ONLINE, BUSY, DRAINING, OFFLINE
@@ -19,6 +20,9 @@ type Worker struct {
 	PodStartedAt         *time.Time     `json:"pod_started_at"`
 	PodReadyAt           *time.Time     `json:"pod_ready_at"`
 	PodTerminatedAt      *time.Time     `json:"pod_terminated_at"`
+	Preempted            bool           `gorm:"default:false" json:"preempted"` // spot worker 被抢占
+	PreemptedAt          *time.Time     `json:"preempted_at"` // 抢占时间, 计费截止于此
+	TerminationReason    string         `json:"termination_reason"` // 终止原因 (如 preempted)
 	ColdStartDurationMs  *int64         `json:"cold_start_duration_ms"`
 	CurrentJobs          int            `gorm:"default:0" json:"current_jobs"`
 	TotalTasksCompleted  int64          `gorm:"default:0" json:"total_tasks_completed"`
@@ -30,6 +34,7 @@ type Worker struct {
 	LastBilledAt         *time.Time     `json:"last_billed_at"`
 	TotalBilledSeconds   int            `gorm:"default:0" json:"total_billed_seconds"`
 	TotalBilledAmount    int64          `gorm:"type:bigint;default:0" json:"total_billed_amount"`
+	BilledExecutionMs    int64          `gorm:"default:0" json:"billed_execution_ms"` // 已出账的任务执行时长, 用于计算空闲时长
 	LastSyncedAt         *time.Time     `json:"last_synced_at"`
 	CreatedAt            time.Time      `json:"created_at"`
 	UpdatedAt            time.Time      `json:"updated_at"`
@@ -39,19 +44,22 @@ func (Worker) TableName() string { return "workers" }
 
 // TaskRouting 任务路由记录
 type TaskRouting struct {
-	ID              int64          `gorm:"primaryKey;autoIncrement" json:"id"`
-	TaskID          string         `gorm:"uniqueIndex;not null" json:"task_id"`
-	UserID          string         `gorm:"index;not null" json:"user_id"`
-	OrgID           string         `json:"org_id"`
-	EndpointID      int64          `gorm:"index;not null" json:"endpoint_id"`
-	ClusterID       string         `gorm:"not null" json:"cluster_id"`
-	Input           datatypes.JSON `json:"input"`
-	WorkerID        string         `json:"worker_id"`
-	Status          string         `gorm:"default:PENDING;index" json:"status"`
-	SubmittedAt     time.Time      `json:"submitted_at"`
-	CreatedAt       *time.Time     `json:"created_at"`
-	CompletedAt     *time.Time     `json:"completed_at"`
-	ExecutionTimeMs int64          `gorm:"default:0" json:"execution_time_ms"`
+	ID                int64          `gorm:"primaryKey;autoIncrement" json:"id"`
+	TaskID            string         `gorm:"uniqueIndex;not null" json:"task_id"`
+	UserID            string         `gorm:"index;not null" json:"user_id"`
+	OrgID             string         `gorm:"index" json:"org_id"`
+	EndpointID        int64          `gorm:"index;not null" json:"endpoint_id"`
+	ClusterID         string         `gorm:"not null" json:"cluster_id"`
+	Input             datatypes.JSON `json:"input"`
+	WorkerID          string         `json:"worker_id"`
+	Status            string         `gorm:"default:PENDING;index" json:"status"`
+	SubmittedAt       time.Time      `json:"submitted_at"`
+	CreatedAt         *time.Time     `json:"created_at"`
+	CompletedAt       *time.Time     `json:"completed_at"`
+	ExecutionTimeMs   int64          `gorm:"default:0" json:"execution_time_ms"`
+	ResubmittedTaskID string         `json:"resubmitted_task_id"` // 所在 worker 被抢占后重新提交的任务 ID, 查询状态时跟随到新任务
+	BilledAt          *time.Time     `gorm:"index" json:"billed_at"` // 按任务计费的 endpoint 出账时间, 为空表示尚未出账
+	RolloutID         *int64         `gorm:"index" json:"rollout_id"` // 分流到镜像发布新版本的任务
 }
 
 func (TaskRouting) TableName() string { return "task_routing" }
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+)
+
+// 组织成员角色, 权限依次递增
+const (
+	OrgRoleViewer    = "viewer"    // 只读: 查看 endpoint、任务、凭证及用量
+	OrgRoleDeveloper = "developer" // 管理 endpoint、任务及镜像仓库凭证
+	OrgRoleAdmin     = "admin"     // 管理 viewer/developer 成员
+	OrgRoleOwner     = "owner"     // 全部权限, 可管理 admin/owner
+)
+
+var orgRoleLevels = map[string]int{
+	OrgRoleViewer:    1,
+	OrgRoleDeveloper: 2,
+	OrgRoleAdmin:     3,
+	OrgRoleOwner:     4,
+}
+
+// OrgRoleLevel 角色权限等级, 未知角色为 0
+func OrgRoleLevel(role string) int {
+	return orgRoleLevels[role]
+}
+
+// OrgMember 组织成员 (endpoint、任务、凭证归属组织, 成员按角色访问)
+type OrgMember struct {
+	ID     int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	OrgID  string `gorm:"column:org_id;type:varchar(100);not null;uniqueIndex:uk_org_member" json:"org_id"`
+	UserID string `gorm:"column:user_id;type:varchar(100);not null;uniqueIndex:uk_org_member;index:idx_member_user" json:"user_id"`
+	Email  string `gorm:"column:email;type:varchar(255)" json:"email"`
+
+	Role      string `gorm:"column:role;type:varchar(20);not null" json:"role"` // owner, admin, developer, viewer
+	InvitedBy string `gorm:"column:invited_by;type:varchar(100)" json:"invited_by"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (OrgMember) TableName() string {
+	return "org_members"
+}
+
+// HasRole 成员角色是否不低于 role
+func (m *OrgMember) HasRole(role string) bool {
+	return OrgRoleLevel(m.Role) >= OrgRoleLevel(role)
+}
@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// Endpoint 跨集群副本分布策略
+const (
+	ReplicaPolicySpread  = "spread"  // 副本均分到各集群, 任务按副本数加权路由 (默认)
+	ReplicaPolicyPrimary = "primary" // 副本全部在主集群, 其余集群为 0 副本热备, 主集群不可用时任务路由到热备集群
+)
+
+// Placement 状态
+const (
+	PlacementStatusActive       = "active"
+	PlacementStatusOrphaned     = "orphaned"     // 集群下线后已被替换, 集群恢复后删除其上的部署
+	PlacementStatusProvisioning = "provisioning" // 迁移目标, 已创建部署但尚未路由任务
+	PlacementStatusDraining     = "draining"     // 迁移源, 不再路由新任务, 等待进行中的任务结束后删除
+)
+
+// PlacementDeployedStatuses 集群上有在用部署的 placement 状态 (需要同步 worker)
+var PlacementDeployedStatuses = []string{PlacementStatusActive, PlacementStatusProvisioning, PlacementStatusDraining}
+
+// EndpointPlacement endpoint 在某个集群上的部署, 一个 endpoint 可同时部署在多个集群
+type EndpointPlacement struct {
+	ID              int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	EndpointID      int64  `gorm:"column:endpoint_id;not null;uniqueIndex:uk_endpoint_cluster" json:"endpoint_id"`
+	ClusterID       string `gorm:"column:cluster_id;type:varchar(100);not null;uniqueIndex:uk_endpoint_cluster;index:idx_cluster" json:"cluster_id"`
+	ClusterSpecName string `gorm:"column:cluster_spec_name;type:varchar(100);not null" json:"cluster_spec_name"` // 集群内部的 spec 名称
+	Rank            int    `gorm:"column:placement_rank;default:0" json:"rank"`                                  // 0 为主集群
+
+	// 分配到该集群的副本配置
+	Replicas        int `gorm:"column:replicas;default:0" json:"replicas"`
+	MinReplicas     int `gorm:"column:min_replicas;default:0" json:"min_replicas"`
+	MaxReplicas     int `gorm:"column:max_replicas;default:0" json:"max_replicas"`
+	CurrentReplicas int `gorm:"column:current_replicas;default:0" json:"current_replicas"`
+
+	Status     string     `gorm:"column:status;type:varchar(20);default:'active';index:idx_status" json:"status"` // active, orphaned, provisioning, draining
+	OrphanedAt *time.Time `gorm:"column:orphaned_at" json:"orphaned_at,omitempty"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (EndpointPlacement) TableName() string {
+	return "endpoint_placements"
+}
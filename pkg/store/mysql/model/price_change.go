@@ -0,0 +1,62 @@
+package model
+
+import (
+	"time"
+)
+
+// 计划调价状态
+const (
+	PriceChangeStatusScheduled = "scheduled"
+	PriceChangeStatusApplied   = "applied"
+	PriceChangeStatusCancelled = "cancelled"
+)
+
+// SpecPriceChange 规格计划调价: 到生效时间后更新规格价格, 并把已有 endpoint 的锁定价格迁移到新价格
+type SpecPriceChange struct {
+	ID       int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	SpecName string `gorm:"column:spec_name;type:varchar(100);not null;index:idx_price_change_spec" json:"spec_name"`
+
+	// 新价格 (单位: 1/1000000 Currency 币种); spot 价格为空表示不变
+	PricePerHour     int64  `gorm:"column:price_per_hour;type:bigint;not null" json:"price_per_hour"`
+	SpotPricePerHour *int64 `gorm:"column:spot_price_per_hour;type:bigint" json:"spot_price_per_hour"`
+
+	// 调价币种: 规格基础币种时更新基础价格 (未单独标价的币种随汇率换算), 否则更新该币种的标价
+	Currency string `gorm:"column:currency;type:varchar(10);not null;default:'USD'" json:"currency"`
+
+	// 生效时间及提前通知天数 (创建时 EffectiveAt 必须不早于 CreatedAt + NoticeDays)
+	EffectiveAt time.Time `gorm:"column:effective_at;not null;index:idx_price_change_due" json:"effective_at"`
+	NoticeDays  int       `gorm:"column:notice_days;not null" json:"notice_days"`
+
+	Status            string     `gorm:"column:status;type:varchar(20);not null;default:'scheduled';index:idx_price_change_due" json:"status"` // scheduled, applied, cancelled
+	AppliedAt         *time.Time `gorm:"column:applied_at" json:"applied_at"`
+	AffectedEndpoints int        `gorm:"column:affected_endpoints;default:0" json:"affected_endpoints"` // 迁移到新价格的 endpoint 数
+
+	Reason     string `gorm:"column:reason;type:varchar(500)" json:"reason"`
+	AdminEmail string `gorm:"column:admin_email;type:varchar(255)" json:"admin_email"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (SpecPriceChange) TableName() string {
+	return "spec_price_changes"
+}
+
+// EndpointPriceHistory endpoint 锁定价格变更历史 (只增不改), 计费时按 EffectiveFrom 拆分时段
+type EndpointPriceHistory struct {
+	ID         int64 `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	EndpointID int64 `gorm:"column:endpoint_id;not null;index:idx_price_history_endpoint" json:"endpoint_id"`
+	ChangeID   int64 `gorm:"column:change_id;not null;index:idx_price_history_change" json:"change_id"` // 关联 spec_price_changes.id
+
+	OldPricePerHour int64     `gorm:"column:old_price_per_hour;type:bigint;not null" json:"old_price_per_hour"`
+	NewPricePerHour int64     `gorm:"column:new_price_per_hour;type:bigint;not null" json:"new_price_per_hour"`
+	EffectiveFrom   time.Time `gorm:"column:effective_from;not null;index:idx_price_history_endpoint" json:"effective_from"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// TableName 表名
+func (EndpointPriceHistory) TableName() string {
+	return "endpoint_price_history"
+}
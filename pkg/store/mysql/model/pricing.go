@@ -19,14 +19,23 @@ type SpecPricing struct {
 	RAMGB    int    `gorm:"column:ram_gb;not null" json:"ram_gb"`                                  // 内存大小
 	DiskGB   int    `gorm:"column:disk_gb" json:"disk_gb"`                                         // 磁盘大小
 
-	// 价格 (单位: 1/1000000 USD)
+	// 价格 (单位: 1/1000000 Currency, 即规格基础币种)
 	PricePerHour int64  `gorm:"column:price_per_hour;type:bigint;not null" json:"price_per_hour"`
 	Currency     string `gorm:"column:currency;type:varchar(10);default:'USD'" json:"currency"`
 
+	// 抢占式 (spot) 价格, 0 表示该规格不提供 spot 档位
+	SpotPricePerHour int64 `gorm:"column:spot_price_per_hour;type:bigint;default:0" json:"spot_price_per_hour"`
+
+	// 按任务执行时长计费的每秒价格, 0 表示该规格不提供按任务计费
+	TaskPricePerSecond int64 `gorm:"column:task_price_per_second;type:bigint;default:0" json:"task_price_per_second"`
+
 	// 价格范围(可选)
 	MinPrice int64 `gorm:"column:min_price;type:bigint" json:"min_price"`
 	MaxPrice int64 `gorm:"column:max_price;type:bigint" json:"max_price"`
 
+	// 计费策略 (为空使用默认按秒计费)
+	BillingPolicyID *int64 `gorm:"column:billing_policy_id" json:"billing_policy_id"`
+
 	// 描述
 	Description string `gorm:"column:description;type:text" json:"description"`
 
@@ -46,15 +55,15 @@ func (SpecPricing) TableName() string {
 // ClusterPricingOverride 集群价格覆盖表(特殊定价)
 type ClusterPricingOverride struct {
 	ID        int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
-	ClusterID string `gorm:"column:cluster_id;type:varchar(100);not null;uniqueIndex:uk_cluster_spec" json:"cluster_id"`
-	SpecName  string `gorm:"column:spec_name;type:varchar(100);not null;uniqueIndex:uk_cluster_spec" json:"spec_name"` // 改为 spec_name,支持 GPU 和 CPU
+	ClusterID string `gorm:"column:cluster_id;type:varchar(100);not null;index:idx_cluster_spec_effective" json:"cluster_id"`
+	SpecName  string `gorm:"column:spec_name;type:varchar(100);not null;index:idx_cluster_spec_effective" json:"spec_name"` // 改为 spec_name,支持 GPU 和 CPU
 
-	// 覆盖价格 (单位: 1/1000000 USD)
+	// 覆盖价格 (单位: 1/1000000 Currency, 计费时按汇率换算为 endpoint 币种)
 	PricePerHour int64  `gorm:"column:price_per_hour;type:bigint;not null" json:"price_per_hour"`
 	Currency     string `gorm:"column:currency;type:varchar(10);default:'USD'" json:"currency"`
 
-	// 生效时间
-	EffectiveFrom  *time.Time `gorm:"column:effective_from;index:idx_effective" json:"effective_from"`
+	// 生效时间 [EffectiveFrom, EffectiveUntil), 为空表示不限
+	EffectiveFrom  *time.Time `gorm:"column:effective_from;index:idx_effective;index:idx_cluster_spec_effective" json:"effective_from"`
 	EffectiveUntil *time.Time `gorm:"column:effective_until;index:idx_effective" json:"effective_until"`
 
 	// 原因
@@ -69,3 +78,14 @@ type ClusterPricingOverride struct {
 func (ClusterPricingOverride) TableName() string {
 	return "cluster_pricing_overrides"
 }
+
+// ActiveAt 判断覆盖价格在 t 时刻是否生效
+func (o *ClusterPricingOverride) ActiveAt(t time.Time) bool {
+	if o.EffectiveFrom != nil && t.Before(*o.EffectiveFrom) {
+		return false
+	}
+	if o.EffectiveUntil != nil && !t.Before(*o.EffectiveUntil) {
+		return false
+	}
+	return true
+}
@@ -9,9 +9,9 @@ import (
 // RegistryCredential 镜像仓库凭证
 type RegistryCredential struct {
 	ID                int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID            string    `gorm:"column:user_id;type:varchar(100);not null;uniqueIndex:uk_user_name" json:"user_id"`
-	OrgID             string    `gorm:"column:org_id;type:varchar(100)" json:"org_id"`
-	Name              string    `gorm:"column:name;type:varchar(100);not null;uniqueIndex:uk_user_name" json:"name"`
+	UserID            string    `gorm:"column:user_id;type:varchar(100);not null" json:"user_id"` // 创建者
+	OrgID             string    `gorm:"column:org_id;type:varchar(100);uniqueIndex:uk_org_name" json:"org_id"`
+	Name              string    `gorm:"column:name;type:varchar(100);not null;uniqueIndex:uk_org_name" json:"name"`
 	Registry          string    `gorm:"column:registry;type:varchar(255);not null;default:docker.io" json:"registry"`
 	Username          string    `gorm:"column:username;type:varchar(255);not null" json:"username"`
 	PasswordEncrypted string    `gorm:"column:password_encrypted;type:varchar(1000);not null" json:"-"`
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+)
+
+// DataArchive 归档文件记录 (与删除同事务写入, 用于审计追溯)
+type DataArchive struct {
+	ID          int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	SourceTable string `gorm:"column:source_table;type:varchar(100);not null;index:idx_archive_table" json:"source_table"`
+	Storage     string `gorm:"column:storage;type:varchar(20);not null" json:"storage"` // local, s3
+	ObjectKey   string `gorm:"column:object_key;type:varchar(500);not null;uniqueIndex:uk_archive_object" json:"object_key"`
+	Format      string `gorm:"column:format;type:varchar(20);not null" json:"format"` // jsonl, csv
+
+	// 本批数据范围
+	FirstID   int64     `gorm:"column:first_id;not null" json:"first_id"`
+	LastID    int64     `gorm:"column:last_id;not null" json:"last_id"`
+	RowCount  int       `gorm:"column:row_count;not null" json:"row_count"`
+	MinTime   time.Time `gorm:"column:min_time;not null" json:"min_time"`
+	MaxTime   time.Time `gorm:"column:max_time;not null" json:"max_time"`
+	Cutoff    time.Time `gorm:"column:cutoff;not null" json:"cutoff"`
+	SizeBytes int64     `gorm:"column:size_bytes;not null" json:"size_bytes"`
+	SHA256    string    `gorm:"column:sha256;type:varchar(64);not null" json:"sha256"` // 压缩文件的校验和
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;index:idx_archive_table" json:"created_at"`
+}
+
+// TableName 表名
+func (DataArchive) TableName() string {
+	return "data_archives"
+}
+
+// BillingDailyRollup 计费成功流水的日汇总 (流水删除前写入, 按 UTC 日期及币种)
+type BillingDailyRollup struct {
+	ID         int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Day        time.Time `gorm:"column:day;type:date;not null;uniqueIndex:uk_billing_rollup" json:"day"`
+	UserID     string    `gorm:"column:user_id;type:varchar(100);not null;uniqueIndex:uk_billing_rollup;index:idx_rollup_user" json:"user_id"`
+	OrgID      string    `gorm:"column:org_id;type:varchar(100);not null;uniqueIndex:uk_billing_rollup" json:"org_id"`
+	EndpointID int64     `gorm:"column:endpoint_id;not null;uniqueIndex:uk_billing_rollup" json:"endpoint_id"`
+	ClusterID  string    `gorm:"column:cluster_id;type:varchar(100);not null;uniqueIndex:uk_billing_rollup" json:"cluster_id"`
+	GPUType    string    `gorm:"column:gpu_type;type:varchar(100);not null;uniqueIndex:uk_billing_rollup" json:"gpu_type"`
+	Currency   string    `gorm:"column:currency;type:varchar(10);not null;default:'USD';uniqueIndex:uk_billing_rollup" json:"currency"`
+
+	Amount           int64 `gorm:"column:amount;type:bigint;not null" json:"amount"` // 单位: 1/1000000 Currency
+	DurationSeconds  int64 `gorm:"column:duration_seconds;not null" json:"duration_seconds"`
+	TransactionCount int64 `gorm:"column:transaction_count;not null" json:"transaction_count"`
+
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (BillingDailyRollup) TableName() string {
+	return "billing_daily_rollups"
+}
@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// Revision 来源
+const (
+	RevisionSourceCreate   = "create"   // 创建 endpoint
+	RevisionSourceUpdate   = "update"   // 更新部署 (image, env, replicas)
+	RevisionSourceConfig   = "config"   // 更新扩缩容配置
+	RevisionSourceRollback = "rollback" // 回滚到历史 revision
+	RevisionSourceRollout  = "rollout"  // 镜像发布全量或回滚
+	RevisionSourceManifest = "manifest" // 声明式清单 apply
+)
+
+// EndpointRevision endpoint 配置的不可变快照, 每次修改部署或扩缩容配置生成一个
+type EndpointRevision struct {
+	ID         int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	EndpointID int64  `gorm:"column:endpoint_id;not null;uniqueIndex:uk_endpoint_revision" json:"endpoint_id"`
+	OrgID      string `gorm:"column:org_id;type:varchar(100);index:idx_org" json:"org_id"`
+	Revision   int    `gorm:"column:revision;not null;uniqueIndex:uk_endpoint_revision" json:"revision"` // endpoint 内从 1 递增
+
+	// 部署配置
+	Image    string  `gorm:"column:image;type:varchar(500);not null" json:"image"`
+	Env      JSONMap `gorm:"column:env;type:json" json:"env"`
+	Replicas int     `gorm:"column:replicas;default:0" json:"replicas"`
+
+	// 扩缩容配置: 最小/最大副本数及超时单独保存, 其余 autoscaler 配置 (累计下发的全部 key) 保存在 Config
+	MinReplicas int     `gorm:"column:min_replicas;default:0" json:"min_replicas"`
+	MaxReplicas int     `gorm:"column:max_replicas;default:0" json:"max_replicas"`
+	TaskTimeout int     `gorm:"column:task_timeout;default:0" json:"task_timeout"`
+	Config      JSONMap `gorm:"column:config;type:json" json:"config"`
+
+	Source     string    `gorm:"column:source;type:varchar(20);not null" json:"source"` // create, update, config, rollback, rollout, manifest
+	RollbackOf *int      `gorm:"column:rollback_of" json:"rollback_of,omitempty"`       // 回滚的目标 revision
+	Author     string    `gorm:"column:author;type:varchar(255)" json:"author"`         // 操作用户, 系统操作为 system
+	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// TableName 表名
+func (EndpointRevision) TableName() string {
+	return "endpoint_revisions"
+}
@@ -0,0 +1,67 @@
+package model
+
+import "time"
+
+// 镜像发布策略
+const (
+	RolloutStrategyCanary    = "canary"     // 按比例将任务分流到新版本, 对比失败率后自动全量或回滚
+	RolloutStrategyBlueGreen = "blue_green" // 新版本就绪后全部任务切换到新版本, 对比失败率后自动全量或回滚
+)
+
+// 镜像发布状态
+const (
+	RolloutStatusDeploying   = "deploying"   // 新版本 (同级 physical endpoint) 部署中
+	RolloutStatusProgressing = "progressing" // 新版本接收任务, 观察失败率
+	RolloutStatusPromoting   = "promoting"   // 新版本通过观察, 原 endpoint 滚动更新为新镜像
+	RolloutStatusCompleted   = "completed"
+	RolloutStatusRolledBack  = "rolled_back"
+	RolloutStatusFailed      = "failed"
+)
+
+// RolloutInProgressStatuses 进行中的发布状态, 同一 endpoint 同时只能有一个
+var RolloutInProgressStatuses = []string{RolloutStatusDeploying, RolloutStatusProgressing, RolloutStatusPromoting}
+
+// EndpointRollout endpoint 镜像发布: 新镜像部署为同级 physical endpoint, 按比例分流任务并对比失败率
+type EndpointRollout struct {
+	ID         int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	EndpointID int64  `gorm:"column:endpoint_id;not null;index:idx_endpoint" json:"endpoint_id"`
+	OrgID      string `gorm:"column:org_id;type:varchar(100);index:idx_org" json:"org_id"`
+	Strategy   string `gorm:"column:strategy;type:varchar(20);not null" json:"strategy"` // canary, blue_green
+
+	// 新版本部署: 部署在 endpoint 主集群上的同级 physical endpoint
+	ClusterID          string  `gorm:"column:cluster_id;type:varchar(100);not null" json:"cluster_id"`
+	CanaryPhysicalName string  `gorm:"column:canary_physical_name;type:varchar(255)" json:"canary_physical_name"`
+	Image              string  `gorm:"column:image;type:varchar(500);not null" json:"image"`
+	Env                JSONMap `gorm:"column:env;type:json" json:"env"` // 为空时沿用 endpoint 的环境变量
+	Replicas           int     `gorm:"column:replicas;default:1" json:"replicas"`
+	PreviousImage      string  `gorm:"column:previous_image;type:varchar(500)" json:"previous_image"` // 回滚时恢复
+	PreviousEnv        JSONMap `gorm:"column:previous_env;type:json" json:"previous_env"`
+
+	// 分流及判定
+	TrafficPercent      int     `gorm:"column:traffic_percent;default:10" json:"traffic_percent"`                 // 分流到新版本的任务比例
+	AnalysisMinutes     int     `gorm:"column:analysis_minutes;default:10" json:"analysis_minutes"`               // 新版本就绪后的观察时长
+	MinTasks            int     `gorm:"column:min_tasks;default:20" json:"min_tasks"`                             // 判定所需的新/原版本最少完成任务数
+	MaxFailureRateDelta float64 `gorm:"column:max_failure_rate_delta;default:0.05" json:"max_failure_rate_delta"` // 新版本失败率最多比原版本高出的比例
+	AutoPromote         bool    `gorm:"column:auto_promote;default:true" json:"auto_promote"`                     // 观察通过后自动全量
+
+	// 最近一次判定时的任务统计 (终态任务数及失败数)
+	CanaryTasks    int64 `gorm:"column:canary_tasks;default:0" json:"canary_tasks"`
+	CanaryFailed   int64 `gorm:"column:canary_failed;default:0" json:"canary_failed"`
+	BaselineTasks  int64 `gorm:"column:baseline_tasks;default:0" json:"baseline_tasks"`
+	BaselineFailed int64 `gorm:"column:baseline_failed;default:0" json:"baseline_failed"`
+
+	Status      string `gorm:"column:status;type:varchar(20);not null;index:idx_status" json:"status"`
+	Reason      string `gorm:"column:reason;type:text" json:"reason,omitempty"` // 全量/回滚/失败原因
+	RequestedBy string `gorm:"column:requested_by;type:varchar(255)" json:"requested_by"`
+
+	ReadyAt     *time.Time `gorm:"column:ready_at" json:"ready_at"`       // 新版本就绪开始接收任务的时间
+	PromotedAt  *time.Time `gorm:"column:promoted_at" json:"promoted_at"` // 开始全量的时间
+	CompletedAt *time.Time `gorm:"column:completed_at" json:"completed_at"`
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (EndpointRollout) TableName() string {
+	return "endpoint_rollouts"
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+)
+
+// 余额告警动作
+const (
+	RunwayActionWarn     = "warn"     // 剩余可用时长低于阈值
+	RunwayActionNegative = "negative" // 余额转负, 进入宽限期
+	RunwayActionSuspend  = "suspend"  // 宽限期结束或超出透支额度, 停机
+)
+
+// OrgBillingState 组织余额预测状态 (BillingJob 每轮更新)
+type OrgBillingState struct {
+	OrgID string `gorm:"column:org_id;type:varchar(100);primaryKey" json:"org_id"`
+
+	// 最近一次预测 (金额单位: 1/1000000 USD)
+	Balance     int64   `gorm:"column:balance;type:bigint;not null" json:"balance"`
+	BurnRate    int64   `gorm:"column:burn_rate;type:bigint;not null" json:"burn_rate"` // 每小时消耗
+	RunwayHours float64 `gorm:"column:runway_hours;not null" json:"runway_hours"`       // 剩余可用小时, -1 表示无消耗
+
+	// 告警与停机状态
+	LastAlertThreshold float64    `gorm:"column:last_alert_threshold;not null;default:0" json:"last_alert_threshold"` // 已告警的最低阈值(小时), 0 表示未告警
+	NegativeSince      *time.Time `gorm:"column:negative_since" json:"negative_since"`                                // 余额转负时间, 宽限期起点
+	SuspendedAt        *time.Time `gorm:"column:suspended_at" json:"suspended_at"`
+
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 表名
+func (OrgBillingState) TableName() string {
+	return "org_billing_states"
+}
+
+// RunwayAlert 余额预测告警记录
+type RunwayAlert struct {
+	ID             int64   `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	OrgID          string  `gorm:"column:org_id;type:varchar(100);not null;index:idx_org_runway_alert" json:"org_id"`
+	Action         string  `gorm:"column:action;type:varchar(20);not null" json:"action"` // warn, negative, suspend
+	ThresholdHours float64 `gorm:"column:threshold_hours;not null" json:"threshold_hours"`
+	RunwayHours    float64 `gorm:"column:runway_hours;not null" json:"runway_hours"`
+	Balance        int64   `gorm:"column:balance;type:bigint;not null" json:"balance"`
+	BurnRate       int64   `gorm:"column:burn_rate;type:bigint;not null" json:"burn_rate"`
+	Message        string  `gorm:"column:message;type:varchar(500)" json:"message"`
+
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime;index:idx_org_runway_alert" json:"created_at"`
+}
+
+// TableName 表名
+func (RunwayAlert) TableName() string {
+	return "runway_alerts"
+}
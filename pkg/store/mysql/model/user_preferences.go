@@ -15,6 +15,7 @@ type UserPreferences struct {
 	// 自动化设置
 	AutoSuspendOnLowBalance bool `gorm:"column:auto_suspend_on_low_balance;default:true" json:"auto_suspend_on_low_balance"` // 余额不足时自动暂停
 	AutoMigrateForPrice     bool `gorm:"column:auto_migrate_for_price;default:false" json:"auto_migrate_for_price"`          // 自动迁移到更便宜的集群
+	AutoMigrateForHealth    bool `gorm:"column:auto_migrate_for_health;default:false" json:"auto_migrate_for_health"`        // 所在集群规格不可用时自动迁移
 
 	// 通知设置
 	EmailNotifications bool `gorm:"column:email_notifications;default:true" json:"email_notifications"`
@@ -0,0 +1,53 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+type OrgMemberRepo struct {
+	db *gorm.DB
+}
+
+func NewOrgMemberRepo(db *gorm.DB) *OrgMemberRepo {
+	return &OrgMemberRepo{db: db}
+}
+
+func (r *OrgMemberRepo) Get(ctx context.Context, orgID, userID string) (*model.OrgMember, error) {
+	var member model.OrgMember
+	err := r.db.WithContext(ctx).Where("org_id = ? AND user_id = ?", orgID, userID).First(&member).Error
+	return &member, err
+}
+
+func (r *OrgMemberRepo) List(ctx context.Context, orgID string) ([]model.OrgMember, error) {
+	var members []model.OrgMember
+	err := r.db.WithContext(ctx).Where("org_id = ?", orgID).Order("created_at ASC, id ASC").Find(&members).Error
+	return members, err
+}
+
+func (r *OrgMemberRepo) Create(ctx context.Context, member *model.OrgMember) error {
+	return r.db.WithContext(ctx).Create(member).Error
+}
+
+// Count 统计组织成员数, role 为空时不过滤
+func (r *OrgMemberRepo) Count(ctx context.Context, orgID, role string) (int64, error) {
+	var total int64
+	query := r.db.WithContext(ctx).Model(&model.OrgMember{}).Where("org_id = ?", orgID)
+	if role != "" {
+		query = query.Where("role = ?", role)
+	}
+	err := query.Count(&total).Error
+	return total, err
+}
+
+func (r *OrgMemberRepo) UpdateRole(ctx context.Context, orgID, userID, role string) error {
+	return r.db.WithContext(ctx).Model(&model.OrgMember{}).
+		Where("org_id = ? AND user_id = ?", orgID, userID).
+		Update("role", role).Error
+}
+
+func (r *OrgMemberRepo) Delete(ctx context.Context, orgID, userID string) error {
+	return r.db.WithContext(ctx).Where("org_id = ? AND user_id = ?", orgID, userID).Delete(&model.OrgMember{}).Error
+}
@@ -0,0 +1,156 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+type PlacementRepo struct {
+	db *gorm.DB
+}
+
+func NewPlacementRepo(db *gorm.DB) *PlacementRepo {
+	return &PlacementRepo{db: db}
+}
+
+func (r *PlacementRepo) Create(ctx context.Context, p *model.EndpointPlacement) error {
+	return r.db.WithContext(ctx).Create(p).Error
+}
+
+func (r *PlacementRepo) Update(ctx context.Context, id int64, updates map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&model.EndpointPlacement{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r *PlacementRepo) Delete(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&model.EndpointPlacement{}).Error
+}
+
+// ListByEndpoint 获取 endpoint 的全部 placement (含 orphaned), 按 rank 排序
+func (r *PlacementRepo) ListByEndpoint(ctx context.Context, endpointID int64) ([]model.EndpointPlacement, error) {
+	var placements []model.EndpointPlacement
+	err := r.db.WithContext(ctx).
+		Where("endpoint_id = ?", endpointID).
+		Order("placement_rank ASC, id ASC").
+		Find(&placements).Error
+	return placements, err
+}
+
+// ListActive 获取所有未删除 endpoint 的 active placement
+func (r *PlacementRepo) ListActive(ctx context.Context) ([]model.EndpointPlacement, error) {
+	var placements []model.EndpointPlacement
+	err := r.db.WithContext(ctx).
+		Joins("JOIN user_endpoints ue ON ue.id = endpoint_placements.endpoint_id").
+		Where("endpoint_placements.status = ? AND ue.deleted_at IS NULL AND ue.status != 'deleted'", model.PlacementStatusActive).
+		Order("endpoint_placements.endpoint_id ASC, endpoint_placements.placement_rank ASC").
+		Find(&placements).Error
+	return placements, err
+}
+
+// ListOnUnavailableClusters 获取所在集群已不可用 (非 active 或已删除) 的在用 placement
+func (r *PlacementRepo) ListOnUnavailableClusters(ctx context.Context) ([]model.EndpointPlacement, error) {
+	var placements []model.EndpointPlacement
+	err := r.db.WithContext(ctx).
+		Joins("LEFT JOIN clusters c ON c.cluster_id = endpoint_placements.cluster_id").
+		Where("endpoint_placements.status IN ? AND (c.cluster_id IS NULL OR c.status != ?)", model.PlacementDeployedStatuses, "active").
+		Find(&placements).Error
+	return placements, err
+}
+
+// ListOrphanedOnActiveClusters 获取所在集群已恢复的 orphaned placement, 其上的部署待删除
+func (r *PlacementRepo) ListOrphanedOnActiveClusters(ctx context.Context) ([]model.EndpointPlacement, error) {
+	var placements []model.EndpointPlacement
+	err := r.db.WithContext(ctx).
+		Joins("JOIN clusters c ON c.cluster_id = endpoint_placements.cluster_id").
+		Where("endpoint_placements.status = ? AND c.status = ?", model.PlacementStatusOrphaned, "active").
+		Find(&placements).Error
+	return placements, err
+}
+
+// ListUnderPlacedEndpointIDs 获取 active placement 数少于 placement_count 的未删除 endpoint
+func (r *PlacementRepo) ListUnderPlacedEndpointIDs(ctx context.Context) ([]int64, error) {
+	var ids []int64
+	err := r.db.WithContext(ctx).
+		Table("user_endpoints ue").
+		Select("ue.id").
+		Joins("LEFT JOIN endpoint_placements p ON p.endpoint_id = ue.id AND p.status = ?", model.PlacementStatusActive).
+		Where("ue.deleted_at IS NULL AND ue.status != 'deleted'").
+		Group("ue.id, ue.placement_count").
+		Having("COUNT(p.id) < ue.placement_count").
+		Pluck("ue.id", &ids).Error
+	return ids, err
+}
+
+// ActiveOnCluster 集群上是否有其他未删除 endpoint 的在用 placement 使用该 physical name
+func (r *PlacementRepo) ActiveOnCluster(ctx context.Context, clusterID, physicalName string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&model.EndpointPlacement{}).
+		Joins("JOIN user_endpoints ue ON ue.id = endpoint_placements.endpoint_id").
+		Where("endpoint_placements.cluster_id = ? AND endpoint_placements.status IN ? AND ue.physical_name = ? AND ue.deleted_at IS NULL",
+			clusterID, model.PlacementDeployedStatuses, physicalName).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Orphan 标记在用 placement 为 orphaned, 同时将其上未下线的 worker 标记下线
+// (计费截止到最后心跳, 不早于已出账时间, 避免已出账时段之后的离线时长被计费或终止时间早于出账时间)
+func (r *PlacementRepo) Orphan(ctx context.Context, p *model.EndpointPlacement, now time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.EndpointPlacement{}).
+			Where("id = ? AND status IN ?", p.ID, model.PlacementDeployedStatuses).
+			Updates(map[string]interface{}{"status": model.PlacementStatusOrphaned, "orphaned_at": now})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return offlineWorkers(tx, p, gorm.Expr("COALESCE(pod_terminated_at, GREATEST(COALESCE(last_heartbeat, ?), COALESCE(last_billed_at, last_heartbeat, ?)))", now, now), now)
+	})
+}
+
+// Promote 迁移切换: 目标 placement 接替源 placement 的 rank 及副本配置开始路由任务, 源 placement 进入排空
+func (r *PlacementRepo) Promote(ctx context.Context, target, source *model.EndpointPlacement) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.EndpointPlacement{}).
+			Where("id = ? AND status = ?", source.ID, model.PlacementStatusActive).
+			Update("status", model.PlacementStatusDraining)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errors.New("source placement is no longer active")
+		}
+		return tx.Model(&model.EndpointPlacement{}).
+			Where("id = ? AND status = ?", target.ID, model.PlacementStatusProvisioning).
+			Updates(map[string]interface{}{
+				"status":         model.PlacementStatusActive,
+				"placement_rank": source.Rank,
+				"replicas":       source.Replicas,
+				"min_replicas":   source.MinReplicas,
+				"max_replicas":   source.MaxReplicas,
+			}).Error
+	})
+}
+
+// Remove 删除部署已删除的 placement, 同时将其上未下线的 worker 标记下线
+func (r *PlacementRepo) Remove(ctx context.Context, p *model.EndpointPlacement, now time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", p.ID).Delete(&model.EndpointPlacement{}).Error; err != nil {
+			return err
+		}
+		return offlineWorkers(tx, p, gorm.Expr("COALESCE(pod_terminated_at, ?)", now), now)
+	})
+}
+
+// offlineWorkers 将 placement 所在集群上该 endpoint 未下线的 worker 标记下线 (镜像发布的新版本 worker 由发布流程处理)
+func offlineWorkers(tx *gorm.DB, p *model.EndpointPlacement, terminatedAt interface{}, now time.Time) error {
+	return tx.Model(&model.Worker{}).
+		Where("endpoint_id = ? AND cluster_id = ? AND rollout_id IS NULL AND status != ?", p.EndpointID, p.ClusterID, "OFFLINE").
+		Updates(map[string]interface{}{
+			"status":            "OFFLINE",
+			"pod_terminated_at": terminatedAt,
+			"updated_at":        now,
+		}).Error
+}
@@ -0,0 +1,49 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PreferencesRepo struct {
+	db *gorm.DB
+}
+
+func NewPreferencesRepo(db *gorm.DB) *PreferencesRepo {
+	return &PreferencesRepo{db: db}
+}
+
+func (r *PreferencesRepo) Get(ctx context.Context, userID string) (*model.UserPreferences, error) {
+	var prefs model.UserPreferences
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&prefs).Error
+	return &prefs, err
+}
+
+// Save 创建或更新用户偏好 (Select("*") 保证 false/0 也会写入, 不被列默认值覆盖)
+func (r *PreferencesRepo) Save(ctx context.Context, prefs *model.UserPreferences) error {
+	return r.db.WithContext(ctx).Select("*").Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{
+			"daily_budget_limit", "monthly_budget_limit", "auto_suspend_on_low_balance",
+			"auto_migrate_for_price", "auto_migrate_for_health", "email_notifications", "low_balance_alert", "updated_at",
+		}),
+	}).Create(prefs).Error
+}
+
+func (r *PreferencesRepo) Delete(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&model.UserPreferences{}).Error
+}
+
+// CreateAlert 记录预算告警, 已存在时忽略, 返回是否新建
+func (r *PreferencesRepo) CreateAlert(ctx context.Context, alert *model.BudgetAlert) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(alert)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *PreferencesRepo) ListAlerts(ctx context.Context, orgID, userID string, limit int) ([]model.BudgetAlert, error) {
+	var alerts []model.BudgetAlert
+	err := r.db.WithContext(ctx).Where("org_id = ? AND user_id = ?", orgID, userID).Order("created_at DESC").Limit(limit).Find(&alerts).Error
+	return alerts, err
+}
@@ -0,0 +1,199 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PriceChangeRepo struct {
+	db *gorm.DB
+}
+
+func NewPriceChangeRepo(db *gorm.DB) *PriceChangeRepo {
+	return &PriceChangeRepo{db: db}
+}
+
+func (r *PriceChangeRepo) Create(ctx context.Context, change *model.SpecPriceChange) error {
+	return r.db.WithContext(ctx).Create(change).Error
+}
+
+func (r *PriceChangeRepo) GetByID(ctx context.Context, id int64) (*model.SpecPriceChange, error) {
+	var change model.SpecPriceChange
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&change).Error
+	return &change, err
+}
+
+// List 列出计划调价, specName/status 为空时不过滤
+func (r *PriceChangeRepo) List(ctx context.Context, specName, status string) ([]model.SpecPriceChange, error) {
+	var changes []model.SpecPriceChange
+	query := r.db.WithContext(ctx)
+	if specName != "" {
+		query = query.Where("spec_name = ?", specName)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("effective_at DESC, id DESC").Find(&changes).Error
+	return changes, err
+}
+
+// ListScheduledForOrg 列出影响组织 endpoint 的待生效调价
+func (r *PriceChangeRepo) ListScheduledForOrg(ctx context.Context, orgID string) ([]model.SpecPriceChange, error) {
+	var changes []model.SpecPriceChange
+	err := r.db.WithContext(ctx).
+		Where("status = ?", model.PriceChangeStatusScheduled).
+		Where("spec_name IN (?)", r.db.Model(&model.UserEndpoint{}).Select("spec_name").
+			Where("org_id = ? AND deleted_at IS NULL AND status != 'deleted'", orgID)).
+		Order("effective_at ASC, id ASC").
+		Find(&changes).Error
+	return changes, err
+}
+
+// Cancel 取消尚未生效的调价, 返回是否取消成功
+func (r *PriceChangeRepo) Cancel(ctx context.Context, id int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&model.SpecPriceChange{}).
+		Where("id = ? AND status = ?", id, model.PriceChangeStatusScheduled).
+		Update("status", model.PriceChangeStatusCancelled)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListDue 列出已到生效时间的调价, 按生效时间先后
+func (r *PriceChangeRepo) ListDue(ctx context.Context, now time.Time) ([]model.SpecPriceChange, error) {
+	var changes []model.SpecPriceChange
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND effective_at <= ?", model.PriceChangeStatusScheduled, now).
+		Order("effective_at ASC, id ASC").
+		Find(&changes).Error
+	return changes, err
+}
+
+// RepriceFunc 计算 endpoint 在调价后的锁定价格 (price 为调价币种的新价格), ok 为 false 表示不受此次调价影响
+type RepriceFunc func(change *model.SpecPriceChange, baseCurrency string, endpoint *model.UserEndpoint, price int64) (newPrice int64, ok bool, err error)
+
+// Apply 在同一事务内更新规格价格 (或该币种标价)、迁移该规格下受影响 endpoint 的锁定价格并记录价格历史, 返回迁移的 endpoint 数.
+// 调价已被处理 (并发或已取消) 时返回 0
+func (r *PriceChangeRepo) Apply(ctx context.Context, id int64, now time.Time, reprice RepriceFunc) (int, error) {
+	affected := 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var change model.SpecPriceChange
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ?", id, model.PriceChangeStatusScheduled).
+			First(&change).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		var spec model.SpecPricing
+		if err := tx.Where("spec_name = ?", change.SpecName).First(&spec).Error; err != nil {
+			return err
+		}
+		specUpdates := map[string]interface{}{"price_per_hour": change.PricePerHour}
+		if change.SpotPricePerHour != nil {
+			specUpdates["spot_price_per_hour"] = *change.SpotPricePerHour
+		}
+		if change.Currency == spec.Currency {
+			if err := tx.Model(&model.SpecPricing{}).Where("spec_name = ?", change.SpecName).Updates(specUpdates).Error; err != nil {
+				return err
+			}
+		} else {
+			// 非基础币种: 更新该币种的标价
+			if err := tx.Model(&model.SpecCurrencyPrice{}).
+				Where("spec_name = ? AND currency = ?", change.SpecName, change.Currency).
+				Updates(specUpdates).Error; err != nil {
+				return err
+			}
+		}
+
+		var endpoints []model.UserEndpoint
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("spec_name = ? AND deleted_at IS NULL AND status != 'deleted'", change.SpecName).
+			Find(&endpoints).Error; err != nil {
+			return err
+		}
+		for _, ep := range endpoints {
+			newPrice := change.PricePerHour
+			if ep.Spot {
+				if change.SpotPricePerHour == nil {
+					continue
+				}
+				newPrice = *change.SpotPricePerHour
+			}
+			newPrice, ok, err := reprice(&change, spec.Currency, &ep, newPrice)
+			if err != nil {
+				return err
+			}
+			if !ok || newPrice == ep.PricePerHour {
+				continue
+			}
+			if err := tx.Create(&model.EndpointPriceHistory{
+				EndpointID:      ep.ID,
+				ChangeID:        change.ID,
+				OldPricePerHour: ep.PricePerHour,
+				NewPricePerHour: newPrice,
+				EffectiveFrom:   change.EffectiveAt,
+			}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&model.UserEndpoint{}).Where("id = ?", ep.ID).Update("price_per_hour", newPrice).Error; err != nil {
+				return err
+			}
+			affected++
+		}
+
+		return tx.Model(&change).Updates(map[string]interface{}{
+			"status":             model.PriceChangeStatusApplied,
+			"applied_at":         now,
+			"affected_endpoints": affected,
+		}).Error
+	})
+	return affected, err
+}
+
+// ListHistoryAfter 获取 endpoint 在 after 之后生效的价格变更, 按生效时间先后
+func (r *PriceChangeRepo) ListHistoryAfter(ctx context.Context, endpointID int64, after time.Time) ([]model.EndpointPriceHistory, error) {
+	var history []model.EndpointPriceHistory
+	err := r.db.WithContext(ctx).
+		Where("endpoint_id = ? AND effective_from > ?", endpointID, after).
+		Order("effective_from ASC, id ASC").
+		Find(&history).Error
+	return history, err
+}
+
+// EndpointPriceHistoryWithName 带 endpoint 名称的价格历史
+type EndpointPriceHistoryWithName struct {
+	model.EndpointPriceHistory
+	EndpointName string `gorm:"column:endpoint_name"`
+	SpecName     string `gorm:"column:spec_name"`
+}
+
+// ListHistoryByOrg 列出组织 endpoint 的价格历史, endpointName 为空时不过滤
+func (r *PriceChangeRepo) ListHistoryByOrg(ctx context.Context, orgID, endpointName string, limit, offset int) ([]EndpointPriceHistoryWithName, int64, error) {
+	query := func() *gorm.DB {
+		q := r.db.WithContext(ctx).
+			Table("endpoint_price_history h").
+			Joins("JOIN user_endpoints ue ON h.endpoint_id = ue.id").
+			Where("ue.org_id = ?", orgID)
+		if endpointName != "" {
+			q = q.Where("ue.logical_name = ?", endpointName)
+		}
+		return q
+	}
+
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var records []EndpointPriceHistoryWithName
+	err := query().Select("h.*, ue.logical_name as endpoint_name, ue.spec_name").
+		Order("h.effective_from DESC, h.id DESC").
+		Limit(limit).Offset(offset).
+		Find(&records).Error
+	return records, total, err
+}
@@ -0,0 +1,59 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+type PricingRepo struct {
+	db *gorm.DB
+}
+
+func NewPricingRepo(db *gorm.DB) *PricingRepo {
+	return &PricingRepo{db: db}
+}
+
+// ListOverrides 列出集群覆盖价格, clusterID/specName 为空时不过滤
+func (r *PricingRepo) ListOverrides(ctx context.Context, clusterID, specName string) ([]model.ClusterPricingOverride, error) {
+	var overrides []model.ClusterPricingOverride
+	query := r.db.WithContext(ctx)
+	if clusterID != "" {
+		query = query.Where("cluster_id = ?", clusterID)
+	}
+	if specName != "" {
+		query = query.Where("spec_name = ?", specName)
+	}
+	err := query.Order("cluster_id, spec_name, effective_from").Find(&overrides).Error
+	return overrides, err
+}
+
+// ListOverridesInWindow 获取与 [from, to) 有交集的覆盖价格
+func (r *PricingRepo) ListOverridesInWindow(ctx context.Context, clusterID, specName string, from, to time.Time) ([]model.ClusterPricingOverride, error) {
+	var overrides []model.ClusterPricingOverride
+	err := r.db.WithContext(ctx).
+		Where("cluster_id = ? AND spec_name = ?", clusterID, specName).
+		Where("(effective_from IS NULL OR effective_from < ?) AND (effective_until IS NULL OR effective_until > ?)", to, from).
+		Find(&overrides).Error
+	return overrides, err
+}
+
+func (r *PricingRepo) GetOverride(ctx context.Context, id int64) (*model.ClusterPricingOverride, error) {
+	var override model.ClusterPricingOverride
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&override).Error
+	return &override, err
+}
+
+func (r *PricingRepo) CreateOverride(ctx context.Context, override *model.ClusterPricingOverride) error {
+	return r.db.WithContext(ctx).Create(override).Error
+}
+
+func (r *PricingRepo) UpdateOverride(ctx context.Context, id int64, updates map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&model.ClusterPricingOverride{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r *PricingRepo) DeleteOverride(ctx context.Context, id int64) error {
+	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&model.ClusterPricingOverride{}).Error
+}
@@ -25,18 +25,18 @@ func (r *RegistryCredentialRepo) GetByID(ctx context.Context, id int64) (*model.
 	return &cred, err
 }
 
-func (r *RegistryCredentialRepo) GetByName(ctx context.Context, userID, name string) (*model.RegistryCredential, error) {
+func (r *RegistryCredentialRepo) GetByName(ctx context.Context, orgID, name string) (*model.RegistryCredential, error) {
 	var cred model.RegistryCredential
-	err := r.db.WithContext(ctx).Where("user_id = ? AND name = ?", userID, name).First(&cred).Error
+	err := r.db.WithContext(ctx).Where("org_id = ? AND name = ?", orgID, name).First(&cred).Error
 	return &cred, err
 }
 
-func (r *RegistryCredentialRepo) List(ctx context.Context, userID string) ([]model.RegistryCredential, error) {
+func (r *RegistryCredentialRepo) List(ctx context.Context, orgID string) ([]model.RegistryCredential, error) {
 	var creds []model.RegistryCredential
-	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&creds).Error
+	err := r.db.WithContext(ctx).Where("org_id = ?", orgID).Order("created_at DESC").Find(&creds).Error
 	return creds, err
 }
 
-func (r *RegistryCredentialRepo) Delete(ctx context.Context, userID string, name string) error {
-	return r.db.WithContext(ctx).Where("user_id = ? AND name = ?", userID, name).Delete(&model.RegistryCredential{}).Error
+func (r *RegistryCredentialRepo) Delete(ctx context.Context, orgID string, name string) error {
+	return r.db.WithContext(ctx).Where("org_id = ? AND name = ?", orgID, name).Delete(&model.RegistryCredential{}).Error
 }
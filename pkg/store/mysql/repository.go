@@ -28,7 +28,8 @@ func NewRepository() (*Repository, error) {
 	}
 
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: gormlogger.Default.LogMode(logLevel),
+		Logger:         gormlogger.Default.LogMode(logLevel),
+		TranslateError: true, // 唯一键冲突转换为 gorm.ErrDuplicatedKey
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
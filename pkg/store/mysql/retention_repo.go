@@ -0,0 +1,64 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+type RetentionRepo struct {
+	db *gorm.DB
+}
+
+func NewRetentionRepo(db *gorm.DB) *RetentionRepo {
+	return &RetentionRepo{db: db}
+}
+
+// ListExpiredTransactions 按 ID 顺序获取一批早于 cutoff 且已投递主站的计费流水
+func (r *RetentionRepo) ListExpiredTransactions(ctx context.Context, cutoff time.Time, limit int) ([]model.BillingTransaction, error) {
+	var txs []model.BillingTransaction
+	err := r.db.WithContext(ctx).
+		Where("billing_period_start < ? AND delivery_status = ?", cutoff, model.DeliveryStatusSent).
+		Order("id ASC").Limit(limit).
+		Find(&txs).Error
+	return txs, err
+}
+
+// ListExpiredTaskRoutings 按 ID 顺序获取一批早于 cutoff 的任务路由
+func (r *RetentionRepo) ListExpiredTaskRoutings(ctx context.Context, cutoff time.Time, limit int) ([]model.TaskRouting, error) {
+	var tasks []model.TaskRouting
+	err := r.db.WithContext(ctx).
+		Where("submitted_at < ?", cutoff).
+		Order("id ASC").Limit(limit).
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// PurgeBatch 在一个事务内写入日汇总 (可选, 仅汇总计费成功的流水, 按币种分开)、归档记录 (可选) 并删除本批数据
+func (r *RetentionRepo) PurgeBatch(ctx context.Context, table string, ids []int64, rollup bool, archive *model.DataArchive) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if rollup {
+			if err := tx.Exec(`INSERT INTO billing_daily_rollups
+				(day, user_id, org_id, endpoint_id, cluster_id, gpu_type, currency, amount, duration_seconds, transaction_count, updated_at)
+				SELECT DATE(billing_period_start), user_id, COALESCE(org_id, ''), endpoint_id, cluster_id, COALESCE(gpu_type, ''), currency,
+					SUM(amount), SUM(duration_seconds), COUNT(*), NOW()
+				FROM billing_transactions WHERE id IN ? AND status = ?
+				GROUP BY DATE(billing_period_start), user_id, COALESCE(org_id, ''), endpoint_id, cluster_id, COALESCE(gpu_type, ''), currency
+				ON DUPLICATE KEY UPDATE
+					amount = amount + VALUES(amount),
+					duration_seconds = duration_seconds + VALUES(duration_seconds),
+					transaction_count = transaction_count + VALUES(transaction_count),
+					updated_at = NOW()`, ids, "success").Error; err != nil {
+				return err
+			}
+		}
+		if archive != nil {
+			if err := tx.Create(archive).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec("DELETE FROM "+table+" WHERE id IN ?", ids).Error
+	})
+}
@@ -0,0 +1,65 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RevisionRepo struct {
+	db *gorm.DB
+}
+
+func NewRevisionRepo(db *gorm.DB) *RevisionRepo {
+	return &RevisionRepo{db: db}
+}
+
+// Create 写入 revision, 编号取该 endpoint 当前最大编号 + 1 (锁住 endpoint 行避免并发编号冲突)
+func (r *RevisionRepo) Create(ctx context.Context, rev *model.EndpointRevision) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var endpointID int64
+		if err := tx.Model(&model.UserEndpoint{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", rev.EndpointID).
+			Pluck("id", &endpointID).Error; err != nil {
+			return err
+		}
+		var latest int
+		if err := tx.Model(&model.EndpointRevision{}).
+			Where("endpoint_id = ?", rev.EndpointID).
+			Select("COALESCE(MAX(revision), 0)").
+			Scan(&latest).Error; err != nil {
+			return err
+		}
+		rev.Revision = latest + 1
+		return tx.Create(rev).Error
+	})
+}
+
+// Latest 获取 endpoint 最新的 revision
+func (r *RevisionRepo) Latest(ctx context.Context, endpointID int64) (*model.EndpointRevision, error) {
+	var rev model.EndpointRevision
+	err := r.db.WithContext(ctx).
+		Where("endpoint_id = ?", endpointID).
+		Order("revision DESC").
+		First(&rev).Error
+	return &rev, err
+}
+
+func (r *RevisionRepo) GetByRevision(ctx context.Context, endpointID int64, revision int) (*model.EndpointRevision, error) {
+	var rev model.EndpointRevision
+	err := r.db.WithContext(ctx).Where("endpoint_id = ? AND revision = ?", endpointID, revision).First(&rev).Error
+	return &rev, err
+}
+
+func (r *RevisionRepo) ListByEndpoint(ctx context.Context, endpointID int64, limit int) ([]model.EndpointRevision, error) {
+	var revs []model.EndpointRevision
+	err := r.db.WithContext(ctx).
+		Where("endpoint_id = ?", endpointID).
+		Order("revision DESC").
+		Limit(limit).
+		Find(&revs).Error
+	return revs, err
+}
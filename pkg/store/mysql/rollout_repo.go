@@ -0,0 +1,90 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+type RolloutRepo struct {
+	db *gorm.DB
+}
+
+func NewRolloutRepo(db *gorm.DB) *RolloutRepo {
+	return &RolloutRepo{db: db}
+}
+
+func (r *RolloutRepo) Create(ctx context.Context, rollout *model.EndpointRollout) error {
+	return r.db.WithContext(ctx).Create(rollout).Error
+}
+
+func (r *RolloutRepo) Update(ctx context.Context, id int64, updates map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&model.EndpointRollout{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r *RolloutRepo) GetByID(ctx context.Context, endpointID, id int64) (*model.EndpointRollout, error) {
+	var rollout model.EndpointRollout
+	err := r.db.WithContext(ctx).Where("id = ? AND endpoint_id = ?", id, endpointID).First(&rollout).Error
+	return &rollout, err
+}
+
+// GetInProgress 获取 endpoint 进行中的发布
+func (r *RolloutRepo) GetInProgress(ctx context.Context, endpointID int64) (*model.EndpointRollout, error) {
+	var rollout model.EndpointRollout
+	err := r.db.WithContext(ctx).
+		Where("endpoint_id = ? AND status IN ?", endpointID, model.RolloutInProgressStatuses).
+		First(&rollout).Error
+	return &rollout, err
+}
+
+// ListInProgress 获取所有进行中的发布
+func (r *RolloutRepo) ListInProgress(ctx context.Context) ([]model.EndpointRollout, error) {
+	var rollouts []model.EndpointRollout
+	err := r.db.WithContext(ctx).
+		Where("status IN ?", model.RolloutInProgressStatuses).
+		Order("id ASC").
+		Find(&rollouts).Error
+	return rollouts, err
+}
+
+func (r *RolloutRepo) ListByEndpoint(ctx context.Context, endpointID int64, limit int) ([]model.EndpointRollout, error) {
+	var rollouts []model.EndpointRollout
+	err := r.db.WithContext(ctx).
+		Where("endpoint_id = ?", endpointID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&rollouts).Error
+	return rollouts, err
+}
+
+// Transition 仅在状态仍为 from 时更新, 返回是否更新
+func (r *RolloutRepo) Transition(ctx context.Context, id int64, from string, updates map[string]interface{}) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.EndpointRollout{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+// Finish 结束发布 (新版本部署已删除), 同时将新版本未下线的 worker 标记下线
+func (r *RolloutRepo) Finish(ctx context.Context, rollout *model.EndpointRollout, updates map[string]interface{}, now time.Time) (bool, error) {
+	var ok bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.EndpointRollout{}).
+			Where("id = ? AND status = ?", rollout.ID, rollout.Status).
+			Updates(updates)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		ok = true
+		return tx.Model(&model.Worker{}).
+			Where("rollout_id = ? AND status != ?", rollout.ID, "OFFLINE").
+			Updates(map[string]interface{}{
+				"status":            "OFFLINE",
+				"pod_terminated_at": gorm.Expr("COALESCE(pod_terminated_at, ?)", now),
+				"updated_at":        now,
+			}).Error
+	})
+	return ok, err
+}
@@ -0,0 +1,40 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
+	"gorm.io/gorm"
+)
+
+type RunwayRepo struct {
+	db *gorm.DB
+}
+
+func NewRunwayRepo(db *gorm.DB) *RunwayRepo {
+	return &RunwayRepo{db: db}
+}
+
+func (r *RunwayRepo) GetState(ctx context.Context, orgID string) (*model.OrgBillingState, error) {
+	var state model.OrgBillingState
+	err := r.db.WithContext(ctx).Where("org_id = ?", orgID).First(&state).Error
+	return &state, err
+}
+
+// SaveState 保存组织余额预测状态 (不存在时创建)
+func (r *RunwayRepo) SaveState(ctx context.Context, state *model.OrgBillingState) error {
+	return r.db.WithContext(ctx).Save(state).Error
+}
+
+func (r *RunwayRepo) CreateAlert(ctx context.Context, alert *model.RunwayAlert) error {
+	return r.db.WithContext(ctx).Create(alert).Error
+}
+
+func (r *RunwayRepo) ListAlerts(ctx context.Context, orgID string, limit int) ([]model.RunwayAlert, error) {
+	var alerts []model.RunwayAlert
+	err := r.db.WithContext(ctx).Where("org_id = ?", orgID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&alerts).Error
+	return alerts, err
+}
@@ -16,26 +16,28 @@ func NewSpecRepo(db *gorm.DB) *SpecRepo {
 }
 
 type SpecWithAvailability struct {
-	SpecName          string `json:"spec_name"`
-	SpecType          string `json:"spec_type"`
-	GPUType           string `json:"gpu_type,omitempty"`
-	GPUCount          int    `json:"gpu_count"`
-	CPUCores          int    `json:"cpu_cores"`
-	RAMGB             int    `json:"ram_gb"`
-	DiskGB            int    `json:"disk_gb"`
-	PricePerHour      int64  `json:"price_per_hour"`
-	Currency          string `json:"currency"`
-	Description       string `json:"description"`
-	AvailableClusters int    `json:"available_clusters"`
-	TotalCapacity     int    `json:"total_capacity"`
-	AvailableCapacity int    `json:"available_capacity"`
+	SpecName           string `json:"spec_name"`
+	SpecType           string `json:"spec_type"`
+	GPUType            string `json:"gpu_type,omitempty"`
+	GPUCount           int    `json:"gpu_count"`
+	CPUCores           int    `json:"cpu_cores"`
+	RAMGB              int    `json:"ram_gb"`
+	DiskGB             int    `json:"disk_gb"`
+	PricePerHour       int64  `json:"price_per_hour"`
+	SpotPricePerHour   int64  `json:"spot_price_per_hour"`
+	TaskPricePerSecond int64  `json:"task_price_per_second"`
+	Currency           string `json:"currency"`
+	Description        string `json:"description"`
+	AvailableClusters  int    `json:"available_clusters"`
+	TotalCapacity      int    `json:"total_capacity"`
+	AvailableCapacity  int    `json:"available_capacity"`
 }
 
 func (r *SpecRepo) ListWithAvailability(ctx context.Context, specType string) ([]SpecWithAvailability, error) {
 	query := `
 		SELECT 
 			sp.spec_name, sp.spec_type, sp.gpu_type, sp.gpu_count, sp.cpu_cores, sp.ram_gb, sp.disk_gb,
-			sp.price_per_hour, sp.currency, sp.description,
+			sp.price_per_hour, sp.spot_price_per_hour, sp.task_price_per_second, sp.currency, sp.description,
 			COALESCE(agg.available_clusters, 0) as available_clusters,
 			COALESCE(agg.total_capacity, 0) as total_capacity,
 			COALESCE(agg.available_capacity, 0) as available_capacity
@@ -21,10 +21,10 @@ func (r *TaskRepo) Create(ctx context.Context, task *model.TaskRouting) error {
 	return r.db.WithContext(ctx).Create(task).Error
 }
 
-// GetByTaskID 根据 TaskID 获取
-func (r *TaskRepo) GetByTaskID(ctx context.Context, taskID, userID string) (*model.TaskRouting, error) {
+// GetByTaskID 根据 TaskID 获取组织内的任务
+func (r *TaskRepo) GetByTaskID(ctx context.Context, taskID, orgID string) (*model.TaskRouting, error) {
 	var task model.TaskRouting
-	err := r.db.WithContext(ctx).Where("task_id = ? AND user_id = ?", taskID, userID).First(&task).Error
+	err := r.db.WithContext(ctx).Where("task_id = ? AND org_id = ?", taskID, orgID).First(&task).Error
 	return &task, err
 }
 
@@ -44,10 +44,68 @@ func (r *TaskRepo) Update(ctx context.Context, taskID, status, workerID string,
 	return r.db.WithContext(ctx).Model(&model.TaskRouting{}).Where("task_id = ?", taskID).Updates(updates).Error
 }
 
-// List 列出用户任务 (关联 endpoint 获取 name)
-func (r *TaskRepo) List(ctx context.Context, userID, status string, limit, offset int) ([]map[string]interface{}, int64, error) {
+// CountInFlight 统计 endpoint 在集群上未完成 (PENDING, IN_PROGRESS) 的任务数
+func (r *TaskRepo) CountInFlight(ctx context.Context, endpointID int64, clusterID string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.TaskRouting{}).
+		Where("endpoint_id = ? AND cluster_id = ? AND status IN ?", endpointID, clusterID, []string{"PENDING", "IN_PROGRESS"}).
+		Count(&count).Error
+	return count, err
+}
+
+// CountOutcomes 统计 endpoint 在 [from, to) 内提交且已结束的任务数及失败 (FAILED, TIMEOUT) 数,
+// rolloutID 为空时统计原版本的任务
+func (r *TaskRepo) CountOutcomes(ctx context.Context, endpointID int64, rolloutID *int64, from, to time.Time) (total, failed int64, err error) {
+	var row struct {
+		Total  int64
+		Failed int64
+	}
+	err = r.db.WithContext(ctx).Model(&model.TaskRouting{}).
+		Select("COUNT(*) AS total, COALESCE(SUM(status IN ('FAILED', 'TIMEOUT')), 0) AS failed").
+		Where("endpoint_id = ? AND rollout_id <=> ? AND submitted_at >= ? AND submitted_at < ? AND status IN ?",
+			endpointID, rolloutID, from, to, []string{"COMPLETED", "FAILED", "TIMEOUT"}).
+		Scan(&row).Error
+	return row.Total, row.Failed, err
+}
+
+// ListExecutedInWindow 获取 endpoint 在 [from, to) 内完成且有执行时长的任务 (不含 input)
+func (r *TaskRepo) ListExecutedInWindow(ctx context.Context, endpointID int64, from, to time.Time) ([]model.TaskRouting, error) {
+	var tasks []model.TaskRouting
+	err := r.db.WithContext(ctx).
+		Select("id, task_id, worker_id, status, submitted_at, completed_at, execution_time_ms").
+		Where("endpoint_id = ? AND completed_at >= ? AND completed_at < ? AND execution_time_ms > 0", endpointID, from, to).
+		Order("completed_at").
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// ListUnbilled 获取按任务计费的 endpoint 下已进入终态且尚未出账的任务 (不含 input)
+func (r *TaskRepo) ListUnbilled(ctx context.Context, limit int) ([]model.TaskRouting, error) {
+	var tasks []model.TaskRouting
+	err := r.db.WithContext(ctx).
+		Select("task_routing.id, task_routing.task_id, task_routing.user_id, task_routing.org_id, task_routing.endpoint_id, "+
+			"task_routing.cluster_id, task_routing.worker_id, task_routing.status, task_routing.completed_at, task_routing.execution_time_ms").
+		Joins("JOIN user_endpoints ue ON ue.id = task_routing.endpoint_id").
+		Where("ue.billing_mode = ? AND task_routing.status IN ? AND task_routing.billed_at IS NULL",
+			model.BillingModeTaskExecution, model.TaskTerminalStatuses).
+		Order("task_routing.id").
+		Limit(limit).
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// MarkBilled 标记任务已出账, 返回是否由本次标记 (已出账时返回 false)
+func (r *TaskRepo) MarkBilled(ctx context.Context, taskID string, billedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&model.TaskRouting{}).
+		Where("task_id = ? AND billed_at IS NULL", taskID).
+		Update("billed_at", billedAt)
+	return result.RowsAffected > 0, result.Error
+}
+
+// List 列出组织任务 (关联 endpoint 获取 name)
+func (r *TaskRepo) List(ctx context.Context, orgID, status string, limit, offset int) ([]map[string]interface{}, int64, error) {
 	var total int64
-	query := r.db.WithContext(ctx).Model(&model.TaskRouting{}).Where("task_routing.user_id = ?", userID)
+	query := r.db.WithContext(ctx).Model(&model.TaskRouting{}).Where("task_routing.org_id = ?", orgID)
 	if status != "" && status != "all" {
 		query = query.Where("task_routing.status = ?", status)
 	}
@@ -57,7 +115,7 @@ func (r *TaskRepo) List(ctx context.Context, userID, status string, limit, offse
 	err := r.db.WithContext(ctx).Table("task_routing").
 		Select("task_routing.*, user_endpoints.logical_name as endpoint").
 		Joins("LEFT JOIN user_endpoints ON task_routing.endpoint_id = user_endpoints.id").
-		Where("task_routing.user_id = ?", userID).
+		Where("task_routing.org_id = ?", orgID).
 		Scopes(func(db *gorm.DB) *gorm.DB {
 			if status != "" && status != "all" {
 				return db.Where("task_routing.status = ?", status)
@@ -72,14 +130,14 @@ func (r *TaskRepo) List(ctx context.Context, userID, status string, limit, offse
 }
 
 // GetOverview 获取任务总览统计
-func (r *TaskRepo) GetOverview(ctx context.Context, userID string) (map[string]int64, error) {
+func (r *TaskRepo) GetOverview(ctx context.Context, orgID string) (map[string]int64, error) {
 	var results []struct {
 		Status string
 		Count  int64
 	}
 	err := r.db.WithContext(ctx).Model(&model.TaskRouting{}).
 		Select("status, COUNT(*) as count").
-		Where("user_id = ?", userID).
+		Where("org_id = ?", orgID).
 		Group("status").
 		Scan(&results).Error
 	if err != nil {
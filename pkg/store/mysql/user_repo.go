@@ -28,3 +28,9 @@ func (r *UserRepo) CreateBalance(ctx context.Context, user *model.UserBalance) e
 func (r *UserRepo) UpdateBalance(ctx context.Context, userID string, updates map[string]interface{}) error {
 	return r.db.WithContext(ctx).Model(&model.UserBalance{}).Where("user_id = ?", userID).Updates(updates).Error
 }
+
+func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*model.UserBalance, error) {
+	var user model.UserBalance
+	err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	return &user, err
+}
@@ -2,6 +2,7 @@ package mysql
 
 import (
 	"context"
+	"time"
 
 	"github.com/wavespeedai/waverless-portal/pkg/store/mysql/model"
 	"gorm.io/gorm"
@@ -15,6 +16,11 @@ func NewWorkerRepo(db *gorm.DB) *WorkerRepo {
 	return &WorkerRepo{db: db}
 }
 
+// Workers 与计费流水同事务的 worker repo
+func (r *BillingRepo) Workers() *WorkerRepo {
+	return &WorkerRepo{db: r.db}
+}
+
 // ListByEndpoint 获取 Endpoint 的 Workers (不包含 OFFLINE)
 func (r *WorkerRepo) ListByEndpoint(ctx context.Context, endpointID int64) ([]model.Worker, error) {
 	var workers []model.Worker
@@ -52,6 +58,22 @@ func (r *WorkerRepo) Update(ctx context.Context, workerID string, updates map[st
 	return r.db.WithContext(ctx).Model(&model.Worker{}).Where("worker_id = ?", workerID).Updates(updates).Error
 }
 
+// AdvanceBilledAt 仅当 last_billed_at 仍为 from 时推进到 to (不累加计费统计), 返回是否更新
+func (r *WorkerRepo) AdvanceBilledAt(ctx context.Context, workerID string, from *time.Time, to time.Time, final bool) (bool, error) {
+	query := r.db.WithContext(ctx).Model(&model.Worker{}).Where("worker_id = ?", workerID)
+	if from == nil {
+		query = query.Where("last_billed_at IS NULL")
+	} else {
+		query = query.Where("last_billed_at = ?", *from)
+	}
+	updates := map[string]interface{}{"last_billed_at": to}
+	if final {
+		updates["billing_status"] = "final_billed"
+	}
+	result := query.Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
 // GetBillableWorkers 获取需要计费的 Workers
 func (r *WorkerRepo) GetBillableWorkers(ctx context.Context) ([]model.Worker, error) {
 	var workers []model.Worker
@@ -60,3 +82,24 @@ func (r *WorkerRepo) GetBillableWorkers(ctx context.Context) ([]model.Worker, er
 		Find(&workers).Error
 	return workers, err
 }
+
+// ListRunningByOrg 获取组织下正在计费的 Workers
+func (r *WorkerRepo) ListRunningByOrg(ctx context.Context, orgID string) ([]model.Worker, error) {
+	var workers []model.Worker
+	err := r.db.WithContext(ctx).
+		Joins("JOIN user_endpoints ue ON ue.id = workers.endpoint_id").
+		Where("ue.org_id = ? AND workers.billing_status = ? AND workers.pod_started_at IS NOT NULL AND workers.pod_terminated_at IS NULL", orgID, "active").
+		Find(&workers).Error
+	return workers, err
+}
+
+// ListByEndpointInWindow 获取与 [from, to) 有交集的 Workers (含已终止), 用于按历史重放成本
+func (r *WorkerRepo) ListByEndpointInWindow(ctx context.Context, endpointID int64, from, to time.Time) ([]model.Worker, error) {
+	var workers []model.Worker
+	err := r.db.WithContext(ctx).
+		Where("endpoint_id = ? AND pod_started_at IS NOT NULL AND pod_started_at < ?", endpointID, to).
+		Where("pod_terminated_at IS NULL OR pod_terminated_at > ?", from).
+		Order("pod_started_at").
+		Find(&workers).Error
+	return workers, err
+}
@@ -4,25 +4,30 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/wavespeedai/waverless-portal/pkg/metrics"
 )
 
 // Client Waverless API 客户端
 type Client struct {
+	clusterID  string // 指标标签
 	baseURL    string
 	apiKey     string
 	httpClient *http.Client
 }
 
-// NewClient 创建 Waverless 客户端
-func NewClient(baseURL, apiKey string) *Client {
+// NewClient 创建集群的 Waverless 客户端
+func NewClient(clusterID, baseURL, apiKey string) *Client {
 	return &Client{
-		baseURL: baseURL,
-		apiKey:  apiKey,
+		clusterID: clusterID,
+		baseURL:   baseURL,
+		apiKey:    apiKey,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -51,6 +56,7 @@ type CreateEndpointRequest struct {
 	PriorityBoost      int                 `json:"priorityBoost,omitempty"`
 	Env                map[string]string   `json:"env,omitempty"`
 	RegistryCredential *RegistryCredential `json:"registryCredential,omitempty"`
+	Spot               bool                `json:"spot,omitempty"` // 调度到可抢占节点
 }
 
 // RegistryCredential for private container registries
@@ -79,21 +85,37 @@ type TaskResponse struct {
 	Error         string                 `json:"error,omitempty"`
 }
 
+// StatusError waverless 返回的 HTTP 错误 (status >= 400)
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// IsNotFound 是否为资源不存在 (404)
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
 // CreateEndpoint 创建 Endpoint
 func (c *Client) CreateEndpoint(ctx context.Context, req *CreateEndpointRequest) error {
-	return c.doRequest(ctx, "POST", "/api/v1/endpoints", req, nil)
+	return c.doRequest(ctx, "CreateEndpoint", "POST", "/api/v1/endpoints", req, nil)
 }
 
 // GetEndpoint 获取 Endpoint 详情
 func (c *Client) GetEndpoint(ctx context.Context, name string) (map[string]interface{}, error) {
 	var resp map[string]interface{}
-	err := c.doRequest(ctx, "GET", fmt.Sprintf("/api/v1/endpoints/%s", name), nil, &resp)
+	err := c.doRequest(ctx, "GetEndpoint", "GET", fmt.Sprintf("/api/v1/endpoints/%s", name), nil, &resp)
 	return resp, err
 }
 
 // DeleteEndpoint 删除 Endpoint
 func (c *Client) DeleteEndpoint(ctx context.Context, name string) error {
-	return c.doRequest(ctx, "DELETE", fmt.Sprintf("/api/v1/endpoints/%s", name), nil, nil)
+	return c.doRequest(ctx, "DeleteEndpoint", "DELETE", fmt.Sprintf("/api/v1/endpoints/%s", name), nil, nil)
 }
 
 // UpdateEndpointDeployment 更新 Endpoint 部署 (replicas, image, env)
@@ -109,30 +131,32 @@ func (c *Client) UpdateEndpointDeployment(ctx context.Context, name string, repl
 	if len(env) > 0 {
 		body["env"] = env
 	}
-	return c.doRequest(ctx, "PATCH", fmt.Sprintf("/api/v1/endpoints/%s/deployment", name), body, nil)
+	return c.doRequest(ctx, "UpdateEndpointDeployment", "PATCH", fmt.Sprintf("/api/v1/endpoints/%s/deployment", name), body, nil)
 }
 
 // UpdateEndpointConfig 更新 Endpoint 配置
 func (c *Client) UpdateEndpointConfig(ctx context.Context, name string, config map[string]interface{}) error {
-	return c.doRequest(ctx, "PUT", fmt.Sprintf("/api/v1/autoscaler/endpoints/%s", name), config, nil)
+	return c.doRequest(ctx, "UpdateEndpointConfig", "PUT", fmt.Sprintf("/api/v1/autoscaler/endpoints/%s", name), config, nil)
 }
 
 // GetEndpointWorkers 获取 Endpoint Worker 列表 (只返回活跃的)
 func (c *Client) GetEndpointWorkers(ctx context.Context, name string) ([]map[string]interface{}, error) {
 	var resp []map[string]interface{}
-	err := c.doRequest(ctx, "GET", fmt.Sprintf("/api/v1/endpoints/%s/workers", name), nil, &resp)
+	err := c.doRequest(ctx, "GetEndpointWorkers", "GET", fmt.Sprintf("/api/v1/endpoints/%s/workers", name), nil, &resp)
 	return resp, err
 }
 
 // GetWorker 获取单个 Worker 详情 (包括 OFFLINE)
 func (c *Client) GetWorker(ctx context.Context, workerID string) (map[string]interface{}, error) {
 	var resp map[string]interface{}
-	err := c.doRequest(ctx, "GET", fmt.Sprintf("/api/v1/workers/%s", workerID), nil, &resp)
+	err := c.doRequest(ctx, "GetWorker", "GET", fmt.Sprintf("/api/v1/workers/%s", workerID), nil, &resp)
 	return resp, err
 }
 
 // GetWorkerLogs 获取 Worker 日志
-func (c *Client) GetWorkerLogs(ctx context.Context, endpoint, podName string, lines int) (string, error) {
+func (c *Client) GetWorkerLogs(ctx context.Context, endpoint, podName string, lines int) (logs string, err error) {
+	start := time.Now()
+	defer func() { c.observe("GetWorkerLogs", start, err) }()
 	url := fmt.Sprintf("%s/api/v1/endpoints/%s/logs?lines=%d&pod_name=%s", c.baseURL, endpoint, lines, podName)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -168,28 +192,28 @@ func (c *Client) GetTasks(ctx context.Context, endpoint, workerID, status, taskI
 	if taskID != "" {
 		url += "&task_id=" + taskID
 	}
-	err := c.doRequest(ctx, "GET", url, nil, &resp)
+	err := c.doRequest(ctx, "GetTasks", "GET", url, nil, &resp)
 	return resp, err
 }
 
 // GetEndpointMetrics 获取 Endpoint 实时指标
 func (c *Client) GetEndpointMetrics(ctx context.Context, name string) (map[string]interface{}, error) {
 	var resp map[string]interface{}
-	err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/%s/metrics/realtime", name), nil, &resp)
+	err := c.doRequest(ctx, "GetEndpointMetrics", "GET", fmt.Sprintf("/v1/%s/metrics/realtime", name), nil, &resp)
 	return resp, err
 }
 
 // GetEndpointStatistics 获取 Endpoint 统计信息
 func (c *Client) GetEndpointStatistics(ctx context.Context, name string) (map[string]interface{}, error) {
 	var resp map[string]interface{}
-	err := c.doRequest(ctx, "GET", fmt.Sprintf("/api/v1/statistics/endpoints/%s", name), nil, &resp)
+	err := c.doRequest(ctx, "GetEndpointStatistics", "GET", fmt.Sprintf("/api/v1/statistics/endpoints/%s", name), nil, &resp)
 	return resp, err
 }
 
 // GetTasksOverview 获取任务总览统计
 func (c *Client) GetTasksOverview(ctx context.Context) (map[string]interface{}, error) {
 	var resp map[string]interface{}
-	err := c.doRequest(ctx, "GET", "/api/v1/statistics/overview", nil, &resp)
+	err := c.doRequest(ctx, "GetTasksOverview", "GET", "/api/v1/statistics/overview", nil, &resp)
 	return resp, err
 }
 
@@ -207,7 +231,7 @@ func (c *Client) GetEndpointStats(ctx context.Context, name, from, to string) (m
 		path += "?" + strings.Join(params, "&")
 	}
 	var resp map[string]interface{}
-	err := c.doRequest(ctx, "GET", path, nil, &resp)
+	err := c.doRequest(ctx, "GetEndpointStats", "GET", path, nil, &resp)
 	return resp, err
 }
 
@@ -215,7 +239,7 @@ func (c *Client) GetEndpointStats(ctx context.Context, name, from, to string) (m
 func (c *Client) SubmitTask(ctx context.Context, endpoint string, input map[string]interface{}) (*TaskResponse, error) {
 	req := &SubmitTaskRequest{Input: input}
 	var resp TaskResponse
-	err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/%s/run", endpoint), req, &resp)
+	err := c.doRequest(ctx, "SubmitTask", "POST", fmt.Sprintf("/v1/%s/run", endpoint), req, &resp)
 	return &resp, err
 }
 
@@ -223,44 +247,55 @@ func (c *Client) SubmitTask(ctx context.Context, endpoint string, input map[stri
 func (c *Client) SubmitTaskSync(ctx context.Context, endpoint string, input map[string]interface{}) (*TaskResponse, error) {
 	req := &SubmitTaskRequest{Input: input}
 	var resp TaskResponse
-	err := c.doRequest(ctx, "POST", fmt.Sprintf("/v1/%s/runsync", endpoint), req, &resp)
+	err := c.doRequest(ctx, "SubmitTaskSync", "POST", fmt.Sprintf("/v1/%s/runsync", endpoint), req, &resp)
 	return &resp, err
 }
 
 // GetTaskStatus 获取任务状态
 func (c *Client) GetTaskStatus(ctx context.Context, taskID string) (*TaskResponse, error) {
 	var resp TaskResponse
-	err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/status/%s", taskID), nil, &resp)
+	err := c.doRequest(ctx, "GetTaskStatus", "GET", fmt.Sprintf("/v1/status/%s", taskID), nil, &resp)
 	return &resp, err
 }
 
 // CancelTask 取消任务
 func (c *Client) CancelTask(ctx context.Context, taskID string) error {
-	return c.doRequest(ctx, "POST", fmt.Sprintf("/v1/cancel/%s", taskID), nil, nil)
+	return c.doRequest(ctx, "CancelTask", "POST", fmt.Sprintf("/v1/cancel/%s", taskID), nil, nil)
 }
 
 // GetTaskTimeline 获取任务时间线
 func (c *Client) GetTaskTimeline(ctx context.Context, taskID string) (map[string]interface{}, error) {
 	var resp map[string]interface{}
-	err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/tasks/%s/timeline", taskID), nil, &resp)
+	err := c.doRequest(ctx, "GetTaskTimeline", "GET", fmt.Sprintf("/v1/tasks/%s/timeline", taskID), nil, &resp)
 	return resp, err
 }
 
 // GetTaskExecutionHistory 获取任务执行历史
 func (c *Client) GetTaskExecutionHistory(ctx context.Context, taskID string) (map[string]interface{}, error) {
 	var resp map[string]interface{}
-	err := c.doRequest(ctx, "GET", fmt.Sprintf("/v1/tasks/%s/execution-history", taskID), nil, &resp)
+	err := c.doRequest(ctx, "GetTaskExecutionHistory", "GET", fmt.Sprintf("/v1/tasks/%s/execution-history", taskID), nil, &resp)
 	return resp, err
 }
 
 // GetScalingHistory 获取扩缩容历史
 func (c *Client) GetScalingHistory(ctx context.Context, endpoint string, limit int) ([]map[string]interface{}, error) {
 	var resp []map[string]interface{}
-	err := c.doRequest(ctx, "GET", fmt.Sprintf("/api/v1/autoscaler/endpoints/%s/history?limit=%d", endpoint, limit), nil, &resp)
+	err := c.doRequest(ctx, "GetScalingHistory", "GET", fmt.Sprintf("/api/v1/autoscaler/endpoints/%s/history?limit=%d", endpoint, limit), nil, &resp)
 	return resp, err
 }
 
-func (c *Client) doRequest(ctx context.Context, method, path string, body interface{}, result interface{}) error {
+// observe 记录一次调用的耗时及是否失败
+func (c *Client) observe(op string, start time.Time, err error) {
+	metrics.WaverlessRequestDuration.Observe(time.Since(start).Seconds(), c.clusterID, op)
+	if err != nil {
+		metrics.WaverlessRequestErrors.Inc(c.clusterID, op)
+	}
+}
+
+// doRequest 发送请求, op 为客户端方法名 (用于指标)
+func (c *Client) doRequest(ctx context.Context, op, method, path string, body interface{}, result interface{}) (err error) {
+	start := time.Now()
+	defer func() { c.observe(op, start, err) }()
 	var reqBody io.Reader
 	if body != nil {
 		jsonData, err := json.Marshal(body)
@@ -288,7 +323,7 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body interf
 
 	if resp.StatusCode >= 400 {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
 	if result != nil {